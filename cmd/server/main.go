@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 
 	"github.com/gin-gonic/gin"
 	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
 	"github.com/login_flow/auth-service/internal/handler"
 	"github.com/login_flow/auth-service/internal/middleware"
 	"github.com/login_flow/auth-service/internal/repository/postgres"
 	"github.com/login_flow/auth-service/internal/service"
+	"github.com/login_flow/auth-service/pkg/jwt"
+	"github.com/login_flow/auth-service/pkg/ldap"
+	"github.com/login_flow/auth-service/pkg/mailer"
+	"github.com/login_flow/auth-service/pkg/oauth"
+	"github.com/login_flow/auth-service/pkg/saml"
 )
 
 func main() {
@@ -32,12 +40,134 @@ func main() {
 
 	userRepo := postgres.NewUserRepository(db) // Manages "users" table
 	tokenRepo := postgres.NewTokenRepository(db)
+	actionTokenRepo := postgres.NewActionTokenRepository(db)       // Single-use emailed tokens
+	roleRepo := postgres.NewRoleRepository(db)                     // Roles, permissions and their assignment
+	auditRepo := postgres.NewAuditRepository(db)                   // Append-only security audit log
+	webhookRepo := postgres.NewWebhookRepository(db)               // Webhook subscriptions, outbox and delivery log
+	knownDeviceRepo := postgres.NewKnownDeviceRepository(db)       // Devices and IPs users signed in from, for login alerts
+	identityRepo := postgres.NewIdentityRepository(db)             // Links to accounts at external login providers
+	oauthRepo := postgres.NewOAuthRepository(db)                   // Client apps of our authorization server, codes and consents
+	serviceAccountRepo := postgres.NewServiceAccountRepository(db) // Machine identities for the client credentials grant
+	patRepo := postgres.NewPersonalAccessTokenRepository(db)       // Users' tokens for scripts and CLIs
+	loginCodeRepo := postgres.NewLoginCodeRepository(db)           // Emailed one-time login codes
+	invitationRepo := postgres.NewInvitationRepository(db)         // Invitations to register while open sign-up is off
+	orgRepo := postgres.NewOrganizationRepository(db)              // Customer organizations and their members
+	orgInvitationRepo := postgres.NewOrgInvitationRepository(db)   // Invitations to join an organization
+	samlRepo := postgres.NewSAMLRepository(db)                     // SAML identity providers and consumed assertions
+	scimRepo := postgres.NewSCIMRepository(db)                     // SCIM tokens and the users organizations provisioned
 
-	authService := service.NewAuthService(userRepo, tokenRepo, cfg) // Login, register, token refresh
+	// Falls back to logging emails when SMTP_HOST is not set
+	mail := mailer.New(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From)
+
+	// Audit events go to the database, and to a JSON-lines file when AUDIT_LOG_FILE is set
+	var auditSinks []service.AuditSink
+	if cfg.Audit.LogFile != "" {
+		fileSink, err := service.NewJSONLinesSink(cfg.Audit.LogFile)
+		if err != nil {
+			log.Fatal("failed to open audit log file", err)
+		}
+		defer fileSink.Close()
+		auditSinks = append(auditSinks, fileSink)
+	}
+	auditService := service.NewAuditService(auditRepo, auditSinks...)
+
+	webhookService := service.NewWebhookService(webhookRepo, auditService, cfg) // Publishes account events to webhook subscribers
+
+	// Password logins are checked against local accounts, then the LDAP directory when LDAP_URL is set
+	authenticators := []service.Authenticator{service.NewLocalAuthenticator(userRepo)}
+	if cfg.LDAP.URL != "" {
+		authenticators = append(authenticators, service.NewLDAPAuthenticator(ldap.NewClient(ldap.Config{
+			URL:                  cfg.LDAP.URL,
+			StartTLS:             cfg.LDAP.StartTLS,
+			BindDN:               cfg.LDAP.BindDN,
+			BindPassword:         cfg.LDAP.BindPassword,
+			BaseDN:               cfg.LDAP.BaseDN,
+			UserFilter:           cfg.LDAP.UserFilter,
+			EmailAttribute:       cfg.LDAP.EmailAttribute,
+			DisplayNameAttribute: cfg.LDAP.DisplayNameAttribute,
+			Timeout:              cfg.LDAP.Timeout,
+		}), userRepo))
+	}
+
+	accountService := service.NewAccountService(db, userRepo, tokenRepo, actionTokenRepo, knownDeviceRepo, patRepo, loginCodeRepo, mail, auditService, webhookService, cfg) // Profile, email change, password reset, account deletion
+	invitationService := service.NewInvitationService(invitationRepo, userRepo, roleRepo, mail, auditService, cfg)                                                          // Invitations to register
+	authService := service.NewAuthService(userRepo, tokenRepo, roleRepo, orgRepo, accountService, invitationService, auditService, webhookService, cfg, authenticators...)  // Login, register, token refresh
+	adminService := service.NewAdminService(userRepo, tokenRepo, roleRepo, accountService, auditService, webhookService, cfg)                                               // User management
+	orgService := service.NewOrganizationService(orgRepo, orgInvitationRepo, userRepo, tokenRepo, mail, auditService, cfg)                                                  // Organizations and memberships
+	patService := service.NewPersonalAccessTokenService(patRepo, userRepo, roleRepo, auditService)                                                                          // Personal access tokens
 	csrfService := service.NewCSRFService(cfg.JWT.Secret)
 
+	// "Sign in with ..." providers from OAUTH_PROVIDERS; OIDC issuers are discovered at startup
+	var oauthProviders []*oauth.Provider
+	for _, p := range cfg.OAuth.Providers {
+		provider, err := oauth.NewProvider(context.Background(), oauth.Config{
+			Name:         p.Name,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  fmt.Sprintf("%s/api/auth/oauth/%s/callback", cfg.OAuth.CallbackBaseURL, p.Name),
+			Scopes:       p.Scopes,
+			Issuer:       p.Issuer,
+			AuthURL:      p.AuthURL,
+			TokenURL:     p.TokenURL,
+			UserInfoURL:  p.UserInfoURL,
+			EmailsURL:    p.EmailsURL,
+		})
+		if err != nil {
+			log.Printf("OAuth provider %s disabled: %v", p.Name, err)
+			continue
+		}
+		oauthProviders = append(oauthProviders, provider)
+	}
+	socialService := service.NewSocialAuthService(authService, userRepo, identityRepo, auditService, oauthProviders...)
+
+	// ID tokens are signed with OIDC_SIGNING_KEY_FILE, or a throwaway key in development
+	var idTokenKey *jwt.SigningKey
+	if cfg.AuthServer.SigningKeyFile != "" {
+		idTokenKey, err = jwt.LoadSigningKey(cfg.AuthServer.SigningKeyFile)
+	} else {
+		log.Println("OIDC_SIGNING_KEY_FILE not set, ID tokens are signed with a key generated at startup")
+		idTokenKey, err = jwt.GenerateSigningKey()
+	}
+	if err != nil {
+		log.Fatal("failed to load ID token signing key", err)
+	}
+	// The SAML SP signs AuthnRequests with SAML_KEY_FILE, or a throwaway pair in development
+	var samlKeys *saml.KeyPair
+	if cfg.SAML.CertFile != "" {
+		samlKeys, err = saml.LoadKeyPair(cfg.SAML.CertFile, cfg.SAML.KeyFile)
+	} else {
+		log.Println("SAML_CERT_FILE not set, the SAML service provider uses a certificate generated at startup")
+		samlKeys, err = saml.GenerateKeyPair(cfg.SAML.BaseURL)
+	}
+	if err != nil {
+		log.Fatal("failed to load SAML key pair", err)
+	}
+	samlService := service.NewSAMLService(authService, samlRepo, userRepo, identityRepo, orgRepo, auditService, samlKeys, cfg) // SAML single sign-on with enterprise identity providers
+
+	scimService := service.NewSCIMService(authService, scimRepo, userRepo, tokenRepo, patRepo, roleRepo, orgRepo, auditService, webhookService, cfg) // User provisioning by organizations' identity providers
+
+	oauthServerService := service.NewOAuthServerService(oauthRepo, userRepo, tokenRepo, serviceAccountRepo, auditService, idTokenKey, cfg) // Authorization server and OpenID provider for our other apps
+
+	// Promote ADMIN_BOOTSTRAP_EMAIL if no admin exists yet
+	if err := authService.BootstrapAdmin(context.Background()); err != nil {
+		log.Println("admin bootstrap skipped:", err)
+	}
+
 	authHandler := handler.NewAuthHandler(authService, csrfService, cfg) // /auth/* endpoints
-	userHandler := handler.NewUserHandler(authService)
+	userHandler := handler.NewUserHandler(authService, accountService, cfg)
+	oauthHandler := handler.NewOAuthHandler(socialService, csrfService, cfg)
+	patHandler := handler.NewPersonalAccessTokenHandler(patService)
+	orgHandler := handler.NewOrganizationHandler(orgService, authService, csrfService, cfg)
+	oauthServerHandler := handler.NewOAuthServerHandler(oauthServerService, authService, csrfService, cfg)
+	adminHandler := handler.NewAdminHandler(adminService, auditService, webhookService)
+	invitationHandler := handler.NewInvitationHandler(invitationService)
+	samlHandler := handler.NewSAMLHandler(samlService, csrfService, cfg)
+	scimHandler := handler.NewSCIMHandler(scimService, cfg)
+
+	// Background jobs
+
+	go accountService.RunDeletionPurge(context.Background(), cfg.Account.DeletionPurgeInterval) // Removes accounts past their grace period
+	go webhookService.RunDispatcher(context.Background(), cfg.Webhook.DispatchInterval)         // Sends queued webhook deliveries, retrying with backoff
 
 	// Server setup
 
@@ -46,10 +176,17 @@ func main() {
 
 	r := gin.New()
 
+	// The client IP goes into the audit log and login alerts, so X-Forwarded-For is
+	// only believed from the configured proxies
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("invalid TRUSTED_PROXIES", err)
+	}
+
 	// Middleware
 
 	r.Use(gin.Recovery())                             // Catches panics and returns 500 instead of crashing
 	r.Use(middleware.Logger())                        // Logs each request (method, path, status, duration)
+	r.Use(middleware.ClientInfo())                    // Makes client IP and user agent available to services (audit log)
 	r.Use(middleware.CORS(cfg.Server.AllowedOrigins)) // Allows cross-origin requests from frontend
 
 	r.GET("/health", func(ctx *gin.Context) {
@@ -57,6 +194,38 @@ func main() {
 			"message": "running",
 		})
 	})
+
+	// Authorization server (browser navigations and client back-channel calls, not under /api)
+	r.GET("/oauth/authorize", oauthServerHandler.Authorize)                  // GET /oauth/authorize (consent page, or login redirect)
+	r.POST("/oauth/authorize", oauthServerHandler.Authorize)                 // POST /oauth/authorize (consent form, CSRF protected)
+	r.POST("/oauth/token", oauthServerHandler.Token)                         // POST /oauth/token (authorization_code, refresh_token, client_credentials)
+	r.POST("/oauth/introspect", oauthServerHandler.Introspect)               // POST /oauth/introspect (confidential clients and service accounts)
+	r.POST("/oauth/revoke", oauthServerHandler.Revoke)                       // POST /oauth/revoke (refresh and access tokens of the calling client)
+	r.GET("/userinfo", oauthServerHandler.UserInfo)                          // GET /userinfo (Bearer client access token with the openid scope)
+	r.POST("/userinfo", oauthServerHandler.UserInfo)                         // POST /userinfo
+	r.GET("/.well-known/openid-configuration", oauthServerHandler.Discovery) // GET /.well-known/openid-configuration
+	r.GET("/.well-known/jwks.json", oauthServerHandler.JWKS)                 // GET /.well-known/jwks.json (ID token signing keys)
+
+	// SCIM 2.0 for identity providers, authenticated with an organization's SCIM token
+	scimAPI := r.Group("/scim/v2", middleware.SCIMAuth(scimService))
+	{
+		scimAPI.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig) // GET /scim/v2/ServiceProviderConfig
+
+		scimAPI.GET("/Users", scimHandler.ListUsers)         // GET /scim/v2/Users (filter, startIndex, count)
+		scimAPI.POST("/Users", scimHandler.CreateUser)       // POST /scim/v2/Users
+		scimAPI.GET("/Users/:id", scimHandler.GetUser)       // GET /scim/v2/Users/:id
+		scimAPI.PUT("/Users/:id", scimHandler.ReplaceUser)   // PUT /scim/v2/Users/:id
+		scimAPI.PATCH("/Users/:id", scimHandler.PatchUser)   // PATCH /scim/v2/Users/:id (active=false disables and signs out)
+		scimAPI.DELETE("/Users/:id", scimHandler.DeleteUser) // DELETE /scim/v2/Users/:id (deletes the account)
+
+		scimAPI.GET("/Groups", scimHandler.ListGroups)         // GET /scim/v2/Groups (the token's roles)
+		scimAPI.POST("/Groups", scimHandler.CreateGroup)       // POST /scim/v2/Groups (claims an allowed role by displayName)
+		scimAPI.GET("/Groups/:id", scimHandler.GetGroup)       // GET /scim/v2/Groups/:id
+		scimAPI.PUT("/Groups/:id", scimHandler.ReplaceGroup)   // PUT /scim/v2/Groups/:id
+		scimAPI.PATCH("/Groups/:id", scimHandler.PatchGroup)   // PATCH /scim/v2/Groups/:id (add or remove members)
+		scimAPI.DELETE("/Groups/:id", scimHandler.DeleteGroup) // DELETE /scim/v2/Groups/:id (removes all members, keeps the role)
+	}
+
 	api := r.Group("/api")
 	{
 		// Authentication routes (PUBLIC - no authentication required)
@@ -65,16 +234,137 @@ func main() {
 			auth.POST("/register", authHandler.Register)                          // POST /api/auth/register
 			auth.POST("/login", authHandler.Login)                                // POST /api/auth/login
 			auth.POST("/refresh", authHandler.Refresh)                            // POST /api/auth/refresh
-			auth.POST("/logout", middleware.CSRFMiddleware(), authHandler.Logout) // POST /api/auth/logout (CSRF protected)
+			auth.POST("/logout", middleware.CSRFMiddleware(), authHandler.Logout) // POST /api/auth/logout (CSRF protected, except in token mode)
+			auth.POST("/email/confirm", userHandler.ConfirmEmailChange)           // POST /api/auth/email/confirm (token from email)
+			auth.POST("/password/forgot", userHandler.ForgotPassword)             // POST /api/auth/password/forgot
+			auth.POST("/sign-in/report", userHandler.ReportSignIn)                // POST /api/auth/sign-in/report ("this wasn't me" link from a login alert)
+			auth.POST("/password/reset", userHandler.ResetPassword)               // POST /api/auth/password/reset (token from email)
+			auth.POST("/magic-link", authHandler.RequestMagicLink)                // POST /api/auth/magic-link
+			auth.POST("/magic-link/consume", authHandler.ConsumeMagicLink)        // POST /api/auth/magic-link/consume (token from email, same browser only)
+			auth.POST("/otp/request", authHandler.RequestLoginCode)               // POST /api/auth/otp/request
+			auth.POST("/otp/verify", authHandler.VerifyLoginCode)                 // POST /api/auth/otp/verify
+
+			auth.GET("/oauth/providers", oauthHandler.Providers)         // GET /api/auth/oauth/providers
+			auth.GET("/oauth/:provider", oauthHandler.Start)             // GET /api/auth/oauth/:provider (redirects to the provider)
+			auth.GET("/oauth/:provider/callback", oauthHandler.Callback) // GET /api/auth/oauth/:provider/callback (redirects to the app)
+
+			auth.GET("/saml/:connection/metadata", samlHandler.Metadata) // GET /api/auth/saml/:connection/metadata (SP metadata for the IdP)
+			auth.GET("/saml/:connection", samlHandler.Start)             // GET /api/auth/saml/:connection (redirects to the IdP with an AuthnRequest)
+			auth.POST("/saml/:connection/acs", samlHandler.ACS)          // POST /api/auth/saml/:connection/acs (IdP response, redirects to the app)
 		}
 
 		// User routes (PROTECTED - require valid access token)
 		user := api.Group("/user") // All routes here start with /api/user
 		// Use() adds middleware to this group only
-		// AuthMiddleware checks for valid access token in cookies
-		user.Use(middleware.AuthMiddleware(authService))
+		// AuthMiddleware checks for valid access token in cookies, or a personal access token
+		user.Use(middleware.AuthMiddleware(authService, patService))
+		user.Use(middleware.RequireAccountScope()) // Personal access tokens need account:read / account:write here
+		user.Use(middleware.CSRFMiddleware())      // State-changing user routes are CSRF protected (GET is skipped)
+		{
+			noImpersonation := middleware.RejectImpersonation() // Sensitive operations stay with the user while an admin impersonates them
+
+			user.GET("/me", userHandler.GetMe)                            // GET /api/user/me (requires auth)
+			user.PATCH("/me", userHandler.UpdateMe)                       // PATCH /api/user/me (profile fields)
+			user.DELETE("/me", noImpersonation, userHandler.DeleteMe)     // DELETE /api/user/me (requires password)
+			user.POST("/email", noImpersonation, userHandler.ChangeEmail) // POST /api/user/email (requires password)
+			user.GET("/identities", oauthHandler.ListIdentities)          // GET /api/user/identities (linked external logins)
+
+			user.GET("/tokens", middleware.RequireSession(), patHandler.List)                           // GET /api/user/tokens (personal access tokens)
+			user.POST("/tokens", middleware.RequireSession(), noImpersonation, patHandler.Create)       // POST /api/user/tokens (returns the token once)
+			user.DELETE("/tokens/:id", middleware.RequireSession(), noImpersonation, patHandler.Revoke) // DELETE /api/user/tokens/:id
+
+			user.GET("/orgs", orgHandler.List)                                                                               // GET /api/user/orgs (with the user's role in each)
+			user.POST("/orgs", middleware.RequireSession(), noImpersonation, orgHandler.Create)                              // POST /api/user/orgs (creator becomes the owner)
+			user.POST("/orgs/switch", middleware.RequireSession(), noImpersonation, orgHandler.Switch)                       // POST /api/user/orgs/switch (re-issues the tokens with org_id)
+			user.POST("/orgs/invitations/accept", middleware.RequireSession(), noImpersonation, orgHandler.AcceptInvitation) // POST /api/user/orgs/invitations/accept (token from email)
+
+			user.POST("/impersonation/stop", authHandler.StopImpersonation) // POST /api/user/impersonation/stop (restores the admin's session)
+		}
+
+		// Organization routes (PROTECTED - authorized by the caller's role in the organization, not global roles)
+		orgs := api.Group("/orgs/:org_id")
+		orgs.Use(middleware.AuthMiddleware(authService, patService))
+		orgs.Use(middleware.RequireSession())
+		orgs.Use(middleware.RejectImpersonation())
+		orgs.Use(middleware.CSRFMiddleware())
 		{
-			user.GET("/me", userHandler.GetMe) // GET /api/user/me (requires auth)
+			anyMember := middleware.RequireOrgRole(orgService)
+			orgAdmin := middleware.RequireOrgRole(orgService, domain.OrgRoleOwner, domain.OrgRoleAdmin)
+			orgOwner := middleware.RequireOrgRole(orgService, domain.OrgRoleOwner)
+
+			orgs.GET("/members", anyMember, orgHandler.ListMembers)                  // GET /api/orgs/:org_id/members
+			orgs.POST("/invitations", orgAdmin, orgHandler.InviteMember)             // POST /api/orgs/:org_id/invitations (emails the invite link)
+			orgs.PATCH("/members/:user_id", orgAdmin, orgHandler.ChangeMemberRole)   // PATCH /api/orgs/:org_id/members/:user_id (only roles below the caller's)
+			orgs.DELETE("/members/:user_id", anyMember, orgHandler.RemoveMember)     // DELETE /api/orgs/:org_id/members/:user_id (admins remove lower roles, anyone can leave)
+			orgs.POST("/transfer-ownership", orgOwner, orgHandler.TransferOwnership) // POST /api/orgs/:org_id/transfer-ownership
+		}
+
+		// Admin routes (PROTECTED - require the admin role)
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(authService, patService))
+		admin.Use(middleware.CSRFMiddleware())
+		admin.Use(middleware.RequireRole(domain.RoleAdmin))
+		admin.Use(middleware.RejectImpersonation())
+		{
+			usersRead := middleware.RequirePermission(domain.PermissionUsersRead)
+			usersWrite := middleware.RequirePermission(domain.PermissionUsersWrite)
+			usersImpersonate := middleware.RequirePermission(domain.PermissionUsersImpersonate)
+			rolesWrite := middleware.RequirePermission(domain.PermissionRolesWrite)
+			auditRead := middleware.RequirePermission(domain.PermissionAuditRead)
+			webhooksManage := middleware.RequirePermission(domain.PermissionWebhooksManage)
+			oauthClientsManage := middleware.RequirePermission(domain.PermissionOAuthClientsManage)
+			serviceAccountsManage := middleware.RequirePermission(domain.PermissionServiceAccounts)
+			invitationsManage := middleware.RequirePermission(domain.PermissionInvitationsManage)
+			samlManage := middleware.RequirePermission(domain.PermissionSAMLManage)
+			scimManage := middleware.RequirePermission(domain.PermissionSCIMManage)
+
+			admin.GET("/users", usersRead, adminHandler.ListUsers)                                 // GET /api/admin/users (q, verified, status, created_after, created_before, page, page_size)
+			admin.GET("/users/search", usersRead, adminHandler.SearchUsers)                        // GET /api/admin/users/search?q=
+			admin.GET("/users/:id", usersRead, adminHandler.GetUser)                               // GET /api/admin/users/:id (with sessions)
+			admin.POST("/users/:id/disable", usersWrite, adminHandler.DisableUser)                 // POST /api/admin/users/:id/disable
+			admin.POST("/users/:id/enable", usersWrite, adminHandler.EnableUser)                   // POST /api/admin/users/:id/enable
+			admin.POST("/users/:id/verify", usersWrite, adminHandler.VerifyUser)                   // POST /api/admin/users/:id/verify
+			admin.POST("/users/:id/approve", usersWrite, adminHandler.ApproveUser)                 // POST /api/admin/users/:id/approve (approval queue)
+			admin.POST("/users/:id/reject", usersWrite, adminHandler.RejectUser)                   // POST /api/admin/users/:id/reject (deletes the pending account)
+			admin.POST("/users/:id/password-reset", usersWrite, adminHandler.TriggerPasswordReset) // POST /api/admin/users/:id/password-reset
+			admin.POST("/users/:id/sessions/revoke", usersWrite, adminHandler.RevokeSessions)      // POST /api/admin/users/:id/sessions/revoke
+
+			admin.POST("/users/:id/impersonate", usersImpersonate, middleware.RequireSession(), authHandler.Impersonate) // POST /api/admin/users/:id/impersonate (reason; short-lived session as the user)
+
+			admin.GET("/roles", adminHandler.ListRoles)                                 // GET /api/admin/roles
+			admin.GET("/users/:id/roles", usersRead, adminHandler.GetUserRoles)         // GET /api/admin/users/:id/roles
+			admin.POST("/users/:id/roles", rolesWrite, adminHandler.AssignRole)         // POST /api/admin/users/:id/roles
+			admin.DELETE("/users/:id/roles/:role", rolesWrite, adminHandler.RemoveRole) // DELETE /api/admin/users/:id/roles/:role
+
+			admin.GET("/audit-events", auditRead, adminHandler.ListAuditEvents) // GET /api/admin/audit-events (type, actor_id, subject_id, outcome, since, until, page, page_size)
+
+			admin.GET("/webhooks", webhooksManage, adminHandler.ListWebhooks)                               // GET /api/admin/webhooks
+			admin.POST("/webhooks", webhooksManage, adminHandler.CreateWebhook)                             // POST /api/admin/webhooks (returns the signing secret once)
+			admin.DELETE("/webhooks/:id", webhooksManage, adminHandler.DeleteWebhook)                       // DELETE /api/admin/webhooks/:id
+			admin.GET("/webhooks/:id/deliveries", webhooksManage, adminHandler.ListWebhookDeliveries)       // GET /api/admin/webhooks/:id/deliveries?limit=
+			admin.GET("/webhook-deliveries/:id/attempts", webhooksManage, adminHandler.ListWebhookAttempts) // GET /api/admin/webhook-deliveries/:id/attempts
+			admin.POST("/webhook-deliveries/:id/retry", webhooksManage, adminHandler.RetryWebhookDelivery)  // POST /api/admin/webhook-deliveries/:id/retry
+
+			admin.GET("/oauth-clients", oauthClientsManage, oauthServerHandler.ListClients)                // GET /api/admin/oauth-clients
+			admin.POST("/oauth-clients", oauthClientsManage, oauthServerHandler.CreateClient)              // POST /api/admin/oauth-clients (returns the client secret once)
+			admin.DELETE("/oauth-clients/:client_id", oauthClientsManage, oauthServerHandler.DeleteClient) // DELETE /api/admin/oauth-clients/:client_id (revokes its tokens)
+
+			admin.GET("/service-accounts", serviceAccountsManage, oauthServerHandler.ListServiceAccounts)                // GET /api/admin/service-accounts (listed apart from users)
+			admin.POST("/service-accounts", serviceAccountsManage, oauthServerHandler.CreateServiceAccount)              // POST /api/admin/service-accounts (returns the client secret once)
+			admin.DELETE("/service-accounts/:client_id", serviceAccountsManage, oauthServerHandler.DeleteServiceAccount) // DELETE /api/admin/service-accounts/:client_id
+
+			admin.GET("/invitations", invitationsManage, invitationHandler.List)          // GET /api/admin/invitations
+			admin.POST("/invitations", invitationsManage, invitationHandler.Create)       // POST /api/admin/invitations (emails the invite link)
+			admin.DELETE("/invitations/:id", invitationsManage, invitationHandler.Revoke) // DELETE /api/admin/invitations/:id (pending only)
+
+			admin.GET("/saml-connections", samlManage, samlHandler.ListConnections)                     // GET /api/admin/saml-connections
+			admin.POST("/saml-connections", samlManage, samlHandler.CreateConnection)                   // POST /api/admin/saml-connections (metadata_xml or metadata_url)
+			admin.PUT("/saml-connections/:connection/metadata", samlManage, samlHandler.UpdateMetadata) // PUT /api/admin/saml-connections/:connection/metadata (re-import)
+			admin.DELETE("/saml-connections/:connection", samlManage, samlHandler.DeleteConnection)     // DELETE /api/admin/saml-connections/:connection
+
+			admin.GET("/scim-tokens", scimManage, scimHandler.ListTokens)         // GET /api/admin/scim-tokens
+			admin.POST("/scim-tokens", scimManage, scimHandler.CreateToken)       // POST /api/admin/scim-tokens (returns the token once)
+			admin.DELETE("/scim-tokens/:id", scimManage, scimHandler.DeleteToken) // DELETE /api/admin/scim-tokens/:id (provisioned users are kept)
 		}
 	}
 
@@ -48,6 +48,19 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return boolValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s: %v. Using default: %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return intValue
+}
+
 func getEnvSlice(key string, defaultValue []string) []string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -57,11 +70,21 @@ func getEnvSlice(key string, defaultValue []string) []string {
 }
 
 type Config struct {
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Server   ServerConfig
-	Cookie   CookieConfig
-	SMTP     SMTPConfig
+	Database     DatabaseConfig
+	JWT          JWTConfig
+	Server       ServerConfig
+	Cookie       CookieConfig
+	SMTP         SMTPConfig
+	Account      AccountConfig
+	Registration RegistrationConfig
+	Admin        AdminConfig
+	Audit        AuditConfig
+	Webhook      WebhookConfig
+	OAuth        OAuthConfig
+	AuthServer   AuthServerConfig
+	SAML         SAMLConfig
+	LDAP         LDAPConfig
+	SCIM         SCIMConfig
 }
 
 type DatabaseConfig struct {
@@ -83,6 +106,8 @@ type ServerConfig struct {
 	Port           string
 	Host           string
 	AllowedOrigins []string
+	AppURL         string   // Public URL of the frontend, used to build links in emails
+	TrustedProxies []string // IPs or CIDRs of reverse proxies whose X-Forwarded-For is believed, none by default
 }
 
 type CookieConfig struct {
@@ -99,6 +124,181 @@ type SMTPConfig struct {
 	From     string
 }
 
+// Registration modes
+const (
+	RegistrationOpen       = "open"        // Anyone can sign up
+	RegistrationInviteOnly = "invite_only" // Sign-up needs an invitation from an admin
+	RegistrationClosed     = "closed"      // No new accounts
+)
+
+type RegistrationConfig struct {
+	Mode            string
+	InviteExpiry    time.Duration
+	RequireApproval bool // Self-registered accounts can't log in until an admin approves them
+}
+
+type AdminConfig struct {
+	BootstrapEmail      string        // Promoted to admin at startup while no admin exists
+	ImpersonationExpiry time.Duration // Lifetime of an impersonation session, it can't be refreshed
+}
+
+type AuditConfig struct {
+	LogFile string // Optional JSON-lines file receiving a copy of every audit event
+}
+
+// AuthServerConfig configures this service as an OAuth 2.1 authorization server for other apps
+type AuthServerConfig struct {
+	Issuer     string        // Public URL of this API, the "iss" of tokens issued to clients
+	CodeExpiry time.Duration // Lifetime of authorization codes
+
+	// Client IDs of resource servers that may introspect the tokens of every client.
+	// Other callers only learn about tokens issued to them or naming them as audience.
+	IntrospectionClients []string
+
+	// PEM RSA private key that signs OpenID Connect ID tokens. When empty a key is
+	// generated at startup, and ID tokens can't be verified after a restart.
+	SigningKeyFile string
+}
+
+// SAMLConfig configures this service as a SAML 2.0 service provider. Connections to
+// identity providers are managed through the admin API.
+type SAMLConfig struct {
+	BaseURL       string        // Public URL of this API, SP URLs are <base>/api/auth/saml/<connection>/...
+	RequestExpiry time.Duration // How long a user can take to sign in at the identity provider
+
+	// PEM certificate and RSA key of the SP. When empty a self-signed pair is generated
+	// at startup, and identity providers have to re-import our metadata after a restart.
+	CertFile string
+	KeyFile  string
+}
+
+// LDAPConfig enables password logins for directory users, after the local accounts.
+// LDAP is off when URL is empty.
+type LDAPConfig struct {
+	URL          string // ldap://host:389 or ldaps://host:636
+	StartTLS     bool
+	BindDN       string // Service account for searching users, anonymous when empty
+	BindPassword string
+	BaseDN       string
+	UserFilter   string // %s is replaced with the escaped email the user logs in with
+
+	// Attribute mapping onto users
+	EmailAttribute       string
+	DisplayNameAttribute string
+
+	Timeout time.Duration
+}
+
+// SCIMConfig configures the SCIM 2.0 provisioning API. Tokens are issued per
+// organization through the admin API.
+type SCIMConfig struct {
+	BaseURL    string // Public URL of this API, resources are at <base>/scim/v2/...
+	MaxResults int    // Largest page a list request returns
+}
+
+type OAuthConfig struct {
+	CallbackBaseURL string        // Public URL of this API, callbacks go to <base>/api/auth/oauth/<provider>/callback
+	StateExpiry     time.Duration // How long a user can take to sign in at the provider
+	Providers       []OAuthProviderConfig
+}
+
+// OAuthProviderConfig configures one "Sign in with ..." provider. OIDC providers
+// only need an Issuer, plain OAuth2 providers need the endpoint URLs.
+type OAuthProviderConfig struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	Issuer       string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	EmailsURL    string
+	Scopes       []string
+}
+
+// oauthPresets fills in the well-known settings of common providers, so only
+// the client ID and secret have to be configured for them
+func oauthPresets(name string) OAuthProviderConfig {
+	switch name {
+	case "google":
+		return OAuthProviderConfig{
+			Issuer: "https://accounts.google.com",
+			Scopes: []string{"openid", "email", "profile"},
+		}
+	case "microsoft":
+		// Needs a tenant ID, the multi-tenant endpoints don't have a fixed issuer
+		return OAuthProviderConfig{
+			Issuer: "https://login.microsoftonline.com/" + getEnv("OAUTH_MICROSOFT_TENANT_ID", "") + "/v2.0",
+			Scopes: []string{"openid", "email", "profile"},
+		}
+	case "github":
+		return OAuthProviderConfig{
+			AuthURL:     "https://github.com/login/oauth/authorize",
+			TokenURL:    "https://github.com/login/oauth/access_token",
+			UserInfoURL: "https://api.github.com/user",
+			EmailsURL:   "https://api.github.com/user/emails",
+			Scopes:      []string{"read:user", "user:email"},
+		}
+	default:
+		return OAuthProviderConfig{Scopes: []string{"openid", "email", "profile"}}
+	}
+}
+
+// loadOAuthProviders reads OAUTH_PROVIDERS (e.g. "google,github") and the
+// OAUTH_<NAME>_* variables of each provider. Providers without a client ID are skipped.
+func loadOAuthProviders() []OAuthProviderConfig {
+	var providers []OAuthProviderConfig
+	for _, name := range getEnvSlice("OAUTH_PROVIDERS", nil) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+
+		provider := oauthPresets(name)
+		provider.Name = name
+		provider.ClientID = getEnv(prefix+"CLIENT_ID", "")
+		provider.ClientSecret = getEnv(prefix+"CLIENT_SECRET", "")
+		provider.Issuer = getEnv(prefix+"ISSUER", provider.Issuer)
+		provider.AuthURL = getEnv(prefix+"AUTH_URL", provider.AuthURL)
+		provider.TokenURL = getEnv(prefix+"TOKEN_URL", provider.TokenURL)
+		provider.UserInfoURL = getEnv(prefix+"USERINFO_URL", provider.UserInfoURL)
+		provider.EmailsURL = getEnv(prefix+"EMAILS_URL", provider.EmailsURL)
+		provider.Scopes = getEnvSlice(prefix+"SCOPES", provider.Scopes)
+
+		if provider.ClientID == "" {
+			log.Printf("OAuth provider %s has no %sCLIENT_ID, skipping", name, prefix)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+type WebhookConfig struct {
+	DispatchInterval time.Duration // How often the outbox is polled for due deliveries
+	Timeout          time.Duration // Per-request timeout when calling a subscriber
+	MaxAttempts      int           // Deliveries are marked failed after this many attempts
+	RetryBaseDelay   time.Duration // Delay before the first retry, doubled on each attempt
+	RetryMaxDelay    time.Duration
+}
+
+type AccountConfig struct {
+	EmailChangeExpiry     time.Duration
+	PasswordResetExpiry   time.Duration
+	DeletionGracePeriod   time.Duration // How long a user can cancel a deletion by logging in
+	DeletionPurgeInterval time.Duration // How often accounts past their grace period are purged
+	LoginAlerts           bool          // Email users when they sign in from a new device or IP
+	SignInReportExpiry    time.Duration // How long the "this wasn't me" link in a login alert works
+	MagicLinkEnabled      bool          // Allow passwordless login with a link sent by email
+	MagicLinkExpiry       time.Duration
+	OTPEnabled            bool // Allow login with a numeric code sent by email
+	OTPLength             int  // Digits of a code, 6 to 8
+	OTPExpiry             time.Duration
+	OTPMaxAttempts        int // Wrong guesses before a code stops working
+	OTPMaxCodesPerHour    int // Codes issued per user an hour, bounds the guesses across reissued codes
+}
+
 func Load() (*Config, error) {
 	// Load .env file if it exists
 	if err := loadEnv(".env"); err != nil {
@@ -123,6 +323,8 @@ func Load() (*Config, error) {
 			Port:           getEnv("SERVER_PORT", "8080"),
 			Host:           getEnv("SERVER_HOST", "localhost"),
 			AllowedOrigins: getEnvSlice("ALLOWED_ORIGINS", []string{}),
+			AppURL:         strings.TrimSuffix(getEnv("APP_URL", "http://localhost:3000"), "/"),
+			TrustedProxies: getEnvSlice("TRUSTED_PROXIES", nil),
 		},
 		Cookie: CookieConfig{
 			Domain:   getEnv("COOKIE_DOMAIN", ""),
@@ -136,6 +338,74 @@ func Load() (*Config, error) {
 			Password: getEnv("SMTP_PASSWORD", ""),
 			From:     getEnv("SMTP_FROM", ""),
 		},
+		Account: AccountConfig{
+			EmailChangeExpiry:     getEnvDuration("EMAIL_CHANGE_EXPIRY", 24*time.Hour),
+			PasswordResetExpiry:   getEnvDuration("PASSWORD_RESET_EXPIRY", time.Hour),
+			DeletionGracePeriod:   getEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 720*time.Hour),
+			DeletionPurgeInterval: getEnvDuration("ACCOUNT_DELETION_PURGE_INTERVAL", time.Hour),
+			LoginAlerts:           getEnvBool("LOGIN_ALERTS_ENABLED", true),
+			SignInReportExpiry:    getEnvDuration("SIGN_IN_REPORT_EXPIRY", 168*time.Hour),
+			MagicLinkEnabled:      getEnvBool("MAGIC_LINK_ENABLED", false),
+			MagicLinkExpiry:       getEnvDuration("MAGIC_LINK_EXPIRY", 15*time.Minute),
+			OTPEnabled:            getEnvBool("OTP_LOGIN_ENABLED", false),
+			OTPLength:             getEnvInt("OTP_LENGTH", 6),
+			OTPExpiry:             getEnvDuration("OTP_EXPIRY", 10*time.Minute),
+			OTPMaxAttempts:        getEnvInt("OTP_MAX_ATTEMPTS", 5),
+			OTPMaxCodesPerHour:    getEnvInt("OTP_MAX_CODES_PER_HOUR", 5),
+		},
+		Registration: RegistrationConfig{
+			Mode:            getEnv("REGISTRATION_MODE", RegistrationOpen),
+			InviteExpiry:    getEnvDuration("INVITE_EXPIRY", 168*time.Hour),
+			RequireApproval: getEnvBool("REGISTRATION_REQUIRE_APPROVAL", false),
+		},
+		Admin: AdminConfig{
+			BootstrapEmail:      getEnv("ADMIN_BOOTSTRAP_EMAIL", ""),
+			ImpersonationExpiry: getEnvDuration("ADMIN_IMPERSONATION_EXPIRY", 15*time.Minute),
+		},
+		Audit: AuditConfig{
+			LogFile: getEnv("AUDIT_LOG_FILE", ""),
+		},
+		OAuth: OAuthConfig{
+			CallbackBaseURL: strings.TrimSuffix(getEnv("OAUTH_CALLBACK_BASE_URL", "http://localhost:8080"), "/"),
+			StateExpiry:     getEnvDuration("OAUTH_STATE_EXPIRY", 10*time.Minute),
+			Providers:       loadOAuthProviders(),
+		},
+		AuthServer: AuthServerConfig{
+			Issuer:     strings.TrimSuffix(getEnv("ISSUER_URL", "http://localhost:8080"), "/"),
+			CodeExpiry: getEnvDuration("OAUTH_CODE_EXPIRY", time.Minute),
+
+			IntrospectionClients: getEnvSlice("OAUTH_INTROSPECTION_CLIENTS", nil),
+
+			SigningKeyFile: getEnv("OIDC_SIGNING_KEY_FILE", ""),
+		},
+		SAML: SAMLConfig{
+			BaseURL:       strings.TrimSuffix(getEnv("SAML_BASE_URL", "http://localhost:8080"), "/"),
+			RequestExpiry: getEnvDuration("SAML_REQUEST_EXPIRY", 10*time.Minute),
+			CertFile:      getEnv("SAML_CERT_FILE", ""),
+			KeyFile:       getEnv("SAML_KEY_FILE", ""),
+		},
+		LDAP: LDAPConfig{
+			URL:                  getEnv("LDAP_URL", ""),
+			StartTLS:             getEnvBool("LDAP_START_TLS", false),
+			BindDN:               getEnv("LDAP_BIND_DN", ""),
+			BindPassword:         getEnv("LDAP_BIND_PASSWORD", ""),
+			BaseDN:               getEnv("LDAP_BASE_DN", ""),
+			UserFilter:           getEnv("LDAP_USER_FILTER", "(&(objectClass=person)(mail=%s))"),
+			EmailAttribute:       getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+			DisplayNameAttribute: getEnv("LDAP_DISPLAY_NAME_ATTRIBUTE", "cn"),
+			Timeout:              getEnvDuration("LDAP_TIMEOUT", 10*time.Second),
+		},
+		SCIM: SCIMConfig{
+			BaseURL:    strings.TrimSuffix(getEnv("SCIM_BASE_URL", "http://localhost:8080"), "/"),
+			MaxResults: getEnvInt("SCIM_MAX_RESULTS", 100),
+		},
+		Webhook: WebhookConfig{
+			DispatchInterval: getEnvDuration("WEBHOOK_DISPATCH_INTERVAL", 5*time.Second),
+			Timeout:          getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+			MaxAttempts:      getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+			RetryBaseDelay:   getEnvDuration("WEBHOOK_RETRY_BASE_DELAY", 30*time.Second),
+			RetryMaxDelay:    getEnvDuration("WEBHOOK_RETRY_MAX_DELAY", 6*time.Hour),
+		},
 	}
 
 	if err := config.Validate(); err != nil {
@@ -155,5 +425,40 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("DATABASE_URL is required")
 	}
 
+	switch c.Registration.Mode {
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationClosed:
+	default:
+		return fmt.Errorf("REGISTRATION_MODE must be open, invite_only or closed")
+	}
+
+	if (c.SAML.CertFile == "") != (c.SAML.KeyFile == "") {
+		return fmt.Errorf("SAML_CERT_FILE and SAML_KEY_FILE must be set together")
+	}
+
+	if c.LDAP.URL != "" {
+		if c.LDAP.BaseDN == "" {
+			return fmt.Errorf("LDAP_BASE_DN is required with LDAP_URL")
+		}
+		if !strings.Contains(c.LDAP.UserFilter, "%s") {
+			return fmt.Errorf("LDAP_USER_FILTER must contain %%s for the login")
+		}
+	}
+
+	if c.Admin.ImpersonationExpiry <= 0 || c.Admin.ImpersonationExpiry > time.Hour {
+		return fmt.Errorf("ADMIN_IMPERSONATION_EXPIRY must be positive and at most 1h")
+	}
+
+	if c.SCIM.MaxResults < 1 {
+		return fmt.Errorf("SCIM_MAX_RESULTS must be at least 1")
+	}
+
+	if c.Account.OTPLength < 6 || c.Account.OTPLength > 8 {
+		return fmt.Errorf("OTP_LENGTH must be between 6 and 8")
+	}
+
+	if c.Account.OTPMaxAttempts < 1 || c.Account.OTPMaxCodesPerHour < 1 {
+		return fmt.Errorf("OTP_MAX_ATTEMPTS and OTP_MAX_CODES_PER_HOUR must be at least 1")
+	}
+
 	return nil
 }
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTokenConsumed is returned by the repository when an action token was already used
+var ErrTokenConsumed = errors.New("action token already consumed")
+
+// Action token purposes
+const (
+	ActionEmailChange   = "email_change"
+	ActionPasswordReset = "password_reset"
+	ActionSignInReport  = "sign_in_report" // "This wasn't me" link in a new sign-in alert
+	ActionMagicLink     = "magic_link"     // Passwordless login, Data holds the hash of the browser nonce
+)
+
+// ActionToken is a single-use token emailed to a user to confirm an action.
+// Only the SHA-256 hash of the token is stored.
+type ActionToken struct {
+	ID         int64      `json:"id" gorm:"primaryKey"`
+	UserID     int64      `json:"user_id" gorm:"index;not null"`
+	Purpose    string     `json:"purpose" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"unique;not null"`
+	Data       string     `json:"data"` // Purpose-specific payload (e.g. the new email address)
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ConsumedAt *time.Time `json:"consumed_at,omitempty"`
+}
+
+type ActionTokenRepository interface {
+	Create(ctx context.Context, token *ActionToken) error
+	GetByHash(ctx context.Context, purpose, tokenHash string) (*ActionToken, error)
+	Consume(ctx context.Context, id int64) error
+	DeletePendingForUser(ctx context.Context, userID int64, purpose string) error
+}
+
+func (t *ActionToken) IsValid() bool {
+	if t.ConsumedAt != nil {
+		return false
+	}
+	return time.Now().Before(t.ExpiresAt)
+}
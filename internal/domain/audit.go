@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Audit event types
+const (
+	AuditRegister             = "user.register"
+	AuditLogin                = "auth.login"
+	AuditRefresh              = "auth.refresh"
+	AuditRefreshReuse         = "auth.refresh_reuse_detected"
+	AuditLogout               = "auth.logout"
+	AuditReauthentication     = "auth.reauthentication"
+	AuditPasswordReset        = "user.password_reset"
+	AuditEmailChangeRequested = "user.email_change_requested"
+	AuditEmailChanged         = "user.email_changed"
+	AuditDeletionScheduled    = "user.deletion_scheduled"
+	AuditNewSignInAlert       = "auth.new_sign_in_alert"
+	AuditSignInReported       = "auth.sign_in_reported"
+	AuditIdentityLinked       = "user.identity_linked"
+	AuditOAuthAuthorize       = "oauth.authorize"
+	AuditOAuthToken           = "oauth.token"
+	AuditOAuthRevoke          = "oauth.revoke"
+
+	AuditPersonalAccessTokenCreated = "user.personal_access_token_created"
+	AuditPersonalAccessTokenRevoked = "user.personal_access_token_revoked"
+	AuditOrganizationCreated        = "org.created"
+	AuditOrgAction                  = "org.action" // Membership changes, Reason holds the action
+	AuditAdminAction                = "admin.action"
+	AuditSCIMAction                 = "scim.action" // Provisioning by an organization's identity provider, Reason holds the action
+	AuditImpersonationStarted       = "admin.impersonation_started"
+	AuditImpersonationStopped       = "admin.impersonation_stopped"
+	AuditImpersonatedRequest        = "admin.impersonated_request" // Every request made while impersonating, the admin is the actor
+)
+
+// Audit event outcomes
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEvent is a security-relevant event. Rows are append-only and are kept
+// after the user is deleted, so they don't reference the users table.
+type AuditEvent struct {
+	ID        int64                  `json:"id" gorm:"primaryKey"`
+	Type      string                 `json:"type" gorm:"not null;index"`
+	ActorID   *int64                 `json:"actor_id,omitempty"`   // Who performed the action
+	SubjectID *int64                 `json:"subject_id,omitempty"` // Which user the action affected
+	Outcome   string                 `json:"outcome" gorm:"not null"`
+	Reason    string                 `json:"reason,omitempty"` // Why it failed, or which admin action ran
+	IP        string                 `json:"ip"`
+	UserAgent string                 `json:"user_agent"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty" gorm:"serializer:json"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// AuditEmitter records audit events. Emitting never fails the calling operation,
+// implementations report their own errors.
+type AuditEmitter interface {
+	Emit(ctx context.Context, event *AuditEvent)
+}
+
+// AuditFilter narrows down List and Count, zero-valued fields don't filter
+type AuditFilter struct {
+	Type      string
+	ActorID   *int64
+	SubjectID *int64
+	Outcome   string
+	Since     *time.Time
+	Until     *time.Time
+	Limit     int
+	Offset    int
+}
+
+type AuditRepository interface {
+	Create(ctx context.Context, event *AuditEvent) error
+	List(ctx context.Context, filter *AuditFilter) ([]*AuditEvent, error)
+	Count(ctx context.Context, filter *AuditFilter) (int64, error)
+}
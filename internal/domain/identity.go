@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// UserIdentity links an account at an external login provider to a user
+type UserIdentity struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	UserID      int64      `json:"user_id" gorm:"index;not null"`
+	Provider    string     `json:"provider" gorm:"not null"`
+	Subject     string     `json:"-" gorm:"not null"` // Provider's stable user ID
+	Email       string     `json:"email"`             // Email reported by the provider when linked
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+type IdentityRepository interface {
+	Create(ctx context.Context, identity *UserIdentity) error
+	GetByProviderSubject(ctx context.Context, provider, subject string) (*UserIdentity, error)
+	ListForUser(ctx context.Context, userID int64) ([]*UserIdentity, error)
+	UpdateLastLogin(ctx context.Context, id int64) error
+}
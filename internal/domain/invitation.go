@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Invitation lets someone register while open sign-up is disabled. It is sent to one
+// email address and gives the new account its role. Only the SHA-256 hash of the token is stored.
+type Invitation struct {
+	ID         int64      `json:"id" gorm:"primaryKey"`
+	Email      string     `json:"email" gorm:"not null"`
+	Role       string     `json:"role" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"unique;not null"`
+	InvitedBy  *int64     `json:"invited_by,omitempty"` // Admin who created it
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	AcceptedBy *int64     `json:"accepted_by,omitempty"` // User that registered with it
+}
+
+type InvitationRepository interface {
+	Create(ctx context.Context, invitation *Invitation) error
+	GetByID(ctx context.Context, id int64) (*Invitation, error)
+	GetByHash(ctx context.Context, tokenHash string) (*Invitation, error)
+	List(ctx context.Context) ([]*Invitation, error)
+	// Accept marks the invitation as used. It fails if it was already accepted.
+	Accept(ctx context.Context, id, userID int64) error
+	Delete(ctx context.Context, id int64) error
+}
+
+func (i *Invitation) IsValid() bool {
+	if i.AcceptedAt != nil {
+		return false
+	}
+	return time.Now().Before(i.ExpiresAt)
+}
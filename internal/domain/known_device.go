@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// KnownDevice is a device and IP a user has signed in from.
+// Device is the browser and OS description, not the raw user agent, so
+// browser updates don't count as a new device.
+type KnownDevice struct {
+	ID          int64     `json:"id" gorm:"primaryKey"`
+	UserID      int64     `json:"user_id" gorm:"index;not null"`
+	Device      string    `json:"device" gorm:"not null"`
+	IP          string    `json:"ip" gorm:"not null"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// DeviceSighting tells whether a device and IP were seen before for a user
+type DeviceSighting struct {
+	FirstSignIn bool // No previous sign-ins are recorded
+	DeviceSeen  bool
+	IPSeen      bool
+}
+
+type KnownDeviceRepository interface {
+	Lookup(ctx context.Context, userID int64, device, ip string) (*DeviceSighting, error)
+	Record(ctx context.Context, userID int64, device, ip string) error
+}
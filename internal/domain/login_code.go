@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// LoginCode is a short numeric code emailed to a user to log in on a device that
+// doesn't have their mailbox. Codes are too short to be looked up by hash alone,
+// so they belong to a user and the number of wrong guesses is counted.
+type LoginCode struct {
+	ID         int64      `json:"id" gorm:"primaryKey"`
+	UserID     int64      `json:"user_id" gorm:"index;not null"`
+	CodeHash   string     `json:"-" gorm:"not null"`
+	Attempts   int        `json:"attempts" gorm:"not null;default:0"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ConsumedAt *time.Time `json:"consumed_at,omitempty"`
+}
+
+type LoginCodeRepository interface {
+	Create(ctx context.Context, code *LoginCode) error
+	// GetPendingForUser returns the newest unconsumed code of the user
+	GetPendingForUser(ctx context.Context, userID int64) (*LoginCode, error)
+	// RecordAttempt counts a guess. It returns false once maxAttempts guesses were made.
+	RecordAttempt(ctx context.Context, id int64, maxAttempts int) (bool, error)
+	Consume(ctx context.Context, id int64) error
+	// ConsumePendingForUser retires the user's unconsumed codes. The rows are kept so
+	// CountCreatedSince still counts them.
+	ConsumePendingForUser(ctx context.Context, userID int64) error
+	CountCreatedSince(ctx context.Context, userID int64, since time.Time) (int64, error)
+}
+
+func (c *LoginCode) IsValid() bool {
+	if c.ConsumedAt != nil {
+		return false
+	}
+	return time.Now().Before(c.ExpiresAt)
+}
@@ -0,0 +1,213 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+)
+
+// OAuth client types (RFC 6749 section 2.1)
+const (
+	ClientConfidential = "confidential" // Can keep a secret, e.g. a server-side web app
+	ClientPublic       = "public"       // Can't keep a secret, e.g. a SPA or native app; relies on PKCE alone
+)
+
+// Scopes with a meaning to this service, clients may also be allowed others
+// that only their resource servers understand
+const (
+	ScopeOpenID  = "openid"  // OpenID Connect: an ID token is issued and /userinfo may be used
+	ScopeEmail   = "email"   // email and email_verified
+	ScopeProfile = "profile" // name, picture, locale and zoneinfo
+)
+
+// OAuthClient is an application that delegates login to this service
+type OAuthClient struct {
+	ID           int64     `json:"-" gorm:"primaryKey"`
+	ClientID     string    `json:"client_id" gorm:"unique;not null"`
+	SecretHash   string    `json:"-"` // SHA-256 of the client secret, empty for public clients
+	Name         string    `json:"name" gorm:"not null"`
+	Type         string    `json:"type" gorm:"not null"`
+	RedirectURIs []string  `json:"redirect_uris" gorm:"serializer:json;not null"`
+	Scopes       []string  `json:"scopes" gorm:"serializer:json;not null"` // Scopes the client may request
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TableName overrides gorm's default of "o_auth_clients"
+func (OAuthClient) TableName() string { return "oauth_clients" }
+
+func (c *OAuthClient) IsConfidential() bool {
+	return c.Type == ClientConfidential
+}
+
+// AllowsRedirectURI reports whether the URI is registered. Matching is exact, as OAuth 2.1 requires.
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// AllowsScopes reports whether every scope is one the client may request
+func (c *OAuthClient) AllowsScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// OAuthAuthorizationCode is a single-use code from /oauth/authorize, exchanged at /oauth/token.
+// Only the SHA-256 hash of the code is stored.
+type OAuthAuthorizationCode struct {
+	ID            int64     `gorm:"primaryKey"`
+	CodeHash      string    `gorm:"unique;not null"`
+	ClientID      string    `gorm:"not null"`
+	UserID        int64     `gorm:"index;not null"`
+	RedirectURI   string    `gorm:"not null"`
+	Scope         string    `gorm:"not null"`
+	CodeChallenge string    `gorm:"not null"` // PKCE S256 challenge
+	Nonce         string    // OIDC nonce, copied into the ID token
+	AuthTime      time.Time `gorm:"not null"` // When the user logged in
+	ExpiresAt     time.Time `gorm:"not null"`
+	CreatedAt     time.Time
+	ConsumedAt    *time.Time
+}
+
+func (OAuthAuthorizationCode) TableName() string { return "oauth_authorization_codes" }
+
+func (c *OAuthAuthorizationCode) IsValid() bool {
+	return c.ConsumedAt == nil && time.Now().Before(c.ExpiresAt)
+}
+
+// OAuthConsent remembers the scopes a user granted to a client, so they aren't asked again
+type OAuthConsent struct {
+	UserID    int64  `gorm:"primaryKey"`
+	ClientID  string `gorm:"primaryKey"`
+	Scope     string `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (OAuthConsent) TableName() string { return "oauth_consents" }
+
+// Covers reports whether the consent includes every requested scope
+func (c *OAuthConsent) Covers(scopes []string) bool {
+	return ScopeCovers(c.Scope, scopes)
+}
+
+// AuthorizationRequest holds the parameters of /oauth/authorize
+type AuthorizationRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	Nonce               string `form:"nonce"`
+}
+
+// TokenRequest holds the parameters of /oauth/token
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// TokenResponse is the successful /oauth/token response (RFC 6749 section 5.1)
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"` // Only with the openid scope
+}
+
+// TokenHintRequest holds the parameters of /oauth/introspect (RFC 7662) and /oauth/revoke (RFC 7009)
+type TokenHintRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"` // "access_token" or "refresh_token", only changes the lookup order
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// IntrospectionResponse is the /oauth/introspect response. Inactive tokens only get Active false.
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"` // "access_token" or "refresh_token"
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+}
+
+// OpenIDConfiguration is the discovery document at /.well-known/openid-configuration
+// (OpenID Connect Discovery 1.0)
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type OAuthRepository interface {
+	CreateClient(ctx context.Context, client *OAuthClient) error
+	GetClient(ctx context.Context, clientID string) (*OAuthClient, error)
+	ListClients(ctx context.Context) ([]*OAuthClient, error)
+	DeleteClient(ctx context.Context, clientID string) error
+
+	CreateCode(ctx context.Context, code *OAuthAuthorizationCode) error
+	GetCodeByHash(ctx context.Context, codeHash string) (*OAuthAuthorizationCode, error)
+	ConsumeCode(ctx context.Context, id int64) error
+
+	GetConsent(ctx context.Context, userID int64, clientID string) (*OAuthConsent, error)
+	SaveConsent(ctx context.Context, consent *OAuthConsent) error
+}
+
+// ParseScope splits a space-separated scope parameter
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// ScopeCovers reports whether a granted scope parameter includes every requested scope
+func ScopeCovers(granted string, requested []string) bool {
+	grantedScopes := ParseScope(granted)
+	for _, scope := range requested {
+		if !slices.Contains(grantedScopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// JoinScope builds a scope parameter, dropping duplicates
+func JoinScope(scopes []string) string {
+	seen := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !slices.Contains(seen, scope) {
+			seen = append(seen, scope)
+		}
+	}
+	return strings.Join(seen, " ")
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Organization roles, held per membership. They only apply inside their organization
+// and are unrelated to the global roles in the roles table.
+const (
+	OrgRoleOwner  = "owner" // Exactly one per organization
+	OrgRoleAdmin  = "admin" // Manages members
+	OrgRoleMember = "member"
+)
+
+// ErrOrganizationSlugTaken is returned by the repository when a slug is already used
+var ErrOrganizationSlugTaken = errors.New("organization slug already in use")
+
+// Organization is a customer tenant that users belong to through memberships
+type Organization struct {
+	ID        int64     `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null"`
+	Slug      string    `json:"slug" gorm:"unique;not null"` // URL-friendly identifier, e.g. "acme"
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Membership puts a user in an organization with an organization role
+type Membership struct {
+	OrgID     int64     `json:"org_id" gorm:"primaryKey"`
+	UserID    int64     `json:"user_id" gorm:"primaryKey"`
+	Role      string    `json:"role" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrgRoleRank orders organization roles, a higher rank manages lower ones.
+// Unknown roles rank 0.
+func OrgRoleRank(role string) int {
+	switch role {
+	case OrgRoleOwner:
+		return 3
+	case OrgRoleAdmin:
+		return 2
+	case OrgRoleMember:
+		return 1
+	}
+	return 0
+}
+
+// UserOrganization is an organization as seen by one of its members
+type UserOrganization struct {
+	Organization
+	Role string `json:"role"`
+}
+
+// OrgMember is a member as listed to the other members of an organization
+type OrgMember struct {
+	UserID      int64     `json:"user_id"`
+	Email       string    `json:"email"`
+	DisplayName string    `json:"display_name"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"joined_at"`
+}
+
+type OrganizationRepository interface {
+	// Create stores the organization and makes ownerID its owner
+	Create(ctx context.Context, org *Organization, ownerID int64) error
+	GetByID(ctx context.Context, id int64) (*Organization, error)
+	GetMembership(ctx context.Context, orgID, userID int64) (*Membership, error)
+	ListForUser(ctx context.Context, userID int64) ([]*UserOrganization, error)
+
+	ListMembers(ctx context.Context, orgID int64) ([]*OrgMember, error)
+	AddMember(ctx context.Context, membership *Membership) error
+	UpdateMemberRole(ctx context.Context, orgID, userID int64, role string) error
+	RemoveMember(ctx context.Context, orgID, userID int64) error
+	// TransferOwnership makes toUserID the owner and fromUserID an admin, in one transaction
+	TransferOwnership(ctx context.Context, orgID, fromUserID, toUserID int64) error
+}
+
+// OrgInvitation invites an email address to join an organization with a role.
+// Only the SHA-256 hash of the token is stored.
+type OrgInvitation struct {
+	ID         int64      `json:"id" gorm:"primaryKey"`
+	OrgID      int64      `json:"org_id" gorm:"index;not null"`
+	Email      string     `json:"email" gorm:"not null"`
+	Role       string     `json:"role" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"unique;not null"`
+	InvitedBy  int64      `json:"invited_by" gorm:"not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
+
+type OrgInvitationRepository interface {
+	Create(ctx context.Context, invitation *OrgInvitation) error
+	GetByHash(ctx context.Context, tokenHash string) (*OrgInvitation, error)
+	// Accept marks the invitation as used. It fails if it was already accepted.
+	Accept(ctx context.Context, id int64) error
+	// DeletePending removes unused invitations of the email to the organization
+	DeletePending(ctx context.Context, orgID int64, email string) error
+}
+
+func (i *OrgInvitation) IsValid() bool {
+	if i.AcceptedAt != nil {
+		return false
+	}
+	return time.Now().Before(i.ExpiresAt)
+}
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, so secret scanners
+// (and people) can recognize one in code or logs
+const PersonalAccessTokenPrefix = "lfpat_"
+
+// Scopes of personal access tokens for the /api/user endpoints. The admin permissions
+// (users:read, ...) can be granted as scopes too, to users who hold them.
+const (
+	ScopeAccountRead  = "account:read"
+	ScopeAccountWrite = "account:write" // Implies account:read
+)
+
+// ErrPersonalAccessTokenNotFound is returned by the repository when revoking a token
+// that doesn't exist, belongs to another user or is already revoked
+var ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+
+// PersonalAccessToken is a long-lived credential a user creates for scripts and CLIs.
+// Only the SHA-256 hash of the token is stored.
+type PersonalAccessToken struct {
+	ID         int64      `json:"id" gorm:"primaryKey"`
+	UserID     int64      `json:"-" gorm:"index;not null"`
+	Name       string     `json:"name" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"unique;not null"`
+	Hint       string     `json:"hint"` // Last characters of the token, to tell tokens apart
+	Scopes     []string   `json:"scopes" gorm:"serializer:json;not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (t *PersonalAccessToken) IsValid() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
+
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+type PersonalAccessTokenRepository interface {
+	Create(ctx context.Context, token *PersonalAccessToken) error
+	GetByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error)
+	ListForUser(ctx context.Context, userID int64) ([]*PersonalAccessToken, error)
+	Revoke(ctx context.Context, userID, id int64) error
+	RevokeAllForUser(ctx context.Context, userID int64) error
+	UpdateLastUsed(ctx context.Context, id int64) error
+}
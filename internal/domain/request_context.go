@@ -0,0 +1,38 @@
+package domain
+
+import "context"
+
+type contextKey string
+
+const (
+	clientInfoKey contextKey = "clientInfo"
+	actorIDKey    contextKey = "actorID"
+)
+
+// ClientInfo describes where a request came from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// WithClientInfo returns a copy of ctx carrying the client's IP and user agent
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey, info)
+}
+
+// ClientInfoFromContext returns the client info set by WithClientInfo, or a zero value
+func ClientInfoFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey).(ClientInfo)
+	return info
+}
+
+// WithActorID returns a copy of ctx carrying the ID of the authenticated user making the request
+func WithActorID(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, actorIDKey, userID)
+}
+
+// ActorIDFromContext returns the authenticated user's ID, if any
+func ActorIDFromContext(ctx context.Context) (int64, bool) {
+	userID, ok := ctx.Value(actorIDKey).(int64)
+	return userID, ok
+}
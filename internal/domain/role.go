@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Built-in roles
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Built-in permissions, granted to roles in the role_permissions table
+const (
+	PermissionUsersRead          = "users:read"
+	PermissionUsersWrite         = "users:write"
+	PermissionUsersImpersonate   = "users:impersonate"
+	PermissionRolesWrite         = "roles:write"
+	PermissionAuditRead          = "audit:read"
+	PermissionWebhooksManage     = "webhooks:manage"
+	PermissionOAuthClientsManage = "oauth_clients:manage"
+	PermissionServiceAccounts    = "service_accounts:manage"
+	PermissionInvitationsManage  = "invitations:manage"
+	PermissionSAMLManage         = "saml:manage"
+	PermissionSCIMManage         = "scim:manage"
+)
+
+type Role struct {
+	ID          int64     `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"unique;not null"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Permission struct {
+	ID          int64  `json:"id" gorm:"primaryKey"`
+	Name        string `json:"name" gorm:"unique;not null"`
+	Description string `json:"description"`
+}
+
+// UserRole assigns a role to a user
+type UserRole struct {
+	UserID    int64     `json:"user_id" gorm:"primaryKey"`
+	RoleID    int64     `json:"role_id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RoleRepository interface {
+	GetByName(ctx context.Context, name string) (*Role, error)
+	List(ctx context.Context) ([]*Role, error)
+	GetUserRoles(ctx context.Context, userID int64) ([]string, error)
+	GetUserPermissions(ctx context.Context, userID int64) ([]string, error)
+	AssignToUser(ctx context.Context, userID int64, roleName string) error
+	RemoveFromUser(ctx context.Context, userID int64, roleName string) error
+	CountUsersWithRole(ctx context.Context, roleName string) (int64, error)
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrSAMLConnectionSlugTaken is returned by the repository when creating a connection with a slug in use
+	ErrSAMLConnectionSlugTaken = errors.New("saml connection slug already taken")
+	// ErrSAMLAssertionReplayed is returned by the repository when an assertion ID was already used
+	ErrSAMLAssertionReplayed = errors.New("saml assertion already used")
+)
+
+// SAMLConnection is an enterprise identity provider users sign in with through SAML 2.0.
+// Its slug names it in the SP URLs (/api/auth/saml/<slug>/...).
+type SAMLConnection struct {
+	ID             int64  `json:"id" gorm:"primaryKey"`
+	Slug           string `json:"slug" gorm:"unique;not null"`
+	Name           string `json:"name" gorm:"not null"`
+	IdPEntityID    string `json:"idp_entity_id" gorm:"column:idp_entity_id;not null"`
+	IdPMetadata    string `json:"-" gorm:"column:idp_metadata;not null"` // Metadata XML as imported
+	EmailAttribute string `json:"email_attribute"`                       // Empty: the NameID is the email
+
+	// The IdP may only assert emails in these domains, so it can't sign in to accounts
+	// of other customers or of our own staff
+	Domains []string `json:"domains" gorm:"serializer:json;not null"`
+
+	OrgID     *int64    `json:"org_id,omitempty"` // Users provisioned just in time join this organization
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SAMLAssertion records a consumed assertion ID until the assertion expires (replay protection)
+type SAMLAssertion struct {
+	ID           string    `gorm:"primaryKey"`
+	ConnectionID int64     `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+}
+
+type SAMLRepository interface {
+	CreateConnection(ctx context.Context, conn *SAMLConnection) error
+	GetConnectionBySlug(ctx context.Context, slug string) (*SAMLConnection, error)
+	ListConnections(ctx context.Context) ([]*SAMLConnection, error)
+	UpdateMetadata(ctx context.Context, id int64, entityID, metadata string) error
+	DeleteConnection(ctx context.Context, id int64) error
+
+	// UseAssertion records the assertion ID, or returns ErrSAMLAssertionReplayed if it
+	// was recorded before. Expired records are removed along the way.
+	UseAssertion(ctx context.Context, assertion *SAMLAssertion) error
+}
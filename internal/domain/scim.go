@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// SCIMTokenPrefix starts every SCIM token, so secret scanners can recognize one
+const SCIMTokenPrefix = "lfscim_"
+
+var (
+	// ErrSCIMTokenNotFound is returned by the repository when deleting a token that doesn't exist
+	ErrSCIMTokenNotFound = errors.New("scim token not found")
+	// ErrSCIMUserNameTaken is returned by the repository when the organization already
+	// provisioned a user with the userName
+	ErrSCIMUserNameTaken = errors.New("scim userName already in use")
+)
+
+// SCIMToken lets the identity provider of an organization provision users through SCIM.
+// Only the SHA-256 hash of the token is stored.
+type SCIMToken struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	OrgID       int64      `json:"org_id" gorm:"index;not null"`
+	Description string     `json:"description" gorm:"not null"`
+	TokenHash   string     `json:"-" gorm:"unique;not null"`
+	Hint        string     `json:"hint"`                                    // Last characters of the token, to tell tokens apart
+	Domains     []string   `json:"domains" gorm:"serializer:json;not null"` // Email domains the token may provision users with
+	Roles       []string   `json:"roles" gorm:"serializer:json;not null"`   // Roles exposed as SCIM groups
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// SCIMUser marks a user as provisioned by an organization's identity provider. Only
+// that organization's tokens see and manage the user.
+type SCIMUser struct {
+	UserID     int64  `gorm:"primaryKey"`
+	OrgID      int64  `gorm:"index;not null"`
+	UserName   string `gorm:"not null"` // Unique per organization, case-insensitive
+	ExternalID string `gorm:"not null"` // The identity provider's ID for the user
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	User *User `gorm:"foreignKey:UserID"`
+}
+
+// SCIMUserFilter narrows down ListUsers and CountUsers, zero-valued fields don't filter
+type SCIMUserFilter struct {
+	UserName   string // Case-insensitive
+	ExternalID string
+	Email      string
+	Active     *bool
+	Role       string // Users holding this role
+	Limit      int
+	Offset     int
+}
+
+type SCIMRepository interface {
+	CreateToken(ctx context.Context, token *SCIMToken) error
+	GetTokenByHash(ctx context.Context, tokenHash string) (*SCIMToken, error)
+	ListTokens(ctx context.Context) ([]*SCIMToken, error)
+	DeleteToken(ctx context.Context, id int64) error
+	UpdateTokenLastUsed(ctx context.Context, id int64) error
+
+	CreateUser(ctx context.Context, scimUser *SCIMUser) error
+	// GetUser returns the organization's provisioned user with User loaded
+	GetUser(ctx context.Context, orgID, userID int64) (*SCIMUser, error)
+	// ListUsers returns the organization's provisioned users with User loaded, oldest first
+	ListUsers(ctx context.Context, orgID int64, filter *SCIMUserFilter) ([]*SCIMUser, error)
+	CountUsers(ctx context.Context, orgID int64, filter *SCIMUserFilter) (int64, error)
+	UpdateUser(ctx context.Context, userID int64, userName, externalID string) error
+}
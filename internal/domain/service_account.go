@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ServiceAccount is a machine identity for backend jobs. It gets access tokens with the
+// client_credentials grant and is not a user: it can't log in and has no profile or roles.
+type ServiceAccount struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	ClientID    string     `json:"client_id" gorm:"unique;not null"`
+	SecretHash  string     `json:"-" gorm:"not null"` // SHA-256 of the client secret
+	Name        string     `json:"name" gorm:"not null"`
+	Description string     `json:"description"`
+	Scopes      []string   `json:"scopes" gorm:"serializer:json;not null"` // Scopes its tokens may carry
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type ServiceAccountRepository interface {
+	Create(ctx context.Context, account *ServiceAccount) error
+	GetByClientID(ctx context.Context, clientID string) (*ServiceAccount, error)
+	List(ctx context.Context) ([]*ServiceAccount, error)
+	Delete(ctx context.Context, clientID string) error
+	UpdateLastUsed(ctx context.Context, id int64) error
+}
@@ -12,6 +12,28 @@ type RefreshToken struct {
 	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
 	CreatedAt time.Time  `json:"created_at"`
 	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	ClientID  string     `json:"client_id,omitempty"` // OAuth client the token was issued to, empty for our own sessions
+	Scope     string     `json:"scope,omitempty"`     // Scopes granted to the OAuth client
+	AuthTime  *time.Time `json:"auth_time,omitempty"` // When the user logged in, carried over on rotation
+	OrgID     *int64     `json:"org_id,omitempty"`    // Active organization, carried over on rotation
+}
+
+// AuthenticatedAt returns when the user logged in to start this session.
+// Tokens issued before auth_time was tracked fall back to their creation time.
+func (t *RefreshToken) AuthenticatedAt() time.Time {
+	if t.AuthTime != nil {
+		return *t.AuthTime
+	}
+	return t.CreatedAt
+}
+
+// RevokedAccessToken marks a revoked access token by its "jti". Access tokens are
+// stateless JWTs, so this is only consulted where we look tokens up (introspection,
+// userinfo); the row can go once the token has expired anyway.
+type RevokedAccessToken struct {
+	JTI       string    `gorm:"column:jti;primaryKey"`
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
 }
 
 type TokenRepository interface {
@@ -20,7 +42,12 @@ type TokenRepository interface {
 	GetByUserID(ctx context.Context, userID int64) ([]*RefreshToken, error)
 	Revoke(ctx context.Context, token string) error
 	RevokeAllForUser(ctx context.Context, userID int64) error
+	RevokeAllForClient(ctx context.Context, userID int64, clientID string) error
+	RevokeAllForOrg(ctx context.Context, userID, orgID int64) error // Sessions switched to the organization
 	CleanupExpired(ctx context.Context) error
+
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
 }
 
 func (t *RefreshToken) IsValid() bool {
@@ -29,3 +56,20 @@ func (t *RefreshToken) IsValid() bool {
 	}
 	return time.Now().Before(t.ExpiresAt)
 }
+
+// SessionResponse describes a refresh token without exposing the token itself
+type SessionResponse struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ClientID  string    `json:"client_id,omitempty"`
+}
+
+func (t *RefreshToken) ToSessionResponse() *SessionResponse {
+	return &SessionResponse{
+		ID:        t.ID,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+		ClientID:  t.ClientID,
+	}
+}
@@ -0,0 +1,10 @@
+package domain
+
+import "context"
+
+// Transactor runs fn in a database transaction, so a service can change several
+// repositories atomically. Repository calls made with the ctx fn is given are part of
+// the transaction; an error from fn rolls it back.
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
@@ -2,16 +2,50 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// User account states
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled" // Disabled by an admin, can't log in
+
+	UserStatusPendingApproval = "pending_approval" // Registered, waiting for an admin to approve
+	UserStatusDeprovisioned   = "deprovisioned"    // Deactivated by the identity provider through SCIM, which may reactivate it
+)
+
+// Where a user's password is checked
+const (
+	AuthSourceLocal = "local" // Our bcrypt hash
+	AuthSourceLDAP  = "ldap"  // The LDAP directory, the account has no local password
+)
+
+// ErrEmailTaken is returned by the repository when an email is already used by another account
+var ErrEmailTaken = errors.New("email already in use")
+
 type User struct {
-	ID        int64     `json:"id" gorm:"primaryKey"`
-	Email     string    `json:"email" gorm:"unique;not null"`
-	Password  string    `json:"-" gorm:"not null"`
-	Verified  bool      `json:"verified" gorm:"default:false"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         int64     `json:"id" gorm:"primaryKey"`
+	Email      string    `json:"email" gorm:"unique;not null"`
+	Password   string    `json:"-" gorm:"not null"`
+	Verified   bool      `json:"verified" gorm:"default:false"`
+	Status     string    `json:"status" gorm:"not null;default:active"`
+	AuthSource string    `json:"auth_source" gorm:"not null;default:local"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// Profile
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	Locale      string `json:"locale"`   // BCP 47 language tag, e.g. "en-US"
+	Timezone    string `json:"timezone"` // IANA time zone, e.g. "Europe/Berlin"
+
+	// Set while the account is pending deletion, the account is purged after this time
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+
+	// Access tokens carry the version they were issued at, bumping it invalidates every
+	// access token issued before (e.g. when the email in their claims changes)
+	TokenVersion int `json:"-" gorm:"not null;default:0"`
 }
 
 type UserRepository interface {
@@ -20,21 +54,79 @@ type UserRepository interface {
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	Update(ctx context.Context, user *User) error
 	Delete(ctx context.Context, id int64) error
+	DeleteIfDeletionDue(ctx context.Context, id int64, before time.Time) (bool, error)
 	MarkAsVerified(ctx context.Context, id int64) error
+	UpdateEmail(ctx context.Context, id int64, email string) error
+	ScheduleDeletion(ctx context.Context, id int64, at *time.Time) error
+	GetDeletionDue(ctx context.Context, before time.Time) ([]*User, error)
+	UpdateProfile(ctx context.Context, id int64, profile *ProfileUpdate) error
+	UpdatePassword(ctx context.Context, id int64, hashedPassword string) error
+	UpdateStatus(ctx context.Context, id int64, status string) error
+	List(ctx context.Context, filter *UserFilter) ([]*User, error)
+	Count(ctx context.Context, filter *UserFilter) (int64, error)
+	Search(ctx context.Context, query string, limit int) ([]*User, error)
+}
+
+// UserFilter narrows down List and Count, zero-valued fields don't filter
+type UserFilter struct {
+	Query         string // Matches email or display name
+	Verified      *bool
+	Status        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Limit         int
+	Offset        int
+}
+
+// ProfileUpdate holds the profile fields to change, nil fields are left untouched
+type ProfileUpdate struct {
+	DisplayName *string
+	AvatarURL   *string
+	Locale      *string
+	Timezone    *string
+}
+
+func (p *ProfileUpdate) IsEmpty() bool {
+	return p.DisplayName == nil && p.AvatarURL == nil && p.Locale == nil && p.Timezone == nil
 }
 
 type UserResponse struct {
-	ID        int64     `json:"id"`
-	Email     string    `json:"email"`
-	Verified  bool      `json:"verified"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                  int64      `json:"id"`
+	Email               string     `json:"email"`
+	Verified            bool       `json:"verified"`
+	Status              string     `json:"status"`
+	AuthSource          string     `json:"auth_source"`
+	DisplayName         string     `json:"display_name"`
+	AvatarURL           string     `json:"avatar_url"`
+	Locale              string     `json:"locale"`
+	Timezone            string     `json:"timezone"`
+	CreatedAt           time.Time  `json:"created_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+func (u *User) IsActive() bool {
+	return u.Status == UserStatusActive
+}
+
+// IsDirectoryUser tells whether the directory owns the account's password. Such users
+// only log in with it: local passwords, reset links and passwordless logins would
+// keep working after the directory disabled them.
+func (u *User) IsDirectoryUser() bool {
+	return u.AuthSource == AuthSourceLDAP
 }
 
 func (u *User) ToResponse() *UserResponse {
 	return &UserResponse{
-		ID:        u.ID,
-		Email:     u.Email,
-		Verified:  u.Verified,
-		CreatedAt: u.CreatedAt,
+		ID:                  u.ID,
+		Email:               u.Email,
+		Verified:            u.Verified,
+		Status:              u.Status,
+		AuthSource:          u.AuthSource,
+		DisplayName:         u.DisplayName,
+		AvatarURL:           u.AvatarURL,
+		Locale:              u.Locale,
+		Timezone:            u.Timezone,
+		CreatedAt:           u.CreatedAt,
+		DeletionScheduledAt: u.DeletionScheduledAt,
 	}
 }
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Account events published to webhook subscribers
+const (
+	EventUserRegistered   = "user.registered"
+	EventUserVerified     = "user.verified"
+	EventUserEmailChanged = "user.email_changed"
+	EventUserDeleted      = "user.deleted"
+
+	// EventAll subscribes to every event
+	EventAll = "*"
+)
+
+// WebhookEvents lists the events a subscription can select
+var WebhookEvents = []string{EventUserRegistered, EventUserVerified, EventUserEmailChanged, EventUserDeleted}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // Gave up after the maximum number of attempts
+)
+
+// EventPublisher notifies other systems of account events
+type EventPublisher interface {
+	Publish(ctx context.Context, eventType string, data map[string]interface{})
+}
+
+type WebhookSubscription struct {
+	ID          int64     `json:"id" gorm:"primaryKey"`
+	URL         string    `json:"url" gorm:"not null"`
+	Events      []string  `json:"events" gorm:"serializer:json;not null"`
+	Secret      string    `json:"-" gorm:"not null"` // HMAC key, shown once on creation
+	Description string    `json:"description"`
+	Active      bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is an outbox entry: one event to deliver to one subscription
+type WebhookDelivery struct {
+	ID             int64      `json:"id" gorm:"primaryKey"`
+	SubscriptionID int64      `json:"subscription_id" gorm:"index;not null"`
+	EventID        string     `json:"event_id" gorm:"not null"`
+	EventType      string     `json:"event_type" gorm:"not null"`
+	Payload        string     `json:"payload" gorm:"not null"` // Exact JSON body that is signed and sent
+	Status         string     `json:"status" gorm:"not null;default:pending"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"not null"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+
+	Subscription *WebhookSubscription `json:"-" gorm:"foreignKey:SubscriptionID"`
+}
+
+// WebhookAttempt is one entry of the delivery log
+type WebhookAttempt struct {
+	ID             int64     `json:"id" gorm:"primaryKey"`
+	DeliveryID     int64     `json:"delivery_id" gorm:"index;not null"`
+	ResponseStatus int       `json:"response_status"` // 0 when no response was received
+	Error          string    `json:"error,omitempty"`
+	DurationMS     int64     `json:"duration_ms"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, subscription *WebhookSubscription) error
+	GetSubscription(ctx context.Context, id int64) (*WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]*WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id int64) error
+	GetSubscriptionsForEvent(ctx context.Context, eventType string) ([]*WebhookSubscription, error)
+
+	CreateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	GetDelivery(ctx context.Context, id int64) (*WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, subscriptionID int64, limit int) ([]*WebhookDelivery, error)
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+
+	CreateAttempt(ctx context.Context, attempt *WebhookAttempt) error
+	ListAttempts(ctx context.Context, deliveryID int64) ([]*WebhookAttempt, error)
+}
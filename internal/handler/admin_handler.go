@@ -0,0 +1,486 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/internal/middleware"
+	"github.com/login_flow/auth-service/internal/service"
+	"github.com/login_flow/auth-service/pkg/validator"
+)
+
+const (
+	defaultPageSize    = 20
+	defaultSearchLimit = 10
+)
+
+type AdminHandler struct {
+	adminService   *service.AdminService
+	auditService   *service.AuditService
+	webhookService *service.WebhookService
+}
+
+func NewAdminHandler(adminService *service.AdminService, auditService *service.AuditService, webhookService *service.WebhookService) *AdminHandler {
+	return &AdminHandler{
+		adminService:   adminService,
+		auditService:   auditService,
+		webhookService: webhookService,
+	}
+}
+
+// parseIDParam reads a numeric path parameter, writing a 400 response if it is invalid
+func parseIDParam(c *gin.Context, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return 0, false
+	}
+	return id, true
+}
+
+// ListUsers returns a page of users, filtered by the query string
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	var query validator.ListUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	filter := &domain.UserFilter{
+		Query:         query.Query,
+		Verified:      query.Verified,
+		Status:        query.Status,
+		CreatedAfter:  query.CreatedAfter,
+		CreatedBefore: query.CreatedBefore,
+		Limit:         query.PageSize,
+		Offset:        (query.Page - 1) * query.PageSize,
+	}
+
+	users, total, err := h.adminService.ListUsers(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":     toUserResponses(users),
+		"total":     total,
+		"page":      query.Page,
+		"page_size": query.PageSize,
+	})
+}
+
+// SearchUsers finds users by email or display name prefix
+func (h *AdminHandler) SearchUsers(c *gin.Context) {
+	var query validator.SearchUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Limit == 0 {
+		query.Limit = defaultSearchLimit
+	}
+
+	users, err := h.adminService.SearchUsers(c.Request.Context(), query.Query, query.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": toUserResponses(users)})
+}
+
+// GetUser returns a user with their roles and active sessions
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	details, err := h.adminService.GetUserDetails(c.Request.Context(), userID)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+
+	sessions := make([]*domain.SessionResponse, 0, len(details.Sessions))
+	for _, session := range details.Sessions {
+		sessions = append(sessions, session.ToSessionResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":     details.User.ToResponse(),
+		"roles":    details.Roles,
+		"sessions": sessions,
+	})
+}
+
+// DisableUser blocks a user from logging in and ends their sessions
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	h.setUserDisabled(c, true)
+}
+
+// EnableUser lets a disabled user log in again
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	h.setUserDisabled(c, false)
+}
+
+func (h *AdminHandler) setUserDisabled(c *gin.Context, disabled bool) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	actorID, _ := middleware.GetUserID(c)
+	if err := h.adminService.SetUserDisabled(c.Request.Context(), actorID, userID, disabled); err != nil {
+		writeUserError(c, err)
+		return
+	}
+
+	message := "user enabled"
+	if disabled {
+		message = "user disabled"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// ApproveUser lets a user waiting for approval log in
+func (h *AdminHandler) ApproveUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.ApproveUser(c.Request.Context(), userID); err != nil {
+		writeUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user approved"})
+}
+
+// RejectUser deletes an account waiting for approval
+func (h *AdminHandler) RejectUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.RejectUser(c.Request.Context(), userID); err != nil {
+		writeUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user rejected"})
+}
+
+// VerifyUser marks a user's email as verified
+func (h *AdminHandler) VerifyUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.VerifyUser(c.Request.Context(), userID); err != nil {
+		writeUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user verified"})
+}
+
+// TriggerPasswordReset emails the user a password reset link
+func (h *AdminHandler) TriggerPasswordReset(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.TriggerPasswordReset(c.Request.Context(), userID); err != nil {
+		writeUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "password reset email sent"})
+}
+
+// RevokeSessions logs the user out of every session
+func (h *AdminHandler) RevokeSessions(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.RevokeSessions(c.Request.Context(), userID); err != nil {
+		writeUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "sessions revoked"})
+}
+
+// ListRoles returns all assignable roles
+func (h *AdminHandler) ListRoles(c *gin.Context) {
+	roles, err := h.adminService.ListRoles(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// GetUserRoles returns the roles assigned to a user
+func (h *AdminHandler) GetUserRoles(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	roles, err := h.adminService.GetUserRoles(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// AssignRole gives a user a role
+func (h *AdminHandler) AssignRole(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req validator.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.adminService.AssignRole(c.Request.Context(), userID, req.Role); err != nil {
+		writeRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role assigned"})
+}
+
+// RemoveRole takes a role away from a user
+func (h *AdminHandler) RemoveRole(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.RemoveRole(c.Request.Context(), userID, c.Param("role")); err != nil {
+		writeRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role removed"})
+}
+
+func writeRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, service.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+	case errors.Is(err, service.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "cannot remove the last admin"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update roles"})
+	}
+}
+
+// ListAuditEvents returns a page of audit events, newest first, filtered by the query string
+func (h *AdminHandler) ListAuditEvents(c *gin.Context) {
+	var query validator.ListAuditEventsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	filter := &domain.AuditFilter{
+		Type:      query.Type,
+		ActorID:   query.ActorID,
+		SubjectID: query.SubjectID,
+		Outcome:   query.Outcome,
+		Since:     query.Since,
+		Until:     query.Until,
+		Limit:     query.PageSize,
+		Offset:    (query.Page - 1) * query.PageSize,
+	}
+
+	events, total, err := h.auditService.List(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":    events,
+		"total":     total,
+		"page":      query.Page,
+		"page_size": query.PageSize,
+	})
+}
+
+// ListWebhooks returns every webhook subscription, secrets are never included
+func (h *AdminHandler) ListWebhooks(c *gin.Context) {
+	subscriptions, err := h.webhookService.ListSubscriptions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": subscriptions})
+}
+
+// CreateWebhook adds a subscription and returns its signing secret, which is only shown once
+func (h *AdminHandler) CreateWebhook(c *gin.Context) {
+	var req validator.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription, secret, err := h.webhookService.CreateSubscription(c.Request.Context(), req.URL, req.Events, req.Secret, req.Description)
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": subscription,
+		"secret":  secret,
+	})
+}
+
+// DeleteWebhook removes a subscription and its pending deliveries
+func (h *AdminHandler) DeleteWebhook(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.DeleteSubscription(c.Request.Context(), id); err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "webhook deleted"})
+}
+
+// ListWebhookDeliveries returns the most recent deliveries of a subscription
+func (h *AdminHandler) ListWebhookDeliveries(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var query validator.ListWebhookDeliveriesQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultPageSize
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(c.Request.Context(), id, query.Limit)
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// ListWebhookAttempts returns the delivery log of one delivery
+func (h *AdminHandler) ListWebhookAttempts(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	attempts, err := h.webhookService.ListAttempts(c.Request.Context(), id)
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attempts": attempts})
+}
+
+// RetryWebhookDelivery queues a delivery again, e.g. after a subscriber outage
+func (h *AdminHandler) RetryWebhookDelivery(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.RetryDelivery(c.Request.Context(), id); err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "delivery queued"})
+}
+
+func writeWebhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrWebhookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+	case errors.Is(err, service.ErrDeliveryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+	case errors.Is(err, service.ErrUnknownWebhookEvent):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update webhooks"})
+	}
+}
+
+func writeUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, service.ErrCannotModifySelf), errors.Is(err, service.ErrUserNotPending),
+		errors.Is(err, service.ErrUserPending), errors.Is(err, service.ErrDirectoryManaged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
+	}
+}
+
+func toUserResponses(users []*domain.User) []*domain.UserResponse {
+	responses := make([]*domain.UserResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, user.ToResponse())
+	}
+	return responses
+}
@@ -6,8 +6,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/internal/middleware"
 	"github.com/login_flow/auth-service/internal/service"
 	"github.com/login_flow/auth-service/internal/util"
+	"github.com/login_flow/auth-service/pkg/crypto"
 	"github.com/login_flow/auth-service/pkg/validator"
 )
 
@@ -25,6 +28,25 @@ func NewAuthHandler(authService *service.AuthService, csrfService *service.CSRFS
 	}
 }
 
+// tokenModeResponse is the JSON body that replaces the session cookies in token mode
+func tokenModeResponse(cfg *config.Config, accessToken, refreshToken string) gin.H {
+	return gin.H{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(cfg.JWT.AccessExpiry.Seconds()),
+	}
+}
+
+// setSessionCookies sets the access, refresh and CSRF cookies of a new or refreshed session
+func setSessionCookies(c *gin.Context, csrfService *service.CSRFService, cfg *config.Config, accessToken, refreshToken string) {
+	util.SetAccessTokenCookie(c, accessToken, &cfg.Cookie, int(cfg.JWT.AccessExpiry.Seconds()))
+	util.SetRefreshTokenCookie(c, refreshToken, &cfg.Cookie, int(cfg.JWT.RefreshExpiry.Seconds()))
+
+	csrfToken := csrfService.GenerateToken()
+	util.SetCSRFTokenCookie(c, csrfToken, &cfg.Cookie, int(cfg.JWT.RefreshExpiry.Seconds()))
+}
+
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req validator.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -39,18 +61,35 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authService.Register(c.Request.Context(), req.Email, req.Password)
+	user, err := h.authService.Register(c.Request.Context(), req.Email, req.Password, req.InviteToken)
 	if err != nil {
 		if errors.Is(err, service.ErrUserAlreadyExists) {
 			c.JSON(http.StatusConflict, gin.H{"error": "user already exists"})
 			return
 		}
+		if errors.Is(err, service.ErrRegistrationClosed) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "registration is closed"})
+			return
+		}
+		if errors.Is(err, service.ErrInvitationRequired) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "registration requires an invitation"})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInvitation) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired invitation"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register user"})
 		return
 	}
 
+	message := "registration successful"
+	if user.Status == domain.UserStatusPendingApproval {
+		message = "registration successful, the account is waiting for approval"
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "registration successful",
+		"message": message,
 		"user":    user.ToResponse(),
 	})
 }
@@ -71,15 +110,30 @@ func (h *AuthHandler) Login(c *gin.Context) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "email not verified"})
 			return
 		}
+		if errors.Is(err, service.ErrUserPendingApproval) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "account pending approval"})
+			return
+		}
+		if errors.Is(err, service.ErrUserDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+			return
+		}
+		if errors.Is(err, service.ErrAuthenticationUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "authentication backend unavailable"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
 		return
 	}
 
-	util.SetAccessTokenCookie(c, accessToken, &h.cfg.Cookie, int(h.cfg.JWT.AccessExpiry.Seconds()))
-	util.SetRefreshTokenCookie(c, refreshToken, &h.cfg.Cookie, int(h.cfg.JWT.RefreshExpiry.Seconds()))
+	if util.IsTokenMode(c) {
+		response := tokenModeResponse(h.cfg, accessToken, refreshToken)
+		response["user"] = user.ToResponse()
+		c.JSON(http.StatusOK, response)
+		return
+	}
 
-	csrfToken := h.csrfService.GenerateToken()
-	util.SetCSRFTokenCookie(c, csrfToken, &h.cfg.Cookie, int(h.cfg.JWT.RefreshExpiry.Seconds()))
+	setSessionCookies(c, h.csrfService, h.cfg, accessToken, refreshToken)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "login successful",
@@ -87,9 +141,148 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	})
 }
 
-func (h *AuthHandler) Refresh(c *gin.Context) {
-	refreshToken, err := util.GetCookie(c, util.RefreshTokenCookie)
+// RequestMagicLink emails a login link and binds it to this browser with a nonce cookie.
+// The response is the same whether or not the account exists.
+func (h *AuthHandler) RequestMagicLink(c *gin.Context) {
+	var req validator.MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nonce, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to request magic link"})
+		return
+	}
+
+	if err := h.authService.RequestMagicLink(c.Request.Context(), req.Email, nonce); err != nil {
+		if errors.Is(err, service.ErrMagicLinkDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "magic link login is disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to request magic link"})
+		return
+	}
+
+	util.SetMagicLinkCookie(c, nonce, &h.cfg.Cookie, int(h.cfg.Account.MagicLinkExpiry.Seconds()))
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "if an account exists for this email, a login link has been sent",
+	})
+}
+
+// ConsumeMagicLink logs in with the token from a magic link email. It sets the same
+// session cookies as Login and only works in the browser that requested the link.
+func (h *AuthHandler) ConsumeMagicLink(c *gin.Context) {
+	var req validator.ConsumeMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nonce, _ := util.GetCookie(c, util.MagicLinkCookie)
+	accessToken, refreshToken, user, err := h.authService.LoginWithMagicLink(c.Request.Context(), req.Token, nonce)
 	if err != nil {
+		if errors.Is(err, service.ErrMagicLinkDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "magic link login is disabled"})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired link"})
+			return
+		}
+		if errors.Is(err, service.ErrMagicLinkWrongBrowser) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "open the link in the browser you requested it from"})
+			return
+		}
+		if errors.Is(err, service.ErrUserDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+
+	util.ClearMagicLinkCookie(c, &h.cfg.Cookie)
+	setSessionCookies(c, h.csrfService, h.cfg, accessToken, refreshToken)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "login successful",
+		"user":    user.ToResponse(),
+	})
+}
+
+// RequestLoginCode emails a one-time login code. The response is the same whether or not the account exists.
+func (h *AuthHandler) RequestLoginCode(c *gin.Context) {
+	var req validator.LoginCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.RequestLoginCode(c.Request.Context(), req.Email); err != nil {
+		if errors.Is(err, service.ErrOTPDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "one-time code login is disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to request login code"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "if an account exists for this email, a login code has been sent",
+	})
+}
+
+// VerifyLoginCode exchanges an emailed one-time code for a session, like Login
+func (h *AuthHandler) VerifyLoginCode(c *gin.Context) {
+	var req validator.VerifyLoginCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	accessToken, refreshToken, user, err := h.authService.LoginWithCode(c.Request.Context(), req.Email, req.Code)
+	if err != nil {
+		if errors.Is(err, service.ErrOTPDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "one-time code login is disabled"})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired code"})
+			return
+		}
+		if errors.Is(err, service.ErrTooManyCodeAttempts) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many attempts, request a new code"})
+			return
+		}
+		if errors.Is(err, service.ErrUserDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+
+	if util.IsTokenMode(c) {
+		response := tokenModeResponse(h.cfg, accessToken, refreshToken)
+		response["user"] = user.ToResponse()
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	setSessionCookies(c, h.csrfService, h.cfg, accessToken, refreshToken)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "login successful",
+		"user":    user.ToResponse(),
+	})
+}
+
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	refreshToken, ok := h.readRefreshToken(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no refresh token"})
 		return
 	}
@@ -100,11 +293,12 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 		return
 	}
 
-	util.SetAccessTokenCookie(c, newAccessToken, &h.cfg.Cookie, int(h.cfg.JWT.AccessExpiry.Seconds()))
-	util.SetRefreshTokenCookie(c, newRefreshToken, &h.cfg.Cookie, int(h.cfg.JWT.RefreshExpiry.Seconds()))
+	if util.IsTokenMode(c) {
+		c.JSON(http.StatusOK, tokenModeResponse(h.cfg, newAccessToken, newRefreshToken))
+		return
+	}
 
-	csrfToken := h.csrfService.GenerateToken()
-	util.SetCSRFTokenCookie(c, csrfToken, &h.cfg.Cookie, int(h.cfg.JWT.RefreshExpiry.Seconds()))
+	setSessionCookies(c, h.csrfService, h.cfg, newAccessToken, newRefreshToken)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "token refreshed successfully",
@@ -112,9 +306,13 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 }
 
 func (h *AuthHandler) Logout(c *gin.Context) {
-	refreshToken, err := util.GetCookie(c, util.RefreshTokenCookie)
-	if err != nil {
-		util.ClearAuthCookies(c, &h.cfg.Cookie)
+	tokenMode := util.IsTokenMode(c)
+
+	refreshToken, ok := h.readRefreshToken(c)
+	if !ok {
+		if !tokenMode {
+			util.ClearAuthCookies(c, &h.cfg.Cookie)
+		}
 		c.JSON(http.StatusOK, gin.H{"message": "logged out"})
 		return
 	}
@@ -124,7 +322,121 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		return
 	}
 
-	util.ClearAuthCookies(c, &h.cfg.Cookie)
+	if !tokenMode {
+		util.ClearAuthCookies(c, &h.cfg.Cookie)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
 }
+
+// Impersonate lets an admin act as a user. The short-lived access token replaces the
+// access cookie (or is returned in token mode); the admin's refresh token is kept, so
+// StopImpersonation, or the first refresh after the token expired, restores their session.
+func (h *AuthHandler) Impersonate(c *gin.Context) {
+	adminID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req validator.ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	accessToken, expiresAt, err := h.authService.Impersonate(c.Request.Context(), adminID, userID, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case errors.Is(err, service.ErrUserDisabled):
+			c.JSON(http.StatusConflict, gin.H{"error": "only active accounts can be impersonated"})
+		case errors.Is(err, service.ErrImpersonationNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to impersonate user"})
+		}
+		return
+	}
+
+	if util.IsTokenMode(c) {
+		c.JSON(http.StatusOK, gin.H{
+			"access_token": accessToken,
+			"token_type":   "Bearer",
+			"expires_in":   int(h.cfg.Admin.ImpersonationExpiry.Seconds()),
+			"expires_at":   expiresAt,
+		})
+		return
+	}
+
+	util.SetAccessTokenCookie(c, accessToken, &h.cfg.Cookie, int(h.cfg.Admin.ImpersonationExpiry.Seconds()))
+	c.JSON(http.StatusOK, gin.H{"message": "impersonating user", "expires_at": expiresAt})
+}
+
+// StopImpersonation ends an impersonation and gives the admin their own session back.
+// Without a usable refresh token of the admin the cookies are cleared instead.
+func (h *AuthHandler) StopImpersonation(c *gin.Context) {
+	claims, ok := middleware.GetImpersonation(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not impersonating a user"})
+		return
+	}
+
+	if err := h.authService.StopImpersonation(c.Request.Context(), claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stop impersonating"})
+		return
+	}
+
+	tokenMode := util.IsTokenMode(c)
+	var refreshToken string
+	if tokenMode {
+		var req validator.StopImpersonationRequest
+		_ = c.ShouldBindJSON(&req) // The body is optional
+		refreshToken = req.RefreshToken
+	} else {
+		refreshToken, _ = util.GetCookie(c, util.RefreshTokenCookie)
+	}
+
+	if refreshToken != "" {
+		accessToken, newRefreshToken, err := h.authService.ResumeSession(c.Request.Context(), claims.Act.UserID, refreshToken)
+		if err == nil {
+			if tokenMode {
+				c.JSON(http.StatusOK, tokenModeResponse(h.cfg, accessToken, newRefreshToken))
+				return
+			}
+			setSessionCookies(c, h.csrfService, h.cfg, accessToken, newRefreshToken)
+			c.JSON(http.StatusOK, gin.H{"message": "impersonation stopped"})
+			return
+		}
+	}
+
+	if !tokenMode {
+		util.ClearAuthCookies(c, &h.cfg.Cookie)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "impersonation stopped, log in again"})
+}
+
+// readRefreshToken reads the refresh token from the JSON body in token mode, and
+// from the cookie otherwise. Token mode never falls back to the cookie, that's what
+// makes skipping the CSRF check safe.
+func (h *AuthHandler) readRefreshToken(c *gin.Context) (string, bool) {
+	if util.IsTokenMode(c) {
+		var req validator.RefreshTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return "", false
+		}
+		return req.RefreshToken, true
+	}
+
+	refreshToken, err := util.GetCookie(c, util.RefreshTokenCookie)
+	if err != nil {
+		return "", false
+	}
+	return refreshToken, true
+}
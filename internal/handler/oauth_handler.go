@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/middleware"
+	"github.com/login_flow/auth-service/internal/service"
+	"github.com/login_flow/auth-service/internal/util"
+)
+
+// OAuthHandler serves "Sign in with ..." logins. These endpoints are browser
+// navigations, not API calls, so they answer with redirects to the frontend.
+type OAuthHandler struct {
+	socialService *service.SocialAuthService
+	csrfService   *service.CSRFService
+	cfg           *config.Config
+}
+
+func NewOAuthHandler(socialService *service.SocialAuthService, csrfService *service.CSRFService, cfg *config.Config) *OAuthHandler {
+	return &OAuthHandler{
+		socialService: socialService,
+		csrfService:   csrfService,
+		cfg:           cfg,
+	}
+}
+
+// Providers lists the configured providers so the frontend can show its buttons
+func (h *OAuthHandler) Providers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.socialService.Providers()})
+}
+
+// Start redirects to the provider's sign-in page
+func (h *OAuthHandler) Start(c *gin.Context) {
+	authURL, state, err := h.socialService.Start(c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownProvider) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown provider"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	value, err := json.Marshal(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	util.SetOAuthStateCookie(c, base64.RawURLEncoding.EncodeToString(value), &h.cfg.Cookie, int(h.cfg.OAuth.StateExpiry.Seconds()))
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback finishes the login, sets the session cookies like Login and
+// redirects to the frontend, with ?error= on failure
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	provider := c.Param("provider")
+	util.ClearOAuthStateCookie(c, &h.cfg.Cookie)
+
+	if providerError := c.Query("error"); providerError != "" {
+		h.redirectWithError(c, "oauth_cancelled")
+		return
+	}
+
+	accessToken, refreshToken, _, err := h.socialService.Complete(c.Request.Context(), readOAuthState(c), provider, c.Query("code"), c.Query("state"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrProviderEmailNotVerified):
+			h.redirectWithError(c, "email_not_verified")
+		case errors.Is(err, service.ErrIdentityConflict):
+			h.redirectWithError(c, "account_exists")
+		case errors.Is(err, service.ErrUserDisabled):
+			h.redirectWithError(c, "account_disabled")
+		case errors.Is(err, service.ErrUserPendingApproval):
+			h.redirectWithError(c, "pending_approval")
+		case errors.Is(err, service.ErrRegistrationClosed):
+			h.redirectWithError(c, "registration_closed")
+		default:
+			log.Printf("oauth login with %s failed: %v", provider, err)
+			h.redirectWithError(c, "oauth_failed")
+		}
+		return
+	}
+
+	setSessionCookies(c, h.csrfService, h.cfg, accessToken, refreshToken)
+	c.Redirect(http.StatusFound, h.cfg.Server.AppURL+"/")
+}
+
+// ListIdentities returns the external logins linked to the current user
+func (h *OAuthHandler) ListIdentities(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	identities, err := h.socialService.ListIdentities(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list identities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+func (h *OAuthHandler) redirectWithError(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, h.cfg.Server.AppURL+"/login?error="+url.QueryEscape(code))
+}
+
+// readOAuthState decodes the state cookie set by Start, nil if missing or malformed
+func readOAuthState(c *gin.Context) *service.OAuthState {
+	value, err := util.GetCookie(c, util.OAuthStateCookie)
+	if err != nil {
+		return nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+	var state service.OAuthState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil
+	}
+	return &state
+}
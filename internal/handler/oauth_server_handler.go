@@ -0,0 +1,454 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/internal/service"
+	"github.com/login_flow/auth-service/internal/util"
+	"github.com/login_flow/auth-service/pkg/validator"
+)
+
+// consentPage is shown by /oauth/authorize. It posts the authorization request
+// back together with the user's decision.
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Authorize {{.Client.Name}}</title>
+</head>
+<body>
+<h1>{{.Client.Name}} wants to access your account</h1>
+<p>Signed in as {{.Email}}. {{.Client.Name}} is asking for:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+{{range $name, $values := .Params}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+{{end}}{{end}}<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// OAuthServerHandler serves the authorization server endpoints used by other apps,
+// and the admin endpoints to register them as clients
+type OAuthServerHandler struct {
+	oauthServerService *service.OAuthServerService
+	authService        *service.AuthService
+	csrfService        *service.CSRFService
+	cfg                *config.Config
+}
+
+func NewOAuthServerHandler(oauthServerService *service.OAuthServerService, authService *service.AuthService, csrfService *service.CSRFService, cfg *config.Config) *OAuthServerHandler {
+	return &OAuthServerHandler{
+		oauthServerService: oauthServerService,
+		authService:        authService,
+		csrfService:        csrfService,
+		cfg:                cfg,
+	}
+}
+
+// Authorize is the authorization endpoint. GET shows the consent page (or redirects
+// straight back when the user already consented), POST handles the user's decision.
+// Users without a session are sent to the frontend login page, which returns them here.
+func (h *OAuthServerHandler) Authorize(c *gin.Context) {
+	var req domain.AuthorizationRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.String(http.StatusBadRequest, "invalid authorization request")
+		return
+	}
+
+	// Until the redirect URI is known to be registered, errors can't be sent to it
+	client, err := h.oauthServerService.ResolveClient(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrClientNotFound) {
+			c.String(http.StatusBadRequest, "unknown client")
+			return
+		}
+		c.String(http.StatusBadRequest, "redirect_uri is not registered for this client")
+		return
+	}
+
+	scopes, err := h.oauthServerService.ValidateRequest(client, &req)
+	if err != nil {
+		h.redirectWithOAuthError(c, &req, err)
+		return
+	}
+
+	user, authTime := h.currentUser(c)
+	if user == nil {
+		returnTo := h.cfg.AuthServer.Issuer + "/oauth/authorize?" + c.Request.URL.RawQuery
+		c.Redirect(http.StatusFound, h.cfg.Server.AppURL+"/login?return_to="+url.QueryEscape(returnTo))
+		return
+	}
+
+	// The page is never framed, so the user can't be tricked into clicking Allow
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+
+	if c.Request.Method == http.MethodGet {
+		if !h.oauthServerService.HasConsent(c.Request.Context(), user.ID, client.ClientID, scopes) {
+			h.showConsent(c, client, user, scopes, &req)
+			return
+		}
+	} else {
+		if !h.validConsentCSRF(c) {
+			c.String(http.StatusForbidden, "invalid or missing CSRF token")
+			return
+		}
+		if c.PostForm("decision") != "allow" {
+			c.Redirect(http.StatusFound, h.oauthServerService.ErrorRedirect(&req, &service.OAuthError{
+				Code:        "access_denied",
+				Description: "the user denied the request",
+			}))
+			return
+		}
+	}
+
+	redirect, err := h.oauthServerService.Authorize(c.Request.Context(), user.ID, authTime, client, &req, scopes)
+	if err != nil {
+		log.Printf("oauth authorize for client %s failed: %v", client.ClientID, err)
+		c.Redirect(http.StatusFound, h.oauthServerService.ErrorRedirect(&req, &service.OAuthError{
+			Code:        "server_error",
+			Description: "authorization failed",
+		}))
+		return
+	}
+
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// Token is the token endpoint. Clients authenticate with HTTP Basic or with
+// client_id and client_secret in the form body.
+func (h *OAuthServerHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req domain.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		writeOAuthError(c, &service.OAuthError{Code: "invalid_request", Description: "malformed token request"})
+		return
+	}
+	if clientID, secret, ok := basicClientCredentials(c); ok {
+		req.ClientID, req.ClientSecret = clientID, secret
+	}
+
+	response, err := h.oauthServerService.Token(c.Request.Context(), &req)
+	if err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Introspect is the token introspection endpoint (RFC 7662) for resource servers.
+// Callers authenticate like at the token endpoint.
+func (h *OAuthServerHandler) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	req, ok := bindTokenHintRequest(c)
+	if !ok {
+		return
+	}
+
+	response, err := h.oauthServerService.Introspect(c.Request.Context(), req)
+	if err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Revoke is the token revocation endpoint (RFC 7009). It answers 200 for unknown
+// tokens too, as the RFC requires.
+func (h *OAuthServerHandler) Revoke(c *gin.Context) {
+	req, ok := bindTokenHintRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := h.oauthServerService.Revoke(c.Request.Context(), req); err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// bindTokenHintRequest reads an introspection or revocation request, writing the error response if invalid
+func bindTokenHintRequest(c *gin.Context) (*domain.TokenHintRequest, bool) {
+	var req domain.TokenHintRequest
+	if err := c.ShouldBind(&req); err != nil || req.Token == "" {
+		writeOAuthError(c, &service.OAuthError{Code: "invalid_request", Description: "token is required"})
+		return nil, false
+	}
+	if clientID, secret, ok := basicClientCredentials(c); ok {
+		req.ClientID, req.ClientSecret = clientID, secret
+	}
+	return &req, true
+}
+
+// basicClientCredentials reads client credentials from HTTP Basic authentication.
+// RFC 6749 section 2.3.1: they are form-encoded before being put in the header.
+func basicClientCredentials(c *gin.Context) (string, string, bool) {
+	clientID, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		return "", "", false
+	}
+	if id, err := url.QueryUnescape(clientID); err == nil {
+		clientID = id
+	}
+	if s, err := url.QueryUnescape(secret); err == nil {
+		secret = s
+	}
+	return clientID, secret, true
+}
+
+// UserInfo is the OpenID Connect userinfo endpoint, authenticated with a client's access token
+func (h *OAuthServerHandler) UserInfo(c *gin.Context) {
+	accessToken, ok := util.GetBearerToken(c)
+	if !ok {
+		// Form-encoded POST bodies may carry the token instead (RFC 6750 section 2.2)
+		accessToken = c.PostForm("access_token")
+	}
+	if accessToken == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="userinfo"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_request", "error_description": "access token required"})
+		return
+	}
+
+	info, err := h.oauthServerService.UserInfo(c.Request.Context(), accessToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInsufficientScope) {
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope", "error_description": err.Error()})
+			return
+		}
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_token", "error_description": "invalid or expired access token"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, info)
+}
+
+// Discovery serves the OpenID Connect discovery document
+func (h *OAuthServerHandler) Discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oauthServerService.Discovery())
+}
+
+// JWKS serves the public keys that verify ID tokens
+func (h *OAuthServerHandler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oauthServerService.JWKS())
+}
+
+// ListClients returns every registered client, secrets are never included
+func (h *OAuthServerHandler) ListClients(c *gin.Context) {
+	clients, err := h.oauthServerService.ListClients(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list oauth clients"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clients": clients})
+}
+
+// CreateClient registers a client and returns its secret, which is only shown once
+func (h *OAuthServerHandler) CreateClient(c *gin.Context) {
+	var req validator.CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, secret, err := h.oauthServerService.RegisterClient(c.Request.Context(), req.Name, req.Type, req.RedirectURIs, req.Scopes)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidClientType) || errors.Is(err, service.ErrInvalidRedirectURI) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create oauth client"})
+		return
+	}
+
+	response := gin.H{"client": client}
+	if secret != "" {
+		response["client_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// DeleteClient removes a client and revokes its tokens
+func (h *OAuthServerHandler) DeleteClient(c *gin.Context) {
+	if err := h.oauthServerService.DeleteClient(c.Request.Context(), c.Param("client_id")); err != nil {
+		if errors.Is(err, service.ErrClientNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "oauth client not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete oauth client"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "oauth client deleted"})
+}
+
+// ListServiceAccounts returns every service account, secrets are never included
+func (h *OAuthServerHandler) ListServiceAccounts(c *gin.Context) {
+	accounts, err := h.oauthServerService.ListServiceAccounts(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list service accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"service_accounts": accounts})
+}
+
+// CreateServiceAccount adds a service account and returns its secret, which is only shown once
+func (h *OAuthServerHandler) CreateServiceAccount(c *gin.Context) {
+	var req validator.CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, secret, err := h.oauthServerService.CreateServiceAccount(c.Request.Context(), req.Name, req.Description, req.Scopes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create service account"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"service_account": account,
+		"client_secret":   secret,
+	})
+}
+
+// DeleteServiceAccount removes a service account, its current tokens expire on their own
+func (h *OAuthServerHandler) DeleteServiceAccount(c *gin.Context) {
+	if err := h.oauthServerService.DeleteServiceAccount(c.Request.Context(), c.Param("client_id")); err != nil {
+		if errors.Is(err, service.ErrServiceAccountNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "service account not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete service account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "service account deleted"})
+}
+
+// currentUser returns the user signed in to this service and when they logged in,
+// nil without a valid session
+func (h *OAuthServerHandler) currentUser(c *gin.Context) (*domain.User, time.Time) {
+	accessToken, err := util.GetCookie(c, util.AccessTokenCookie)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	claims, err := h.authService.ValidateAccessToken(c.Request.Context(), accessToken)
+	// An impersonating admin must not consent to apps on the user's behalf
+	if err != nil || claims.Act != nil {
+		return nil, time.Time{}
+	}
+	user, err := h.authService.GetUserByID(c.Request.Context(), claims.UserID)
+	if err != nil || !user.IsActive() {
+		return nil, time.Time{}
+	}
+
+	// Tokens from before auth_time was added only know when they were issued
+	authTime := time.Now()
+	if claims.AuthTime != nil {
+		authTime = claims.AuthTime.Time
+	} else if claims.IssuedAt != nil {
+		authTime = claims.IssuedAt.Time
+	}
+	return user, authTime
+}
+
+func (h *OAuthServerHandler) showConsent(c *gin.Context, client *domain.OAuthClient, user *domain.User, scopes []string, req *domain.AuthorizationRequest) {
+	csrfToken, err := util.GetCookie(c, util.CSRFTokenCookie)
+	if err != nil || !h.csrfService.ValidateToken(csrfToken) {
+		csrfToken = h.csrfService.GenerateToken()
+		util.SetCSRFTokenCookie(c, csrfToken, &h.cfg.Cookie, int(h.cfg.JWT.RefreshExpiry.Seconds()))
+	}
+
+	params := url.Values{
+		"response_type":         {req.ResponseType},
+		"client_id":             {req.ClientID},
+		"redirect_uri":          {req.RedirectURI},
+		"scope":                 {req.Scope},
+		"code_challenge":        {req.CodeChallenge},
+		"code_challenge_method": {req.CodeChallengeMethod},
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	if req.Nonce != "" {
+		params.Set("nonce", req.Nonce)
+	}
+
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := consentPage.Execute(c.Writer, gin.H{
+		"Client":    client,
+		"Email":     user.Email,
+		"Scopes":    scopes,
+		"CSRFToken": csrfToken,
+		"Params":    params,
+	}); err != nil {
+		log.Printf("failed to render consent page: %v", err)
+	}
+}
+
+// validConsentCSRF checks the consent form's csrf_token against the cookie (double submit)
+func (h *OAuthServerHandler) validConsentCSRF(c *gin.Context) bool {
+	cookie, err := util.GetCookie(c, util.CSRFTokenCookie)
+	if err != nil {
+		return false
+	}
+	form := c.PostForm("csrf_token")
+	return form != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(form)) == 1
+}
+
+func (h *OAuthServerHandler) redirectWithOAuthError(c *gin.Context, req *domain.AuthorizationRequest, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		oauthErr = &service.OAuthError{Code: "server_error", Description: "authorization failed"}
+	}
+	c.Redirect(http.StatusFound, h.oauthServerService.ErrorRedirect(req, oauthErr))
+}
+
+// writeOAuthError writes a token endpoint error response (RFC 6749 section 5.2)
+func writeOAuthError(c *gin.Context, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		log.Printf("oauth token request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.JSON(status, gin.H{
+		"error":             oauthErr.Code,
+		"error_description": oauthErr.Description,
+	})
+}
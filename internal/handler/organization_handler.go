@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/middleware"
+	"github.com/login_flow/auth-service/internal/service"
+	"github.com/login_flow/auth-service/internal/util"
+	"github.com/login_flow/auth-service/pkg/validator"
+)
+
+// OrganizationHandler lets users create organizations and switch their session between them
+type OrganizationHandler struct {
+	orgService  *service.OrganizationService
+	authService *service.AuthService
+	csrfService *service.CSRFService
+	cfg         *config.Config
+}
+
+func NewOrganizationHandler(orgService *service.OrganizationService, authService *service.AuthService, csrfService *service.CSRFService, cfg *config.Config) *OrganizationHandler {
+	return &OrganizationHandler{
+		orgService:  orgService,
+		authService: authService,
+		csrfService: csrfService,
+		cfg:         cfg,
+	}
+}
+
+// List returns the current user's organizations and which one is active
+func (h *OrganizationHandler) List(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	orgs, err := h.orgService.ListForUser(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list organizations"})
+		return
+	}
+
+	response := gin.H{"organizations": orgs}
+	if orgID, ok := middleware.GetOrgID(c); ok {
+		response["active_org_id"] = orgID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Create adds an organization with the current user as its owner
+func (h *OrganizationHandler) Create(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req validator.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validator.ValidateSlug(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slug must be lowercase letters, digits and single hyphens"})
+		return
+	}
+
+	org, err := h.orgService.Create(c.Request.Context(), userID, req.Name, req.Slug)
+	if err != nil {
+		if errors.Is(err, service.ErrOrganizationSlugTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "organization slug already in use"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create organization"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"organization": org})
+}
+
+// Switch re-issues the session's tokens with another active organization (org_id 0
+// leaves it). Like Refresh, the refresh token comes from the cookie, or from the body
+// in token mode.
+func (h *OrganizationHandler) Switch(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req validator.SwitchOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	refreshToken := req.RefreshToken
+	if !util.IsTokenMode(c) {
+		refreshToken, _ = util.GetCookie(c, util.RefreshTokenCookie)
+	}
+	if refreshToken == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no refresh token"})
+		return
+	}
+
+	accessToken, newRefreshToken, err := h.authService.SwitchOrganization(c.Request.Context(), userID, refreshToken, req.OrgID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotOrgMember) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not a member of this organization"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	if util.IsTokenMode(c) {
+		c.JSON(http.StatusOK, tokenModeResponse(h.cfg, accessToken, newRefreshToken))
+		return
+	}
+
+	setSessionCookies(c, h.csrfService, h.cfg, accessToken, newRefreshToken)
+	c.JSON(http.StatusOK, gin.H{"message": "organization switched"})
+}
+
+// AcceptInvitation adds the current user to an organization with the token from an invitation email
+func (h *OrganizationHandler) AcceptInvitation(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req validator.AcceptOrgInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, err := h.orgService.AcceptInvitation(c.Request.Context(), userID, req.Token)
+	if err != nil {
+		writeOrgError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"organization": org})
+}
+
+// ListMembers returns the members of the organization with their roles
+func (h *OrganizationHandler) ListMembers(c *gin.Context) {
+	membership, _ := middleware.GetOrgMembership(c)
+
+	members, err := h.orgService.ListMembers(c.Request.Context(), membership.OrgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list members"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// InviteMember emails an invitation to join the organization
+func (h *OrganizationHandler) InviteMember(c *gin.Context) {
+	membership, _ := middleware.GetOrgMembership(c)
+
+	var req validator.InviteOrgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := h.orgService.InviteMember(c.Request.Context(), membership, req.Email, req.Role)
+	if err != nil {
+		writeOrgError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"invitation": invitation})
+}
+
+// ChangeMemberRole sets the organization role of a member
+func (h *OrganizationHandler) ChangeMemberRole(c *gin.Context) {
+	membership, _ := middleware.GetOrgMembership(c)
+	userID, ok := parseIDParam(c, "user_id")
+	if !ok {
+		return
+	}
+
+	var req validator.ChangeOrgMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.orgService.ChangeMemberRole(c.Request.Context(), membership, userID, req.Role); err != nil {
+		writeOrgError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "member role changed"})
+}
+
+// RemoveMember takes a member out of the organization and revokes their sessions in it
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	membership, _ := middleware.GetOrgMembership(c)
+	userID, ok := parseIDParam(c, "user_id")
+	if !ok {
+		return
+	}
+
+	if err := h.orgService.RemoveMember(c.Request.Context(), membership, userID); err != nil {
+		writeOrgError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "member removed"})
+}
+
+// TransferOwnership makes another member the owner of the organization
+func (h *OrganizationHandler) TransferOwnership(c *gin.Context) {
+	membership, _ := middleware.GetOrgMembership(c)
+
+	var req validator.TransferOwnershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.orgService.TransferOwnership(c.Request.Context(), membership, req.UserID); err != nil {
+		writeOrgError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "ownership transferred"})
+}
+
+func writeOrgError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrMemberNotFound), errors.Is(err, service.ErrOrganizationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrOrgRoleNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAlreadyMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidOrgInvitation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update organization"})
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/service"
+	"github.com/login_flow/auth-service/internal/util"
+	"github.com/login_flow/auth-service/pkg/validator"
+)
+
+// SAMLHandler serves SAML single sign-on. Like OAuthHandler, the login endpoints are
+// browser navigations and answer with redirects to the frontend.
+type SAMLHandler struct {
+	samlService *service.SAMLService
+	csrfService *service.CSRFService
+	cfg         *config.Config
+}
+
+func NewSAMLHandler(samlService *service.SAMLService, csrfService *service.CSRFService, cfg *config.Config) *SAMLHandler {
+	return &SAMLHandler{
+		samlService: samlService,
+		csrfService: csrfService,
+		cfg:         cfg,
+	}
+}
+
+// Metadata serves the SP metadata the identity provider imports
+func (h *SAMLHandler) Metadata(c *gin.Context) {
+	metadata, err := h.samlService.Metadata(c.Request.Context(), c.Param("connection"))
+	if err != nil {
+		if errors.Is(err, service.ErrSAMLConnectionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown saml connection"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build saml metadata"})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// Start redirects to the identity provider with an AuthnRequest
+func (h *SAMLHandler) Start(c *gin.Context) {
+	redirectURL, state, err := h.samlService.Start(c.Request.Context(), c.Param("connection"))
+	if err != nil {
+		if errors.Is(err, service.ErrSAMLConnectionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown saml connection"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	value, err := json.Marshal(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	util.SetSAMLRequestCookie(c, base64.RawURLEncoding.EncodeToString(value), &h.cfg.Cookie, int(h.cfg.SAML.RequestExpiry.Seconds()))
+
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// ACS (assertion consumer service) receives the identity provider's response, sets the
+// session cookies like Login and redirects to the frontend, with ?error= on failure
+func (h *SAMLHandler) ACS(c *gin.Context) {
+	connection := c.Param("connection")
+	state := readSAMLState(c)
+	util.ClearSAMLRequestCookie(c, &h.cfg.Cookie)
+
+	accessToken, refreshToken, _, err := h.samlService.Complete(c.Request.Context(), state, connection, c.PostForm("SAMLResponse"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSAMLConnectionNotFound):
+			h.redirectWithError(c, "unknown_connection")
+		case errors.Is(err, service.ErrInvalidSAMLState):
+			h.redirectWithError(c, "saml_expired")
+		case errors.Is(err, service.ErrSAMLEmailMissing), errors.Is(err, service.ErrSAMLDomainNotAllowed):
+			h.redirectWithError(c, "email_not_allowed")
+		case errors.Is(err, service.ErrIdentityConflict):
+			h.redirectWithError(c, "account_exists")
+		case errors.Is(err, service.ErrUserDisabled):
+			h.redirectWithError(c, "account_disabled")
+		case errors.Is(err, service.ErrUserPendingApproval):
+			h.redirectWithError(c, "pending_approval")
+		default:
+			log.Printf("saml login with %s failed: %v", connection, err)
+			h.redirectWithError(c, "saml_failed")
+		}
+		return
+	}
+
+	setSessionCookies(c, h.csrfService, h.cfg, accessToken, refreshToken)
+	c.Redirect(http.StatusFound, h.cfg.Server.AppURL+"/")
+}
+
+// ListConnections returns the configured identity providers, without their metadata
+func (h *SAMLHandler) ListConnections(c *gin.Context) {
+	conns, err := h.samlService.ListConnections(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list saml connections"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"connections": conns})
+}
+
+// CreateConnection imports an identity provider from its metadata
+func (h *SAMLHandler) CreateConnection(c *gin.Context) {
+	var req validator.CreateSAMLConnectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validator.ValidateSlug(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slug must be lowercase letters, digits and single hyphens"})
+		return
+	}
+
+	conn, err := h.samlService.CreateConnection(c.Request.Context(), req.Name, req.Slug, req.MetadataXML, req.MetadataURL, req.EmailAttribute, req.Domains, req.OrgID)
+	if err != nil {
+		h.writeConnectionError(c, err, "failed to create saml connection")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"connection": conn})
+}
+
+// UpdateMetadata re-imports the metadata of an identity provider
+func (h *SAMLHandler) UpdateMetadata(c *gin.Context) {
+	var req validator.UpdateSAMLMetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := h.samlService.UpdateMetadata(c.Request.Context(), c.Param("connection"), req.MetadataXML, req.MetadataURL)
+	if err != nil {
+		h.writeConnectionError(c, err, "failed to update saml metadata")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"connection": conn})
+}
+
+func (h *SAMLHandler) DeleteConnection(c *gin.Context) {
+	if err := h.samlService.DeleteConnection(c.Request.Context(), c.Param("connection")); err != nil {
+		h.writeConnectionError(c, err, "failed to delete saml connection")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "saml connection deleted"})
+}
+
+func (h *SAMLHandler) writeConnectionError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrSAMLConnectionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "saml connection not found"})
+	case errors.Is(err, service.ErrSAMLConnectionSlugTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "saml connection slug already in use"})
+	case errors.Is(err, service.ErrOrganizationNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "organization not found"})
+	case errors.Is(err, service.ErrInvalidSAMLMetadata):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+func (h *SAMLHandler) redirectWithError(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, h.cfg.Server.AppURL+"/login?error="+url.QueryEscape(code))
+}
+
+// readSAMLState decodes the request cookie set by Start, nil if missing or malformed
+func readSAMLState(c *gin.Context) *service.SAMLState {
+	value, err := util.GetCookie(c, util.SAMLRequestCookie)
+	if err != nil {
+		return nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+	var state service.SAMLState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil
+	}
+	return &state
+}
@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/middleware"
+	"github.com/login_flow/auth-service/internal/service"
+	"github.com/login_flow/auth-service/pkg/scim"
+	"github.com/login_flow/auth-service/pkg/validator"
+)
+
+// SCIMHandler serves the SCIM 2.0 API identity providers provision users with, under
+// /scim/v2, and the admin endpoints for SCIM tokens. SCIM responses use the SCIM
+// content type and error format.
+type SCIMHandler struct {
+	scimService *service.SCIMService
+	cfg         *config.Config
+}
+
+func NewSCIMHandler(scimService *service.SCIMService, cfg *config.Config) *SCIMHandler {
+	return &SCIMHandler{scimService: scimService, cfg: cfg}
+}
+
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	h.respond(c, http.StatusOK, scim.ServiceProviderConfig(h.cfg.SCIM.MaxResults))
+}
+
+// ListUsers returns a page of the organization's users (filter, startIndex, count)
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+	startIndex, count := h.page(c)
+
+	list, err := h.scimService.ListUsers(c.Request.Context(), token, c.Query("filter"), startIndex, count)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, list)
+}
+
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+
+	user, err := h.scimService.GetUser(c.Request.Context(), token, c.Param("id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+	var resource scim.User
+	if !h.bind(c, &resource) {
+		return
+	}
+
+	user, err := h.scimService.CreateUser(c.Request.Context(), token, &resource)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Header("Location", user.Meta.Location)
+	h.respond(c, http.StatusCreated, user)
+}
+
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+	var resource scim.User
+	if !h.bind(c, &resource) {
+		return
+	}
+
+	user, err := h.scimService.ReplaceUser(c.Request.Context(), token, c.Param("id"), &resource)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+	var req scim.PatchRequest
+	if !h.bind(c, &req) {
+		return
+	}
+
+	user, err := h.scimService.PatchUser(c.Request.Context(), token, c.Param("id"), req.Operations)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+
+	if err := h.scimService.DeleteUser(c.Request.Context(), token, c.Param("id")); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups returns a page of the groups (filter, startIndex, count, excludedAttributes=members)
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+	startIndex, count := h.page(c)
+
+	list, err := h.scimService.ListGroups(c.Request.Context(), token, c.Query("filter"), startIndex, count, h.withMembers(c))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, list)
+}
+
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+
+	group, err := h.scimService.GetGroup(c.Request.Context(), token, c.Param("id"), h.withMembers(c))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+	var resource scim.Group
+	if !h.bind(c, &resource) {
+		return
+	}
+
+	group, err := h.scimService.CreateGroup(c.Request.Context(), token, &resource)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Header("Location", group.Meta.Location)
+	h.respond(c, http.StatusCreated, group)
+}
+
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+	var resource scim.Group
+	if !h.bind(c, &resource) {
+		return
+	}
+
+	group, err := h.scimService.ReplaceGroup(c.Request.Context(), token, c.Param("id"), &resource)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+	var req scim.PatchRequest
+	if !h.bind(c, &req) {
+		return
+	}
+
+	group, err := h.scimService.PatchGroup(c.Request.Context(), token, c.Param("id"), req.Operations)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) DeleteGroup(c *gin.Context) {
+	token, _ := middleware.GetSCIMToken(c)
+
+	if err := h.scimService.DeleteGroup(c.Request.Context(), token, c.Param("id")); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListTokens returns the SCIM tokens of all organizations, never the token values
+func (h *SCIMHandler) ListTokens(c *gin.Context) {
+	tokens, err := h.scimService.ListTokens(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list scim tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// CreateToken issues a token for an organization and returns its value, which is only shown once
+func (h *SCIMHandler) CreateToken(c *gin.Context) {
+	var req validator.CreateSCIMTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scimToken, token, err := h.scimService.CreateToken(c.Request.Context(), req.OrgID, req.Description, req.Domains, req.Roles)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrOrganizationNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "organization not found"})
+		case errors.Is(err, service.ErrRoleNotFound), errors.Is(err, service.ErrSCIMRoleNotAllowed):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create scim token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":    scimToken,
+		"value":    token,
+		"base_url": h.cfg.SCIM.BaseURL + "/scim/v2",
+		"message":  "copy the token now, it won't be shown again",
+	})
+}
+
+// DeleteToken revokes a token, the users it provisioned are kept
+func (h *SCIMHandler) DeleteToken(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.scimService.DeleteToken(c.Request.Context(), id); err != nil {
+		if errors.Is(err, service.ErrSCIMTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "scim token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete scim token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "scim token deleted"})
+}
+
+// page reads startIndex (1-based) and count, which is capped at SCIM_MAX_RESULTS
+func (h *SCIMHandler) page(c *gin.Context) (startIndex, count int) {
+	startIndex, err := strconv.Atoi(c.Query("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(h.cfg.SCIM.MaxResults)))
+	if err != nil || count > h.cfg.SCIM.MaxResults {
+		count = h.cfg.SCIM.MaxResults
+	}
+	return startIndex, max(count, 0)
+}
+
+// withMembers tells whether group members are wanted; identity providers exclude them
+// when they only look a group up
+func (h *SCIMHandler) withMembers(c *gin.Context) bool {
+	for _, attribute := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *SCIMHandler) bind(c *gin.Context, v interface{}) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(v); err != nil {
+		h.respond(c, http.StatusBadRequest, scim.Errorf(scim.InvalidSyntax, "invalid request body"))
+		return false
+	}
+	return true
+}
+
+func (h *SCIMHandler) respond(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", scim.ContentType)
+	c.JSON(status, body)
+}
+
+func (h *SCIMHandler) writeError(c *gin.Context, err error) {
+	var scimErr *scim.Error
+	switch {
+	case errors.As(err, &scimErr):
+		h.respond(c, scimErr.HTTPStatus(), scimErr)
+	case errors.Is(err, service.ErrSCIMUserNotFound), errors.Is(err, service.ErrSCIMGroupNotFound):
+		h.respond(c, http.StatusNotFound, scim.NewError(http.StatusNotFound, "", "resource not found"))
+	case errors.Is(err, service.ErrUserAlreadyExists):
+		h.respond(c, http.StatusConflict, scim.NewError(http.StatusConflict, scim.Uniqueness, "an account with this email already exists"))
+	case errors.Is(err, service.ErrSCIMUserNameTaken):
+		h.respond(c, http.StatusConflict, scim.NewError(http.StatusConflict, scim.Uniqueness, "userName already in use"))
+	case errors.Is(err, service.ErrSCIMRoleNotAllowed):
+		h.respond(c, http.StatusBadRequest, scim.Errorf(scim.InvalidValue, "%s", err.Error()))
+	default:
+		log.Printf("scim request %s %s failed: %v", c.Request.Method, c.FullPath(), err)
+		h.respond(c, http.StatusInternalServerError, scim.NewError(http.StatusInternalServerError, "", "internal error"))
+	}
+}
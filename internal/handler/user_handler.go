@@ -1,20 +1,29 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
 	"github.com/login_flow/auth-service/internal/middleware"
 	"github.com/login_flow/auth-service/internal/service"
+	"github.com/login_flow/auth-service/internal/util"
+	"github.com/login_flow/auth-service/pkg/validator"
 )
 
 type UserHandler struct {
-	authService *service.AuthService
+	authService    *service.AuthService
+	accountService *service.AccountService
+	cfg            *config.Config
 }
 
-func NewUserHandler(authService *service.AuthService) *UserHandler {
+func NewUserHandler(authService *service.AuthService, accountService *service.AccountService, cfg *config.Config) *UserHandler {
 	return &UserHandler{
-		authService: authService,
+		authService:    authService,
+		accountService: accountService,
+		cfg:            cfg,
 	}
 }
 
@@ -32,7 +41,232 @@ func (h *UserHandler) GetMe(c *gin.Context) {
 		return
 	}
 
+	response := gin.H{
+		"user":         user.ToResponse(),
+		"roles":        middleware.GetRoles(c),
+		"impersonated": false,
+	}
+	// Lets the app show a banner while an admin acts as the user
+	if claims, ok := middleware.GetImpersonation(c); ok {
+		response["impersonated"] = true
+		response["impersonator"] = gin.H{
+			"user_id":    claims.Act.UserID,
+			"email":      claims.Act.Email,
+			"expires_at": claims.ExpiresAt.Time,
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ChangeEmail starts an email change by sending a confirmation link to the new address
+func (h *UserHandler) ChangeEmail(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req validator.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.RequestEmailChange(c.Request.Context(), userID, req.NewEmail, req.Password); err != nil {
+		switch {
+		case errors.Is(err, service.ErrReauthenticationFailed):
+			c.JSON(http.StatusForbidden, gin.H{"error": "invalid password"})
+		case errors.Is(err, service.ErrDirectoryManaged):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrEmailUnchanged):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "new email is the same as the current one"})
+		case errors.Is(err, service.ErrUserAlreadyExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "email already in use"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "confirmation email sent to the new address",
+	})
+}
+
+// ConfirmEmailChange applies a pending email change and ends all existing sessions
+func (h *UserHandler) ConfirmEmailChange(c *gin.Context) {
+	var req validator.ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.accountService.ConfirmEmailChange(c.Request.Context(), req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidToken):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		case errors.Is(err, service.ErrUserAlreadyExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "email already in use"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm email change"})
+		}
+		return
+	}
+
+	// Cookies issued for the old email are no longer valid
+	util.ClearAuthCookies(c, &h.cfg.Cookie)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "email changed, please log in again",
+		"user":    user.ToResponse(),
+	})
+}
+
+// DeleteMe schedules the current user's account for deletion and logs them out
+func (h *UserHandler) DeleteMe(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req validator.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.accountService.ScheduleDeletion(c.Request.Context(), userID, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrReauthenticationFailed):
+			c.JSON(http.StatusForbidden, gin.H{"error": "invalid password"})
+		case errors.Is(err, service.ErrDirectoryManaged):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete account"})
+		}
+		return
+	}
+
+	// All sessions were revoked, including this one
+	util.ClearAuthCookies(c, &h.cfg.Cookie)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":               "account scheduled for deletion, log in again to cancel",
+		"deletion_scheduled_at": user.DeletionScheduledAt,
+	})
+}
+
+// UpdateMe changes the current user's profile fields
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req validator.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile := &domain.ProfileUpdate{
+		DisplayName: req.DisplayName,
+		AvatarURL:   req.AvatarURL,
+		Locale:      req.Locale,
+		Timezone:    req.Timezone,
+	}
+	if profile.IsEmpty() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no profile fields to update"})
+		return
+	}
+
+	user, err := h.accountService.UpdateProfile(c.Request.Context(), userID, profile)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"user": user.ToResponse(),
 	})
 }
+
+// ForgotPassword emails a password reset link. The response is the same whether or not the account exists.
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req validator.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to request password reset"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "if an account exists for this email, a reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using the token from the reset email
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req validator.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !validator.ValidatePassword(req.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "password must be at least 8 characters and contain uppercase, lowercase, and number",
+		})
+		return
+	}
+
+	if err := h.accountService.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+
+	// All sessions were revoked
+	util.ClearAuthCookies(c, &h.cfg.Cookie)
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset, please log in again"})
+}
+
+// ReportSignIn handles the "this wasn't me" link from a new sign-in alert.
+// All sessions are revoked and a password reset email is sent.
+func (h *UserHandler) ReportSignIn(c *gin.Context) {
+	var req validator.ReportSignInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.ReportSignIn(c.Request.Context(), req.Token); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to secure account"})
+		return
+	}
+
+	util.ClearAuthCookies(c, &h.cfg.Cookie)
+
+	c.JSON(http.StatusOK, gin.H{"message": "all sessions were signed out, check your email to reset your password"})
+}
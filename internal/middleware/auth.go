@@ -2,30 +2,128 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/domain"
 	"github.com/login_flow/auth-service/internal/service"
 	"github.com/login_flow/auth-service/internal/util"
+	"github.com/login_flow/auth-service/pkg/jwt"
 )
 
-func AuthMiddleware(authService *service.AuthService) gin.HandlerFunc {
+// AuthMiddleware authenticates the request with the access token cookie. Token mode
+// requests (see util.IsTokenMode) are only authenticated with the "Authorization: Bearer"
+// header instead, which carries an access token or a personal access token.
+func AuthMiddleware(authService *service.AuthService, patService *service.PersonalAccessTokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token, err := util.GetCookie(c, util.AccessTokenCookie)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized: no access token"})
-			c.Abort()
-			return
+		var token string
+		if util.IsTokenMode(c) {
+			bearer, ok := util.GetBearerToken(c)
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized: no bearer token"})
+				c.Abort()
+				return
+			}
+
+			if strings.HasPrefix(bearer, domain.PersonalAccessTokenPrefix) {
+				authenticatePersonalAccessToken(c, patService, bearer)
+				return
+			}
+			token = bearer
+		} else {
+			cookie, err := util.GetCookie(c, util.AccessTokenCookie)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized: no access token"})
+				c.Abort()
+				return
+			}
+			token = cookie
 		}
 
-		claims, err := authService.ValidateAccessToken(token)
+		claims, err := authService.ValidateAccessToken(c.Request.Context(), token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized: invalid token"})
 			c.Abort()
 			return
 		}
 
+		if claims.Act != nil {
+			if err := authService.ValidateImpersonation(c.Request.Context(), claims); err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized: impersonation ended"})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Set("userID", claims.UserID)
 		c.Set("email", claims.Email)
+		c.Set("roles", claims.Roles)
+		c.Set("permissions", claims.Permissions)
+		if claims.OrgID != nil {
+			c.Set("orgID", *claims.OrgID)
+			c.Set("orgRole", claims.OrgRole)
+		}
+
+		// Services read the actor from the request context (e.g. for audit events).
+		// While impersonating, the admin is the one acting.
+		actorID := claims.UserID
+		if claims.Act != nil {
+			c.Set("impersonation", claims)
+			actorID = claims.Act.UserID
+		}
+		c.Request = c.Request.WithContext(domain.WithActorID(c.Request.Context(), actorID))
+
+		c.Next()
+
+		if claims.Act != nil {
+			authService.RecordImpersonatedRequest(c.Request.Context(), claims, c.Request.Method, c.Request.URL.Path, c.Writer.Status())
+		}
+	}
+}
+
+func authenticatePersonalAccessToken(c *gin.Context, patService *service.PersonalAccessTokenService, token string) {
+	auth, err := patService.Authenticate(c.Request.Context(), token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized: invalid token"})
+		c.Abort()
+		return
+	}
+
+	c.Set("userID", auth.User.ID)
+	c.Set("email", auth.User.Email)
+	c.Set("roles", auth.Roles)
+	c.Set("permissions", auth.Permissions)
+	c.Set("tokenScopes", auth.Token.Scopes)
+
+	c.Request = c.Request.WithContext(domain.WithActorID(c.Request.Context(), auth.User.ID))
+
+	c.Next()
+}
+
+// RequireSession rejects requests made with a personal access token, for endpoints
+// that only a logged-in user may use (e.g. creating more tokens).
+// It must run after AuthMiddleware.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetTokenScopes(c); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden: not allowed with a personal access token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RejectImpersonation blocks sensitive operations, like changing the email or deleting
+// the account, while an admin impersonates the user. It must run after AuthMiddleware.
+func RejectImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetImpersonation(c); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden: not allowed while impersonating a user"})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
@@ -46,3 +144,42 @@ func GetEmail(c *gin.Context) (string, bool) {
 	}
 	return email.(string), true
 }
+
+// GetOrgID returns the active organization of the session; ok is false outside any
+// organization and for personal access tokens
+func GetOrgID(c *gin.Context) (int64, bool) {
+	orgID, exists := c.Get("orgID")
+	if !exists {
+		return 0, false
+	}
+	return orgID.(int64), true
+}
+
+// GetOrgRole returns the user's role in the active organization, empty outside any organization
+func GetOrgRole(c *gin.Context) string {
+	role, exists := c.Get("orgRole")
+	if !exists {
+		return ""
+	}
+	return role.(string)
+}
+
+// GetTokenScopes returns the scopes of the personal access token the request was made
+// with; ok is false for requests authenticated with a session
+func GetTokenScopes(c *gin.Context) ([]string, bool) {
+	scopes, exists := c.Get("tokenScopes")
+	if !exists {
+		return nil, false
+	}
+	return scopes.([]string), true
+}
+
+// GetImpersonation returns the claims of the impersonation token the request was made
+// with, the admin is in their Act; ok is false unless an admin impersonates the user
+func GetImpersonation(c *gin.Context) (*jwt.Claims, bool) {
+	claims, exists := c.Get("impersonation")
+	if !exists {
+		return nil, false
+	}
+	return claims.(*jwt.Claims), true
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+// ClientInfo stores the client IP and user agent in the request context,
+// so services can record where a request came from
+func ClientInfo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := domain.WithClientInfo(c.Request.Context(), domain.ClientInfo{
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
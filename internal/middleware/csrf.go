@@ -17,6 +17,12 @@ func CSRFMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Token mode requests never use the cookies, so there is nothing to forge
+		if util.IsTokenMode(c) {
+			c.Next()
+			return
+		}
+
 		// Skip CSRF for non-browser clients (optional - check for custom header)
 		// This allows Postman/API clients to work
 		if c.GetHeader("X-Requested-With") == "XMLHttpRequest" ||
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/internal/service"
+)
+
+// RequireOrgRole allows the request if the user is a member of the organization in the
+// :org_id path parameter with one of the given roles (any role if none are given).
+// The membership is read from the database, not the token, so role changes and
+// removals apply immediately. It must run after AuthMiddleware.
+func RequireOrgRole(orgService *service.OrganizationService, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid org_id"})
+			c.Abort()
+			return
+		}
+
+		userID, _ := GetUserID(c)
+		membership, err := orgService.GetMembership(c.Request.Context(), orgID, userID)
+		if err != nil {
+			// Non-members can't tell whether the organization exists
+			c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
+			c.Abort()
+			return
+		}
+
+		if len(roles) > 0 && !slices.Contains(roles, membership.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden: missing required organization role"})
+			c.Abort()
+			return
+		}
+
+		c.Set("orgMembership", membership)
+		c.Next()
+	}
+}
+
+// GetOrgMembership returns the caller's membership in the organization of the
+// request path, as loaded by RequireOrgRole
+func GetOrgMembership(c *gin.Context) (*domain.Membership, bool) {
+	membership, exists := c.Get("orgMembership")
+	if !exists {
+		return nil, false
+	}
+	return membership.(*domain.Membership), true
+}
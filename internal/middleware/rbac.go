@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+// RequireRole allows the request if the user has at least one of the given roles.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userRoles := GetRoles(c)
+		for _, role := range roles {
+			if slices.Contains(userRoles, role) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden: missing required role"})
+		c.Abort()
+	}
+}
+
+// RequirePermission allows the request only if the user has all of the given permissions.
+// It must run after AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userPermissions := GetPermissions(c)
+		for _, permission := range permissions {
+			if !slices.Contains(userPermissions, permission) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "forbidden: missing permission " + permission})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAccountScope limits personal access tokens: reading needs account:read or
+// account:write, changes need account:write. Requests with a session are not affected.
+// It must run after AuthMiddleware.
+func RequireAccountScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, ok := GetTokenScopes(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		allowed := slices.Contains(scopes, domain.ScopeAccountWrite)
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			allowed = allowed || slices.Contains(scopes, domain.ScopeAccountRead)
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden: token is missing the required scope"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func GetRoles(c *gin.Context) []string {
+	roles, exists := c.Get("roles")
+	if !exists {
+		return nil
+	}
+	return roles.([]string)
+}
+
+func GetPermissions(c *gin.Context) []string {
+	permissions, exists := c.Get("permissions")
+	if !exists {
+		return nil
+	}
+	return permissions.([]string)
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/internal/service"
+	"github.com/login_flow/auth-service/internal/util"
+	"github.com/login_flow/auth-service/pkg/scim"
+)
+
+// SCIMAuth authenticates an identity provider with the SCIM token in the
+// "Authorization: Bearer" header. Errors are SCIM error responses.
+func SCIMAuth(scimService *service.SCIMService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearer, ok := util.GetBearerToken(c)
+		if !ok {
+			abortSCIM(c, http.StatusUnauthorized, "no bearer token")
+			return
+		}
+
+		token, err := scimService.Authenticate(c.Request.Context(), bearer)
+		if err != nil {
+			abortSCIM(c, http.StatusUnauthorized, "invalid token")
+			return
+		}
+
+		c.Set("scimToken", token)
+		c.Next()
+	}
+}
+
+// GetSCIMToken returns the token the request was authenticated with by SCIMAuth
+func GetSCIMToken(c *gin.Context) (*domain.SCIMToken, bool) {
+	token, exists := c.Get("scimToken")
+	if !exists {
+		return nil, false
+	}
+	return token.(*domain.SCIMToken), true
+}
+
+func abortSCIM(c *gin.Context, status int, detail string) {
+	c.Header("Content-Type", scim.ContentType)
+	c.AbortWithStatusJSON(status, scim.NewError(status, "", detail))
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+type ActionTokenRepository struct {
+	db *DB
+}
+
+func NewActionTokenRepository(db *DB) *ActionTokenRepository {
+	return &ActionTokenRepository{db: db}
+}
+
+func (r *ActionTokenRepository) Create(ctx context.Context, token *domain.ActionToken) error {
+	result := r.db.conn(ctx).Create(token)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create action token: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *ActionTokenRepository) GetByHash(ctx context.Context, purpose, tokenHash string) (*domain.ActionToken, error) {
+	var token domain.ActionToken
+	result := r.db.conn(ctx).
+		Where("purpose = ? AND token_hash = ?", purpose, tokenHash).
+		First(&token)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get action token: %w", result.Error)
+	}
+	return &token, nil
+}
+
+// Consume marks the token as used. It fails if the token was already consumed,
+// so two concurrent requests can't both redeem the same token.
+func (r *ActionTokenRepository) Consume(ctx context.Context, id int64) error {
+	result := r.db.conn(ctx).Model(&domain.ActionToken{}).
+		Where("id = ? AND consumed_at IS NULL", id).
+		Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to consume action token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrTokenConsumed
+	}
+	return nil
+}
+
+func (r *ActionTokenRepository) DeletePendingForUser(ctx context.Context, userID int64, purpose string) error {
+	result := r.db.conn(ctx).
+		Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", userID, purpose).
+		Delete(&domain.ActionToken{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete pending action tokens: %w", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"gorm.io/gorm"
+)
+
+type AuditRepository struct {
+	db *DB
+}
+
+func NewAuditRepository(db *DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) Create(ctx context.Context, event *domain.AuditEvent) error {
+	result := r.db.conn(ctx).Create(event)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create audit event: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *AuditRepository) List(ctx context.Context, filter *domain.AuditFilter) ([]*domain.AuditEvent, error) {
+	var events []*domain.AuditEvent
+	query := r.filtered(ctx, filter).Order("created_at DESC, id DESC")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	result := query.Find(&events)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", result.Error)
+	}
+	return events, nil
+}
+
+func (r *AuditRepository) Count(ctx context.Context, filter *domain.AuditFilter) (int64, error) {
+	var count int64
+	result := r.filtered(ctx, filter).Count(&count)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count audit events: %w", result.Error)
+	}
+	return count, nil
+}
+
+// filtered applies the filter's conditions to an audit_events query
+func (r *AuditRepository) filtered(ctx context.Context, filter *domain.AuditFilter) *gorm.DB {
+	query := r.db.conn(ctx).Model(&domain.AuditEvent{})
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.SubjectID != nil {
+		query = query.Where("subject_id = ?", *filter.SubjectID)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+	return query
+}
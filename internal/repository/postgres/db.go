@@ -1,6 +1,8 @@
 package postgres
 
 import (
+	"context"
+
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -10,7 +12,9 @@ type DB struct {
 }
 
 func NewDB(database_url string) (*DB, error) {
-	db, err := gorm.Open(postgres.Open(database_url), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(database_url), &gorm.Config{
+		TranslateError: true, // Map driver errors (e.g. unique violations) to gorm.ErrDuplicatedKey
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -18,6 +22,24 @@ func NewDB(database_url string) (*DB, error) {
 	return &DB{Client: db}, nil
 }
 
+type txKey struct{}
+
+// WithTx implements domain.Transactor. Transactions nest as savepoints.
+func (db *DB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return db.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// conn returns the client repositories query with: the transaction of ctx if it was
+// given by WithTx, the pool otherwise
+func (db *DB) conn(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.Client.WithContext(ctx)
+}
+
 func (db *DB) Close() {
 	sqlDB, err := db.Client.DB()
 	if err != nil {
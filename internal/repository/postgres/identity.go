@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+type IdentityRepository struct {
+	db *DB
+}
+
+func NewIdentityRepository(db *DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+func (r *IdentityRepository) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	result := r.db.conn(ctx).Create(identity)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create user identity: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *IdentityRepository) GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+	result := r.db.conn(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get user identity: %w", result.Error)
+	}
+	return &identity, nil
+}
+
+func (r *IdentityRepository) ListForUser(ctx context.Context, userID int64) ([]*domain.UserIdentity, error) {
+	var identities []*domain.UserIdentity
+	result := r.db.conn(ctx).Where("user_id = ?", userID).Order("created_at").Find(&identities)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list user identities: %w", result.Error)
+	}
+	return identities, nil
+}
+
+func (r *IdentityRepository) UpdateLastLogin(ctx context.Context, id int64) error {
+	result := r.db.conn(ctx).Model(&domain.UserIdentity{}).Where("id = ?", id).Update("last_login_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to update identity last login: %w", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+type InvitationRepository struct {
+	db *DB
+}
+
+func NewInvitationRepository(db *DB) *InvitationRepository {
+	return &InvitationRepository{db: db}
+}
+
+func (r *InvitationRepository) Create(ctx context.Context, invitation *domain.Invitation) error {
+	result := r.db.conn(ctx).Create(invitation)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create invitation: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *InvitationRepository) GetByID(ctx context.Context, id int64) (*domain.Invitation, error) {
+	var invitation domain.Invitation
+	result := r.db.conn(ctx).First(&invitation, id)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", result.Error)
+	}
+	return &invitation, nil
+}
+
+func (r *InvitationRepository) GetByHash(ctx context.Context, tokenHash string) (*domain.Invitation, error) {
+	var invitation domain.Invitation
+	result := r.db.conn(ctx).Where("token_hash = ?", tokenHash).First(&invitation)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", result.Error)
+	}
+	return &invitation, nil
+}
+
+func (r *InvitationRepository) List(ctx context.Context) ([]*domain.Invitation, error) {
+	var invitations []*domain.Invitation
+	result := r.db.conn(ctx).Order("created_at DESC").Find(&invitations)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", result.Error)
+	}
+	return invitations, nil
+}
+
+func (r *InvitationRepository) Accept(ctx context.Context, id, userID int64) error {
+	result := r.db.conn(ctx).Model(&domain.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL", id).
+		Updates(map[string]interface{}{"accepted_at": time.Now(), "accepted_by": userID})
+	if result.Error != nil {
+		return fmt.Errorf("failed to accept invitation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("invitation already accepted")
+	}
+	return nil
+}
+
+func (r *InvitationRepository) Delete(ctx context.Context, id int64) error {
+	result := r.db.conn(ctx).Delete(&domain.Invitation{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete invitation: %w", result.Error)
+	}
+	return nil
+}
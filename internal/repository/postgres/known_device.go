@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"gorm.io/gorm/clause"
+)
+
+type KnownDeviceRepository struct {
+	db *DB
+}
+
+func NewKnownDeviceRepository(db *DB) *KnownDeviceRepository {
+	return &KnownDeviceRepository{db: db}
+}
+
+func (r *KnownDeviceRepository) Lookup(ctx context.Context, userID int64, device, ip string) (*domain.DeviceSighting, error) {
+	var row struct {
+		AnySeen    bool
+		DeviceSeen bool
+		IPSeen     bool
+	}
+	result := r.db.conn(ctx).Raw(`SELECT
+		EXISTS (SELECT 1 FROM known_devices WHERE user_id = ?) AS any_seen,
+		EXISTS (SELECT 1 FROM known_devices WHERE user_id = ? AND device = ?) AS device_seen,
+		EXISTS (SELECT 1 FROM known_devices WHERE user_id = ? AND ip = ?) AS ip_seen`,
+		userID, userID, device, userID, ip).Scan(&row)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to look up known device: %w", result.Error)
+	}
+	return &domain.DeviceSighting{
+		FirstSignIn: !row.AnySeen,
+		DeviceSeen:  row.DeviceSeen,
+		IPSeen:      row.IPSeen,
+	}, nil
+}
+
+// Record adds the device and IP for the user, or refreshes last_seen_at if already known
+func (r *KnownDeviceRepository) Record(ctx context.Context, userID int64, device, ip string) error {
+	now := time.Now()
+	knownDevice := &domain.KnownDevice{
+		UserID:      userID,
+		Device:      device,
+		IP:          ip,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+	result := r.db.conn(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "device"}, {Name: "ip"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"last_seen_at": now}),
+	}).Create(knownDevice)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record known device: %w", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"gorm.io/gorm"
+)
+
+type LoginCodeRepository struct {
+	db *DB
+}
+
+func NewLoginCodeRepository(db *DB) *LoginCodeRepository {
+	return &LoginCodeRepository{db: db}
+}
+
+func (r *LoginCodeRepository) Create(ctx context.Context, code *domain.LoginCode) error {
+	result := r.db.conn(ctx).Create(code)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create login code: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *LoginCodeRepository) GetPendingForUser(ctx context.Context, userID int64) (*domain.LoginCode, error) {
+	var code domain.LoginCode
+	result := r.db.conn(ctx).
+		Where("user_id = ? AND consumed_at IS NULL", userID).
+		Order("created_at DESC").
+		First(&code)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get login code: %w", result.Error)
+	}
+	return &code, nil
+}
+
+// RecordAttempt increments the attempt counter in a single statement, so concurrent
+// guesses can't get past the limit.
+func (r *LoginCodeRepository) RecordAttempt(ctx context.Context, id int64, maxAttempts int) (bool, error) {
+	result := r.db.conn(ctx).Model(&domain.LoginCode{}).
+		Where("id = ? AND attempts < ?", id, maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record login code attempt: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Consume marks the code as used. It fails if the code was already consumed.
+func (r *LoginCodeRepository) Consume(ctx context.Context, id int64) error {
+	result := r.db.conn(ctx).Model(&domain.LoginCode{}).
+		Where("id = ? AND consumed_at IS NULL", id).
+		Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to consume login code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("login code already consumed")
+	}
+	return nil
+}
+
+func (r *LoginCodeRepository) ConsumePendingForUser(ctx context.Context, userID int64) error {
+	result := r.db.conn(ctx).Model(&domain.LoginCode{}).
+		Where("user_id = ? AND consumed_at IS NULL", userID).
+		Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to consume pending login codes: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *LoginCodeRepository) CountCreatedSince(ctx context.Context, userID int64, since time.Time) (int64, error) {
+	var count int64
+	result := r.db.conn(ctx).Model(&domain.LoginCode{}).
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Count(&count)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count login codes: %w", result.Error)
+	}
+	return count, nil
+}
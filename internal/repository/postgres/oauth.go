@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OAuthRepository struct {
+	db *DB
+}
+
+func NewOAuthRepository(db *DB) *OAuthRepository {
+	return &OAuthRepository{db: db}
+}
+
+func (r *OAuthRepository) CreateClient(ctx context.Context, client *domain.OAuthClient) error {
+	result := r.db.conn(ctx).Create(client)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create oauth client: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *OAuthRepository) GetClient(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	var client domain.OAuthClient
+	result := r.db.conn(ctx).Where("client_id = ?", clientID).First(&client)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get oauth client: %w", result.Error)
+	}
+	return &client, nil
+}
+
+func (r *OAuthRepository) ListClients(ctx context.Context) ([]*domain.OAuthClient, error) {
+	var clients []*domain.OAuthClient
+	result := r.db.conn(ctx).Order("created_at").Find(&clients)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list oauth clients: %w", result.Error)
+	}
+	return clients, nil
+}
+
+// DeleteClient removes the client with its codes, consents and refresh tokens
+func (r *OAuthRepository) DeleteClient(ctx context.Context, clientID string) error {
+	err := r.db.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("client_id = ?", clientID).Delete(&domain.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("client_id = ?", clientID).Delete(&domain.OAuthAuthorizationCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("client_id = ?", clientID).Delete(&domain.OAuthConsent{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("client_id = ?", clientID).Delete(&domain.OAuthClient{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete oauth client: %w", err)
+	}
+	return nil
+}
+
+func (r *OAuthRepository) CreateCode(ctx context.Context, code *domain.OAuthAuthorizationCode) error {
+	result := r.db.conn(ctx).Create(code)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create authorization code: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *OAuthRepository) GetCodeByHash(ctx context.Context, codeHash string) (*domain.OAuthAuthorizationCode, error) {
+	var code domain.OAuthAuthorizationCode
+	result := r.db.conn(ctx).Where("code_hash = ?", codeHash).First(&code)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get authorization code: %w", result.Error)
+	}
+	return &code, nil
+}
+
+// ConsumeCode marks the code as used. It fails if the code was already used,
+// so a code can't be exchanged twice even by concurrent requests.
+func (r *OAuthRepository) ConsumeCode(ctx context.Context, id int64) error {
+	result := r.db.conn(ctx).Model(&domain.OAuthAuthorizationCode{}).
+		Where("id = ? AND consumed_at IS NULL", id).
+		Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to consume authorization code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("authorization code already consumed")
+	}
+	return nil
+}
+
+func (r *OAuthRepository) GetConsent(ctx context.Context, userID int64, clientID string) (*domain.OAuthConsent, error) {
+	var consent domain.OAuthConsent
+	result := r.db.conn(ctx).Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get oauth consent: %w", result.Error)
+	}
+	return &consent, nil
+}
+
+// SaveConsent stores the granted scopes, replacing an earlier consent
+func (r *OAuthRepository) SaveConsent(ctx context.Context, consent *domain.OAuthConsent) error {
+	result := r.db.conn(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scope", "updated_at"}),
+	}).Create(consent)
+	if result.Error != nil {
+		return fmt.Errorf("failed to save oauth consent: %w", result.Error)
+	}
+	return nil
+}
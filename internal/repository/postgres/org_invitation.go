@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+type OrgInvitationRepository struct {
+	db *DB
+}
+
+func NewOrgInvitationRepository(db *DB) *OrgInvitationRepository {
+	return &OrgInvitationRepository{db: db}
+}
+
+func (r *OrgInvitationRepository) Create(ctx context.Context, invitation *domain.OrgInvitation) error {
+	result := r.db.conn(ctx).Create(invitation)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create organization invitation: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *OrgInvitationRepository) GetByHash(ctx context.Context, tokenHash string) (*domain.OrgInvitation, error) {
+	var invitation domain.OrgInvitation
+	result := r.db.conn(ctx).Where("token_hash = ?", tokenHash).First(&invitation)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get organization invitation: %w", result.Error)
+	}
+	return &invitation, nil
+}
+
+func (r *OrgInvitationRepository) Accept(ctx context.Context, id int64) error {
+	result := r.db.conn(ctx).Model(&domain.OrgInvitation{}).
+		Where("id = ? AND accepted_at IS NULL", id).
+		Update("accepted_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to accept organization invitation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("organization invitation already accepted")
+	}
+	return nil
+}
+
+func (r *OrgInvitationRepository) DeletePending(ctx context.Context, orgID int64, email string) error {
+	result := r.db.conn(ctx).
+		Where("org_id = ? AND LOWER(email) = LOWER(?) AND accepted_at IS NULL", orgID, email).
+		Delete(&domain.OrgInvitation{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete pending organization invitations: %w", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"gorm.io/gorm"
+)
+
+type OrganizationRepository struct {
+	db *DB
+}
+
+func NewOrganizationRepository(db *DB) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+func (r *OrganizationRepository) Create(ctx context.Context, org *domain.Organization, ownerID int64) error {
+	err := r.db.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&domain.Membership{OrgID: org.ID, UserID: ownerID, Role: domain.OrgRoleOwner}).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return domain.ErrOrganizationSlugTaken
+		}
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+	return nil
+}
+
+func (r *OrganizationRepository) GetByID(ctx context.Context, id int64) (*domain.Organization, error) {
+	var org domain.Organization
+	result := r.db.conn(ctx).First(&org, id)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", result.Error)
+	}
+	return &org, nil
+}
+
+func (r *OrganizationRepository) GetMembership(ctx context.Context, orgID, userID int64) (*domain.Membership, error) {
+	var membership domain.Membership
+	result := r.db.conn(ctx).Where("org_id = ? AND user_id = ?", orgID, userID).First(&membership)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get membership: %w", result.Error)
+	}
+	return &membership, nil
+}
+
+func (r *OrganizationRepository) ListForUser(ctx context.Context, userID int64) ([]*domain.UserOrganization, error) {
+	var orgs []*domain.UserOrganization
+	result := r.db.conn(ctx).Model(&domain.Organization{}).
+		Select("organizations.*, memberships.role").
+		Joins("JOIN memberships ON memberships.org_id = organizations.id").
+		Where("memberships.user_id = ?", userID).
+		Order("organizations.name").
+		Scan(&orgs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", result.Error)
+	}
+	return orgs, nil
+}
+
+func (r *OrganizationRepository) ListMembers(ctx context.Context, orgID int64) ([]*domain.OrgMember, error) {
+	var members []*domain.OrgMember
+	result := r.db.conn(ctx).Model(&domain.Membership{}).
+		Select("memberships.user_id, users.email, users.display_name, memberships.role, memberships.created_at").
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.org_id = ?", orgID).
+		Order("memberships.created_at").
+		Scan(&members)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list members: %w", result.Error)
+	}
+	return members, nil
+}
+
+func (r *OrganizationRepository) AddMember(ctx context.Context, membership *domain.Membership) error {
+	result := r.db.conn(ctx).Create(membership)
+	if result.Error != nil {
+		return fmt.Errorf("failed to add member: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *OrganizationRepository) UpdateMemberRole(ctx context.Context, orgID, userID int64, role string) error {
+	result := r.db.conn(ctx).Model(&domain.Membership{}).
+		Where("org_id = ? AND user_id = ?", orgID, userID).
+		Update("role", role)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update member role: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *OrganizationRepository) RemoveMember(ctx context.Context, orgID, userID int64) error {
+	result := r.db.conn(ctx).
+		Where("org_id = ? AND user_id = ?", orgID, userID).
+		Delete(&domain.Membership{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove member: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *OrganizationRepository) TransferOwnership(ctx context.Context, orgID, fromUserID, toUserID int64) error {
+	err := r.db.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.Membership{}).
+			Where("org_id = ? AND user_id = ? AND role = ?", orgID, fromUserID, domain.OrgRoleOwner).
+			Update("role", domain.OrgRoleAdmin)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("current owner changed")
+		}
+
+		result = tx.Model(&domain.Membership{}).
+			Where("org_id = ? AND user_id = ?", orgID, toUserID).
+			Update("role", domain.OrgRoleOwner)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("new owner is not a member")
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to transfer ownership: %w", err)
+	}
+	return nil
+}
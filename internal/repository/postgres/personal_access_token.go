@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+type PersonalAccessTokenRepository struct {
+	db *DB
+}
+
+func NewPersonalAccessTokenRepository(db *DB) *PersonalAccessTokenRepository {
+	return &PersonalAccessTokenRepository{db: db}
+}
+
+func (r *PersonalAccessTokenRepository) Create(ctx context.Context, token *domain.PersonalAccessToken) error {
+	result := r.db.conn(ctx).Create(token)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create personal access token: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *PersonalAccessTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*domain.PersonalAccessToken, error) {
+	var token domain.PersonalAccessToken
+	result := r.db.conn(ctx).Where("token_hash = ?", tokenHash).First(&token)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get personal access token: %w", result.Error)
+	}
+	return &token, nil
+}
+
+// ListForUser returns the user's tokens that are neither revoked nor expired
+func (r *PersonalAccessTokenRepository) ListForUser(ctx context.Context, userID int64) ([]*domain.PersonalAccessToken, error) {
+	var tokens []*domain.PersonalAccessToken
+	result := r.db.conn(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&tokens)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list personal access tokens: %w", result.Error)
+	}
+	return tokens, nil
+}
+
+// Revoke revokes one of the user's tokens, domain.ErrPersonalAccessTokenNotFound if there is no such active token
+func (r *PersonalAccessTokenRepository) Revoke(ctx context.Context, userID, id int64) error {
+	result := r.db.conn(ctx).Model(&domain.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke personal access token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrPersonalAccessTokenNotFound
+	}
+	return nil
+}
+
+func (r *PersonalAccessTokenRepository) RevokeAllForUser(ctx context.Context, userID int64) error {
+	result := r.db.conn(ctx).Model(&domain.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke personal access tokens: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *PersonalAccessTokenRepository) UpdateLastUsed(ctx context.Context, id int64) error {
+	result := r.db.conn(ctx).Model(&domain.PersonalAccessToken{}).
+		Where("id = ?", id).
+		Update("last_used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to update personal access token last use: %w", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"gorm.io/gorm/clause"
+)
+
+type RoleRepository struct {
+	db *DB
+}
+
+func NewRoleRepository(db *DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+func (r *RoleRepository) GetByName(ctx context.Context, name string) (*domain.Role, error) {
+	var role domain.Role
+	result := r.db.conn(ctx).Where("name = ?", name).First(&role)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get role: %w", result.Error)
+	}
+	return &role, nil
+}
+
+func (r *RoleRepository) List(ctx context.Context) ([]*domain.Role, error) {
+	var roles []*domain.Role
+	result := r.db.conn(ctx).Order("name").Find(&roles)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", result.Error)
+	}
+	return roles, nil
+}
+
+func (r *RoleRepository) GetUserRoles(ctx context.Context, userID int64) ([]string, error) {
+	var names []string
+	result := r.db.conn(ctx).Model(&domain.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &names)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", result.Error)
+	}
+	return names, nil
+}
+
+func (r *RoleRepository) GetUserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	var names []string
+	result := r.db.conn(ctx).Model(&domain.Permission{}).
+		Distinct("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+		Where("user_roles.user_id = ?", userID).
+		Order("permissions.name").
+		Pluck("permissions.name", &names)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get user permissions: %w", result.Error)
+	}
+	return names, nil
+}
+
+// AssignToUser gives the user a role, assigning a role the user already has is a no-op
+func (r *RoleRepository) AssignToUser(ctx context.Context, userID int64, roleName string) error {
+	role, err := r.GetByName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	result := r.db.conn(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.UserRole{UserID: userID, RoleID: role.ID})
+	if result.Error != nil {
+		return fmt.Errorf("failed to assign role: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *RoleRepository) RemoveFromUser(ctx context.Context, userID int64, roleName string) error {
+	role, err := r.GetByName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	result := r.db.conn(ctx).
+		Where("user_id = ? AND role_id = ?", userID, role.ID).
+		Delete(&domain.UserRole{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove role: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *RoleRepository) CountUsersWithRole(ctx context.Context, roleName string) (int64, error) {
+	var count int64
+	result := r.db.conn(ctx).Model(&domain.UserRole{}).
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ?", roleName).
+		Count(&count)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count users with role: %w", result.Error)
+	}
+	return count, nil
+}
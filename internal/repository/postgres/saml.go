@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"gorm.io/gorm"
+)
+
+type SAMLRepository struct {
+	db *DB
+}
+
+func NewSAMLRepository(db *DB) *SAMLRepository {
+	return &SAMLRepository{db: db}
+}
+
+func (r *SAMLRepository) CreateConnection(ctx context.Context, conn *domain.SAMLConnection) error {
+	result := r.db.conn(ctx).Create(conn)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return domain.ErrSAMLConnectionSlugTaken
+		}
+		return fmt.Errorf("failed to create saml connection: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *SAMLRepository) GetConnectionBySlug(ctx context.Context, slug string) (*domain.SAMLConnection, error) {
+	var conn domain.SAMLConnection
+	result := r.db.conn(ctx).Where("slug = ?", slug).First(&conn)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get saml connection: %w", result.Error)
+	}
+	return &conn, nil
+}
+
+func (r *SAMLRepository) ListConnections(ctx context.Context) ([]*domain.SAMLConnection, error) {
+	var conns []*domain.SAMLConnection
+	result := r.db.conn(ctx).Order("name").Find(&conns)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list saml connections: %w", result.Error)
+	}
+	return conns, nil
+}
+
+// UpdateMetadata replaces the IdP metadata, e.g. when the IdP rotates its signing certificate
+func (r *SAMLRepository) UpdateMetadata(ctx context.Context, id int64, entityID, metadata string) error {
+	result := r.db.conn(ctx).Model(&domain.SAMLConnection{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"idp_entity_id": entityID, "idp_metadata": metadata, "updated_at": time.Now()})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update saml metadata: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *SAMLRepository) DeleteConnection(ctx context.Context, id int64) error {
+	err := r.db.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("connection_id = ?", id).Delete(&domain.SAMLAssertion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.SAMLConnection{}, id).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete saml connection: %w", err)
+	}
+	return nil
+}
+
+func (r *SAMLRepository) UseAssertion(ctx context.Context, assertion *domain.SAMLAssertion) error {
+	db := r.db.conn(ctx)
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&domain.SAMLAssertion{}).Error; err != nil {
+		return fmt.Errorf("failed to delete expired saml assertions: %w", err)
+	}
+
+	// The primary key makes this safe against concurrent requests with the same assertion
+	if err := db.Create(assertion).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return domain.ErrSAMLAssertionReplayed
+		}
+		return fmt.Errorf("failed to record saml assertion: %w", err)
+	}
+	return nil
+}
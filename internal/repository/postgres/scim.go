@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"gorm.io/gorm"
+)
+
+type SCIMRepository struct {
+	db *DB
+}
+
+func NewSCIMRepository(db *DB) *SCIMRepository {
+	return &SCIMRepository{db: db}
+}
+
+func (r *SCIMRepository) CreateToken(ctx context.Context, token *domain.SCIMToken) error {
+	result := r.db.conn(ctx).Create(token)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create scim token: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *SCIMRepository) GetTokenByHash(ctx context.Context, tokenHash string) (*domain.SCIMToken, error) {
+	var token domain.SCIMToken
+	result := r.db.conn(ctx).Where("token_hash = ?", tokenHash).First(&token)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get scim token: %w", result.Error)
+	}
+	return &token, nil
+}
+
+func (r *SCIMRepository) ListTokens(ctx context.Context) ([]*domain.SCIMToken, error) {
+	var tokens []*domain.SCIMToken
+	result := r.db.conn(ctx).Order("org_id, created_at").Find(&tokens)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list scim tokens: %w", result.Error)
+	}
+	return tokens, nil
+}
+
+// DeleteToken deletes a token, domain.ErrSCIMTokenNotFound if there is no such token
+func (r *SCIMRepository) DeleteToken(ctx context.Context, id int64) error {
+	result := r.db.conn(ctx).Delete(&domain.SCIMToken{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete scim token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrSCIMTokenNotFound
+	}
+	return nil
+}
+
+func (r *SCIMRepository) UpdateTokenLastUsed(ctx context.Context, id int64) error {
+	result := r.db.conn(ctx).Model(&domain.SCIMToken{}).
+		Where("id = ?", id).
+		Update("last_used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to update scim token last use: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *SCIMRepository) CreateUser(ctx context.Context, scimUser *domain.SCIMUser) error {
+	result := r.db.conn(ctx).Omit("User").Create(scimUser)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return domain.ErrSCIMUserNameTaken
+		}
+		return fmt.Errorf("failed to create scim user: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *SCIMRepository) GetUser(ctx context.Context, orgID, userID int64) (*domain.SCIMUser, error) {
+	var scimUser domain.SCIMUser
+	result := r.db.conn(ctx).Preload("User").
+		Where("org_id = ? AND user_id = ?", orgID, userID).
+		First(&scimUser)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get scim user: %w", result.Error)
+	}
+	return &scimUser, nil
+}
+
+func (r *SCIMRepository) ListUsers(ctx context.Context, orgID int64, filter *domain.SCIMUserFilter) ([]*domain.SCIMUser, error) {
+	var scimUsers []*domain.SCIMUser
+	query := r.filteredUsers(ctx, orgID, filter).Preload("User").Order("scim_users.created_at, scim_users.user_id")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	result := query.Find(&scimUsers)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list scim users: %w", result.Error)
+	}
+	return scimUsers, nil
+}
+
+func (r *SCIMRepository) CountUsers(ctx context.Context, orgID int64, filter *domain.SCIMUserFilter) (int64, error) {
+	var count int64
+	result := r.filteredUsers(ctx, orgID, filter).Count(&count)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count scim users: %w", result.Error)
+	}
+	return count, nil
+}
+
+func (r *SCIMRepository) UpdateUser(ctx context.Context, userID int64, userName, externalID string) error {
+	result := r.db.conn(ctx).Model(&domain.SCIMUser{}).Where("user_id = ?", userID).
+		Updates(map[string]interface{}{"user_name": userName, "external_id": externalID, "updated_at": time.Now()})
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return domain.ErrSCIMUserNameTaken
+		}
+		return fmt.Errorf("failed to update scim user: %w", result.Error)
+	}
+	return nil
+}
+
+// filteredUsers applies the filter's conditions to a query of the organization's users
+func (r *SCIMRepository) filteredUsers(ctx context.Context, orgID int64, filter *domain.SCIMUserFilter) *gorm.DB {
+	query := r.db.conn(ctx).Model(&domain.SCIMUser{}).
+		Joins("JOIN users ON users.id = scim_users.user_id").
+		Where("scim_users.org_id = ?", orgID)
+	if filter.UserName != "" {
+		query = query.Where("LOWER(scim_users.user_name) = LOWER(?)", filter.UserName)
+	}
+	if filter.ExternalID != "" {
+		query = query.Where("scim_users.external_id = ?", filter.ExternalID)
+	}
+	if filter.Email != "" {
+		query = query.Where("LOWER(users.email) = LOWER(?)", filter.Email)
+	}
+	if filter.Active != nil {
+		if *filter.Active {
+			query = query.Where("users.status = ?", domain.UserStatusActive)
+		} else {
+			query = query.Where("users.status <> ?", domain.UserStatusActive)
+		}
+	}
+	if filter.Role != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id WHERE user_roles.user_id = scim_users.user_id AND roles.name = ?)", filter.Role)
+	}
+	return query
+}
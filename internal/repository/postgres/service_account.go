@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+type ServiceAccountRepository struct {
+	db *DB
+}
+
+func NewServiceAccountRepository(db *DB) *ServiceAccountRepository {
+	return &ServiceAccountRepository{db: db}
+}
+
+func (r *ServiceAccountRepository) Create(ctx context.Context, account *domain.ServiceAccount) error {
+	result := r.db.conn(ctx).Create(account)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create service account: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *ServiceAccountRepository) GetByClientID(ctx context.Context, clientID string) (*domain.ServiceAccount, error) {
+	var account domain.ServiceAccount
+	result := r.db.conn(ctx).Where("client_id = ?", clientID).First(&account)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get service account: %w", result.Error)
+	}
+	return &account, nil
+}
+
+func (r *ServiceAccountRepository) List(ctx context.Context) ([]*domain.ServiceAccount, error) {
+	var accounts []*domain.ServiceAccount
+	result := r.db.conn(ctx).Order("created_at").Find(&accounts)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", result.Error)
+	}
+	return accounts, nil
+}
+
+func (r *ServiceAccountRepository) Delete(ctx context.Context, clientID string) error {
+	result := r.db.conn(ctx).Where("client_id = ?", clientID).Delete(&domain.ServiceAccount{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete service account: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *ServiceAccountRepository) UpdateLastUsed(ctx context.Context, id int64) error {
+	result := r.db.conn(ctx).Model(&domain.ServiceAccount{}).
+		Where("id = ?", id).
+		Update("last_used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to update service account last use: %w", result.Error)
+	}
+	return nil
+}
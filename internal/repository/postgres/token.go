@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/login_flow/auth-service/internal/domain"
+	"gorm.io/gorm/clause"
 )
 
 type TokenRepository struct {
@@ -17,7 +18,7 @@ func NewTokenRepository(db *DB) *TokenRepository {
 }
 
 func (r *TokenRepository) Create(ctx context.Context, token *domain.RefreshToken) error {
-	result := r.db.Client.WithContext(ctx).Create(token)
+	result := r.db.conn(ctx).Create(token)
 	if result.Error != nil {
 		return fmt.Errorf("failed to create refresh token: %w", result.Error)
 	}
@@ -26,7 +27,7 @@ func (r *TokenRepository) Create(ctx context.Context, token *domain.RefreshToken
 
 func (r *TokenRepository) GetByToken(ctx context.Context, tokenStr string) (*domain.RefreshToken, error) {
 	var token domain.RefreshToken
-	result := r.db.Client.WithContext(ctx).
+	result := r.db.conn(ctx).
 		Where("token = ?", tokenStr).
 		First(&token)
 	if result.Error != nil {
@@ -37,7 +38,7 @@ func (r *TokenRepository) GetByToken(ctx context.Context, tokenStr string) (*dom
 
 func (r *TokenRepository) GetByUserID(ctx context.Context, userID int64) ([]*domain.RefreshToken, error) {
 	var tokens []*domain.RefreshToken
-	result := r.db.Client.WithContext(ctx).
+	result := r.db.conn(ctx).
 		Where("user_id = ? AND revoked_at IS NULL", userID).
 		Order("created_at DESC").
 		Find(&tokens)
@@ -48,7 +49,7 @@ func (r *TokenRepository) GetByUserID(ctx context.Context, userID int64) ([]*dom
 }
 
 func (r *TokenRepository) Revoke(ctx context.Context, tokenStr string) error {
-	result := r.db.Client.WithContext(ctx).Model(&domain.RefreshToken{}).Where("token = ?", tokenStr).Update("revoked_at", time.Now())
+	result := r.db.conn(ctx).Model(&domain.RefreshToken{}).Where("token = ?", tokenStr).Update("revoked_at", time.Now())
 	if result.Error != nil {
 		return fmt.Errorf("failed to revoke refresh token: %w", result.Error)
 	}
@@ -56,17 +57,62 @@ func (r *TokenRepository) Revoke(ctx context.Context, tokenStr string) error {
 }
 
 func (r *TokenRepository) RevokeAllForUser(ctx context.Context, userID int64) error {
-	result := r.db.Client.WithContext(ctx).Model(&domain.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now())
+	result := r.db.conn(ctx).Model(&domain.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now())
 	if result.Error != nil {
 		return fmt.Errorf("failed to revoke all tokens for user: %w", result.Error)
 	}
 	return nil
 }
 
+// RevokeAllForClient revokes the tokens a user granted to one OAuth client
+func (r *TokenRepository) RevokeAllForClient(ctx context.Context, userID int64, clientID string) error {
+	result := r.db.conn(ctx).Model(&domain.RefreshToken{}).
+		Where("user_id = ? AND client_id = ? AND revoked_at IS NULL", userID, clientID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke client tokens for user: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *TokenRepository) RevokeAllForOrg(ctx context.Context, userID, orgID int64) error {
+	result := r.db.conn(ctx).Model(&domain.RefreshToken{}).
+		Where("user_id = ? AND org_id = ? AND revoked_at IS NULL", userID, orgID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke organization sessions for user: %w", result.Error)
+	}
+	return nil
+}
+
 func (r *TokenRepository) CleanupExpired(ctx context.Context) error {
-	result := r.db.Client.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&domain.RefreshToken{})
+	result := r.db.conn(ctx).Where("expires_at < ?", time.Now()).Delete(&domain.RefreshToken{})
 	if result.Error != nil {
 		return fmt.Errorf("failed to cleanup expired tokens: %w", result.Error)
 	}
+	result = r.db.conn(ctx).Where("expires_at < ?", time.Now()).Delete(&domain.RevokedAccessToken{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to cleanup revoked access tokens: %w", result.Error)
+	}
+	return nil
+}
+
+// RevokeAccessToken adds an access token to the denylist, revoking it twice is not an error
+func (r *TokenRepository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	result := r.db.conn(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.RevokedAccessToken{JTI: jti, ExpiresAt: expiresAt})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke access token: %w", result.Error)
+	}
 	return nil
 }
+
+func (r *TokenRepository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+	result := r.db.conn(ctx).Model(&domain.RevokedAccessToken{}).Where("jti = ?", jti).Count(&count)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to check access token revocation: %w", result.Error)
+	}
+	return count > 0, nil
+}
@@ -2,9 +2,14 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/login_flow/auth-service/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct {
@@ -16,7 +21,7 @@ func NewUserRepository(db *DB) *UserRepository {
 }
 
 func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
-	result := r.db.Client.WithContext(ctx).Create(user)
+	result := r.db.conn(ctx).Create(user)
 	if result.Error != nil {
 		return fmt.Errorf("failed to create user: %w", result.Error)
 	}
@@ -25,7 +30,7 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 
 func (r *UserRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
 	var user domain.User
-	result := r.db.Client.WithContext(ctx).First(&user, id)
+	result := r.db.conn(ctx).First(&user, id)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to get user by ID: %w", result.Error)
 	}
@@ -34,7 +39,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id int64) (*domain.User, e
 
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var user domain.User
-	result := r.db.Client.WithContext(ctx).Where("email = ?", email).First(&user)
+	result := r.db.conn(ctx).Where("email = ?", email).First(&user)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to get user by email: %w", result.Error)
 	}
@@ -42,25 +47,241 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.
 }
 
 func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
-	result := r.db.Client.WithContext(ctx).Save(user)
+	result := r.db.conn(ctx).Save(user)
 	if result.Error != nil {
 		return fmt.Errorf("failed to update user: %w", result.Error)
 	}
 	return nil
 }
 
+// Delete permanently removes the user and every row linked to it
 func (r *UserRepository) Delete(ctx context.Context, id int64) error {
-	result := r.db.Client.WithContext(ctx).Delete(&domain.User{}, id)
+	err := r.db.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		return deleteUser(tx, id)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
+// DeleteIfDeletionDue deletes the user like Delete, but only while its deletion is
+// still scheduled before the given time. The row is locked first, so a login that
+// cancels the deletion meanwhile either wins or waits. Returns false if it no
+// longer matched.
+func (r *UserRepository) DeleteIfDeletionDue(ctx context.Context, id int64, before time.Time) (bool, error) {
+	deleted := false
+	err := r.db.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var user domain.User
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND deletion_scheduled_at <= ?", id, before).
+			Limit(1).Find(&user)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		deleted = true
+		return deleteUser(tx, id)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
+	return deleted, nil
+}
+
+func deleteUser(tx *gorm.DB, id int64) error {
+	if err := tx.Where("user_id = ?", id).Delete(&domain.RefreshToken{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&domain.ActionToken{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&domain.UserRole{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&domain.KnownDevice{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&domain.UserIdentity{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&domain.OAuthAuthorizationCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&domain.OAuthConsent{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&domain.PersonalAccessToken{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&domain.LoginCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&domain.Membership{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&domain.SCIMUser{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&domain.User{}, id).Error
+}
+
+// ScheduleDeletion sets when the account will be purged, nil cancels a scheduled deletion
+func (r *UserRepository) ScheduleDeletion(ctx context.Context, id int64, at *time.Time) error {
+	result := r.db.conn(ctx).Model(&domain.User{}).Where("id = ?", id).Update("deletion_scheduled_at", at)
 	if result.Error != nil {
-		return fmt.Errorf("failed to delete user: %w", result.Error)
+		return fmt.Errorf("failed to schedule user deletion: %w", result.Error)
 	}
 	return nil
 }
 
+// GetDeletionDue returns the users whose grace period ended before the given time
+func (r *UserRepository) GetDeletionDue(ctx context.Context, before time.Time) ([]*domain.User, error) {
+	var users []*domain.User
+	result := r.db.conn(ctx).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", before).
+		Find(&users)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get users due for deletion: %w", result.Error)
+	}
+	return users, nil
+}
+
 func (r *UserRepository) MarkAsVerified(ctx context.Context, id int64) error {
-	result := r.db.Client.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Update("verified", true)
+	result := r.db.conn(ctx).Model(&domain.User{}).Where("id = ?", id).Update("verified", true)
 	if result.Error != nil {
 		return fmt.Errorf("failed to mark user as verified: %w", result.Error)
 	}
 	return nil
 }
+
+// UpdateEmail swaps the user's email in a single statement. The new address is
+// considered verified since the caller confirmed ownership of it. The token version is
+// bumped, so access tokens with the old email claim stop being accepted.
+func (r *UserRepository) UpdateEmail(ctx context.Context, id int64, email string) error {
+	result := r.db.conn(ctx).Model(&domain.User{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"email": email, "verified": true, "token_version": gorm.Expr("token_version + 1")})
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return domain.ErrEmailTaken
+		}
+		return fmt.Errorf("failed to update user email: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to update user email: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// UpdateProfile updates only the profile columns that are set, unlike Update
+// which saves the whole row
+func (r *UserRepository) UpdateProfile(ctx context.Context, id int64, profile *domain.ProfileUpdate) error {
+	fields := map[string]interface{}{}
+	if profile.DisplayName != nil {
+		fields["display_name"] = *profile.DisplayName
+	}
+	if profile.AvatarURL != nil {
+		fields["avatar_url"] = *profile.AvatarURL
+	}
+	if profile.Locale != nil {
+		fields["locale"] = *profile.Locale
+	}
+	if profile.Timezone != nil {
+		fields["timezone"] = *profile.Timezone
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	result := r.db.conn(ctx).Model(&domain.User{}).Where("id = ?", id).Updates(fields)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update user profile: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, id int64, hashedPassword string) error {
+	result := r.db.conn(ctx).Model(&domain.User{}).Where("id = ?", id).Update("password", hashedPassword)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update user password: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *UserRepository) UpdateStatus(ctx context.Context, id int64, status string) error {
+	result := r.db.conn(ctx).Model(&domain.User{}).Where("id = ?", id).Update("status", status)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update user status: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *UserRepository) List(ctx context.Context, filter *domain.UserFilter) ([]*domain.User, error) {
+	var users []*domain.User
+	query := r.filtered(ctx, filter).Order("created_at DESC, id DESC")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	result := query.Find(&users)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list users: %w", result.Error)
+	}
+	return users, nil
+}
+
+func (r *UserRepository) Count(ctx context.Context, filter *domain.UserFilter) (int64, error) {
+	var count int64
+	result := r.filtered(ctx, filter).Count(&count)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count users: %w", result.Error)
+	}
+	return count, nil
+}
+
+// Search returns users whose email or display name starts with the query, for quick lookups
+func (r *UserRepository) Search(ctx context.Context, query string, limit int) ([]*domain.User, error) {
+	var users []*domain.User
+	pattern := escapeLike(query) + "%"
+	result := r.db.conn(ctx).
+		Where("email ILIKE ? OR display_name ILIKE ?", pattern, pattern).
+		Order("email").
+		Limit(limit).
+		Find(&users)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to search users: %w", result.Error)
+	}
+	return users, nil
+}
+
+// filtered applies the filter's conditions to a users query
+func (r *UserRepository) filtered(ctx context.Context, filter *domain.UserFilter) *gorm.DB {
+	query := r.db.conn(ctx).Model(&domain.User{})
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		query = query.Where("email ILIKE ? OR display_name ILIKE ?", pattern, pattern)
+	}
+	if filter.Verified != nil {
+		query = query.Where("verified = ?", *filter.Verified)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
+	return query
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
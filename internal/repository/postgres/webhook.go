@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepository struct {
+	db *DB
+}
+
+func NewWebhookRepository(db *DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	result := r.db.conn(ctx).Create(subscription)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) GetSubscription(ctx context.Context, id int64) (*domain.WebhookSubscription, error) {
+	var subscription domain.WebhookSubscription
+	result := r.db.conn(ctx).First(&subscription, id)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", result.Error)
+	}
+	return &subscription, nil
+}
+
+func (r *WebhookRepository) ListSubscriptions(ctx context.Context) ([]*domain.WebhookSubscription, error) {
+	var subscriptions []*domain.WebhookSubscription
+	result := r.db.conn(ctx).Order("id").Find(&subscriptions)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", result.Error)
+	}
+	return subscriptions, nil
+}
+
+// DeleteSubscription removes the subscription together with its outbox and delivery log
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, id int64) error {
+	err := r.db.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		deliveries := tx.Model(&domain.WebhookDelivery{}).Select("id").Where("subscription_id = ?", id)
+		if err := tx.Where("delivery_id IN (?)", deliveries).Delete(&domain.WebhookAttempt{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subscription_id = ?", id).Delete(&domain.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.WebhookSubscription{}, id).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	return nil
+}
+
+// GetSubscriptionsForEvent returns the active subscriptions that selected the event or all events
+func (r *WebhookRepository) GetSubscriptionsForEvent(ctx context.Context, eventType string) ([]*domain.WebhookSubscription, error) {
+	event, _ := json.Marshal([]string{eventType})
+	all, _ := json.Marshal([]string{domain.EventAll})
+
+	var subscriptions []*domain.WebhookSubscription
+	result := r.db.conn(ctx).
+		Where("active AND (events @> ?::jsonb OR events @> ?::jsonb)", string(event), string(all)).
+		Find(&subscriptions)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get webhook subscriptions for event: %w", result.Error)
+	}
+	return subscriptions, nil
+}
+
+func (r *WebhookRepository) CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	result := r.db.conn(ctx).Create(delivery)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) GetDelivery(ctx context.Context, id int64) (*domain.WebhookDelivery, error) {
+	var delivery domain.WebhookDelivery
+	result := r.db.conn(ctx).First(&delivery, id)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", result.Error)
+	}
+	return &delivery, nil
+}
+
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, subscriptionID int64, limit int) ([]*domain.WebhookDelivery, error) {
+	var deliveries []*domain.WebhookDelivery
+	result := r.db.conn(ctx).
+		Where("subscription_id = ?", subscriptionID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&deliveries)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", result.Error)
+	}
+	return deliveries, nil
+}
+
+// ClaimDueDeliveries locks pending deliveries that are due and pushes their next attempt
+// back by the lease, so concurrent dispatchers (or a crashed one) don't send them twice
+// within the lease. Rows locked by another dispatcher are skipped.
+func (r *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.WebhookDelivery, error) {
+	var deliveries []*domain.WebhookDelivery
+	err := r.db.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", domain.DeliveryPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&deliveries)
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.ID)
+		}
+		if err := tx.Model(&domain.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error; err != nil {
+			return err
+		}
+
+		return tx.Preload("Subscription").Where("id IN ?", ids).Find(&deliveries).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	result := r.db.conn(ctx).Model(delivery).Select("status", "attempts", "next_attempt_at", "last_error", "delivered_at").Updates(delivery)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) CreateAttempt(ctx context.Context, attempt *domain.WebhookAttempt) error {
+	result := r.db.conn(ctx).Create(attempt)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create webhook attempt: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) ListAttempts(ctx context.Context, deliveryID int64) ([]*domain.WebhookAttempt, error) {
+	var attempts []*domain.WebhookAttempt
+	result := r.db.conn(ctx).Where("delivery_id = ?", deliveryID).Order("created_at, id").Find(&attempts)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list webhook attempts: %w", result.Error)
+	}
+	return attempts, nil
+}
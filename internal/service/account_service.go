@@ -0,0 +1,602 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+	"github.com/login_flow/auth-service/pkg/mailer"
+	"github.com/login_flow/auth-service/pkg/useragent"
+)
+
+var (
+	ErrReauthenticationFailed = errors.New("password confirmation failed")
+	ErrEmailUnchanged         = errors.New("new email is the same as the current one")
+	ErrMagicLinkWrongBrowser  = errors.New("magic link was requested from another browser")
+	ErrTooManyCodeAttempts    = errors.New("too many attempts for this code")
+	ErrTooManyLoginCodes      = errors.New("too many login codes requested")
+	ErrDirectoryManaged       = errors.New("account credentials are managed by the directory")
+)
+
+// AccountService handles self-service changes to an existing account
+type AccountService struct {
+	tx              domain.Transactor
+	userRepo        domain.UserRepository
+	tokenRepo       domain.TokenRepository
+	actionTokenRepo domain.ActionTokenRepository
+	knownDeviceRepo domain.KnownDeviceRepository
+	patRepo         domain.PersonalAccessTokenRepository
+	loginCodeRepo   domain.LoginCodeRepository
+	mailer          mailer.Mailer
+	audit           domain.AuditEmitter
+	events          domain.EventPublisher
+	cfg             *config.Config
+}
+
+func NewAccountService(tx domain.Transactor, userRepo domain.UserRepository, tokenRepo domain.TokenRepository, actionTokenRepo domain.ActionTokenRepository, knownDeviceRepo domain.KnownDeviceRepository, patRepo domain.PersonalAccessTokenRepository, loginCodeRepo domain.LoginCodeRepository, mailer mailer.Mailer, audit domain.AuditEmitter, events domain.EventPublisher, cfg *config.Config) *AccountService {
+	return &AccountService{
+		tx:              tx,
+		userRepo:        userRepo,
+		tokenRepo:       tokenRepo,
+		actionTokenRepo: actionTokenRepo,
+		knownDeviceRepo: knownDeviceRepo,
+		patRepo:         patRepo,
+		loginCodeRepo:   loginCodeRepo,
+		mailer:          mailer,
+		audit:           audit,
+		events:          events,
+		cfg:             cfg,
+	}
+}
+
+// reauthenticate checks the current password before a sensitive change,
+// so a stolen session alone is not enough to take over the account
+func (s *AccountService) reauthenticate(ctx context.Context, userID int64, password string) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	// There is no local password to confirm, and the directory owns the email
+	if user.IsDirectoryUser() {
+		return nil, ErrDirectoryManaged
+	}
+
+	if err := crypto.ComparePassword(user.Password, password); err != nil {
+		s.audit.Emit(ctx, &domain.AuditEvent{
+			Type:      domain.AuditReauthentication,
+			SubjectID: &user.ID,
+			Outcome:   domain.AuditFailure,
+			Reason:    "invalid_password",
+		})
+		return nil, ErrReauthenticationFailed
+	}
+
+	return user, nil
+}
+
+// createActionToken stores a new single-use token and returns its plain value for the email link.
+// Earlier unused tokens for the same purpose are invalidated so only the latest link works.
+func (s *AccountService) createActionToken(ctx context.Context, userID int64, purpose, data string, expiry time.Duration) (string, error) {
+	if err := s.actionTokenRepo.DeletePendingForUser(ctx, userID, purpose); err != nil {
+		return "", err
+	}
+
+	token, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate %s token: %w", purpose, err)
+	}
+
+	actionToken := &domain.ActionToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: crypto.HashToken(token),
+		Data:      data,
+		ExpiresAt: time.Now().Add(expiry),
+	}
+
+	if err := s.actionTokenRepo.Create(ctx, actionToken); err != nil {
+		return "", fmt.Errorf("failed to store %s token: %w", purpose, err)
+	}
+
+	return token, nil
+}
+
+// redeemActionToken validates a token from an email link and marks it as used
+func (s *AccountService) redeemActionToken(ctx context.Context, purpose, token string) (*domain.ActionToken, error) {
+	actionToken, err := s.actionTokenRepo.GetByHash(ctx, purpose, crypto.HashToken(token))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !actionToken.IsValid() {
+		return nil, ErrInvalidToken
+	}
+
+	if err := s.actionTokenRepo.Consume(ctx, actionToken.ID); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return actionToken, nil
+}
+
+// RequestEmailChange emails a confirmation link to the new address and a notice to the old one.
+// The email is only changed once the link is confirmed.
+func (s *AccountService) RequestEmailChange(ctx context.Context, userID int64, newEmail, password string) error {
+	user, err := s.reauthenticate(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(user.Email, newEmail) {
+		return ErrEmailUnchanged
+	}
+
+	existingUser, err := s.userRepo.GetByEmail(ctx, newEmail)
+	if err == nil && existingUser != nil {
+		return ErrUserAlreadyExists
+	}
+
+	token, err := s.createActionToken(ctx, user.ID, domain.ActionEmailChange, newEmail, s.cfg.Account.EmailChangeExpiry)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/confirm-email?token=%s", s.cfg.Server.AppURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Confirm that you want to use this address for your account by opening the link below:\n\n%s\n\nThe link expires in %s. If you didn't request this change, ignore this email.\n",
+		link, s.cfg.Account.EmailChangeExpiry)
+	if err := s.mailer.Send(ctx, newEmail, "Confirm your new email address", body); err != nil {
+		return fmt.Errorf("failed to send confirmation email: %w", err)
+	}
+
+	// The notice is informational, a delivery failure shouldn't block the change
+	notice := fmt.Sprintf("A request was made to change the email address of your account to %s.\n\nIf this wasn't you, change your password immediately.\n", newEmail)
+	if err := s.mailer.Send(ctx, user.Email, "Your email address is being changed", notice); err != nil {
+		log.Printf("failed to send email change notice to user %d: %v", user.ID, err)
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditEmailChangeRequested,
+		SubjectID: &user.ID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"old_email": user.Email, "new_email": newEmail},
+	})
+
+	return nil
+}
+
+// ConfirmEmailChange redeems an email change token and swaps the user's email
+func (s *AccountService) ConfirmEmailChange(ctx context.Context, token string) (*domain.User, error) {
+	actionToken, err := s.actionTokenRepo.GetByHash(ctx, domain.ActionEmailChange, crypto.HashToken(token))
+	if err != nil || !actionToken.IsValid() {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, actionToken.UserID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	oldEmail := user.Email
+
+	// The token is only consumed together with the update, so it isn't used up
+	// when another account took the address in the meantime. The refresh tokens of the
+	// sessions issued for the old address are revoked with it.
+	err = s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.actionTokenRepo.Consume(ctx, actionToken.ID); err != nil {
+			return err
+		}
+		if err := s.userRepo.UpdateEmail(ctx, actionToken.UserID, actionToken.Data); err != nil {
+			return err
+		}
+		return s.tokenRepo.RevokeAllForUser(ctx, actionToken.UserID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrTokenConsumed):
+			return nil, ErrInvalidToken
+		case errors.Is(err, domain.ErrEmailTaken):
+			return nil, ErrUserAlreadyExists
+		}
+		return nil, err
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditEmailChanged,
+		SubjectID: &actionToken.UserID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"old_email": oldEmail, "new_email": actionToken.Data},
+	})
+
+	s.events.Publish(ctx, domain.EventUserEmailChanged, map[string]interface{}{
+		"user_id":   actionToken.UserID,
+		"old_email": oldEmail,
+		"email":     actionToken.Data,
+	})
+
+	return s.userRepo.GetByID(ctx, actionToken.UserID)
+}
+
+// RequestPasswordReset emails a reset link if an active account uses this email.
+// It succeeds either way so the endpoint can't be used to discover accounts.
+func (s *AccountService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil || !user.IsActive() || user.IsDirectoryUser() {
+		return nil
+	}
+
+	return s.SendPasswordReset(ctx, user)
+}
+
+// SendPasswordReset emails the user a link to choose a new password. Directory users
+// change their password in the directory.
+func (s *AccountService) SendPasswordReset(ctx context.Context, user *domain.User) error {
+	if user.IsDirectoryUser() {
+		return ErrDirectoryManaged
+	}
+
+	token, err := s.createActionToken(ctx, user.ID, domain.ActionPasswordReset, "", s.cfg.Account.PasswordResetExpiry)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.cfg.Server.AppURL, url.QueryEscape(token))
+	body := fmt.Sprintf("A password reset was requested for your account. Choose a new password by opening the link below:\n\n%s\n\nThe link expires in %s. If you didn't request this, ignore this email.\n",
+		link, s.cfg.Account.PasswordResetExpiry)
+	if err := s.mailer.Send(ctx, user.Email, "Reset your password", body); err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password from a reset token and revokes all sessions
+func (s *AccountService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	actionToken, err := s.redeemActionToken(ctx, domain.ActionPasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := crypto.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, actionToken.UserID, hashedPassword); err != nil {
+		return err
+	}
+
+	// Whoever knew the old password may still hold a session or a personal access token
+	if err := s.tokenRepo.RevokeAllForUser(ctx, actionToken.UserID); err != nil {
+		return err
+	}
+	if err := s.patRepo.RevokeAllForUser(ctx, actionToken.UserID); err != nil {
+		return err
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditPasswordReset,
+		SubjectID: &actionToken.UserID,
+		Outcome:   domain.AuditSuccess,
+	})
+
+	return nil
+}
+
+// NotifySignIn records the device and IP of a successful sign-in and emails the user
+// when either is new. The very first sign-in never alerts. Failures are logged so
+// they can't block the login.
+//
+// The IP is the only location signal trusted here: it is the connection's address, or
+// X-Forwarded-For from TRUSTED_PROXIES only. The device comes from the client's own
+// User-Agent, so a known device alone never suppresses the alert, and a sign-in without
+// a known IP always counts as one from a new IP.
+func (s *AccountService) NotifySignIn(ctx context.Context, user *domain.User) {
+	client := domain.ClientInfoFromContext(ctx)
+	device := useragent.Describe(client.UserAgent)
+
+	sighting, err := s.knownDeviceRepo.Lookup(ctx, user.ID, device, client.IP)
+	if err != nil {
+		log.Printf("failed to check sign-in device for user %d: %v", user.ID, err)
+		return
+	}
+	if err := s.knownDeviceRepo.Record(ctx, user.ID, device, client.IP); err != nil {
+		log.Printf("failed to record sign-in device for user %d: %v", user.ID, err)
+	}
+	if client.IP == "" {
+		sighting.IPSeen = false
+	}
+
+	if !s.cfg.Account.LoginAlerts || sighting.FirstSignIn || (sighting.DeviceSeen && sighting.IPSeen) {
+		return
+	}
+
+	token, err := s.createActionToken(ctx, user.ID, domain.ActionSignInReport, "", s.cfg.Account.SignInReportExpiry)
+	if err != nil {
+		log.Printf("failed to create sign-in report token for user %d: %v", user.ID, err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/report-sign-in?token=%s", s.cfg.Server.AppURL, url.QueryEscape(token))
+	body := fmt.Sprintf("There was a new sign-in to your account from %s, %s on %s.\n\nIf this was you, there's nothing to do. If this wasn't you, open the link below to sign out everywhere and reset your password:\n\n%s\n",
+		device, client.IP, time.Now().UTC().Format(time.RFC1123), link)
+	if err := s.mailer.Send(ctx, user.Email, "New sign-in from "+device, body); err != nil {
+		log.Printf("failed to send sign-in alert to user %d: %v", user.ID, err)
+		return
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditNewSignInAlert,
+		SubjectID: &user.ID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"device": device, "new_device": !sighting.DeviceSeen, "new_ip": !sighting.IPSeen},
+	})
+}
+
+// ReportSignIn handles the "this wasn't me" link of a sign-in alert: every session is
+// revoked and a password reset email is sent. Refresh tokens are rotated on use, so
+// the reported session can't be told apart from the others and all of them go.
+func (s *AccountService) ReportSignIn(ctx context.Context, token string) error {
+	actionToken, err := s.redeemActionToken(ctx, domain.ActionSignInReport, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, actionToken.UserID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.tokenRepo.RevokeAllForUser(ctx, user.ID); err != nil {
+		return err
+	}
+	// Whoever had the session may have created tokens to keep access
+	if err := s.patRepo.RevokeAllForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditSignInReported,
+		SubjectID: &user.ID,
+		Outcome:   domain.AuditSuccess,
+	})
+
+	if user.IsDirectoryUser() {
+		return nil
+	}
+	return s.SendPasswordReset(ctx, user)
+}
+
+// SendMagicLink emails the user a single-use login link. The link only works together
+// with the nonce, which the caller keeps in the requesting browser, so a forwarded or
+// intercepted email can't be used to log in from somewhere else.
+func (s *AccountService) SendMagicLink(ctx context.Context, user *domain.User, nonce string) error {
+	token, err := s.createActionToken(ctx, user.ID, domain.ActionMagicLink, crypto.HashToken(nonce), s.cfg.Account.MagicLinkExpiry)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/magic-link?token=%s", s.cfg.Server.AppURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Log in to your account by opening the link below in the same browser you requested it from:\n\n%s\n\nThe link works once and expires in %s. If you didn't request this, ignore this email.\n",
+		link, s.cfg.Account.MagicLinkExpiry)
+	if err := s.mailer.Send(ctx, user.Email, "Your login link", body); err != nil {
+		return fmt.Errorf("failed to send magic link email: %w", err)
+	}
+
+	return nil
+}
+
+// RedeemMagicLink checks a magic link token against the nonce of the browser it is
+// opened in and marks it as used. The nonce is checked first, so opening a forwarded
+// link elsewhere doesn't burn it for the real user. With ErrMagicLinkWrongBrowser the
+// token is still returned, so the attempt can be audited for its user.
+func (s *AccountService) RedeemMagicLink(ctx context.Context, token, nonce string) (*domain.ActionToken, error) {
+	actionToken, err := s.actionTokenRepo.GetByHash(ctx, domain.ActionMagicLink, crypto.HashToken(token))
+	if err != nil || !actionToken.IsValid() {
+		return nil, ErrInvalidToken
+	}
+
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(crypto.HashToken(nonce)), []byte(actionToken.Data)) != 1 {
+		return actionToken, ErrMagicLinkWrongBrowser
+	}
+
+	if err := s.actionTokenRepo.Consume(ctx, actionToken.ID); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return actionToken, nil
+}
+
+// SendLoginCode emails the user a one-time code to log in with, replacing any code
+// sent before. Unlike a magic link the code can be typed on another device.
+// Each code allows OTP_MAX_ATTEMPTS guesses, so at most OTP_MAX_CODES_PER_HOUR codes
+// are issued per user an hour; otherwise requesting fresh codes would reset the limit.
+func (s *AccountService) SendLoginCode(ctx context.Context, user *domain.User) error {
+	issued, err := s.loginCodeRepo.CountCreatedSince(ctx, user.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if issued >= int64(s.cfg.Account.OTPMaxCodesPerHour) {
+		return ErrTooManyLoginCodes
+	}
+
+	if err := s.loginCodeRepo.ConsumePendingForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	code, err := crypto.GenerateNumericCode(s.cfg.Account.OTPLength)
+	if err != nil {
+		return err
+	}
+
+	loginCode := &domain.LoginCode{
+		UserID:    user.ID,
+		CodeHash:  s.hashLoginCode(user.ID, code),
+		ExpiresAt: time.Now().Add(s.cfg.Account.OTPExpiry),
+	}
+	if err := s.loginCodeRepo.Create(ctx, loginCode); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Your login code is:\n\n%s\n\nIt expires in %s. If you didn't request this, ignore this email and don't share the code with anyone.\n",
+		code, s.cfg.Account.OTPExpiry)
+	if err := s.mailer.Send(ctx, user.Email, "Your login code", body); err != nil {
+		return fmt.Errorf("failed to send login code email: %w", err)
+	}
+
+	return nil
+}
+
+// RedeemLoginCode checks a code against the user's pending code and marks it as used.
+// Every guess counts against the code, so it can't be brute-forced within its lifetime.
+func (s *AccountService) RedeemLoginCode(ctx context.Context, userID int64, code string) error {
+	loginCode, err := s.loginCodeRepo.GetPendingForUser(ctx, userID)
+	if err != nil || !loginCode.IsValid() {
+		return ErrInvalidToken
+	}
+
+	allowed, err := s.loginCodeRepo.RecordAttempt(ctx, loginCode.ID, s.cfg.Account.OTPMaxAttempts)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrTooManyCodeAttempts
+	}
+
+	if subtle.ConstantTimeCompare([]byte(s.hashLoginCode(userID, code)), []byte(loginCode.CodeHash)) != 1 {
+		return ErrInvalidToken
+	}
+
+	if err := s.loginCodeRepo.Consume(ctx, loginCode.ID); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+func (s *AccountService) hashLoginCode(userID int64, code string) string {
+	return crypto.HashCode(s.cfg.JWT.Secret, strconv.FormatInt(userID, 10), code)
+}
+
+// NotifyRegistrationDecision tells a user waiting for approval whether they can log in now
+func (s *AccountService) NotifyRegistrationDecision(ctx context.Context, user *domain.User, approved bool) error {
+	subject := "Your account was approved"
+	body := fmt.Sprintf("Your registration was approved. You can log in now:\n\n%s/login\n", s.cfg.Server.AppURL)
+	if !approved {
+		subject = "Your registration was declined"
+		body = "Your registration was declined and the account has been removed. If you think this is a mistake, contact the administrator.\n"
+	}
+
+	if err := s.mailer.Send(ctx, user.Email, subject, body); err != nil {
+		return fmt.Errorf("failed to send registration decision email: %w", err)
+	}
+	return nil
+}
+
+// ScheduleDeletion marks the account for deletion after the grace period and revokes all sessions.
+// Logging in again before the grace period ends cancels the deletion.
+func (s *AccountService) ScheduleDeletion(ctx context.Context, userID int64, password string) (*domain.User, error) {
+	user, err := s.reauthenticate(ctx, userID, password)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteAt := time.Now().Add(s.cfg.Account.DeletionGracePeriod)
+	if err := s.userRepo.ScheduleDeletion(ctx, user.ID, &deleteAt); err != nil {
+		return nil, err
+	}
+	user.DeletionScheduledAt = &deleteAt
+
+	if err := s.tokenRepo.RevokeAllForUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	notice := fmt.Sprintf("Your account is scheduled for deletion on %s.\n\nTo keep your account, log in again before then.\n",
+		deleteAt.UTC().Format(time.RFC1123))
+	if err := s.mailer.Send(ctx, user.Email, "Your account will be deleted", notice); err != nil {
+		log.Printf("failed to send deletion notice to user %d: %v", user.ID, err)
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditDeletionScheduled,
+		SubjectID: &user.ID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"delete_at": deleteAt},
+	})
+
+	return user, nil
+}
+
+// PurgeDeletedAccounts permanently removes accounts whose grace period has ended
+func (s *AccountService) PurgeDeletedAccounts(ctx context.Context) (int, error) {
+	now := time.Now()
+	users, err := s.userRepo.GetDeletionDue(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		// Checked again when deleting, the user may have logged in since and
+		// cancelled the deletion
+		deleted, err := s.userRepo.DeleteIfDeletionDue(ctx, user.ID, now)
+		if err != nil {
+			return purged, err
+		}
+		if !deleted {
+			continue
+		}
+		purged++
+
+		s.events.Publish(ctx, domain.EventUserDeleted, map[string]interface{}{"user_id": user.ID, "email": user.Email})
+	}
+
+	return purged, nil
+}
+
+// RunDeletionPurge calls PurgeDeletedAccounts every interval until ctx is cancelled
+func (s *AccountService) RunDeletionPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.PurgeDeletedAccounts(ctx)
+			if err != nil {
+				log.Printf("account deletion purge failed: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("purged %d deleted accounts", purged)
+			}
+		}
+	}
+}
+
+// UpdateProfile changes the given profile fields and returns the updated user
+func (s *AccountService) UpdateProfile(ctx context.Context, userID int64, profile *domain.ProfileUpdate) (*domain.User, error) {
+	if profile.DisplayName != nil {
+		displayName := strings.TrimSpace(*profile.DisplayName)
+		profile.DisplayName = &displayName
+	}
+
+	if err := s.userRepo.UpdateProfile(ctx, userID, profile); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+func TestConfirmEmailChange(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID := env.users.add(domain.User{Email: "jane@example.com", Verified: true})
+	user, _ := env.users.GetByID(ctx, userID)
+
+	oldAccessToken, _, err := env.auth.StartSession(ctx, user, "password")
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	token, err := env.account.createActionToken(ctx, userID, domain.ActionEmailChange, "jane.doe@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("createActionToken: %v", err)
+	}
+
+	user, err = env.account.ConfirmEmailChange(ctx, token)
+	if err != nil {
+		t.Fatalf("ConfirmEmailChange: %v", err)
+	}
+	if user.Email != "jane.doe@example.com" || !user.Verified {
+		t.Errorf("user = %+v, want the verified new email", user)
+	}
+
+	// Every session of the old address ends, its access tokens included
+	if _, err := env.auth.ValidateAccessToken(ctx, oldAccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ValidateAccessToken of a token with the old email error = %v, want ErrInvalidToken", err)
+	}
+	for _, refreshToken := range env.tokens.tokens {
+		if refreshToken.RevokedAt == nil {
+			t.Errorf("refresh token %q wasn't revoked", refreshToken.Token)
+		}
+	}
+
+	newAccessToken, _, err := env.auth.StartSession(ctx, user, "password")
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	claims, err := env.auth.ValidateAccessToken(ctx, newAccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken of a new session: %v", err)
+	}
+	if claims.Email != "jane.doe@example.com" {
+		t.Errorf("email claim = %q, want the new email", claims.Email)
+	}
+
+	if _, err := env.account.ConfirmEmailChange(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("second ConfirmEmailChange error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestConfirmEmailChangeToTakenAddress(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID := env.users.add(domain.User{Email: "jane@example.com", Verified: true})
+	env.users.add(domain.User{Email: "jane.doe@example.com", Verified: true})
+	user, _ := env.users.GetByID(ctx, userID)
+
+	accessToken, _, err := env.auth.StartSession(ctx, user, "password")
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	token, err := env.account.createActionToken(ctx, userID, domain.ActionEmailChange, "jane.doe@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("createActionToken: %v", err)
+	}
+
+	if _, err := env.account.ConfirmEmailChange(ctx, token); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Fatalf("ConfirmEmailChange error = %v, want ErrUserAlreadyExists", err)
+	}
+	if _, err := env.auth.ValidateAccessToken(ctx, accessToken); err != nil {
+		t.Errorf("ValidateAccessToken after a failed change: %v", err)
+	}
+}
+
+func TestResetPasswordRevokesSessionsAndTokens(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID := env.users.add(domain.User{Email: "jane@example.com", Verified: true})
+	user, _ := env.users.GetByID(ctx, userID)
+
+	if _, _, err := env.auth.StartSession(ctx, user, "password"); err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	env.pats.tokens = append(env.pats.tokens, &domain.PersonalAccessToken{UserID: userID, ExpiresAt: time.Now().Add(time.Hour)})
+	token, err := env.account.createActionToken(ctx, userID, domain.ActionPasswordReset, "", time.Hour)
+	if err != nil {
+		t.Fatalf("createActionToken: %v", err)
+	}
+
+	if err := env.account.ResetPassword(ctx, token, "new-password-123"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	for _, refreshToken := range env.tokens.tokens {
+		if refreshToken.RevokedAt == nil {
+			t.Errorf("refresh token %q wasn't revoked", refreshToken.Token)
+		}
+	}
+	for _, pat := range env.pats.tokens {
+		if pat.RevokedAt == nil {
+			t.Errorf("personal access token %d wasn't revoked", pat.ID)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+var (
+	ErrRoleNotFound     = errors.New("role not found")
+	ErrLastAdmin        = errors.New("cannot remove the last admin")
+	ErrCannotModifySelf = errors.New("admins cannot perform this action on their own account")
+	ErrUserNotPending   = errors.New("user is not waiting for approval")
+	ErrUserPending      = errors.New("user is waiting for approval, use /approve to let them in")
+)
+
+// AdminService backs the /api/admin endpoints
+type AdminService struct {
+	userRepo       domain.UserRepository
+	tokenRepo      domain.TokenRepository
+	roleRepo       domain.RoleRepository
+	accountService *AccountService
+	audit          domain.AuditEmitter
+	events         domain.EventPublisher
+	cfg            *config.Config
+}
+
+func NewAdminService(userRepo domain.UserRepository, tokenRepo domain.TokenRepository, roleRepo domain.RoleRepository, accountService *AccountService, audit domain.AuditEmitter, events domain.EventPublisher, cfg *config.Config) *AdminService {
+	return &AdminService{
+		userRepo:       userRepo,
+		tokenRepo:      tokenRepo,
+		roleRepo:       roleRepo,
+		accountService: accountService,
+		audit:          audit,
+		events:         events,
+		cfg:            cfg,
+	}
+}
+
+// recordAction audits an admin action on a user, the admin is taken from ctx
+func (s *AdminService) recordAction(ctx context.Context, action string, userID int64, metadata map[string]interface{}) {
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditAdminAction,
+		SubjectID: &userID,
+		Outcome:   domain.AuditSuccess,
+		Reason:    action,
+		Metadata:  metadata,
+	})
+}
+
+// UserDetails is a user as seen by an admin
+type UserDetails struct {
+	User     *domain.User
+	Roles    []string
+	Sessions []*domain.RefreshToken
+}
+
+// ListUsers returns one page of users matching the filter and the total number of matches
+func (s *AdminService) ListUsers(ctx context.Context, filter *domain.UserFilter) ([]*domain.User, int64, error) {
+	total, err := s.userRepo.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users, err := s.userRepo.List(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// SearchUsers finds users by email or display name prefix
+func (s *AdminService) SearchUsers(ctx context.Context, query string, limit int) ([]*domain.User, error) {
+	return s.userRepo.Search(ctx, query, limit)
+}
+
+// GetUserDetails returns a user with their roles and active sessions
+func (s *AdminService) GetUserDetails(ctx context.Context, userID int64) (*UserDetails, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	roles, err := s.roleRepo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.tokenRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserDetails{User: user, Roles: roles, Sessions: sessions}, nil
+}
+
+// SetUserDisabled disables or re-enables a user. Disabling also revokes all of the user's sessions.
+func (s *AdminService) SetUserDisabled(ctx context.Context, actorID, userID int64, disabled bool) error {
+	if actorID == userID {
+		return ErrCannotModifySelf
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	// Enabling is only the way back from disabled, it must not skip the approval queue
+	if !disabled && user.Status == domain.UserStatusPendingApproval {
+		return ErrUserPending
+	}
+
+	status := domain.UserStatusActive
+	if disabled {
+		status = domain.UserStatusDisabled
+	}
+
+	if err := s.userRepo.UpdateStatus(ctx, userID, status); err != nil {
+		return err
+	}
+
+	if disabled {
+		if err := s.tokenRepo.RevokeAllForUser(ctx, userID); err != nil {
+			return err
+		}
+		s.recordAction(ctx, "disable_user", userID, nil)
+		return nil
+	}
+
+	s.recordAction(ctx, "enable_user", userID, nil)
+	return nil
+}
+
+// ApproveUser lets a user waiting in the approval queue log in and emails them
+func (s *AdminService) ApproveUser(ctx context.Context, userID int64) error {
+	user, err := s.pendingUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdateStatus(ctx, userID, domain.UserStatusActive); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "approve_user", userID, nil)
+	// The approval stands even if the email fails, the user can log in anyway
+	if err := s.accountService.NotifyRegistrationDecision(ctx, user, true); err != nil {
+		log.Printf("failed to notify user %d of approval: %v", userID, err)
+	}
+	return nil
+}
+
+// RejectUser deletes an account waiting in the approval queue and emails the user
+func (s *AdminService) RejectUser(ctx context.Context, userID int64) error {
+	user, err := s.pendingUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.Delete(ctx, userID); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "reject_user", userID, map[string]interface{}{"email": user.Email})
+	s.events.Publish(ctx, domain.EventUserDeleted, map[string]interface{}{"user_id": user.ID, "email": user.Email})
+	if err := s.accountService.NotifyRegistrationDecision(ctx, user, false); err != nil {
+		log.Printf("failed to notify user %d of rejection: %v", userID, err)
+	}
+	return nil
+}
+
+func (s *AdminService) pendingUser(ctx context.Context, userID int64) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Status != domain.UserStatusPendingApproval {
+		return nil, ErrUserNotPending
+	}
+	return user, nil
+}
+
+// VerifyUser marks a user's email as verified without the verification email
+func (s *AdminService) VerifyUser(ctx context.Context, userID int64) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.userRepo.MarkAsVerified(ctx, userID); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "verify_user", userID, nil)
+	if !user.Verified {
+		s.events.Publish(ctx, domain.EventUserVerified, map[string]interface{}{"user_id": user.ID, "email": user.Email})
+	}
+	return nil
+}
+
+// TriggerPasswordReset sends the user a password reset email
+func (s *AdminService) TriggerPasswordReset(ctx context.Context, userID int64) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.accountService.SendPasswordReset(ctx, user); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "trigger_password_reset", userID, nil)
+	return nil
+}
+
+// RevokeSessions logs the user out everywhere
+func (s *AdminService) RevokeSessions(ctx context.Context, userID int64) error {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.tokenRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "revoke_sessions", userID, nil)
+	return nil
+}
+
+// ListRoles returns every role that can be assigned
+func (s *AdminService) ListRoles(ctx context.Context) ([]*domain.Role, error) {
+	return s.roleRepo.List(ctx)
+}
+
+// GetUserRoles returns the role names assigned to a user
+func (s *AdminService) GetUserRoles(ctx context.Context, userID int64) ([]string, error) {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, ErrUserNotFound
+	}
+	return s.roleRepo.GetUserRoles(ctx, userID)
+}
+
+// AssignRole gives a user a role. It takes effect on the user's next token refresh.
+func (s *AdminService) AssignRole(ctx context.Context, userID int64, roleName string) error {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return ErrUserNotFound
+	}
+
+	if _, err := s.roleRepo.GetByName(ctx, roleName); err != nil {
+		return ErrRoleNotFound
+	}
+
+	if err := s.roleRepo.AssignToUser(ctx, userID, roleName); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "assign_role", userID, map[string]interface{}{"role": roleName})
+	return nil
+}
+
+// RemoveRole takes a role away from a user, refusing to remove the last admin
+func (s *AdminService) RemoveRole(ctx context.Context, userID int64, roleName string) error {
+	roles, err := s.GetUserRoles(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.roleRepo.GetByName(ctx, roleName); err != nil {
+		return ErrRoleNotFound
+	}
+
+	if roleName == domain.RoleAdmin && slices.Contains(roles, domain.RoleAdmin) {
+		count, err := s.roleRepo.CountUsersWithRole(ctx, domain.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if count <= 1 {
+			return ErrLastAdmin
+		}
+	}
+
+	if err := s.roleRepo.RemoveFromUser(ctx, userID, roleName); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "remove_role", userID, map[string]interface{}{"role": roleName})
+	return nil
+}
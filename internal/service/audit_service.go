@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+// AuditSink receives a copy of every audit event, e.g. for shipping to a log pipeline
+type AuditSink interface {
+	Write(event *domain.AuditEvent) error
+}
+
+// AuditService records audit events in the database and forwards them to the configured sinks.
+// It implements domain.AuditEmitter.
+type AuditService struct {
+	auditRepo domain.AuditRepository
+	sinks     []AuditSink
+}
+
+func NewAuditService(auditRepo domain.AuditRepository, sinks ...AuditSink) *AuditService {
+	return &AuditService{
+		auditRepo: auditRepo,
+		sinks:     sinks,
+	}
+}
+
+// Emit records an event. The client IP, user agent and actor are taken from ctx
+// when the caller didn't set them. Failures are logged, never returned.
+func (s *AuditService) Emit(ctx context.Context, event *domain.AuditEvent) {
+	client := domain.ClientInfoFromContext(ctx)
+	if event.IP == "" {
+		event.IP = client.IP
+	}
+	if event.UserAgent == "" {
+		event.UserAgent = client.UserAgent
+	}
+	if event.ActorID == nil {
+		if actorID, ok := domain.ActorIDFromContext(ctx); ok {
+			event.ActorID = &actorID
+		}
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	if err := s.auditRepo.Create(ctx, event); err != nil {
+		log.Printf("failed to record audit event %s: %v", event.Type, err)
+	}
+
+	for _, sink := range s.sinks {
+		if err := sink.Write(event); err != nil {
+			log.Printf("failed to write audit event %s to sink: %v", event.Type, err)
+		}
+	}
+}
+
+// List returns one page of audit events matching the filter and the total number of matches
+func (s *AuditService) List(ctx context.Context, filter *domain.AuditFilter) ([]*domain.AuditEvent, int64, error) {
+	total, err := s.auditRepo.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events, err := s.auditRepo.List(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
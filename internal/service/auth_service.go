@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/login_flow/auth-service/internal/config"
@@ -13,32 +16,81 @@ import (
 )
 
 var (
-	ErrInvalidCredentials = errors.New("invalid email or password")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrUserAlreadyExists  = errors.New("user with this email already exists")
-	ErrInvalidToken       = errors.New("invalid or expired token")
-	ErrUserNotVerified    = errors.New("email not verified")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrUserAlreadyExists   = errors.New("user with this email already exists")
+	ErrInvalidToken        = errors.New("invalid or expired token")
+	ErrUserNotVerified     = errors.New("email not verified")
+	ErrUserDisabled        = errors.New("account disabled")
+	ErrMagicLinkDisabled   = errors.New("magic link login is disabled")
+	ErrOTPDisabled         = errors.New("one-time code login is disabled")
+	ErrRegistrationClosed  = errors.New("registration is closed")
+	ErrInvitationRequired  = errors.New("registration requires an invitation")
+	ErrUserPendingApproval = errors.New("account is waiting for approval")
+	ErrNotOrgMember        = errors.New("not a member of this organization")
+
+	ErrImpersonationNotAllowed = errors.New("this user can't be impersonated")
+	ErrNotImpersonating        = errors.New("not impersonating a user")
+
+	ErrAuthenticationUnavailable = errors.New("authentication backend unavailable")
 )
 
 type AuthService struct {
-	userRepo  domain.UserRepository
-	tokenRepo domain.TokenRepository
-	cfg       *config.Config
+	userRepo       domain.UserRepository
+	tokenRepo      domain.TokenRepository
+	roleRepo       domain.RoleRepository
+	orgRepo        domain.OrganizationRepository
+	accountService *AccountService
+	invitations    *InvitationService
+	audit          domain.AuditEmitter
+	events         domain.EventPublisher
+	cfg            *config.Config
+	authenticators []Authenticator // Password checks for Login, asked in order
 }
 
-func NewAuthService(userRepo domain.UserRepository, tokenRepo domain.TokenRepository, cfg *config.Config) *AuthService {
+func NewAuthService(userRepo domain.UserRepository, tokenRepo domain.TokenRepository, roleRepo domain.RoleRepository, orgRepo domain.OrganizationRepository, accountService *AccountService, invitations *InvitationService, audit domain.AuditEmitter, events domain.EventPublisher, cfg *config.Config, authenticators ...Authenticator) *AuthService {
 	return &AuthService{
-		userRepo:  userRepo,
-		tokenRepo: tokenRepo,
-		cfg:       cfg,
+		userRepo:       userRepo,
+		tokenRepo:      tokenRepo,
+		roleRepo:       roleRepo,
+		orgRepo:        orgRepo,
+		accountService: accountService,
+		invitations:    invitations,
+		audit:          audit,
+		events:         events,
+		cfg:            cfg,
+		authenticators: authenticators,
 	}
 }
 
-// Register creates a new user account
-func (s *AuthService) Register(ctx context.Context, email, password string) (*domain.User, error) {
+// Register creates a new user account. Depending on the registration mode an
+// invitation token is required; with one the account also gets the invited role.
+func (s *AuthService) Register(ctx context.Context, email, password, inviteToken string) (*domain.User, error) {
+	switch s.cfg.Registration.Mode {
+	case config.RegistrationClosed:
+		s.registerFailed(ctx, email, "registration_closed")
+		return nil, ErrRegistrationClosed
+	case config.RegistrationInviteOnly:
+		if inviteToken == "" {
+			s.registerFailed(ctx, email, "invitation_required")
+			return nil, ErrInvitationRequired
+		}
+	}
+
+	var invitation *domain.Invitation
+	if inviteToken != "" {
+		var err error
+		invitation, err = s.invitations.validate(ctx, inviteToken, email)
+		if err != nil {
+			s.registerFailed(ctx, email, "invalid_invitation")
+			return nil, err
+		}
+	}
+
 	// Check if user already exists
 	existingUser, err := s.userRepo.GetByEmail(ctx, email)
 	if err == nil && existingUser != nil {
+		s.registerFailed(ctx, email, "email_taken")
 		return nil, ErrUserAlreadyExists
 	}
 
@@ -48,54 +100,320 @@ func (s *AuthService) Register(ctx context.Context, email, password string) (*do
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Create user
-	user := &domain.User{
+	// Invitations come from an admin, so those accounts are approved already
+	user, err := s.createUser(ctx, &domain.User{
 		Email:    email,
 		Password: hashedPassword,
-		Verified: false, // Email verification required
+		Status:   s.newAccountStatus(invitation != nil),
+	}, "password")
+	if err != nil {
+		return nil, err
+	}
+
+	if invitation != nil {
+		if invitation.Role != domain.RoleUser {
+			if err := s.roleRepo.AssignToUser(ctx, user.ID, invitation.Role); err != nil {
+				return nil, fmt.Errorf("failed to assign invited role: %w", err)
+			}
+		}
+		// The email is unique, so a second use of the same invitation already failed above
+		if err := s.invitations.accept(ctx, invitation, user.ID); err != nil {
+			log.Printf("failed to mark invitation %d as accepted: %v", invitation.ID, err)
+		}
+	}
+
+	return user, nil
+}
+
+// newAccountStatus is the status of a new account, which waits for approval when
+// the registration approval queue is on and nobody invited the user
+func (s *AuthService) newAccountStatus(invited bool) string {
+	if s.cfg.Registration.RequireApproval && !invited {
+		return domain.UserStatusPendingApproval
+	}
+	return domain.UserStatusActive
+}
+
+// openSignUp tells whether new accounts may be created without an invitation,
+// e.g. on the first login with an external provider
+func (s *AuthService) openSignUp() bool {
+	return s.cfg.Registration.Mode == config.RegistrationOpen
+}
+
+func (s *AuthService) registerFailed(ctx context.Context, email, reason string) {
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:     domain.AuditRegister,
+		Outcome:  domain.AuditFailure,
+		Reason:   reason,
+		Metadata: map[string]interface{}{"email": email},
+	})
+}
+
+// createUser stores a new account with the default role. method records how the
+// user signed up (password, or the external login provider).
+func (s *AuthService) createUser(ctx context.Context, user *domain.User, method string) (*domain.User, error) {
+	user.Verified = false // Email verification required
+	if user.AuthSource == "" {
+		user.AuthSource = domain.AuthSourceLocal
 	}
 
 	if err := s.userRepo.Create(ctx, user); err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	if err := s.roleRepo.AssignToUser(ctx, user.ID, domain.RoleUser); err != nil {
+		return nil, fmt.Errorf("failed to assign default role: %w", err)
+	}
+
 	// TODO: Send verification email
 	// For now, auto-verify for testing
 	if err := s.userRepo.MarkAsVerified(ctx, user.ID); err != nil {
 		return nil, fmt.Errorf("failed to verify user: %w", err)
 	}
+	user.Verified = true
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditRegister,
+		ActorID:   &user.ID,
+		SubjectID: &user.ID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"method": method},
+	})
+
+	s.events.Publish(ctx, domain.EventUserRegistered, map[string]interface{}{"user_id": user.ID, "email": user.Email})
+	s.events.Publish(ctx, domain.EventUserVerified, map[string]interface{}{"user_id": user.ID, "email": user.Email})
 
 	return user, nil
 }
 
-// Login authenticates a user and returns tokens
+// Login authenticates a user with the authenticator chain and returns tokens
 func (s *AuthService) Login(ctx context.Context, email, password string) (accessToken, refreshToken string, user *domain.User, err error) {
-	// Get user by email
-	user, err = s.userRepo.GetByEmail(ctx, email)
+	result, method, err := s.authenticate(ctx, email, password)
 	if err != nil {
-		return "", "", nil, ErrInvalidCredentials
+		return "", "", nil, err
 	}
 
-	// Verify password
-	if err := crypto.ComparePassword(user.Password, password); err != nil {
-		return "", "", nil, ErrInvalidCredentials
+	user = result.User
+	if user == nil {
+		user, err = s.provisionUser(ctx, result, method)
+		if err != nil {
+			return "", "", nil, err
+		}
+	} else if result.DisplayName != "" && result.DisplayName != user.DisplayName {
+		// Directory profiles win, like the directory password
+		if err := s.userRepo.UpdateProfile(ctx, user.ID, &domain.ProfileUpdate{DisplayName: &result.DisplayName}); err != nil {
+			log.Printf("failed to update display name of user %d: %v", user.ID, err)
+		} else {
+			user.DisplayName = result.DisplayName
+		}
 	}
 
 	// Check if email is verified
 	if !user.Verified {
+		s.loginFailed(ctx, email, &user.ID, "email_not_verified")
 		return "", "", nil, ErrUserNotVerified
 	}
 
+	if user.Status == domain.UserStatusPendingApproval {
+		s.loginFailed(ctx, email, &user.ID, "pending_approval")
+		return "", "", nil, ErrUserPendingApproval
+	}
+
+	if !user.IsActive() {
+		s.loginFailed(ctx, email, &user.ID, "account_disabled")
+		return "", "", nil, ErrUserDisabled
+	}
+
+	accessToken, refreshToken, err = s.StartSession(ctx, user, method)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return accessToken, refreshToken, user, nil
+}
+
+// authenticate asks each authenticator in turn until one handles the email, and
+// returns its result with the authenticator's name
+func (s *AuthService) authenticate(ctx context.Context, email, password string) (*Authenticated, string, error) {
+	for _, authenticator := range s.authenticators {
+		result, err := authenticator.Authenticate(ctx, email, password)
+		switch {
+		case err == nil:
+			return result, authenticator.Name(), nil
+		case errors.Is(err, ErrNotHandled):
+			continue
+		case errors.Is(err, ErrInvalidCredentials):
+			s.loginFailed(ctx, email, s.userIDByEmail(ctx, email), "invalid_password")
+			return nil, "", ErrInvalidCredentials
+		case errors.Is(err, ErrIdentityConflict):
+			s.loginFailed(ctx, email, nil, authenticator.Name()+"_identity_conflict")
+			return nil, "", ErrInvalidCredentials
+		default:
+			// Fail closed: the next authenticator must not answer for this one's users
+			log.Printf("%s authenticator failed: %v", authenticator.Name(), err)
+			s.loginFailed(ctx, email, nil, authenticator.Name()+"_unavailable")
+			return nil, "", ErrAuthenticationUnavailable
+		}
+	}
+
+	s.loginFailed(ctx, email, nil, "unknown_email")
+	return nil, "", ErrInvalidCredentials
+}
+
+// provisionUser creates the account of a user an external store (the directory)
+// authenticated for the first time. The store vouches for them, so neither the
+// registration mode nor the approval queue apply. The account has no local password.
+func (s *AuthService) provisionUser(ctx context.Context, result *Authenticated, method string) (*domain.User, error) {
+	return s.createUser(ctx, &domain.User{
+		Email:       result.Email,
+		Status:      domain.UserStatusActive,
+		AuthSource:  result.Source,
+		DisplayName: result.DisplayName,
+	}, method)
+}
+
+// userIDByEmail returns the ID of the account with the email for audit events, nil if there is none
+func (s *AuthService) userIDByEmail(ctx context.Context, email string) *int64 {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+	return &user.ID
+}
+
+// RequestMagicLink emails a login link if an active, verified account exists for the
+// email. Like a password reset request it doesn't tell whether the account exists.
+func (s *AuthService) RequestMagicLink(ctx context.Context, email, nonce string) error {
+	if !s.cfg.Account.MagicLinkEnabled {
+		return ErrMagicLinkDisabled
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil || !user.Verified || !user.IsActive() || user.IsDirectoryUser() {
+		return nil
+	}
+
+	return s.accountService.SendMagicLink(ctx, user, nonce)
+}
+
+// LoginWithMagicLink starts a session from a magic link opened in the browser that requested it
+func (s *AuthService) LoginWithMagicLink(ctx context.Context, token, nonce string) (accessToken, refreshToken string, user *domain.User, err error) {
+	if !s.cfg.Account.MagicLinkEnabled {
+		return "", "", nil, ErrMagicLinkDisabled
+	}
+
+	actionToken, err := s.accountService.RedeemMagicLink(ctx, token, nonce)
+	if err != nil {
+		if errors.Is(err, ErrMagicLinkWrongBrowser) {
+			s.loginFailed(ctx, "", &actionToken.UserID, "magic_link_wrong_browser")
+		} else {
+			s.loginFailed(ctx, "", nil, "invalid_magic_link")
+		}
+		return "", "", nil, err
+	}
+
+	user, err = s.userRepo.GetByID(ctx, actionToken.UserID)
+	if err != nil {
+		return "", "", nil, ErrUserNotFound
+	}
+
+	// The account may have been disabled after the link was sent
+	if user.Status == domain.UserStatusPendingApproval {
+		s.loginFailed(ctx, user.Email, &user.ID, "pending_approval")
+		return "", "", nil, ErrUserPendingApproval
+	}
+	if !user.IsActive() {
+		s.loginFailed(ctx, user.Email, &user.ID, "account_disabled")
+		return "", "", nil, ErrUserDisabled
+	}
+
+	accessToken, refreshToken, err = s.StartSession(ctx, user, "magic_link")
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return accessToken, refreshToken, user, nil
+}
+
+// RequestLoginCode emails a one-time code if an active, verified account exists for
+// the email, without telling whether it does.
+func (s *AuthService) RequestLoginCode(ctx context.Context, email string) error {
+	if !s.cfg.Account.OTPEnabled {
+		return ErrOTPDisabled
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil || !user.Verified || !user.IsActive() || user.IsDirectoryUser() {
+		return nil
+	}
+
+	// Answering differently would tell that the account exists
+	if err := s.accountService.SendLoginCode(ctx, user); err != nil && !errors.Is(err, ErrTooManyLoginCodes) {
+		return err
+	}
+	return nil
+}
+
+// LoginWithCode starts a session from an emailed one-time code
+func (s *AuthService) LoginWithCode(ctx context.Context, email, code string) (accessToken, refreshToken string, user *domain.User, err error) {
+	if !s.cfg.Account.OTPEnabled {
+		return "", "", nil, ErrOTPDisabled
+	}
+
+	user, err = s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		s.loginFailed(ctx, email, nil, "unknown_email")
+		return "", "", nil, ErrInvalidToken
+	}
+
+	if err := s.accountService.RedeemLoginCode(ctx, user.ID, code); err != nil {
+		if errors.Is(err, ErrTooManyCodeAttempts) {
+			s.loginFailed(ctx, email, &user.ID, "otp_attempts_exceeded")
+		} else {
+			s.loginFailed(ctx, email, &user.ID, "invalid_otp")
+		}
+		return "", "", nil, err
+	}
+
+	if user.Status == domain.UserStatusPendingApproval {
+		s.loginFailed(ctx, email, &user.ID, "pending_approval")
+		return "", "", nil, ErrUserPendingApproval
+	}
+	if !user.IsActive() {
+		s.loginFailed(ctx, email, &user.ID, "account_disabled")
+		return "", "", nil, ErrUserDisabled
+	}
+
+	accessToken, refreshToken, err = s.StartSession(ctx, user, "otp")
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return accessToken, refreshToken, user, nil
+}
+
+// StartSession issues the tokens of a new session for an authenticated user.
+// Every login method ends here; method is recorded in the audit log.
+func (s *AuthService) StartSession(ctx context.Context, user *domain.User, method string) (accessToken, refreshToken string, err error) {
+	// Logging in during the grace period cancels a scheduled deletion
+	if user.DeletionScheduledAt != nil {
+		if err := s.userRepo.ScheduleDeletion(ctx, user.ID, nil); err != nil {
+			return "", "", fmt.Errorf("failed to cancel account deletion: %w", err)
+		}
+		user.DeletionScheduledAt = nil
+	}
+
 	// Generate access token
-	accessToken, err = jwt.GenerateAccessToken(user.ID, user.Email, s.cfg.JWT.Secret, s.cfg.JWT.AccessExpiry)
+	authTime := time.Now()
+	accessToken, err = s.generateAccessToken(ctx, user, authTime, nil)
 	if err != nil {
-		return "", "", nil, fmt.Errorf("failed to generate access token: %w", err)
+		return "", "", err
 	}
 
 	// Generate refresh token
 	refreshToken, err = crypto.GenerateRandomToken(32)
 	if err != nil {
-		return "", "", nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
 	// Store refresh token in database
@@ -103,25 +421,113 @@ func (s *AuthService) Login(ctx context.Context, email, password string) (access
 		UserID:    user.ID,
 		Token:     refreshToken,
 		ExpiresAt: time.Now().Add(s.cfg.JWT.RefreshExpiry),
+		AuthTime:  &authTime,
 	}
 
 	if err := s.tokenRepo.Create(ctx, refreshTokenModel); err != nil {
-		return "", "", nil, fmt.Errorf("failed to store refresh token: %w", err)
+		return "", "", fmt.Errorf("failed to store refresh token: %w", err)
 	}
 
-	return accessToken, refreshToken, user, nil
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditLogin,
+		ActorID:   &user.ID,
+		SubjectID: &user.ID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"method": method},
+	})
+
+	// Emails the user if this device or IP is new for them
+	s.accountService.NotifySignIn(ctx, user)
+
+	return accessToken, refreshToken, nil
+}
+
+// loginFailed records a failed login attempt with the reason it was rejected
+func (s *AuthService) loginFailed(ctx context.Context, email string, userID *int64, reason string) {
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditLogin,
+		SubjectID: userID,
+		Outcome:   domain.AuditFailure,
+		Reason:    reason,
+		Metadata:  map[string]interface{}{"email": email},
+	})
 }
 
 // RefreshAccessToken generates a new access token using a refresh token
 func (s *AuthService) RefreshAccessToken(ctx context.Context, refreshTokenStr string) (string, string, error) {
+	return s.rotateSession(ctx, refreshTokenStr, func(session *domain.RefreshToken) (*int64, error) {
+		return session.OrgID, nil
+	})
+}
+
+// SwitchOrganization re-issues the tokens of the user's session with orgID as the
+// active organization. An orgID of 0 leaves the organization.
+func (s *AuthService) SwitchOrganization(ctx context.Context, userID int64, refreshTokenStr string, orgID int64) (string, string, error) {
+	return s.rotateSession(ctx, refreshTokenStr, func(session *domain.RefreshToken) (*int64, error) {
+		if session.UserID != userID {
+			return nil, ErrInvalidToken
+		}
+		if orgID == 0 {
+			return nil, nil
+		}
+		if _, err := s.orgRepo.GetMembership(ctx, orgID, userID); err != nil {
+			return nil, ErrNotOrgMember
+		}
+		return &orgID, nil
+	})
+}
+
+// rotateSession replaces a refresh token with a new pair of tokens. selectOrg picks
+// the active organization of the new tokens from the session being rotated.
+func (s *AuthService) rotateSession(ctx context.Context, refreshTokenStr string, selectOrg func(session *domain.RefreshToken) (*int64, error)) (string, string, error) {
 	// Get refresh token from database
 	refreshToken, err := s.tokenRepo.GetByToken(ctx, refreshTokenStr)
 	if err != nil {
+		s.audit.Emit(ctx, &domain.AuditEvent{
+			Type:    domain.AuditRefresh,
+			Outcome: domain.AuditFailure,
+			Reason:  "unknown_token",
+		})
+		return "", "", ErrInvalidToken
+	}
+
+	// Tokens issued to OAuth clients are refreshed at /oauth/token with the
+	// client's credentials, they must not turn into a session of our own
+	if refreshToken.ClientID != "" {
+		s.audit.Emit(ctx, &domain.AuditEvent{
+			Type:      domain.AuditRefresh,
+			SubjectID: &refreshToken.UserID,
+			Outcome:   domain.AuditFailure,
+			Reason:    "client_token",
+		})
+		return "", "", ErrInvalidToken
+	}
+
+	// Rotation revokes a refresh token as soon as it is used, so a revoked token
+	// showing up again means it was copied. Revoke every session of the user,
+	// which also kills the copy that was already rotated by the other party.
+	if refreshToken.RevokedAt != nil {
+		if err := s.tokenRepo.RevokeAllForUser(ctx, refreshToken.UserID); err != nil {
+			return "", "", fmt.Errorf("failed to revoke sessions after token reuse: %w", err)
+		}
+		s.audit.Emit(ctx, &domain.AuditEvent{
+			Type:      domain.AuditRefreshReuse,
+			SubjectID: &refreshToken.UserID,
+			Outcome:   domain.AuditFailure,
+			Reason:    "revoked_token_reused",
+			Metadata:  map[string]interface{}{"session_id": refreshToken.ID},
+		})
 		return "", "", ErrInvalidToken
 	}
 
 	// Check if token is valid
 	if !refreshToken.IsValid() {
+		s.audit.Emit(ctx, &domain.AuditEvent{
+			Type:      domain.AuditRefresh,
+			SubjectID: &refreshToken.UserID,
+			Outcome:   domain.AuditFailure,
+			Reason:    "expired",
+		})
 		return "", "", ErrInvalidToken
 	}
 
@@ -131,10 +537,27 @@ func (s *AuthService) RefreshAccessToken(ctx context.Context, refreshTokenStr st
 		return "", "", ErrUserNotFound
 	}
 
-	// Generate new access token
-	newAccessToken, err := jwt.GenerateAccessToken(user.ID, user.Email, s.cfg.JWT.Secret, s.cfg.JWT.AccessExpiry)
+	if !user.IsActive() {
+		s.audit.Emit(ctx, &domain.AuditEvent{
+			Type:      domain.AuditRefresh,
+			SubjectID: &user.ID,
+			Outcome:   domain.AuditFailure,
+			Reason:    "account_disabled",
+		})
+		return "", "", ErrUserDisabled
+	}
+
+	orgID, err := selectOrg(refreshToken)
+	if err != nil {
+		return "", "", err
+	}
+	membership := s.activeMembership(ctx, user.ID, orgID)
+
+	// Generate new access token (roles are re-read so changes apply on the next refresh)
+	authTime := refreshToken.AuthenticatedAt()
+	newAccessToken, err := s.generateAccessToken(ctx, user, authTime, membership)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate access token: %w", err)
+		return "", "", err
 	}
 
 	// Rotate refresh token (optional but recommended)
@@ -153,23 +576,269 @@ func (s *AuthService) RefreshAccessToken(ctx context.Context, refreshTokenStr st
 		UserID:    user.ID,
 		Token:     newRefreshToken,
 		ExpiresAt: time.Now().Add(s.cfg.JWT.RefreshExpiry),
+		AuthTime:  &authTime,
+	}
+	if membership != nil {
+		newRefreshTokenModel.OrgID = &membership.OrgID
 	}
 
 	if err := s.tokenRepo.Create(ctx, newRefreshTokenModel); err != nil {
 		return "", "", fmt.Errorf("failed to store refresh token: %w", err)
 	}
 
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditRefresh,
+		ActorID:   &user.ID,
+		SubjectID: &user.ID,
+		Outcome:   domain.AuditSuccess,
+	})
+
 	return newAccessToken, newRefreshToken, nil
 }
 
+// activeMembership returns the user's membership in the session's organization. It is
+// nil without an organization, or once the user was removed from it, so the session
+// falls back to no organization instead of failing.
+func (s *AuthService) activeMembership(ctx context.Context, userID int64, orgID *int64) *domain.Membership {
+	if orgID == nil {
+		return nil
+	}
+	membership, err := s.orgRepo.GetMembership(ctx, *orgID, userID)
+	if err != nil {
+		return nil
+	}
+	return membership
+}
+
+// generateAccessToken signs an access token carrying the user's current roles and permissions.
+// authTime is when the user logged in to start the session. With a membership the token
+// also carries the active organization and the user's role in it.
+func (s *AuthService) generateAccessToken(ctx context.Context, user *domain.User, authTime time.Time, membership *domain.Membership) (string, error) {
+	claims, err := s.sessionClaims(ctx, user, authTime, membership)
+	if err != nil {
+		return "", err
+	}
+
+	accessToken, err := jwt.GenerateAccessToken(claims, s.cfg.JWT.Secret, s.cfg.JWT.AccessExpiry)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate access token: %w", err)
+	}
+	return accessToken, nil
+}
+
+// sessionClaims returns the claims of an access token for the user's session
+func (s *AuthService) sessionClaims(ctx context.Context, user *domain.User, authTime time.Time, membership *domain.Membership) (*jwt.Claims, error) {
+	roles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.roleRepo.GetUserPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &jwt.Claims{
+		UserID:       user.ID,
+		Email:        user.Email,
+		Roles:        roles,
+		Permissions:  permissions,
+		AuthTime:     jwt.NewNumericDate(authTime),
+		TokenVersion: user.TokenVersion,
+	}
+	if membership != nil {
+		claims.OrgID = &membership.OrgID
+		claims.OrgRole = membership.Role
+	}
+	return claims, nil
+}
+
+// Impersonate issues an access token that lets an admin act as the user to debug their
+// account. The token carries the admin in its "act" claim, lives ADMIN_IMPERSONATION_EXPIRY
+// and has no refresh token, so the admin's own session is left as it is. Admins and
+// accounts that aren't active can't be impersonated.
+func (s *AuthService) Impersonate(ctx context.Context, adminID, userID int64, reason string) (string, time.Time, error) {
+	if adminID == userID {
+		return "", time.Time{}, ErrImpersonationNotAllowed
+	}
+
+	admin, err := s.userRepo.GetByID(ctx, adminID)
+	if err != nil {
+		return "", time.Time{}, ErrUserNotFound
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return "", time.Time{}, ErrUserNotFound
+	}
+	if !user.IsActive() {
+		return "", time.Time{}, ErrUserDisabled
+	}
+
+	// Impersonating an admin would hand out their permissions
+	roles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if slices.Contains(roles, domain.RoleAdmin) {
+		return "", time.Time{}, ErrImpersonationNotAllowed
+	}
+
+	claims, err := s.sessionClaims(ctx, user, time.Now(), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	claims.Act = &jwt.Actor{Subject: strconv.FormatInt(admin.ID, 10), UserID: admin.ID, Email: admin.Email}
+
+	accessToken, err := jwt.GenerateAccessToken(claims, s.cfg.JWT.Secret, s.cfg.Admin.ImpersonationExpiry)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate access token: %w", err)
+	}
+	expiresAt := claims.ExpiresAt.Time
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditImpersonationStarted,
+		ActorID:   &admin.ID,
+		SubjectID: &user.ID,
+		Outcome:   domain.AuditSuccess,
+		Reason:    reason,
+		Metadata:  map[string]interface{}{"token_id": claims.ID, "expires_at": expiresAt},
+	})
+
+	return accessToken, expiresAt, nil
+}
+
+// ValidateImpersonation checks that an impersonation token is still usable: it wasn't
+// stopped, and the admin is still active and allowed to impersonate
+func (s *AuthService) ValidateImpersonation(ctx context.Context, claims *jwt.Claims) error {
+	if claims.Act == nil {
+		return ErrNotImpersonating
+	}
+
+	revoked, err := s.tokenRepo.IsAccessTokenRevoked(ctx, claims.ID)
+	if err != nil || revoked {
+		return ErrInvalidToken
+	}
+
+	admin, err := s.userRepo.GetByID(ctx, claims.Act.UserID)
+	if err != nil || !admin.IsActive() {
+		return ErrInvalidToken
+	}
+	permissions, err := s.roleRepo.GetUserPermissions(ctx, admin.ID)
+	if err != nil || !slices.Contains(permissions, domain.PermissionUsersImpersonate) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// RecordImpersonatedRequest audits a request made with an impersonation token
+func (s *AuthService) RecordImpersonatedRequest(ctx context.Context, claims *jwt.Claims, method, path string, status int) {
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditImpersonatedRequest,
+		ActorID:   &claims.Act.UserID,
+		SubjectID: &claims.UserID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"method": method, "path": path, "status": status, "token_id": claims.ID},
+	})
+}
+
+// StopImpersonation revokes an impersonation token before it expires
+func (s *AuthService) StopImpersonation(ctx context.Context, claims *jwt.Claims) error {
+	if claims.Act == nil {
+		return ErrNotImpersonating
+	}
+
+	if err := s.tokenRepo.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return fmt.Errorf("failed to revoke impersonation token: %w", err)
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditImpersonationStopped,
+		ActorID:   &claims.Act.UserID,
+		SubjectID: &claims.UserID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"token_id": claims.ID},
+	})
+	return nil
+}
+
+// ResumeSession rotates the refresh token of the user's own session, e.g. to give an
+// admin their session back after impersonating. The session must belong to userID.
+func (s *AuthService) ResumeSession(ctx context.Context, userID int64, refreshTokenStr string) (string, string, error) {
+	return s.rotateSession(ctx, refreshTokenStr, func(session *domain.RefreshToken) (*int64, error) {
+		if session.UserID != userID {
+			return nil, ErrInvalidToken
+		}
+		return session.OrgID, nil
+	})
+}
+
+// BootstrapAdmin grants the admin role to the account configured in ADMIN_BOOTSTRAP_EMAIL.
+// It only runs while no admin exists, so the setting can't be used to regain access later.
+func (s *AuthService) BootstrapAdmin(ctx context.Context) error {
+	email := s.cfg.Admin.BootstrapEmail
+	if email == "" {
+		return nil
+	}
+
+	count, err := s.roleRepo.CountUsersWithRole(ctx, domain.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("bootstrap admin %s must register before it can be promoted: %w", email, err)
+	}
+
+	// Nobody could approve the first admin otherwise
+	if user.Status == domain.UserStatusPendingApproval {
+		if err := s.userRepo.UpdateStatus(ctx, user.ID, domain.UserStatusActive); err != nil {
+			return err
+		}
+	}
+
+	return s.roleRepo.AssignToUser(ctx, user.ID, domain.RoleAdmin)
+}
+
 // Logout revokes a refresh token
 func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
-	return s.tokenRepo.Revoke(ctx, refreshToken)
+	if err := s.tokenRepo.Revoke(ctx, refreshToken); err != nil {
+		return err
+	}
+
+	event := &domain.AuditEvent{Type: domain.AuditLogout, Outcome: domain.AuditSuccess}
+	if token, err := s.tokenRepo.GetByToken(ctx, refreshToken); err == nil {
+		event.ActorID = &token.UserID
+		event.SubjectID = &token.UserID
+	}
+	s.audit.Emit(ctx, event)
+
+	return nil
 }
 
-// ValidateAccessToken validates an access token and returns claims
-func (s *AuthService) ValidateAccessToken(tokenStr string) (*jwt.Claims, error) {
-	return jwt.ValidateToken(tokenStr, s.cfg.JWT.Secret)
+// ValidateAccessToken validates an access token and returns claims. Tokens issued
+// before the user's token version was bumped (see domain.User.TokenVersion) are
+// rejected even though they haven't expired yet.
+func (s *AuthService) ValidateAccessToken(ctx context.Context, tokenStr string) (*jwt.Claims, error) {
+	claims, err := jwt.ValidateToken(tokenStr, s.cfg.JWT.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens issued to OAuth clients are for the client's resource servers,
+	// they don't grant access to this API
+	if claims.ClientID != "" {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil || user.TokenVersion != claims.TokenVersion {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
 }
 
 // GetUserByID retrieves a user by ID
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+)
+
+// The status can change after a link or code was sent, so the passwordless logins check
+// it again like Login does
+func TestPasswordlessLoginChecksStatus(t *testing.T) {
+	logins := []struct {
+		name  string
+		login func(t *testing.T, env *testEnv, user *domain.User) error
+	}{
+		{
+			name: "magic link",
+			login: func(t *testing.T, env *testEnv, user *domain.User) error {
+				token, err := env.account.createActionToken(context.Background(), user.ID, domain.ActionMagicLink, crypto.HashToken("nonce"), time.Hour)
+				if err != nil {
+					t.Fatalf("createActionToken: %v", err)
+				}
+				_, _, _, err = env.auth.LoginWithMagicLink(context.Background(), token, "nonce")
+				return err
+			},
+		},
+		{
+			name: "login code",
+			login: func(t *testing.T, env *testEnv, user *domain.User) error {
+				env.loginCodes.codes = append(env.loginCodes.codes, &domain.LoginCode{
+					ID:        1,
+					UserID:    user.ID,
+					CodeHash:  env.account.hashLoginCode(user.ID, "123456"),
+					ExpiresAt: time.Now().Add(time.Hour),
+				})
+				_, _, _, err := env.auth.LoginWithCode(context.Background(), user.Email, "123456")
+				return err
+			},
+		},
+	}
+	statuses := []struct {
+		status     string
+		want       error
+		wantReason string
+	}{
+		{status: domain.UserStatusActive},
+		{status: domain.UserStatusPendingApproval, want: ErrUserPendingApproval, wantReason: "pending_approval"},
+		{status: domain.UserStatusDisabled, want: ErrUserDisabled, wantReason: "account_disabled"},
+	}
+
+	for _, login := range logins {
+		for _, tt := range statuses {
+			t.Run(login.name+"/"+tt.status, func(t *testing.T) {
+				env := newTestEnv(t)
+				env.cfg.Account.MagicLinkEnabled = true
+				env.cfg.Account.OTPEnabled = true
+				env.cfg.Account.OTPMaxAttempts = 5
+				userID := env.users.add(domain.User{Email: "jane@example.com", Verified: true, Status: tt.status})
+				user, _ := env.users.GetByID(context.Background(), userID)
+
+				err := login.login(t, env, user)
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("login error = %v, want %v", err, tt.want)
+				}
+				if tt.want == nil {
+					return
+				}
+				if len(env.tokens.tokens) != 0 {
+					t.Errorf("sessions = %d, want none", len(env.tokens.tokens))
+				}
+				if reasons := env.audit.failureReasons(); len(reasons) != 1 || reasons[0] != tt.wantReason {
+					t.Errorf("failed login reasons = %v, want [%s]", reasons, tt.wantReason)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+	"github.com/login_flow/auth-service/pkg/ldap"
+)
+
+// ErrNotHandled is returned by an Authenticator that doesn't know the email, so
+// the next authenticator of the chain is asked
+var ErrNotHandled = errors.New("unknown to this authenticator")
+
+// Authenticator checks an email and password against one credential store. Login asks
+// each authenticator in turn until one handles the email; its answer is final, a wrong
+// password at one store is never retried at the next.
+type Authenticator interface {
+	// Name is recorded as the login method in the audit log
+	Name() string
+
+	// Authenticate returns ErrNotHandled, ErrInvalidCredentials, or who the credentials
+	// belong to. A nil User means the store knows the person but we have no account yet.
+	Authenticate(ctx context.Context, email, password string) (*Authenticated, error)
+}
+
+// Authenticated is a successful authentication. Email and DisplayName fill in an
+// account provisioned just in time; the display name also refreshes an existing one.
+type Authenticated struct {
+	User        *domain.User
+	Email       string
+	DisplayName string
+	Source      string // domain.AuthSource* of accounts provisioned from this result
+}
+
+// LocalAuthenticator checks passwords against the bcrypt hashes in the users table
+type LocalAuthenticator struct {
+	userRepo domain.UserRepository
+}
+
+func NewLocalAuthenticator(userRepo domain.UserRepository) *LocalAuthenticator {
+	return &LocalAuthenticator{userRepo: userRepo}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return "password"
+}
+
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, email, password string) (*Authenticated, error) {
+	user, err := a.userRepo.GetByEmail(ctx, email)
+	if err != nil || user.AuthSource != domain.AuthSourceLocal {
+		return nil, ErrNotHandled
+	}
+
+	if err := crypto.ComparePassword(user.Password, password); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Authenticated{User: user, Email: user.Email}, nil
+}
+
+// LDAPAuthenticator binds to the directory as the user. It handles directory users and
+// emails without an account; local accounts are left to LocalAuthenticator, even when
+// the directory has an entry with the same email.
+type LDAPAuthenticator struct {
+	client   *ldap.Client
+	userRepo domain.UserRepository
+}
+
+func NewLDAPAuthenticator(client *ldap.Client, userRepo domain.UserRepository) *LDAPAuthenticator {
+	return &LDAPAuthenticator{client: client, userRepo: userRepo}
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return "ldap"
+}
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, email, password string) (*Authenticated, error) {
+	if user, err := a.userRepo.GetByEmail(ctx, email); err == nil && !user.IsDirectoryUser() {
+		return nil, ErrNotHandled
+	}
+
+	entry, err := a.client.Authenticate(ctx, email, password)
+	if err != nil {
+		switch {
+		case errors.Is(err, ldap.ErrUserNotFound):
+			return nil, ErrNotHandled
+		case errors.Is(err, ldap.ErrInvalidCredentials):
+			return nil, ErrInvalidCredentials
+		default:
+			return nil, fmt.Errorf("ldap authentication failed: %w", err)
+		}
+	}
+
+	// The account gets the email attribute of the entry, which is the login itself
+	// unless the user filter matches another attribute (e.g. userPrincipalName)
+	result := &Authenticated{Email: entry.Email, DisplayName: entry.DisplayName, Source: domain.AuthSourceLDAP}
+	if result.Email == "" {
+		result.Email = email
+	}
+
+	user, err := a.userRepo.GetByEmail(ctx, result.Email)
+	if err == nil {
+		if !user.IsDirectoryUser() {
+			return nil, ErrIdentityConflict
+		}
+		result.User = user
+	}
+	return result, nil
+}
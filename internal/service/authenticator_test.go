@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+	"github.com/login_flow/auth-service/pkg/ldap"
+	"github.com/login_flow/auth-service/pkg/ldap/ldaptest"
+)
+
+type fakeAuthenticator struct {
+	name   string
+	result *Authenticated
+	err    error
+	calls  int
+}
+
+func (a *fakeAuthenticator) Name() string {
+	return a.name
+}
+
+func (a *fakeAuthenticator) Authenticate(ctx context.Context, email, password string) (*Authenticated, error) {
+	a.calls++
+	return a.result, a.err
+}
+
+func TestAuthenticate(t *testing.T) {
+	jane := &Authenticated{Email: "jane@example.com"}
+
+	tests := []struct {
+		name       string
+		first      *fakeAuthenticator
+		second     *fakeAuthenticator
+		want       error
+		wantMethod string
+		wantReason string // Reason of the failed login audit event
+		wantSecond int    // Calls to the second authenticator
+	}{
+		{
+			name:       "first authenticator answers",
+			first:      &fakeAuthenticator{name: "password", result: jane},
+			second:     &fakeAuthenticator{name: "ldap", result: jane},
+			wantMethod: "password",
+		},
+		{
+			name:       "unknown email is passed on",
+			first:      &fakeAuthenticator{name: "password", err: ErrNotHandled},
+			second:     &fakeAuthenticator{name: "ldap", result: jane},
+			wantMethod: "ldap",
+			wantSecond: 1,
+		},
+		{
+			name:       "wrong password is final",
+			first:      &fakeAuthenticator{name: "password", err: ErrInvalidCredentials},
+			second:     &fakeAuthenticator{name: "ldap", result: jane},
+			want:       ErrInvalidCredentials,
+			wantReason: "invalid_password",
+		},
+		{
+			name:       "identity conflict",
+			first:      &fakeAuthenticator{name: "ldap", err: ErrIdentityConflict},
+			second:     &fakeAuthenticator{name: "password", result: jane},
+			want:       ErrInvalidCredentials,
+			wantReason: "ldap_identity_conflict",
+		},
+		{
+			name:       "backend failure fails closed",
+			first:      &fakeAuthenticator{name: "ldap", err: errors.New("connection refused")},
+			second:     &fakeAuthenticator{name: "password", result: jane},
+			want:       ErrAuthenticationUnavailable,
+			wantReason: "ldap_unavailable",
+		},
+		{
+			name:       "nobody knows the email",
+			first:      &fakeAuthenticator{name: "password", err: ErrNotHandled},
+			second:     &fakeAuthenticator{name: "ldap", err: ErrNotHandled},
+			want:       ErrInvalidCredentials,
+			wantReason: "unknown_email",
+			wantSecond: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.auth.authenticators = []Authenticator{tt.first, tt.second}
+
+			result, method, err := env.auth.authenticate(context.Background(), "jane@example.com", "secret")
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("authenticate error = %v, want %v", err, tt.want)
+				}
+				if result != nil {
+					t.Errorf("result = %+v, want none", result)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("authenticate: %v", err)
+				}
+				if result != jane || method != tt.wantMethod {
+					t.Errorf("authenticate = %+v, %q; want %+v, %q", result, method, jane, tt.wantMethod)
+				}
+			}
+
+			if tt.second.calls != tt.wantSecond {
+				t.Errorf("second authenticator called %d times, want %d", tt.second.calls, tt.wantSecond)
+			}
+			var wantReasons []string
+			if tt.wantReason != "" {
+				wantReasons = []string{tt.wantReason}
+			}
+			if reasons := env.audit.failureReasons(); !slices.Equal(reasons, wantReasons) {
+				t.Errorf("failed login reasons = %v, want %v", reasons, wantReasons)
+			}
+		})
+	}
+}
+
+func TestAuthenticateWithoutAuthenticators(t *testing.T) {
+	env := newTestEnv(t)
+
+	if _, _, err := env.auth.authenticate(context.Background(), "jane@example.com", "secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("authenticate error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+// The directory has an entry for jane@example.com, who also has a local account. Users
+// log in with their userPrincipalName, which for jane isn't her email.
+func newLDAPTestEnv(t *testing.T) (*testEnv, *LDAPAuthenticator, *ldaptest.Directory) {
+	t.Helper()
+	directory := ldaptest.Start(t,
+		&ldaptest.Entry{
+			DN:       "uid=jane,ou=people,dc=example,dc=com",
+			Password: "directory-secret",
+			Attributes: map[string][]string{
+				"mail":              {"jane@example.com"},
+				"userPrincipalName": {"jdoe@corp.example.com"},
+				"cn":                {"Jane Doe"},
+			},
+		},
+		&ldaptest.Entry{
+			DN:         "uid=bob,ou=people,dc=example,dc=com",
+			Password:   "bob-secret",
+			Attributes: map[string][]string{"mail": {"bob@example.com"}, "userPrincipalName": {"bob@example.com"}, "cn": {"Bob"}},
+		},
+	)
+	client := ldap.NewClient(ldap.Config{
+		URL:                  directory.URL,
+		BindDN:               directory.BindDN,
+		BindPassword:         directory.BindPassword,
+		BaseDN:               "ou=people,dc=example,dc=com",
+		UserFilter:           "(userPrincipalName=%s)",
+		EmailAttribute:       "mail",
+		DisplayNameAttribute: "cn",
+		Timeout:              5 * time.Second,
+	})
+
+	env := newTestEnv(t)
+	hashedPassword, err := crypto.HashPassword("local-secret")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	env.users.add(domain.User{Email: "jane@example.com", Password: hashedPassword, Verified: true})
+
+	ldapAuthenticator := NewLDAPAuthenticator(client, env.users)
+	env.auth.authenticators = []Authenticator{NewLocalAuthenticator(env.users), ldapAuthenticator}
+	return env, ldapAuthenticator, directory
+}
+
+// A local account is never answered by the directory, even with the directory password
+func TestLDAPAuthenticatorLeavesLocalAccounts(t *testing.T) {
+	env, authenticator, directory := newLDAPTestEnv(t)
+
+	_, err := authenticator.Authenticate(context.Background(), "jane@example.com", "directory-secret")
+	if !errors.Is(err, ErrNotHandled) {
+		t.Fatalf("Authenticate error = %v, want ErrNotHandled", err)
+	}
+	if binds := directory.Binds(); len(binds) != 0 {
+		t.Errorf("directory was asked: binds = %v", binds)
+	}
+
+	if _, _, _, err := env.auth.Login(context.Background(), "jane@example.com", "directory-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login with the directory password error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, _, _, err := env.auth.Login(context.Background(), "jane@example.com", "local-secret"); err != nil {
+		t.Fatalf("Login with the local password: %v", err)
+	}
+}
+
+// Logging in with another attribute of the entry must not reach the local account that
+// has the entry's email
+func TestLDAPAuthenticatorIdentityConflict(t *testing.T) {
+	env, authenticator, _ := newLDAPTestEnv(t)
+
+	_, err := authenticator.Authenticate(context.Background(), "jdoe@corp.example.com", "directory-secret")
+	if !errors.Is(err, ErrIdentityConflict) {
+		t.Fatalf("Authenticate error = %v, want ErrIdentityConflict", err)
+	}
+
+	if _, _, _, err := env.auth.Login(context.Background(), "jdoe@corp.example.com", "directory-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestLDAPAuthenticatorProvisionsDirectoryUsers(t *testing.T) {
+	env, authenticator, _ := newLDAPTestEnv(t)
+
+	if _, err := authenticator.Authenticate(context.Background(), "bob@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate with a wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := authenticator.Authenticate(context.Background(), "carol@example.com", "secret"); !errors.Is(err, ErrNotHandled) {
+		t.Fatalf("Authenticate of an unknown login error = %v, want ErrNotHandled", err)
+	}
+
+	_, _, user, err := env.auth.Login(context.Background(), "bob@example.com", "bob-secret")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if !user.IsDirectoryUser() || user.DisplayName != "Bob" || user.Password != "" {
+		t.Errorf("provisioned user = %+v, want a directory account named Bob without a local password", user)
+	}
+
+	// The second login finds the account instead of provisioning another
+	result, err := authenticator.Authenticate(context.Background(), "bob@example.com", "bob-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if result.User == nil || result.User.ID != user.ID {
+		t.Errorf("result user = %+v, want user %d", result.User, user.ID)
+	}
+}
+
+func TestLDAPAuthenticatorFailsClosed(t *testing.T) {
+	env, authenticator, directory := newLDAPTestEnv(t)
+	directory.FailSearches(52) // Unavailable
+
+	_, err := authenticator.Authenticate(context.Background(), "bob@example.com", "bob-secret")
+	if err == nil || errors.Is(err, ErrNotHandled) || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate error = %v, want a directory error", err)
+	}
+
+	if _, _, _, err := env.auth.Login(context.Background(), "bob@example.com", "bob-secret"); !errors.Is(err, ErrAuthenticationUnavailable) {
+		t.Fatalf("Login error = %v, want ErrAuthenticationUnavailable", err)
+	}
+}
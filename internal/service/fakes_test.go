@@ -0,0 +1,622 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+// The fakes embed the repository interface they stand in for, so a call the test
+// didn't expect panics instead of silently succeeding
+
+var errFakeNotFound = errors.New("record not found")
+
+// fakeTransactor runs fn without a transaction, the fakes have none to join
+type fakeTransactor struct{}
+
+func (fakeTransactor) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+type fakeUserRepo struct {
+	domain.UserRepository
+	users  map[int64]*domain.User
+	nextID int64
+}
+
+func newFakeUserRepo() *fakeUserRepo {
+	return &fakeUserRepo{users: make(map[int64]*domain.User), nextID: 1}
+}
+
+// add stores a copy of the user with a new ID and returns the ID
+func (r *fakeUserRepo) add(user domain.User) int64 {
+	user.ID = r.nextID
+	r.nextID++
+	if user.AuthSource == "" {
+		user.AuthSource = domain.AuthSourceLocal
+	}
+	if user.Status == "" {
+		user.Status = domain.UserStatusActive
+	}
+	r.users[user.ID] = &user
+	return user.ID
+}
+
+func (r *fakeUserRepo) Create(ctx context.Context, user *domain.User) error {
+	if _, err := r.GetByEmail(ctx, user.Email); err == nil {
+		return domain.ErrEmailTaken
+	}
+	// Like the database, report the column defaults back
+	*user = *r.users[r.add(*user)]
+	return nil
+}
+
+func (r *fakeUserRepo) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, errFakeNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *fakeUserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (r *fakeUserRepo) MarkAsVerified(ctx context.Context, id int64) error {
+	user, ok := r.users[id]
+	if !ok {
+		return errFakeNotFound
+	}
+	user.Verified = true
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateEmail(ctx context.Context, id int64, email string) error {
+	if other, err := r.GetByEmail(ctx, email); err == nil && other.ID != id {
+		return domain.ErrEmailTaken
+	}
+	user, ok := r.users[id]
+	if !ok {
+		return errFakeNotFound
+	}
+	user.Email = email
+	user.Verified = true
+	user.TokenVersion++
+	return nil
+}
+
+func (r *fakeUserRepo) UpdatePassword(ctx context.Context, id int64, hashedPassword string) error {
+	user, ok := r.users[id]
+	if !ok {
+		return errFakeNotFound
+	}
+	user.Password = hashedPassword
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateStatus(ctx context.Context, id int64, status string) error {
+	user, ok := r.users[id]
+	if !ok {
+		return errFakeNotFound
+	}
+	user.Status = status
+	return nil
+}
+
+func (r *fakeUserRepo) Delete(ctx context.Context, id int64) error {
+	delete(r.users, id)
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateProfile(ctx context.Context, id int64, profile *domain.ProfileUpdate) error {
+	user, ok := r.users[id]
+	if !ok {
+		return errFakeNotFound
+	}
+	if profile.DisplayName != nil {
+		user.DisplayName = *profile.DisplayName
+	}
+	return nil
+}
+
+type fakeIdentityRepo struct {
+	domain.IdentityRepository
+	identities []*domain.UserIdentity
+}
+
+func (r *fakeIdentityRepo) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	identity.ID = int64(len(r.identities) + 1)
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *fakeIdentityRepo) GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (r *fakeIdentityRepo) UpdateLastLogin(ctx context.Context, id int64) error {
+	return nil
+}
+
+type fakeRoleRepo struct {
+	domain.RoleRepository
+	defined     []*domain.Role // What List returns
+	roles       map[int64][]string
+	permissions map[int64][]string
+}
+
+func (r *fakeRoleRepo) List(ctx context.Context) ([]*domain.Role, error) {
+	return slices.Clone(r.defined), nil
+}
+
+func (r *fakeRoleRepo) AssignToUser(ctx context.Context, userID int64, roleName string) error {
+	r.roles[userID] = append(r.roles[userID], roleName)
+	return nil
+}
+
+func (r *fakeRoleRepo) RemoveFromUser(ctx context.Context, userID int64, roleName string) error {
+	r.roles[userID] = slices.DeleteFunc(r.roles[userID], func(role string) bool { return role == roleName })
+	return nil
+}
+
+func (r *fakeRoleRepo) GetUserRoles(ctx context.Context, userID int64) ([]string, error) {
+	return r.roles[userID], nil
+}
+
+func (r *fakeRoleRepo) GetUserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	return r.permissions[userID], nil
+}
+
+type fakeOrgRepo struct {
+	domain.OrganizationRepository
+	members []*domain.Membership
+}
+
+func (r *fakeOrgRepo) AddMember(ctx context.Context, membership *domain.Membership) error {
+	r.members = append(r.members, membership)
+	return nil
+}
+
+type fakeTokenRepo struct {
+	domain.TokenRepository
+	tokens      []*domain.RefreshToken
+	revokedJTIs []string
+}
+
+func (r *fakeTokenRepo) Create(ctx context.Context, token *domain.RefreshToken) error {
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *fakeTokenRepo) RevokeAllForUser(ctx context.Context, userID int64) error {
+	now := time.Now()
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeTokenRepo) GetByToken(ctx context.Context, token string) (*domain.RefreshToken, error) {
+	for _, refreshToken := range r.tokens {
+		if refreshToken.Token == token {
+			copied := *refreshToken
+			return &copied, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (r *fakeTokenRepo) Revoke(ctx context.Context, token string) error {
+	now := time.Now()
+	for _, refreshToken := range r.tokens {
+		if refreshToken.Token == token && refreshToken.RevokedAt == nil {
+			refreshToken.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeTokenRepo) RevokeAllForClient(ctx context.Context, userID int64, clientID string) error {
+	now := time.Now()
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.ClientID == clientID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeTokenRepo) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	r.revokedJTIs = append(r.revokedJTIs, jti)
+	return nil
+}
+
+func (r *fakeTokenRepo) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return slices.Contains(r.revokedJTIs, jti), nil
+}
+
+type fakeOAuthRepo struct {
+	domain.OAuthRepository
+	clients  []*domain.OAuthClient
+	codes    []*domain.OAuthAuthorizationCode
+	consents []*domain.OAuthConsent
+}
+
+func (r *fakeOAuthRepo) CreateClient(ctx context.Context, client *domain.OAuthClient) error {
+	client.ID = int64(len(r.clients) + 1)
+	r.clients = append(r.clients, client)
+	return nil
+}
+
+func (r *fakeOAuthRepo) GetClient(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	for _, client := range r.clients {
+		if client.ClientID == clientID {
+			return client, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (r *fakeOAuthRepo) CreateCode(ctx context.Context, code *domain.OAuthAuthorizationCode) error {
+	code.ID = int64(len(r.codes) + 1)
+	r.codes = append(r.codes, code)
+	return nil
+}
+
+func (r *fakeOAuthRepo) GetCodeByHash(ctx context.Context, codeHash string) (*domain.OAuthAuthorizationCode, error) {
+	for _, code := range r.codes {
+		if code.CodeHash == codeHash {
+			copied := *code
+			return &copied, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (r *fakeOAuthRepo) ConsumeCode(ctx context.Context, id int64) error {
+	for _, code := range r.codes {
+		if code.ID == id && code.ConsumedAt == nil {
+			now := time.Now()
+			code.ConsumedAt = &now
+			return nil
+		}
+	}
+	return errFakeNotFound
+}
+
+func (r *fakeOAuthRepo) GetConsent(ctx context.Context, userID int64, clientID string) (*domain.OAuthConsent, error) {
+	for _, consent := range r.consents {
+		if consent.UserID == userID && consent.ClientID == clientID {
+			copied := *consent
+			return &copied, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+// SaveConsent replaces an earlier consent, like the upsert in postgres
+func (r *fakeOAuthRepo) SaveConsent(ctx context.Context, consent *domain.OAuthConsent) error {
+	r.consents = slices.DeleteFunc(r.consents, func(other *domain.OAuthConsent) bool {
+		return other.UserID == consent.UserID && other.ClientID == consent.ClientID
+	})
+	r.consents = append(r.consents, consent)
+	return nil
+}
+
+type fakeServiceAccountRepo struct {
+	domain.ServiceAccountRepository
+	accounts []*domain.ServiceAccount
+}
+
+func (r *fakeServiceAccountRepo) Create(ctx context.Context, account *domain.ServiceAccount) error {
+	account.ID = int64(len(r.accounts) + 1)
+	r.accounts = append(r.accounts, account)
+	return nil
+}
+
+func (r *fakeServiceAccountRepo) GetByClientID(ctx context.Context, clientID string) (*domain.ServiceAccount, error) {
+	for _, account := range r.accounts {
+		if account.ClientID == clientID {
+			return account, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (r *fakeServiceAccountRepo) UpdateLastUsed(ctx context.Context, id int64) error {
+	return nil
+}
+
+type fakePersonalAccessTokenRepo struct {
+	domain.PersonalAccessTokenRepository
+	tokens []*domain.PersonalAccessToken
+}
+
+func (r *fakePersonalAccessTokenRepo) Create(ctx context.Context, token *domain.PersonalAccessToken) error {
+	token.ID = int64(len(r.tokens) + 1)
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *fakePersonalAccessTokenRepo) GetByHash(ctx context.Context, tokenHash string) (*domain.PersonalAccessToken, error) {
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (r *fakePersonalAccessTokenRepo) RevokeAllForUser(ctx context.Context, userID int64) error {
+	now := time.Now()
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakePersonalAccessTokenRepo) UpdateLastUsed(ctx context.Context, id int64) error {
+	return nil
+}
+
+type fakeLoginCodeRepo struct {
+	domain.LoginCodeRepository
+	codes []*domain.LoginCode
+}
+
+func (r *fakeLoginCodeRepo) GetPendingForUser(ctx context.Context, userID int64) (*domain.LoginCode, error) {
+	for _, code := range slices.Backward(r.codes) {
+		if code.UserID == userID && code.ConsumedAt == nil {
+			copied := *code
+			return &copied, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (r *fakeLoginCodeRepo) RecordAttempt(ctx context.Context, id int64, maxAttempts int) (bool, error) {
+	for _, code := range r.codes {
+		if code.ID == id {
+			if code.Attempts >= maxAttempts {
+				return false, nil
+			}
+			code.Attempts++
+			return true, nil
+		}
+	}
+	return false, errFakeNotFound
+}
+
+func (r *fakeLoginCodeRepo) Consume(ctx context.Context, id int64) error {
+	for _, code := range r.codes {
+		if code.ID == id && code.ConsumedAt == nil {
+			now := time.Now()
+			code.ConsumedAt = &now
+			return nil
+		}
+	}
+	return errFakeNotFound
+}
+
+// fakeSCIMRepo loads the User of a provisioned user from users, and filters by role with roles
+type fakeSCIMRepo struct {
+	domain.SCIMRepository
+	users     *fakeUserRepo
+	roles     *fakeRoleRepo
+	scimUsers []*domain.SCIMUser
+}
+
+func (r *fakeSCIMRepo) CreateUser(ctx context.Context, scimUser *domain.SCIMUser) error {
+	for _, other := range r.scimUsers {
+		if other.OrgID == scimUser.OrgID && strings.EqualFold(other.UserName, scimUser.UserName) {
+			return domain.ErrSCIMUserNameTaken
+		}
+	}
+	copied := *scimUser
+	copied.User = nil
+	r.scimUsers = append(r.scimUsers, &copied)
+	return nil
+}
+
+func (r *fakeSCIMRepo) GetUser(ctx context.Context, orgID, userID int64) (*domain.SCIMUser, error) {
+	for _, scimUser := range r.scimUsers {
+		if scimUser.OrgID == orgID && scimUser.UserID == userID {
+			return r.load(ctx, scimUser), nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (r *fakeSCIMRepo) ListUsers(ctx context.Context, orgID int64, filter *domain.SCIMUserFilter) ([]*domain.SCIMUser, error) {
+	var matching []*domain.SCIMUser
+	for _, scimUser := range r.scimUsers {
+		if loaded := r.load(ctx, scimUser); scimUser.OrgID == orgID && r.matches(loaded, filter) {
+			matching = append(matching, loaded)
+		}
+	}
+	matching = matching[min(filter.Offset, len(matching)):]
+	if filter.Limit > 0 {
+		matching = matching[:min(filter.Limit, len(matching))]
+	}
+	return matching, nil
+}
+
+func (r *fakeSCIMRepo) CountUsers(ctx context.Context, orgID int64, filter *domain.SCIMUserFilter) (int64, error) {
+	unpaged := *filter
+	unpaged.Offset, unpaged.Limit = 0, 0
+	users, err := r.ListUsers(ctx, orgID, &unpaged)
+	return int64(len(users)), err
+}
+
+func (r *fakeSCIMRepo) UpdateUser(ctx context.Context, userID int64, userName, externalID string) error {
+	for _, scimUser := range r.scimUsers {
+		if scimUser.UserID == userID {
+			scimUser.UserName, scimUser.ExternalID = userName, externalID
+			return nil
+		}
+	}
+	return errFakeNotFound
+}
+
+func (r *fakeSCIMRepo) load(ctx context.Context, scimUser *domain.SCIMUser) *domain.SCIMUser {
+	copied := *scimUser
+	copied.User, _ = r.users.GetByID(ctx, scimUser.UserID)
+	return &copied
+}
+
+func (r *fakeSCIMRepo) matches(scimUser *domain.SCIMUser, filter *domain.SCIMUserFilter) bool {
+	user := scimUser.User
+	switch {
+	case user == nil:
+		return false
+	case filter.UserName != "" && !strings.EqualFold(scimUser.UserName, filter.UserName):
+		return false
+	case filter.ExternalID != "" && scimUser.ExternalID != filter.ExternalID:
+		return false
+	case filter.Email != "" && !strings.EqualFold(user.Email, filter.Email):
+		return false
+	case filter.Active != nil && user.IsActive() != *filter.Active:
+		return false
+	case filter.Role != "" && !slices.Contains(r.roles.roles[user.ID], filter.Role):
+		return false
+	}
+	return true
+}
+
+type fakeActionTokenRepo struct {
+	domain.ActionTokenRepository
+	tokens []*domain.ActionToken
+}
+
+func (r *fakeActionTokenRepo) Create(ctx context.Context, token *domain.ActionToken) error {
+	token.ID = int64(len(r.tokens) + 1)
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *fakeActionTokenRepo) GetByHash(ctx context.Context, purpose, tokenHash string) (*domain.ActionToken, error) {
+	for _, token := range r.tokens {
+		if token.Purpose == purpose && token.TokenHash == tokenHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (r *fakeActionTokenRepo) DeletePendingForUser(ctx context.Context, userID int64, purpose string) error {
+	r.tokens = slices.DeleteFunc(r.tokens, func(token *domain.ActionToken) bool {
+		return token.UserID == userID && token.Purpose == purpose && token.ConsumedAt == nil
+	})
+	return nil
+}
+
+func (r *fakeActionTokenRepo) Consume(ctx context.Context, id int64) error {
+	for _, token := range r.tokens {
+		if token.ID == id && token.ConsumedAt == nil {
+			now := time.Now()
+			token.ConsumedAt = &now
+			return nil
+		}
+	}
+	return domain.ErrTokenConsumed
+}
+
+// fakeKnownDeviceRepo reports every sign-in as the first one, so no alert is mailed
+type fakeKnownDeviceRepo struct {
+	domain.KnownDeviceRepository
+}
+
+func (r *fakeKnownDeviceRepo) Lookup(ctx context.Context, userID int64, device, ip string) (*domain.DeviceSighting, error) {
+	return &domain.DeviceSighting{FirstSignIn: true}, nil
+}
+
+func (r *fakeKnownDeviceRepo) Record(ctx context.Context, userID int64, device, ip string) error {
+	return nil
+}
+
+type fakeAudit struct {
+	events []*domain.AuditEvent
+}
+
+func (a *fakeAudit) Emit(ctx context.Context, event *domain.AuditEvent) {
+	a.events = append(a.events, event)
+}
+
+// failureReasons returns the reasons of the failed events, in order
+func (a *fakeAudit) failureReasons() []string {
+	var reasons []string
+	for _, event := range a.events {
+		if event.Outcome == domain.AuditFailure {
+			reasons = append(reasons, event.Reason)
+		}
+	}
+	return reasons
+}
+
+type fakeEvents struct{}
+
+func (fakeEvents) Publish(ctx context.Context, eventType string, data map[string]interface{}) {}
+
+// testEnv is an AuthService on in-memory repositories. Tests set
+// env.auth.authenticators to the chain they need.
+type testEnv struct {
+	cfg          *config.Config
+	users        *fakeUserRepo
+	identities   *fakeIdentityRepo
+	roles        *fakeRoleRepo
+	orgs         *fakeOrgRepo
+	tokens       *fakeTokenRepo
+	actionTokens *fakeActionTokenRepo
+	pats         *fakePersonalAccessTokenRepo
+	loginCodes   *fakeLoginCodeRepo
+	audit        *fakeAudit
+	account      *AccountService
+	auth         *AuthService
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	env := &testEnv{
+		cfg: &config.Config{
+			JWT:          config.JWTConfig{Secret: "test-secret-at-least-32-bytes-long", AccessExpiry: 15 * time.Minute, RefreshExpiry: 24 * time.Hour},
+			Registration: config.RegistrationConfig{Mode: config.RegistrationOpen},
+		},
+		users:        newFakeUserRepo(),
+		identities:   &fakeIdentityRepo{},
+		roles:        &fakeRoleRepo{roles: make(map[int64][]string), permissions: make(map[int64][]string)},
+		orgs:         &fakeOrgRepo{},
+		tokens:       &fakeTokenRepo{},
+		actionTokens: &fakeActionTokenRepo{},
+		pats:         &fakePersonalAccessTokenRepo{},
+		loginCodes:   &fakeLoginCodeRepo{},
+		audit:        &fakeAudit{},
+	}
+	env.account = NewAccountService(fakeTransactor{}, env.users, env.tokens, env.actionTokens, &fakeKnownDeviceRepo{}, env.pats, env.loginCodes, nil, env.audit, fakeEvents{}, env.cfg)
+	env.auth = NewAuthService(env.users, env.tokens, env.roles, env.orgs, env.account, nil, env.audit, fakeEvents{}, env.cfg)
+	return env
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+	"github.com/login_flow/auth-service/pkg/mailer"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvalidInvitation  = errors.New("invalid or expired invitation")
+)
+
+// InvitationService lets admins invite people to register while open sign-up is disabled
+type InvitationService struct {
+	inviteRepo domain.InvitationRepository
+	userRepo   domain.UserRepository
+	roleRepo   domain.RoleRepository
+	mailer     mailer.Mailer
+	audit      domain.AuditEmitter
+	cfg        *config.Config
+}
+
+func NewInvitationService(inviteRepo domain.InvitationRepository, userRepo domain.UserRepository, roleRepo domain.RoleRepository, mailer mailer.Mailer, audit domain.AuditEmitter, cfg *config.Config) *InvitationService {
+	return &InvitationService{
+		inviteRepo: inviteRepo,
+		userRepo:   userRepo,
+		roleRepo:   roleRepo,
+		mailer:     mailer,
+		audit:      audit,
+		cfg:        cfg,
+	}
+}
+
+// Create stores an invitation and emails its link. The role is assigned to the
+// account registered with it, on top of the default user role.
+func (s *InvitationService) Create(ctx context.Context, email, role string) (*domain.Invitation, error) {
+	if _, err := s.roleRepo.GetByName(ctx, role); err != nil {
+		return nil, ErrRoleNotFound
+	}
+	if _, err := s.userRepo.GetByEmail(ctx, email); err == nil {
+		return nil, ErrUserAlreadyExists
+	}
+
+	token, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+
+	invitation := &domain.Invitation{
+		Email:     email,
+		Role:      role,
+		TokenHash: crypto.HashToken(token),
+		ExpiresAt: time.Now().Add(s.cfg.Registration.InviteExpiry),
+	}
+	if actorID, ok := domain.ActorIDFromContext(ctx); ok {
+		invitation.InvitedBy = &actorID
+	}
+	if err := s.inviteRepo.Create(ctx, invitation); err != nil {
+		return nil, err
+	}
+
+	link := fmt.Sprintf("%s/register?invite=%s", s.cfg.Server.AppURL, url.QueryEscape(token))
+	body := fmt.Sprintf("You have been invited to create an account. Register with this email address by opening the link below:\n\n%s\n\nThe invitation expires in %s.\n",
+		link, s.cfg.Registration.InviteExpiry)
+	if err := s.mailer.Send(ctx, email, "You're invited", body); err != nil {
+		// Without the email nobody can use it, the admin can simply invite again
+		if err := s.inviteRepo.Delete(ctx, invitation.ID); err != nil {
+			log.Printf("failed to delete unsent invitation %d: %v", invitation.ID, err)
+		}
+		return nil, fmt.Errorf("failed to send invitation email: %w", err)
+	}
+
+	s.recordAction(ctx, "create_invitation", map[string]interface{}{"invitation_id": invitation.ID, "email": email, "role": role})
+	return invitation, nil
+}
+
+func (s *InvitationService) List(ctx context.Context) ([]*domain.Invitation, error) {
+	return s.inviteRepo.List(ctx)
+}
+
+// Revoke deletes an invitation that was not used yet
+func (s *InvitationService) Revoke(ctx context.Context, id int64) error {
+	invitation, err := s.inviteRepo.GetByID(ctx, id)
+	if err != nil || invitation.AcceptedAt != nil {
+		return ErrInvitationNotFound
+	}
+
+	if err := s.inviteRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "revoke_invitation", map[string]interface{}{"invitation_id": id, "email": invitation.Email})
+	return nil
+}
+
+// validate returns the invitation for a token if it can still be used to register the email
+func (s *InvitationService) validate(ctx context.Context, token, email string) (*domain.Invitation, error) {
+	invitation, err := s.inviteRepo.GetByHash(ctx, crypto.HashToken(token))
+	if err != nil || !invitation.IsValid() {
+		return nil, ErrInvalidInvitation
+	}
+	// An invitation is for one person, a forwarded link can't be used for another address
+	if !strings.EqualFold(invitation.Email, email) {
+		return nil, ErrInvalidInvitation
+	}
+	return invitation, nil
+}
+
+// accept marks the invitation as used by the new account
+func (s *InvitationService) accept(ctx context.Context, invitation *domain.Invitation, userID int64) error {
+	if err := s.inviteRepo.Accept(ctx, invitation.ID, userID); err != nil {
+		return ErrInvalidInvitation
+	}
+	return nil
+}
+
+func (s *InvitationService) recordAction(ctx context.Context, action string, metadata map[string]interface{}) {
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:     domain.AuditAdminAction,
+		Outcome:  domain.AuditSuccess,
+		Reason:   action,
+		Metadata: metadata,
+	})
+}
@@ -0,0 +1,843 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+	"github.com/login_flow/auth-service/pkg/jwt"
+)
+
+var (
+	ErrClientNotFound         = errors.New("oauth client not found")
+	ErrInsufficientScope      = errors.New("token was not granted the openid scope")
+	ErrInvalidClientType      = errors.New("client type must be confidential or public")
+	ErrInvalidRedirectURI     = errors.New("invalid redirect uri")
+	ErrServiceAccountNotFound = errors.New("service account not found")
+)
+
+// serviceAccountPrefix starts the client ID of every service account
+const serviceAccountPrefix = "sa_"
+
+// OAuthError is an OAuth error response (RFC 6749 sections 4.1.2.1 and 5.2).
+// Code is one of the error codes defined there, e.g. "invalid_grant".
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// OAuthServerService lets other apps delegate login to this service: it is an
+// OAuth 2.1 authorization server with the authorization code (PKCE required)
+// and refresh token grants, and an OpenID Connect provider for the openid scope.
+// Service accounts get tokens for machine-to-machine calls with the client
+// credentials grant.
+type OAuthServerService struct {
+	oauthRepo          domain.OAuthRepository
+	userRepo           domain.UserRepository
+	tokenRepo          domain.TokenRepository
+	serviceAccountRepo domain.ServiceAccountRepository
+	audit              domain.AuditEmitter
+	idTokenKey         *jwt.SigningKey // Signs ID tokens, published at the JWKS endpoint
+	cfg                *config.Config
+}
+
+func NewOAuthServerService(oauthRepo domain.OAuthRepository, userRepo domain.UserRepository, tokenRepo domain.TokenRepository, serviceAccountRepo domain.ServiceAccountRepository, audit domain.AuditEmitter, idTokenKey *jwt.SigningKey, cfg *config.Config) *OAuthServerService {
+	return &OAuthServerService{
+		oauthRepo:          oauthRepo,
+		userRepo:           userRepo,
+		tokenRepo:          tokenRepo,
+		serviceAccountRepo: serviceAccountRepo,
+		audit:              audit,
+		idTokenKey:         idTokenKey,
+		cfg:                cfg,
+	}
+}
+
+// RegisterClient adds a client app. Confidential clients get a secret, which is
+// returned here and only stored hashed.
+func (s *OAuthServerService) RegisterClient(ctx context.Context, name, clientType string, redirectURIs, scopes []string) (*domain.OAuthClient, string, error) {
+	if clientType != domain.ClientConfidential && clientType != domain.ClientPublic {
+		return nil, "", ErrInvalidClientType
+	}
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidRedirectURI, uri)
+		}
+	}
+
+	clientID, err := crypto.GenerateRandomToken(16)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate client id: %w", err)
+	}
+
+	client := &domain.OAuthClient{
+		ClientID:     clientID,
+		Name:         name,
+		Type:         clientType,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+	}
+
+	var secret string
+	if client.IsConfidential() {
+		secret, err = crypto.GenerateRandomToken(32)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate client secret: %w", err)
+		}
+		client.SecretHash = crypto.HashToken(secret)
+	}
+
+	if err := s.oauthRepo.CreateClient(ctx, client); err != nil {
+		return nil, "", err
+	}
+
+	s.recordAction(ctx, "create_oauth_client", client.ClientID)
+	return client, secret, nil
+}
+
+func (s *OAuthServerService) ListClients(ctx context.Context) ([]*domain.OAuthClient, error) {
+	return s.oauthRepo.ListClients(ctx)
+}
+
+// DeleteClient removes a client and revokes every token issued to it
+func (s *OAuthServerService) DeleteClient(ctx context.Context, clientID string) error {
+	if _, err := s.oauthRepo.GetClient(ctx, clientID); err != nil {
+		return ErrClientNotFound
+	}
+
+	if err := s.oauthRepo.DeleteClient(ctx, clientID); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "delete_oauth_client", clientID)
+	return nil
+}
+
+// CreateServiceAccount adds a service account. The client ID starts with "sa_" so it can't be
+// mistaken for an OAuth client; the secret is returned here and only stored hashed.
+func (s *OAuthServerService) CreateServiceAccount(ctx context.Context, name, description string, scopes []string) (*domain.ServiceAccount, string, error) {
+	clientID, err := crypto.GenerateRandomToken(16)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate client id: %w", err)
+	}
+	secret, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate client secret: %w", err)
+	}
+
+	account := &domain.ServiceAccount{
+		ClientID:    serviceAccountPrefix + clientID,
+		SecretHash:  crypto.HashToken(secret),
+		Name:        name,
+		Description: description,
+		Scopes:      scopes,
+	}
+	if err := s.serviceAccountRepo.Create(ctx, account); err != nil {
+		return nil, "", err
+	}
+
+	s.recordAction(ctx, "create_service_account", account.ClientID)
+	return account, secret, nil
+}
+
+func (s *OAuthServerService) ListServiceAccounts(ctx context.Context) ([]*domain.ServiceAccount, error) {
+	return s.serviceAccountRepo.List(ctx)
+}
+
+// DeleteServiceAccount removes a service account. Tokens it already holds stay valid until
+// they expire, access tokens are not stored.
+func (s *OAuthServerService) DeleteServiceAccount(ctx context.Context, clientID string) error {
+	if _, err := s.serviceAccountRepo.GetByClientID(ctx, clientID); err != nil {
+		return ErrServiceAccountNotFound
+	}
+
+	if err := s.serviceAccountRepo.Delete(ctx, clientID); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "delete_service_account", clientID)
+	return nil
+}
+
+// ResolveClient finds the client and checks the redirect URI of an authorization request.
+// Its errors must be shown to the user: the redirect URI can't be trusted, so nothing
+// may be sent to it.
+func (s *OAuthServerService) ResolveClient(ctx context.Context, req *domain.AuthorizationRequest) (*domain.OAuthClient, error) {
+	client, err := s.oauthRepo.GetClient(ctx, req.ClientID)
+	if err != nil {
+		return nil, ErrClientNotFound
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, ErrInvalidRedirectURI
+	}
+	return client, nil
+}
+
+// ValidateRequest checks the remaining parameters of an authorization request and returns
+// the requested scopes. Errors are *OAuthError, to be sent to the redirect URI.
+func (s *OAuthServerService) ValidateRequest(client *domain.OAuthClient, req *domain.AuthorizationRequest) ([]string, error) {
+	if req.ResponseType != "code" {
+		return nil, oauthError("unsupported_response_type", "only the code response type is supported")
+	}
+
+	// OAuth 2.1 requires PKCE for every client and drops the "plain" method
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) < 43 || len(req.CodeChallenge) > 128 {
+		return nil, oauthError("invalid_request", "a code_challenge with code_challenge_method S256 is required")
+	}
+
+	scopes := domain.ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		return nil, oauthError("invalid_scope", "scope is required")
+	}
+	if !client.AllowsScopes(scopes) {
+		return nil, oauthError("invalid_scope", "the client may not request these scopes")
+	}
+
+	return scopes, nil
+}
+
+// HasConsent reports whether the user already granted these scopes to the client
+func (s *OAuthServerService) HasConsent(ctx context.Context, userID int64, clientID string, scopes []string) bool {
+	consent, err := s.oauthRepo.GetConsent(ctx, userID, clientID)
+	return err == nil && consent.Covers(scopes)
+}
+
+// Authorize records the user's consent and returns the redirect carrying a new authorization code.
+// authTime is when the user logged in, it ends up in the ID token.
+func (s *OAuthServerService) Authorize(ctx context.Context, userID int64, authTime time.Time, client *domain.OAuthClient, req *domain.AuthorizationRequest, scopes []string) (string, error) {
+	// Consent adds up: approving a narrower request doesn't take back the scopes
+	// granted before, or the user would be asked for them again
+	granted := scopes
+	if consent, err := s.oauthRepo.GetConsent(ctx, userID, client.ClientID); err == nil {
+		granted = append(domain.ParseScope(consent.Scope), scopes...)
+	}
+	if err := s.oauthRepo.SaveConsent(ctx, &domain.OAuthConsent{
+		UserID:   userID,
+		ClientID: client.ClientID,
+		Scope:    domain.JoinScope(granted),
+	}); err != nil {
+		return "", err
+	}
+
+	scope := domain.JoinScope(scopes)
+
+	code, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate authorization code: %w", err)
+	}
+
+	if err := s.oauthRepo.CreateCode(ctx, &domain.OAuthAuthorizationCode{
+		CodeHash:      crypto.HashToken(code),
+		ClientID:      client.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         scope,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		AuthTime:      authTime,
+		ExpiresAt:     time.Now().Add(s.cfg.AuthServer.CodeExpiry),
+	}); err != nil {
+		return "", err
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditOAuthAuthorize,
+		ActorID:   &userID,
+		SubjectID: &userID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"client_id": client.ClientID, "scope": scope},
+	})
+
+	return s.redirect(req, url.Values{"code": {code}}), nil
+}
+
+// ErrorRedirect returns the redirect that reports an error to the client
+func (s *OAuthServerService) ErrorRedirect(req *domain.AuthorizationRequest, oauthErr *OAuthError) string {
+	return s.redirect(req, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+	})
+}
+
+// redirect adds the state and, against mix-up attacks (RFC 9207), our issuer to the response parameters
+func (s *OAuthServerService) redirect(req *domain.AuthorizationRequest, params url.Values) string {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	params.Set("iss", s.cfg.AuthServer.Issuer)
+
+	redirectURI, _ := url.Parse(req.RedirectURI)
+	query := redirectURI.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	redirectURI.RawQuery = query.Encode()
+	return redirectURI.String()
+}
+
+// Token handles the token endpoint. Errors are *OAuthError.
+func (s *OAuthServerService) Token(ctx context.Context, req *domain.TokenRequest) (*domain.TokenResponse, error) {
+	response, err := s.token(ctx, req)
+	if err != nil {
+		reason := "server_error"
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) {
+			reason = oauthErr.Code
+		}
+		s.audit.Emit(ctx, &domain.AuditEvent{
+			Type:     domain.AuditOAuthToken,
+			Outcome:  domain.AuditFailure,
+			Reason:   reason,
+			Metadata: map[string]interface{}{"client_id": req.ClientID, "grant_type": req.GrantType},
+		})
+		return nil, err
+	}
+	return response, nil
+}
+
+func (s *OAuthServerService) token(ctx context.Context, req *domain.TokenRequest) (*domain.TokenResponse, error) {
+	// Service accounts are not OAuth clients and only use this grant
+	if req.GrantType == "client_credentials" {
+		return s.clientCredentials(ctx, req)
+	}
+
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case "authorization_code":
+		return s.exchangeCode(ctx, client, req)
+	case "refresh_token":
+		return s.refresh(ctx, client, req)
+	default:
+		return nil, oauthError("unsupported_grant_type", "supported grant types are authorization_code, refresh_token and client_credentials")
+	}
+}
+
+// authenticateClient checks the client's credentials. Public clients have no secret
+// and are identified by client_id alone.
+func (s *OAuthServerService) authenticateClient(ctx context.Context, clientID, secret string) (*domain.OAuthClient, error) {
+	client, err := s.oauthRepo.GetClient(ctx, clientID)
+	if err != nil {
+		return nil, oauthError("invalid_client", "unknown client")
+	}
+
+	if client.IsConfidential() {
+		if secret == "" || subtle.ConstantTimeCompare([]byte(crypto.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+			return nil, oauthError("invalid_client", "client authentication failed")
+		}
+	}
+	return client, nil
+}
+
+func (s *OAuthServerService) authenticateServiceAccount(ctx context.Context, clientID, secret string) (*domain.ServiceAccount, error) {
+	account, err := s.serviceAccountRepo.GetByClientID(ctx, clientID)
+	if err != nil {
+		return nil, oauthError("invalid_client", "unknown client")
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(crypto.HashToken(secret)), []byte(account.SecretHash)) != 1 {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	return account, nil
+}
+
+// authenticateCaller authenticates an OAuth client or a service account and returns its
+// client ID. Public clients are only accepted when allowPublic is set.
+func (s *OAuthServerService) authenticateCaller(ctx context.Context, clientID, secret string, allowPublic bool) (string, error) {
+	if strings.HasPrefix(clientID, serviceAccountPrefix) {
+		account, err := s.authenticateServiceAccount(ctx, clientID, secret)
+		if err != nil {
+			return "", err
+		}
+		return account.ClientID, nil
+	}
+
+	client, err := s.authenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return "", err
+	}
+	if !allowPublic && !client.IsConfidential() {
+		return "", oauthError("invalid_client", "public clients may not use this endpoint")
+	}
+	return client.ClientID, nil
+}
+
+// Introspect tells a resource server whether a token is active and what it grants
+// (RFC 7662). Callers are confidential clients or service accounts, and tokens they may
+// not introspect are reported inactive. Errors are *OAuthError.
+func (s *OAuthServerService) Introspect(ctx context.Context, req *domain.TokenHintRequest) (*domain.IntrospectionResponse, error) {
+	callerID, err := s.authenticateCaller(ctx, req.ClientID, req.ClientSecret, false)
+	if err != nil {
+		return nil, err
+	}
+
+	lookups := []func(context.Context, string) *domain.IntrospectionResponse{s.introspectAccessToken, s.introspectRefreshToken}
+	if req.TokenTypeHint == "refresh_token" {
+		slices.Reverse(lookups)
+	}
+	for _, lookup := range lookups {
+		if response := lookup(ctx, req.Token); response != nil {
+			if !s.mayIntrospect(callerID, response) {
+				break
+			}
+			return response, nil
+		}
+	}
+	return &domain.IntrospectionResponse{Active: false}, nil
+}
+
+// mayIntrospect reports whether the caller may see the token: it was issued to the caller or
+// names it as audience, or the caller is a resource server listed in IntrospectionClients.
+// Our own sessions are never described, they don't belong to any client.
+func (s *OAuthServerService) mayIntrospect(callerID string, token *domain.IntrospectionResponse) bool {
+	if token.ClientID == "" {
+		return false
+	}
+	return token.ClientID == callerID || slices.Contains(token.Audience, callerID) ||
+		slices.Contains(s.cfg.AuthServer.IntrospectionClients, callerID)
+}
+
+// introspectAccessToken describes an active access token, nil for anything else
+func (s *OAuthServerService) introspectAccessToken(ctx context.Context, token string) *domain.IntrospectionResponse {
+	claims, err := jwt.ValidateToken(token, s.cfg.JWT.Secret)
+	if err != nil || claims.ExpiresAt == nil || s.accessTokenRevoked(ctx, claims) {
+		return nil
+	}
+
+	// Tokens stay valid until they expire, but not for a user who can't log in anymore
+	var username string
+	if claims.UserID != 0 {
+		user, err := s.userRepo.GetByID(ctx, claims.UserID)
+		if err != nil || !user.IsActive() {
+			return nil
+		}
+		username = user.Email
+	} else if _, err := s.serviceAccountRepo.GetByClientID(ctx, claims.ClientID); err != nil {
+		return nil
+	}
+
+	response := &domain.IntrospectionResponse{
+		Active:    true,
+		TokenType: "access_token",
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  username,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+	}
+	if claims.IssuedAt != nil {
+		response.IssuedAt = claims.IssuedAt.Unix()
+	}
+	return response
+}
+
+// introspectRefreshToken describes an active refresh token, nil for anything else
+func (s *OAuthServerService) introspectRefreshToken(ctx context.Context, token string) *domain.IntrospectionResponse {
+	refreshToken, err := s.tokenRepo.GetByToken(ctx, token)
+	if err != nil || !refreshToken.IsValid() {
+		return nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, refreshToken.UserID)
+	if err != nil || !user.IsActive() {
+		return nil
+	}
+
+	return &domain.IntrospectionResponse{
+		Active:    true,
+		TokenType: "refresh_token",
+		Scope:     refreshToken.Scope,
+		ClientID:  refreshToken.ClientID,
+		Username:  user.Email,
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Issuer:    s.cfg.AuthServer.Issuer,
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+		IssuedAt:  refreshToken.CreatedAt.Unix(),
+	}
+}
+
+// Revoke revokes a refresh or access token that was issued to the calling client (RFC 7009).
+// Unknown tokens and tokens of other clients are ignored, so the response never tells a
+// client anything about a token it doesn't own. Errors are *OAuthError.
+func (s *OAuthServerService) Revoke(ctx context.Context, req *domain.TokenHintRequest) error {
+	clientID, err := s.authenticateCaller(ctx, req.ClientID, req.ClientSecret, true)
+	if err != nil {
+		return err
+	}
+
+	if refreshToken, err := s.tokenRepo.GetByToken(ctx, req.Token); err == nil {
+		if refreshToken.ClientID != clientID || refreshToken.RevokedAt != nil {
+			return nil
+		}
+		if err := s.tokenRepo.Revoke(ctx, req.Token); err != nil {
+			return err
+		}
+		s.recordRevocation(ctx, clientID, "refresh_token", &refreshToken.UserID)
+		return nil
+	}
+
+	claims, err := jwt.ValidateToken(req.Token, s.cfg.JWT.Secret)
+	if err != nil || claims.ClientID != clientID || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	if err := s.tokenRepo.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+	var subjectID *int64
+	if claims.UserID != 0 {
+		subjectID = &claims.UserID
+	}
+	s.recordRevocation(ctx, clientID, "access_token", subjectID)
+	return nil
+}
+
+func (s *OAuthServerService) recordRevocation(ctx context.Context, clientID, tokenType string, subjectID *int64) {
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditOAuthRevoke,
+		SubjectID: subjectID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"client_id": clientID, "token_type": tokenType},
+	})
+}
+
+// accessTokenRevoked reports whether the access token was revoked at /oauth/revoke.
+// When the lookup fails the token is treated as revoked.
+func (s *OAuthServerService) accessTokenRevoked(ctx context.Context, claims *jwt.Claims) bool {
+	if claims.ID == "" {
+		return false
+	}
+	revoked, err := s.tokenRepo.IsAccessTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		log.Printf("failed to check access token revocation: %v", err)
+		return true
+	}
+	return revoked
+}
+
+func (s *OAuthServerService) exchangeCode(ctx context.Context, client *domain.OAuthClient, req *domain.TokenRequest) (*domain.TokenResponse, error) {
+	code, err := s.oauthRepo.GetCodeByHash(ctx, crypto.HashToken(req.Code))
+	if err != nil || !code.IsValid() || code.ClientID != client.ClientID {
+		return nil, oauthError("invalid_grant", "invalid or expired authorization code")
+	}
+	if code.RedirectURI != req.RedirectURI {
+		return nil, oauthError("invalid_grant", "redirect_uri does not match the authorization request")
+	}
+	if !verifyCodeChallenge(req.CodeVerifier, code.CodeChallenge) {
+		return nil, oauthError("invalid_grant", "code_verifier does not match the code challenge")
+	}
+	if err := s.oauthRepo.ConsumeCode(ctx, code.ID); err != nil {
+		return nil, oauthError("invalid_grant", "invalid or expired authorization code")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, code.UserID)
+	if err != nil || !user.IsActive() {
+		return nil, oauthError("invalid_grant", "the user is no longer active")
+	}
+
+	return s.issueTokens(ctx, client, user, code.Scope, req.GrantType, code.Nonce, code.AuthTime)
+}
+
+// refresh rotates a client's refresh token like RefreshAccessToken does for our own sessions
+func (s *OAuthServerService) refresh(ctx context.Context, client *domain.OAuthClient, req *domain.TokenRequest) (*domain.TokenResponse, error) {
+	refreshToken, err := s.tokenRepo.GetByToken(ctx, req.RefreshToken)
+	if err != nil || refreshToken.ClientID != client.ClientID {
+		return nil, oauthError("invalid_grant", "invalid refresh token")
+	}
+
+	// A rotated token showing up again was copied, revoke everything the user gave this client
+	if refreshToken.RevokedAt != nil {
+		if err := s.tokenRepo.RevokeAllForClient(ctx, refreshToken.UserID, client.ClientID); err != nil {
+			return nil, err
+		}
+		s.audit.Emit(ctx, &domain.AuditEvent{
+			Type:      domain.AuditRefreshReuse,
+			SubjectID: &refreshToken.UserID,
+			Outcome:   domain.AuditFailure,
+			Reason:    "revoked_token_reused",
+			Metadata:  map[string]interface{}{"session_id": refreshToken.ID, "client_id": client.ClientID},
+		})
+		return nil, oauthError("invalid_grant", "invalid refresh token")
+	}
+	if !refreshToken.IsValid() {
+		return nil, oauthError("invalid_grant", "invalid refresh token")
+	}
+
+	// The client may ask for fewer scopes than it was granted, never more
+	scope := refreshToken.Scope
+	if req.Scope != "" {
+		requested := domain.ParseScope(req.Scope)
+		if !domain.ScopeCovers(refreshToken.Scope, requested) {
+			return nil, oauthError("invalid_scope", "scope exceeds the original grant")
+		}
+		scope = domain.JoinScope(requested)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, refreshToken.UserID)
+	if err != nil || !user.IsActive() {
+		return nil, oauthError("invalid_grant", "the user is no longer active")
+	}
+
+	if err := s.tokenRepo.Revoke(ctx, req.RefreshToken); err != nil {
+		return nil, err
+	}
+
+	// No nonce: it belongs to the authorization request, not to later ID tokens (OIDC Core 12.2)
+	return s.issueTokens(ctx, client, user, scope, req.GrantType, "", refreshToken.AuthenticatedAt())
+}
+
+// clientCredentials issues an access token to a service account (RFC 6749 section 4.4).
+// There is no refresh token: the account simply authenticates again.
+func (s *OAuthServerService) clientCredentials(ctx context.Context, req *domain.TokenRequest) (*domain.TokenResponse, error) {
+	account, err := s.authenticateServiceAccount(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a scope parameter the token gets every scope the account is allowed
+	scopes := account.Scopes
+	if req.Scope != "" {
+		scopes = domain.ParseScope(req.Scope)
+		if !domain.ScopeCovers(domain.JoinScope(account.Scopes), scopes) {
+			return nil, oauthError("invalid_scope", "the service account may not request these scopes")
+		}
+	}
+	scope := domain.JoinScope(scopes)
+
+	claims := &jwt.Claims{
+		Scope:    scope,
+		ClientID: account.ClientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:  s.cfg.AuthServer.Issuer,
+			Subject: account.ClientID,
+		},
+	}
+	accessToken, err := jwt.GenerateAccessToken(claims, s.cfg.JWT.Secret, s.cfg.JWT.AccessExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	if err := s.serviceAccountRepo.UpdateLastUsed(ctx, account.ID); err != nil {
+		log.Printf("failed to record service account use: %v", err)
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:     domain.AuditOAuthToken,
+		Outcome:  domain.AuditSuccess,
+		Metadata: map[string]interface{}{"client_id": account.ClientID, "grant_type": req.GrantType, "scope": scope},
+	})
+
+	return &domain.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.cfg.JWT.AccessExpiry.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// issueTokens signs an access token for the client with pkg/jwt and stores a new refresh token.
+// With the openid scope it adds an ID token.
+func (s *OAuthServerService) issueTokens(ctx context.Context, client *domain.OAuthClient, user *domain.User, scope, grantType, nonce string, authTime time.Time) (*domain.TokenResponse, error) {
+	claims := &jwt.Claims{
+		UserID:   user.ID,
+		Scope:    scope,
+		ClientID: client.ClientID,
+		AuthTime: jwt.NewNumericDate(authTime),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   s.cfg.AuthServer.Issuer,
+			Subject:  strconv.FormatInt(user.ID, 10),
+			Audience: jwt.ClaimStrings{client.ClientID},
+		},
+	}
+	// The email is only shared with clients that were granted it
+	if domain.ScopeCovers(scope, []string{domain.ScopeEmail}) {
+		claims.Email = user.Email
+	}
+
+	accessToken, err := jwt.GenerateAccessToken(claims, s.cfg.JWT.Secret, s.cfg.JWT.AccessExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	refreshToken, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	if err := s.tokenRepo.Create(ctx, &domain.RefreshToken{
+		UserID:    user.ID,
+		Token:     refreshToken,
+		ExpiresAt: time.Now().Add(s.cfg.JWT.RefreshExpiry),
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		AuthTime:  &authTime,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	var idToken string
+	if domain.ScopeCovers(scope, []string{domain.ScopeOpenID}) {
+		idToken, err = s.generateIDToken(client, user, scope, nonce, authTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditOAuthToken,
+		SubjectID: &user.ID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"client_id": client.ClientID, "grant_type": grantType, "scope": scope},
+	})
+
+	return &domain.TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.cfg.JWT.AccessExpiry.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        scope,
+		IDToken:      idToken,
+	}, nil
+}
+
+// generateIDToken signs an OpenID Connect ID token for the client. The email claims are
+// only included with the email scope, like in the access token.
+func (s *OAuthServerService) generateIDToken(client *domain.OAuthClient, user *domain.User, scope, nonce string, authTime time.Time) (string, error) {
+	claims := &jwt.IDTokenClaims{
+		Nonce:    nonce,
+		AuthTime: jwt.NewNumericDate(authTime),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   s.cfg.AuthServer.Issuer,
+			Subject:  strconv.FormatInt(user.ID, 10),
+			Audience: jwt.ClaimStrings{client.ClientID},
+		},
+	}
+	if domain.ScopeCovers(scope, []string{domain.ScopeEmail}) {
+		claims.Email = user.Email
+		claims.EmailVerified = &user.Verified
+	}
+
+	idToken, err := jwt.GenerateIDToken(claims, s.idTokenKey, s.cfg.JWT.AccessExpiry)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate id token: %w", err)
+	}
+	return idToken, nil
+}
+
+// UserInfo returns the claims about the user that the access token's scopes allow
+// (OIDC Core 5.3). Only client tokens with the openid scope are accepted.
+func (s *OAuthServerService) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	claims, err := jwt.ValidateToken(accessToken, s.cfg.JWT.Secret)
+	if err != nil || claims.ClientID == "" || claims.Issuer != s.cfg.AuthServer.Issuer || s.accessTokenRevoked(ctx, claims) {
+		return nil, ErrInvalidToken
+	}
+	if !domain.ScopeCovers(claims.Scope, []string{domain.ScopeOpenID}) {
+		return nil, ErrInsufficientScope
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil || !user.IsActive() {
+		return nil, ErrInvalidToken
+	}
+
+	info := map[string]interface{}{"sub": strconv.FormatInt(user.ID, 10)}
+	if domain.ScopeCovers(claims.Scope, []string{domain.ScopeEmail}) {
+		info["email"] = user.Email
+		info["email_verified"] = user.Verified
+	}
+	if domain.ScopeCovers(claims.Scope, []string{domain.ScopeProfile}) {
+		info["name"] = user.DisplayName
+		info["picture"] = user.AvatarURL
+		info["locale"] = user.Locale
+		info["zoneinfo"] = user.Timezone
+		info["updated_at"] = user.UpdatedAt.Unix()
+	}
+	return info, nil
+}
+
+// Discovery returns the OpenID Connect discovery document
+func (s *OAuthServerService) Discovery() *domain.OpenIDConfiguration {
+	issuer := s.cfg.AuthServer.Issuer
+	return &domain.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		ScopesSupported:                   []string{domain.ScopeOpenID, domain.ScopeEmail, domain.ScopeProfile},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+			"email", "email_verified", "name", "picture", "locale", "zoneinfo", "updated_at",
+		},
+	}
+}
+
+// JWKS returns the public keys that verify ID tokens
+func (s *OAuthServerService) JWKS() *jwt.JWKSet {
+	return s.idTokenKey.JWKS()
+}
+
+func (s *OAuthServerService) recordAction(ctx context.Context, action, clientID string) {
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:     domain.AuditAdminAction,
+		Outcome:  domain.AuditSuccess,
+		Metadata: map[string]interface{}{"action": action, "client_id": clientID},
+	})
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against its S256 challenge (RFC 7636)
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// validRedirectURI allows absolute https URIs, and http only on loopback for local development.
+// Fragments are not allowed (RFC 6749 section 3.1.2).
+func validRedirectURI(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Fragment != "" || parsed.Host == "" {
+		return false
+	}
+	switch parsed.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := parsed.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,492 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/jwt"
+)
+
+// testVerifier is the PKCE code verifier of every authorization request in these tests
+const testVerifier = "test-verifier-test-verifier-test-verifier-test"
+
+const testRedirectURI = "https://app.example.com/callback"
+
+// oauthTestEnv is an OAuthServerService on the in-memory repositories of a testEnv
+type oauthTestEnv struct {
+	*testEnv
+	oauth           *fakeOAuthRepo
+	serviceAccounts *fakeServiceAccountRepo
+	server          *OAuthServerService
+}
+
+func newTestOAuthServer(t *testing.T) *oauthTestEnv {
+	t.Helper()
+	env := newTestEnv(t)
+	env.cfg.AuthServer.Issuer = "https://auth.example.com"
+	env.cfg.AuthServer.CodeExpiry = time.Minute
+
+	key, err := jwt.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	o := &oauthTestEnv{testEnv: env, oauth: &fakeOAuthRepo{}, serviceAccounts: &fakeServiceAccountRepo{}}
+	o.server = NewOAuthServerService(o.oauth, env.users, env.tokens, o.serviceAccounts, env.audit, key, env.cfg)
+	return o
+}
+
+// registerClient adds a confidential client that may request openid, email and profile,
+// and returns it with its secret
+func (o *oauthTestEnv) registerClient(t *testing.T, name string) (*domain.OAuthClient, string) {
+	t.Helper()
+	client, secret, err := o.server.RegisterClient(context.Background(), name, domain.ClientConfidential,
+		[]string{testRedirectURI}, []string{domain.ScopeOpenID, domain.ScopeEmail, domain.ScopeProfile})
+	if err != nil {
+		t.Fatalf("RegisterClient: %v", err)
+	}
+	return client, secret
+}
+
+// authorize approves an authorization request of the client for the user and returns the code
+func (o *oauthTestEnv) authorize(t *testing.T, client *domain.OAuthClient, userID int64, scope, nonce string, authTime time.Time) string {
+	t.Helper()
+	challenge := sha256.Sum256([]byte(testVerifier))
+	req := &domain.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            client.ClientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               scope,
+		State:               "state",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(challenge[:]),
+		CodeChallengeMethod: "S256",
+		Nonce:               nonce,
+	}
+	scopes, err := o.server.ValidateRequest(client, req)
+	if err != nil {
+		t.Fatalf("ValidateRequest: %v", err)
+	}
+	redirect, err := o.server.Authorize(context.Background(), userID, authTime, client, req, scopes)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	parsed, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatalf("Authorize redirect %q: %v", redirect, err)
+	}
+	return parsed.Query().Get("code")
+}
+
+// exchangeRequest redeems the code as the client would
+func exchangeRequest(client *domain.OAuthClient, secret, code string) *domain.TokenRequest {
+	return &domain.TokenRequest{
+		GrantType:    "authorization_code",
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testVerifier,
+	}
+}
+
+func TestAuthorizeKeepsEarlierConsent(t *testing.T) {
+	o := newTestOAuthServer(t)
+	client, _ := o.registerClient(t, "app")
+	userID := o.users.add(domain.User{Email: "jane@example.com", Verified: true})
+	ctx := context.Background()
+
+	o.authorize(t, client, userID, "openid email", "", time.Now())
+	o.authorize(t, client, userID, "openid profile", "", time.Now())
+
+	// The narrower second request adds profile and takes nothing back
+	for _, scopes := range [][]string{{domain.ScopeOpenID, domain.ScopeEmail}, {domain.ScopeProfile}} {
+		if !o.server.HasConsent(ctx, userID, client.ClientID, scopes) {
+			t.Errorf("HasConsent(%v) = false, want true", scopes)
+		}
+	}
+	if len(o.oauth.consents) != 1 {
+		t.Errorf("consents = %d, want one per user and client", len(o.oauth.consents))
+	}
+}
+
+func TestTokenRejectsMismatchedCodeExchange(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(req *domain.TokenRequest, o *oauthTestEnv)
+	}{
+		{
+			name: "wrong verifier",
+			tamper: func(req *domain.TokenRequest, o *oauthTestEnv) {
+				req.CodeVerifier = "other-verifier-other-verifier-other-verifier"
+			},
+		},
+		{
+			name:   "no verifier",
+			tamper: func(req *domain.TokenRequest, o *oauthTestEnv) { req.CodeVerifier = "" },
+		},
+		{
+			name:   "other redirect_uri",
+			tamper: func(req *domain.TokenRequest, o *oauthTestEnv) { req.RedirectURI = "https://app.example.com/other" },
+		},
+		{
+			name: "code of another client",
+			tamper: func(req *domain.TokenRequest, o *oauthTestEnv) {
+				other, secret := o.registerClient(t, "other")
+				req.ClientID, req.ClientSecret = other.ClientID, secret
+			},
+		},
+		{
+			name:   "unknown code",
+			tamper: func(req *domain.TokenRequest, o *oauthTestEnv) { req.Code = "forged" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOAuthServer(t)
+			client, secret := o.registerClient(t, "app")
+			userID := o.users.add(domain.User{Email: "jane@example.com", Verified: true})
+			req := exchangeRequest(client, secret, o.authorize(t, client, userID, "openid", "", time.Now()))
+			tt.tamper(req, o)
+
+			_, err := o.server.Token(context.Background(), req)
+			if code := oauthErrorCode(err); code != "invalid_grant" {
+				t.Fatalf("Token error = %v, want invalid_grant", err)
+			}
+			if len(o.tokens.tokens) != 0 {
+				t.Errorf("refresh tokens = %d, want none", len(o.tokens.tokens))
+			}
+		})
+	}
+}
+
+func TestTokenRejectsReusedCode(t *testing.T) {
+	o := newTestOAuthServer(t)
+	client, secret := o.registerClient(t, "app")
+	userID := o.users.add(domain.User{Email: "jane@example.com", Verified: true})
+	req := exchangeRequest(client, secret, o.authorize(t, client, userID, "openid", "", time.Now()))
+
+	if _, err := o.server.Token(context.Background(), req); err != nil {
+		t.Fatalf("first Token: %v", err)
+	}
+	_, err := o.server.Token(context.Background(), req)
+	if code := oauthErrorCode(err); code != "invalid_grant" {
+		t.Fatalf("second Token error = %v, want invalid_grant", err)
+	}
+	if len(o.tokens.tokens) != 1 {
+		t.Errorf("refresh tokens = %d, want only the first exchange's", len(o.tokens.tokens))
+	}
+}
+
+func TestTokenRefreshReuseRevokesClientSessions(t *testing.T) {
+	o := newTestOAuthServer(t)
+	client, secret := o.registerClient(t, "app")
+	userID := o.users.add(domain.User{Email: "jane@example.com", Verified: true})
+	ctx := context.Background()
+	session := &domain.RefreshToken{UserID: userID, Token: "first-party", ExpiresAt: time.Now().Add(time.Hour)}
+	o.tokens.tokens = append(o.tokens.tokens, session)
+
+	first, err := o.server.Token(ctx, exchangeRequest(client, secret, o.authorize(t, client, userID, "openid email", "", time.Now())))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	refresh := &domain.TokenRequest{GrantType: "refresh_token", ClientID: client.ClientID, ClientSecret: secret, RefreshToken: first.RefreshToken}
+	rotated, err := o.server.Token(ctx, refresh)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if rotated.RefreshToken == first.RefreshToken || rotated.Scope != "openid email" {
+		t.Errorf("refresh = token %q with scope %q, want a new token with the original scope", rotated.RefreshToken, rotated.Scope)
+	}
+
+	// Whoever replays the rotated token loses the whole grant, the rightful client too
+	_, err = o.server.Token(ctx, refresh)
+	if code := oauthErrorCode(err); code != "invalid_grant" {
+		t.Fatalf("replayed refresh error = %v, want invalid_grant", err)
+	}
+	current, _ := o.tokens.GetByToken(ctx, rotated.RefreshToken)
+	if current.RevokedAt == nil {
+		t.Error("rotated refresh token still valid after the replay")
+	}
+	if session.RevokedAt != nil {
+		t.Error("first-party session revoked, want only the client's tokens")
+	}
+	if reuses := countEvents(o.audit, domain.AuditRefreshReuse); reuses != 1 {
+		t.Errorf("refresh reuse events = %d, want 1", reuses)
+	}
+}
+
+func TestTokenRefreshRejectsBroaderScope(t *testing.T) {
+	o := newTestOAuthServer(t)
+	client, secret := o.registerClient(t, "app")
+	userID := o.users.add(domain.User{Email: "jane@example.com", Verified: true})
+	ctx := context.Background()
+
+	first, err := o.server.Token(ctx, exchangeRequest(client, secret, o.authorize(t, client, userID, "openid", "", time.Now())))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	_, err = o.server.Token(ctx, &domain.TokenRequest{
+		GrantType: "refresh_token", ClientID: client.ClientID, ClientSecret: secret,
+		RefreshToken: first.RefreshToken, Scope: "openid email",
+	})
+	if code := oauthErrorCode(err); code != "invalid_scope" {
+		t.Fatalf("refresh error = %v, want invalid_scope", err)
+	}
+}
+
+// oauthErrorCode returns the OAuth error code of err, empty when it isn't an *OAuthError
+func oauthErrorCode(err error) string {
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return oauthErr.Code
+	}
+	return ""
+}
+
+func countEvents(audit *fakeAudit, eventType string) int {
+	n := 0
+	for _, event := range audit.events {
+		if event.Type == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+// idTokenClaims reads the claims of an ID token. The signature is pkg/jwt's concern.
+func idTokenClaims(t *testing.T, idToken string) *jwt.IDTokenClaims {
+	t.Helper()
+	claims := &jwt.IDTokenClaims{}
+	if _, _, err := gojwt.NewParser().ParseUnverified(idToken, claims); err != nil {
+		t.Fatalf("ID token %q: %v", idToken, err)
+	}
+	return claims
+}
+
+func TestTokenIssuesIDToken(t *testing.T) {
+	o := newTestOAuthServer(t)
+	client, secret := o.registerClient(t, "app")
+	userID := o.users.add(domain.User{Email: "jane@example.com", Verified: true})
+	authTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	ctx := context.Background()
+
+	response, err := o.server.Token(ctx, exchangeRequest(client, secret, o.authorize(t, client, userID, "openid email", "n-0S6_WzA2Mj", authTime)))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	claims := idTokenClaims(t, response.IDToken)
+	if claims.Nonce != "n-0S6_WzA2Mj" || claims.AuthTime == nil || !claims.AuthTime.Equal(authTime) {
+		t.Errorf("nonce = %q, auth_time = %v; want n-0S6_WzA2Mj and %v", claims.Nonce, claims.AuthTime, authTime)
+	}
+	if claims.Issuer != o.cfg.AuthServer.Issuer || claims.Subject != strconv.FormatInt(userID, 10) || len(claims.Audience) != 1 || claims.Audience[0] != client.ClientID {
+		t.Errorf("iss = %q, sub = %q, aud = %v; want %q, %d, [%s]", claims.Issuer, claims.Subject, claims.Audience, o.cfg.AuthServer.Issuer, userID, client.ClientID)
+	}
+	if claims.Email != "jane@example.com" || claims.EmailVerified == nil || !*claims.EmailVerified {
+		t.Errorf("email = %q, email_verified = %v; want jane@example.com, verified", claims.Email, claims.EmailVerified)
+	}
+
+	// A refreshed ID token keeps the login time but not the nonce of the authorization request
+	refreshed, err := o.server.Token(ctx, &domain.TokenRequest{GrantType: "refresh_token", ClientID: client.ClientID, ClientSecret: secret, RefreshToken: response.RefreshToken})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	claims = idTokenClaims(t, refreshed.IDToken)
+	if claims.Nonce != "" || claims.AuthTime == nil || !claims.AuthTime.Equal(authTime) {
+		t.Errorf("refreshed nonce = %q, auth_time = %v; want none and %v", claims.Nonce, claims.AuthTime, authTime)
+	}
+}
+
+func TestTokenIDTokenClaimsFollowScope(t *testing.T) {
+	o := newTestOAuthServer(t)
+	client, secret := o.registerClient(t, "app")
+	userID := o.users.add(domain.User{Email: "jane@example.com", Verified: true})
+	ctx := context.Background()
+
+	response, err := o.server.Token(ctx, exchangeRequest(client, secret, o.authorize(t, client, userID, "openid", "", time.Now())))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if claims := idTokenClaims(t, response.IDToken); claims.Email != "" || claims.EmailVerified != nil {
+		t.Errorf("email = %q, email_verified = %v; want none without the email scope", claims.Email, claims.EmailVerified)
+	}
+
+	response, err = o.server.Token(ctx, exchangeRequest(client, secret, o.authorize(t, client, userID, "profile", "", time.Now())))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if response.IDToken != "" {
+		t.Error("ID token issued without the openid scope")
+	}
+}
+
+func TestTokenClientCredentials(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string // Empty: the account's own
+		scope     string
+		wantScope string
+		wantErr   string
+	}{
+		{name: "every allowed scope by default", wantScope: "reports:read reports:write"},
+		{name: "narrower scope", scope: "reports:read", wantScope: "reports:read"},
+		{name: "scope the account may not request", scope: "reports:read billing:read", wantErr: "invalid_scope"},
+		{name: "wrong secret", secret: "wrong", wantErr: "invalid_client"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOAuthServer(t)
+			account, secret, err := o.server.CreateServiceAccount(context.Background(), "reporting", "", []string{"reports:read", "reports:write"})
+			if err != nil {
+				t.Fatalf("CreateServiceAccount: %v", err)
+			}
+			if tt.secret != "" {
+				secret = tt.secret
+			}
+
+			response, err := o.server.Token(context.Background(), &domain.TokenRequest{
+				GrantType: "client_credentials", ClientID: account.ClientID, ClientSecret: secret, Scope: tt.scope,
+			})
+			if tt.wantErr != "" {
+				if code := oauthErrorCode(err); code != tt.wantErr {
+					t.Fatalf("Token error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Token: %v", err)
+			}
+			if response.Scope != tt.wantScope || response.RefreshToken != "" || response.IDToken != "" {
+				t.Errorf("Token = %+v, want only an access token with scope %q", response, tt.wantScope)
+			}
+			claims, err := jwt.ValidateToken(response.AccessToken, o.cfg.JWT.Secret)
+			if err != nil {
+				t.Fatalf("access token: %v", err)
+			}
+			if claims.ClientID != account.ClientID || claims.Subject != account.ClientID || claims.UserID != 0 || claims.Scope != tt.wantScope {
+				t.Errorf("claims = %+v, want the service account %s with scope %q", claims, account.ClientID, tt.wantScope)
+			}
+		})
+	}
+}
+
+// Service accounts authenticate with client_credentials only, they have no user to act for
+func TestTokenServiceAccountRejectsOtherGrants(t *testing.T) {
+	o := newTestOAuthServer(t)
+	account, secret, err := o.server.CreateServiceAccount(context.Background(), "reporting", "", []string{"reports:read"})
+	if err != nil {
+		t.Fatalf("CreateServiceAccount: %v", err)
+	}
+	_, err = o.server.Token(context.Background(), &domain.TokenRequest{
+		GrantType: "refresh_token", ClientID: account.ClientID, ClientSecret: secret, RefreshToken: "anything",
+	})
+	if code := oauthErrorCode(err); code != "invalid_client" {
+		t.Fatalf("Token error = %v, want invalid_client", err)
+	}
+}
+
+func TestIntrospectOnlyDescribesTheCallersTokens(t *testing.T) {
+	o := newTestOAuthServer(t)
+	client, secret := o.registerClient(t, "app")
+	other, otherSecret := o.registerClient(t, "other")
+	resourceServer, resourceServerSecret, err := o.server.CreateServiceAccount(context.Background(), "api", "", nil)
+	if err != nil {
+		t.Fatalf("CreateServiceAccount: %v", err)
+	}
+	o.cfg.AuthServer.IntrospectionClients = []string{resourceServer.ClientID}
+	userID := o.users.add(domain.User{Email: "jane@example.com", Verified: true})
+	ctx := context.Background()
+
+	issued, err := o.server.Token(ctx, exchangeRequest(client, secret, o.authorize(t, client, userID, "openid email", "", time.Now())))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	session, err := jwt.GenerateAccessToken(&jwt.Claims{UserID: userID, Email: "jane@example.com"}, o.cfg.JWT.Secret, o.cfg.JWT.AccessExpiry)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		callerID     string
+		callerSecret string
+		token        string
+		wantActive   bool
+	}{
+		{name: "own access token", callerID: client.ClientID, callerSecret: secret, token: issued.AccessToken, wantActive: true},
+		{name: "own refresh token", callerID: client.ClientID, callerSecret: secret, token: issued.RefreshToken, wantActive: true},
+		{name: "access token of another client", callerID: other.ClientID, callerSecret: otherSecret, token: issued.AccessToken},
+		{name: "refresh token of another client", callerID: other.ClientID, callerSecret: otherSecret, token: issued.RefreshToken},
+		{name: "first-party session", callerID: client.ClientID, callerSecret: secret, token: session},
+		{name: "allowed resource server", callerID: resourceServer.ClientID, callerSecret: resourceServerSecret, token: issued.AccessToken, wantActive: true},
+		{name: "first-party session at allowed resource server", callerID: resourceServer.ClientID, callerSecret: resourceServerSecret, token: session},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := o.server.Introspect(ctx, &domain.TokenHintRequest{Token: tt.token, ClientID: tt.callerID, ClientSecret: tt.callerSecret})
+			if err != nil {
+				t.Fatalf("Introspect: %v", err)
+			}
+			if response.Active != tt.wantActive {
+				t.Fatalf("active = %v, want %v", response.Active, tt.wantActive)
+			}
+			if !tt.wantActive && (response.ClientID != "" || response.Username != "") {
+				t.Errorf("inactive response = %+v, want nothing but active false", response)
+			}
+			if tt.wantActive && (response.ClientID != client.ClientID || response.Username != "jane@example.com") {
+				t.Errorf("response = %+v, want the token of %s for jane@example.com", response, client.ClientID)
+			}
+		})
+	}
+}
+
+func TestRevokeIgnoresTokensOfOtherClients(t *testing.T) {
+	o := newTestOAuthServer(t)
+	client, secret := o.registerClient(t, "app")
+	other, otherSecret := o.registerClient(t, "other")
+	userID := o.users.add(domain.User{Email: "jane@example.com", Verified: true})
+	ctx := context.Background()
+
+	issued, err := o.server.Token(ctx, exchangeRequest(client, secret, o.authorize(t, client, userID, "openid", "", time.Now())))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	introspect := func(token string) bool {
+		t.Helper()
+		response, err := o.server.Introspect(ctx, &domain.TokenHintRequest{Token: token, ClientID: client.ClientID, ClientSecret: secret})
+		if err != nil {
+			t.Fatalf("Introspect: %v", err)
+		}
+		return response.Active
+	}
+
+	for _, token := range []string{issued.AccessToken, issued.RefreshToken} {
+		if err := o.server.Revoke(ctx, &domain.TokenHintRequest{Token: token, ClientID: other.ClientID, ClientSecret: otherSecret}); err != nil {
+			t.Fatalf("Revoke by another client: %v", err)
+		}
+		if !introspect(token) {
+			t.Error("another client revoked the token")
+		}
+	}
+
+	for _, token := range []string{issued.AccessToken, issued.RefreshToken} {
+		if err := o.server.Revoke(ctx, &domain.TokenHintRequest{Token: token, ClientID: client.ClientID, ClientSecret: secret}); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+		if introspect(token) {
+			t.Error("token still active after the client revoked it")
+		}
+	}
+	if revocations := countEvents(o.audit, domain.AuditOAuthRevoke); revocations != 2 {
+		t.Errorf("revocation events = %d, want 2", revocations)
+	}
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+	"github.com/login_flow/auth-service/pkg/mailer"
+)
+
+var (
+	ErrOrganizationSlugTaken = errors.New("organization slug already in use")
+	ErrOrganizationNotFound  = errors.New("organization not found")
+	ErrMemberNotFound        = errors.New("member not found")
+	ErrAlreadyMember         = errors.New("user is already a member of this organization")
+	ErrOrgRoleNotAllowed     = errors.New("your organization role does not allow this")
+	ErrInvalidOrgInvitation  = errors.New("invalid or expired organization invitation")
+)
+
+// OrganizationService manages the customer organizations users belong to and their
+// members. Member management is authorized by the caller's role in the organization,
+// passed in as the actor's membership: a role can only manage lower roles.
+type OrganizationService struct {
+	orgRepo    domain.OrganizationRepository
+	inviteRepo domain.OrgInvitationRepository
+	userRepo   domain.UserRepository
+	tokenRepo  domain.TokenRepository
+	mailer     mailer.Mailer
+	audit      domain.AuditEmitter
+	cfg        *config.Config
+}
+
+func NewOrganizationService(orgRepo domain.OrganizationRepository, inviteRepo domain.OrgInvitationRepository, userRepo domain.UserRepository, tokenRepo domain.TokenRepository, mailer mailer.Mailer, audit domain.AuditEmitter, cfg *config.Config) *OrganizationService {
+	return &OrganizationService{
+		orgRepo:    orgRepo,
+		inviteRepo: inviteRepo,
+		userRepo:   userRepo,
+		tokenRepo:  tokenRepo,
+		mailer:     mailer,
+		audit:      audit,
+		cfg:        cfg,
+	}
+}
+
+// Create adds an organization owned by the user creating it
+func (s *OrganizationService) Create(ctx context.Context, userID int64, name, slug string) (*domain.Organization, error) {
+	org := &domain.Organization{Name: name, Slug: slug}
+	if err := s.orgRepo.Create(ctx, org, userID); err != nil {
+		if errors.Is(err, domain.ErrOrganizationSlugTaken) {
+			return nil, ErrOrganizationSlugTaken
+		}
+		return nil, err
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditOrganizationCreated,
+		ActorID:   &userID,
+		SubjectID: &userID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"org_id": org.ID, "slug": org.Slug},
+	})
+	return org, nil
+}
+
+// ListForUser returns the organizations the user belongs to, with their role in each
+func (s *OrganizationService) ListForUser(ctx context.Context, userID int64) ([]*domain.UserOrganization, error) {
+	return s.orgRepo.ListForUser(ctx, userID)
+}
+
+// GetMembership returns the user's membership in the organization
+func (s *OrganizationService) GetMembership(ctx context.Context, orgID, userID int64) (*domain.Membership, error) {
+	membership, err := s.orgRepo.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		return nil, ErrMemberNotFound
+	}
+	return membership, nil
+}
+
+func (s *OrganizationService) ListMembers(ctx context.Context, orgID int64) ([]*domain.OrgMember, error) {
+	return s.orgRepo.ListMembers(ctx, orgID)
+}
+
+// InviteMember emails an invitation to join the organization. The invited person accepts
+// it while logged in with that email address, registering first if needed.
+func (s *OrganizationService) InviteMember(ctx context.Context, actor *domain.Membership, email, role string) (*domain.OrgInvitation, error) {
+	if !canAssign(actor, role) {
+		return nil, ErrOrgRoleNotAllowed
+	}
+
+	org, err := s.orgRepo.GetByID(ctx, actor.OrgID)
+	if err != nil {
+		return nil, ErrOrganizationNotFound
+	}
+
+	if user, err := s.userRepo.GetByEmail(ctx, email); err == nil {
+		if _, err := s.orgRepo.GetMembership(ctx, org.ID, user.ID); err == nil {
+			return nil, ErrAlreadyMember
+		}
+	}
+
+	// A new invitation replaces the pending ones, e.g. to change the role
+	if err := s.inviteRepo.DeletePending(ctx, org.ID, email); err != nil {
+		return nil, err
+	}
+
+	token, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+
+	invitation := &domain.OrgInvitation{
+		OrgID:     org.ID,
+		Email:     email,
+		Role:      role,
+		TokenHash: crypto.HashToken(token),
+		InvitedBy: actor.UserID,
+		ExpiresAt: time.Now().Add(s.cfg.Registration.InviteExpiry),
+	}
+	if err := s.inviteRepo.Create(ctx, invitation); err != nil {
+		return nil, err
+	}
+
+	link := fmt.Sprintf("%s/org-invite?token=%s", s.cfg.Server.AppURL, url.QueryEscape(token))
+	body := fmt.Sprintf("You have been invited to join %s. Log in with this email address and accept the invitation by opening the link below:\n\n%s\n\nThe invitation expires in %s.\n",
+		org.Name, link, s.cfg.Registration.InviteExpiry)
+	if err := s.mailer.Send(ctx, email, "Join "+org.Name, body); err != nil {
+		return nil, fmt.Errorf("failed to send organization invitation email: %w", err)
+	}
+
+	s.recordAction(ctx, actor, "invite_member", nil, map[string]interface{}{"email": email, "role": role})
+	return invitation, nil
+}
+
+// AcceptInvitation adds the user to the organization of an invitation sent to their email
+func (s *OrganizationService) AcceptInvitation(ctx context.Context, userID int64, token string) (*domain.Organization, error) {
+	invitation, err := s.inviteRepo.GetByHash(ctx, crypto.HashToken(token))
+	if err != nil || !invitation.IsValid() {
+		return nil, ErrInvalidOrgInvitation
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	// A forwarded invitation can't be accepted from another account
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return nil, ErrInvalidOrgInvitation
+	}
+
+	org, err := s.orgRepo.GetByID(ctx, invitation.OrgID)
+	if err != nil {
+		return nil, ErrOrganizationNotFound
+	}
+	if _, err := s.orgRepo.GetMembership(ctx, org.ID, userID); err == nil {
+		return nil, ErrAlreadyMember
+	}
+
+	if err := s.inviteRepo.Accept(ctx, invitation.ID); err != nil {
+		return nil, ErrInvalidOrgInvitation
+	}
+	if err := s.orgRepo.AddMember(ctx, &domain.Membership{OrgID: org.ID, UserID: userID, Role: invitation.Role}); err != nil {
+		return nil, err
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditOrgAction,
+		ActorID:   &userID,
+		SubjectID: &userID,
+		Outcome:   domain.AuditSuccess,
+		Reason:    "accept_invitation",
+		Metadata:  map[string]interface{}{"org_id": org.ID, "role": invitation.Role, "invitation_id": invitation.ID},
+	})
+	return org, nil
+}
+
+// ChangeMemberRole sets a member's role. Ownership moves only with TransferOwnership.
+func (s *OrganizationService) ChangeMemberRole(ctx context.Context, actor *domain.Membership, userID int64, role string) error {
+	target, err := s.manageableMember(ctx, actor, userID)
+	if err != nil {
+		return err
+	}
+	if !canAssign(actor, role) {
+		return ErrOrgRoleNotAllowed
+	}
+
+	if err := s.orgRepo.UpdateMemberRole(ctx, actor.OrgID, userID, role); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, actor, "change_member_role", &userID, map[string]interface{}{"from": target.Role, "to": role})
+	return nil
+}
+
+// RemoveMember takes a user out of the organization and revokes their sessions in it.
+// Members can also remove themselves, except the owner, who must transfer ownership first.
+func (s *OrganizationService) RemoveMember(ctx context.Context, actor *domain.Membership, userID int64) error {
+	if actor.UserID == userID {
+		if actor.Role == domain.OrgRoleOwner {
+			return ErrOrgRoleNotAllowed
+		}
+	} else if _, err := s.manageableMember(ctx, actor, userID); err != nil {
+		return err
+	}
+
+	if err := s.orgRepo.RemoveMember(ctx, actor.OrgID, userID); err != nil {
+		return err
+	}
+	if err := s.tokenRepo.RevokeAllForOrg(ctx, userID, actor.OrgID); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, actor, "remove_member", &userID, map[string]interface{}{})
+	return nil
+}
+
+// TransferOwnership makes another member the owner, the current owner becomes an admin
+func (s *OrganizationService) TransferOwnership(ctx context.Context, actor *domain.Membership, userID int64) error {
+	if actor.Role != domain.OrgRoleOwner || actor.UserID == userID {
+		return ErrOrgRoleNotAllowed
+	}
+	if _, err := s.orgRepo.GetMembership(ctx, actor.OrgID, userID); err != nil {
+		return ErrMemberNotFound
+	}
+
+	if err := s.orgRepo.TransferOwnership(ctx, actor.OrgID, actor.UserID, userID); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, actor, "transfer_ownership", &userID, map[string]interface{}{})
+	return nil
+}
+
+// manageableMember returns the membership of userID if the actor's role is above it
+func (s *OrganizationService) manageableMember(ctx context.Context, actor *domain.Membership, userID int64) (*domain.Membership, error) {
+	target, err := s.orgRepo.GetMembership(ctx, actor.OrgID, userID)
+	if err != nil {
+		return nil, ErrMemberNotFound
+	}
+	if domain.OrgRoleRank(actor.Role) <= domain.OrgRoleRank(target.Role) {
+		return nil, ErrOrgRoleNotAllowed
+	}
+	return target, nil
+}
+
+// canAssign tells whether the actor may give someone the role: any valid role up
+// to their own, but never owner
+func canAssign(actor *domain.Membership, role string) bool {
+	if role == domain.OrgRoleOwner || domain.OrgRoleRank(role) == 0 {
+		return false
+	}
+	return domain.OrgRoleRank(role) <= domain.OrgRoleRank(actor.Role)
+}
+
+// recordAction audits a membership change, subjectID is the member it affected if any
+func (s *OrganizationService) recordAction(ctx context.Context, actor *domain.Membership, action string, subjectID *int64, metadata map[string]interface{}) {
+	metadata["org_id"] = actor.OrgID
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditOrgAction,
+		ActorID:   &actor.UserID,
+		SubjectID: subjectID,
+		Outcome:   domain.AuditSuccess,
+		Reason:    action,
+		Metadata:  metadata,
+	})
+}
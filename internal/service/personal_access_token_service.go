@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+)
+
+var (
+	ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+	ErrScopeNotAllowed             = errors.New("scope is unknown or requires a permission you don't have")
+)
+
+// lastUsedResolution limits how often last_used_at is written for a busy token
+const lastUsedResolution = time.Minute
+
+// PersonalAccessTokenAuth is the result of authenticating a request with a personal access token
+type PersonalAccessTokenAuth struct {
+	User        *domain.User
+	Token       *domain.PersonalAccessToken
+	Roles       []string
+	Permissions []string // The user's current permissions that the token has as scopes
+}
+
+// PersonalAccessTokenService manages the tokens users create for scripts and CLIs
+type PersonalAccessTokenService struct {
+	patRepo  domain.PersonalAccessTokenRepository
+	userRepo domain.UserRepository
+	roleRepo domain.RoleRepository
+	audit    domain.AuditEmitter
+}
+
+func NewPersonalAccessTokenService(patRepo domain.PersonalAccessTokenRepository, userRepo domain.UserRepository, roleRepo domain.RoleRepository, audit domain.AuditEmitter) *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{
+		patRepo:  patRepo,
+		userRepo: userRepo,
+		roleRepo: roleRepo,
+		audit:    audit,
+	}
+}
+
+// Create issues a token for the user. The token is returned here only, it is stored hashed.
+// Scopes are the account scopes, or admin permissions the user currently holds.
+func (s *PersonalAccessTokenService) Create(ctx context.Context, userID int64, name string, scopes []string, expiry time.Duration) (*domain.PersonalAccessToken, string, error) {
+	permissions, err := s.roleRepo.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, scope := range scopes {
+		if scope != domain.ScopeAccountRead && scope != domain.ScopeAccountWrite && !slices.Contains(permissions, scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrScopeNotAllowed, scope)
+		}
+	}
+
+	random, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate personal access token: %w", err)
+	}
+	token := domain.PersonalAccessTokenPrefix + strings.TrimRight(random, "=")
+
+	pat := &domain.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: crypto.HashToken(token),
+		Hint:      token[len(token)-4:],
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+		ExpiresAt: time.Now().Add(expiry),
+	}
+	if err := s.patRepo.Create(ctx, pat); err != nil {
+		return nil, "", err
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditPersonalAccessTokenCreated,
+		ActorID:   &userID,
+		SubjectID: &userID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"token_id": pat.ID, "name": name, "scopes": pat.Scopes, "expires_at": pat.ExpiresAt},
+	})
+
+	return pat, token, nil
+}
+
+// List returns the user's active tokens
+func (s *PersonalAccessTokenService) List(ctx context.Context, userID int64) ([]*domain.PersonalAccessToken, error) {
+	return s.patRepo.ListForUser(ctx, userID)
+}
+
+// Revoke revokes one of the user's tokens
+func (s *PersonalAccessTokenService) Revoke(ctx context.Context, userID, id int64) error {
+	if err := s.patRepo.Revoke(ctx, userID, id); err != nil {
+		if errors.Is(err, domain.ErrPersonalAccessTokenNotFound) {
+			return ErrPersonalAccessTokenNotFound
+		}
+		return err
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditPersonalAccessTokenRevoked,
+		ActorID:   &userID,
+		SubjectID: &userID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"token_id": id},
+	})
+	return nil
+}
+
+// Authenticate checks a token from an Authorization header. Roles and permissions are
+// read fresh, so a token never grants more than its user currently has.
+func (s *PersonalAccessTokenService) Authenticate(ctx context.Context, token string) (*PersonalAccessTokenAuth, error) {
+	if !strings.HasPrefix(token, domain.PersonalAccessTokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	pat, err := s.patRepo.GetByHash(ctx, crypto.HashToken(token))
+	if err != nil || !pat.IsValid() {
+		return nil, ErrInvalidToken
+	}
+
+	// Accounts pending deletion only come back through a real login
+	user, err := s.userRepo.GetByID(ctx, pat.UserID)
+	if err != nil || !user.IsActive() || user.DeletionScheduledAt != nil {
+		return nil, ErrInvalidToken
+	}
+
+	roles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := s.roleRepo.GetUserPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	permissions = slices.DeleteFunc(permissions, func(permission string) bool {
+		return !pat.HasScope(permission)
+	})
+	// The admin role lets a request into /api/admin, so it only comes with a token that
+	// was granted an admin permission
+	if len(permissions) == 0 {
+		roles = slices.DeleteFunc(slices.Clone(roles), func(role string) bool {
+			return role == domain.RoleAdmin
+		})
+	}
+
+	if pat.LastUsedAt == nil || time.Since(*pat.LastUsedAt) > lastUsedResolution {
+		if err := s.patRepo.UpdateLastUsed(ctx, pat.ID); err != nil {
+			log.Printf("failed to record personal access token use: %v", err)
+		}
+	}
+
+	return &PersonalAccessTokenAuth{
+		User:        user,
+		Token:       pat,
+		Roles:       roles,
+		Permissions: permissions,
+	}, nil
+}
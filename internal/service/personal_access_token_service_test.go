@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+)
+
+func TestPersonalAccessTokenAdminRoleNeedsAdminScope(t *testing.T) {
+	tests := []struct {
+		name            string
+		scopes          []string
+		wantAdmin       bool
+		wantPermissions []string
+	}{
+		{name: "account scopes only", scopes: []string{domain.ScopeAccountRead, domain.ScopeAccountWrite}},
+		{name: "admin permission", scopes: []string{domain.ScopeAccountRead, domain.PermissionUsersRead}, wantAdmin: true, wantPermissions: []string{domain.PermissionUsersRead}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			s := NewPersonalAccessTokenService(env.pats, env.users, env.roles, env.audit)
+			userID := env.users.add(domain.User{Email: "admin@example.com", Verified: true})
+			env.roles.roles[userID] = []string{domain.RoleUser, domain.RoleAdmin}
+			env.roles.permissions[userID] = []string{domain.PermissionUsersRead, domain.PermissionUsersWrite}
+
+			_, token, err := s.Create(ctx, userID, "script", tt.scopes, time.Hour)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			auth, err := s.Authenticate(ctx, token)
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if isAdmin := slices.Contains(auth.Roles, domain.RoleAdmin); isAdmin != tt.wantAdmin {
+				t.Errorf("roles = %v, admin %v; want admin %v", auth.Roles, isAdmin, tt.wantAdmin)
+			}
+			if !slices.Contains(auth.Roles, domain.RoleUser) {
+				t.Errorf("roles = %v, want the user role kept", auth.Roles)
+			}
+			if !slices.Equal(auth.Permissions, tt.wantPermissions) {
+				t.Errorf("permissions = %v, want %v", auth.Permissions, tt.wantPermissions)
+			}
+			if !slices.Contains(env.roles.roles[userID], domain.RoleAdmin) {
+				t.Error("the user lost the admin role")
+			}
+		})
+	}
+}
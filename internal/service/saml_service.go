@@ -0,0 +1,406 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+	"github.com/login_flow/auth-service/pkg/saml"
+)
+
+var (
+	ErrSAMLConnectionNotFound  = errors.New("saml connection not found")
+	ErrSAMLConnectionSlugTaken = errors.New("saml connection slug already in use")
+	ErrInvalidSAMLMetadata     = errors.New("invalid identity provider metadata")
+	ErrInvalidSAMLState        = errors.New("invalid or expired saml login state")
+	ErrInvalidSAMLResponse     = errors.New("invalid saml response")
+	ErrSAMLAssertionReplayed   = errors.New("saml assertion was already used")
+	ErrSAMLEmailMissing        = errors.New("identity provider did not send an email")
+	ErrSAMLDomainNotAllowed    = errors.New("email domain is not allowed for this connection")
+)
+
+// samlTransientNameID is a per-login NameID, it can't identify the user across logins
+const samlTransientNameID = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+
+// SAMLState is kept by the browser between the AuthnRequest and the response
+type SAMLState struct {
+	Connection string `json:"connection"`
+	RequestID  string `json:"request_id"`
+}
+
+// SAMLService makes this service a SAML 2.0 service provider for enterprise SSO.
+// Each connection is one identity provider with its own SP entity ID and ACS URL.
+type SAMLService struct {
+	authService  *AuthService
+	samlRepo     domain.SAMLRepository
+	userRepo     domain.UserRepository
+	identityRepo domain.IdentityRepository
+	orgRepo      domain.OrganizationRepository
+	audit        domain.AuditEmitter
+	keys         *saml.KeyPair
+	httpClient   *http.Client // Fetches IdP metadata
+	cfg          *config.Config
+}
+
+func NewSAMLService(authService *AuthService, samlRepo domain.SAMLRepository, userRepo domain.UserRepository, identityRepo domain.IdentityRepository, orgRepo domain.OrganizationRepository, audit domain.AuditEmitter, keys *saml.KeyPair, cfg *config.Config) *SAMLService {
+	return &SAMLService{
+		authService:  authService,
+		samlRepo:     samlRepo,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		orgRepo:      orgRepo,
+		audit:        audit,
+		keys:         keys,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		cfg:          cfg,
+	}
+}
+
+// CreateConnection imports an identity provider from its metadata XML, or from the URL
+// given instead. Users provisioned through it join orgID, when set.
+func (s *SAMLService) CreateConnection(ctx context.Context, name, slug, metadataXML, metadataURL, emailAttribute string, domains []string, orgID *int64) (*domain.SAMLConnection, error) {
+	metadata, entityID, err := s.loadMetadata(ctx, metadataXML, metadataURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if orgID != nil {
+		if _, err := s.orgRepo.GetByID(ctx, *orgID); err != nil {
+			return nil, ErrOrganizationNotFound
+		}
+	}
+
+	conn := &domain.SAMLConnection{
+		Slug:           slug,
+		Name:           name,
+		IdPEntityID:    entityID,
+		IdPMetadata:    metadata,
+		EmailAttribute: emailAttribute,
+		Domains:        normalizeDomains(domains),
+		OrgID:          orgID,
+	}
+	if err := s.samlRepo.CreateConnection(ctx, conn); err != nil {
+		if errors.Is(err, domain.ErrSAMLConnectionSlugTaken) {
+			return nil, ErrSAMLConnectionSlugTaken
+		}
+		return nil, err
+	}
+
+	s.recordAction(ctx, "create_saml_connection", slug)
+	return conn, nil
+}
+
+func (s *SAMLService) ListConnections(ctx context.Context) ([]*domain.SAMLConnection, error) {
+	return s.samlRepo.ListConnections(ctx)
+}
+
+// UpdateMetadata re-imports the metadata of a connection, e.g. after the identity
+// provider rotated its signing certificate
+func (s *SAMLService) UpdateMetadata(ctx context.Context, slug, metadataXML, metadataURL string) (*domain.SAMLConnection, error) {
+	conn, err := s.samlRepo.GetConnectionBySlug(ctx, slug)
+	if err != nil {
+		return nil, ErrSAMLConnectionNotFound
+	}
+
+	metadata, entityID, err := s.loadMetadata(ctx, metadataXML, metadataURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.samlRepo.UpdateMetadata(ctx, conn.ID, entityID, metadata); err != nil {
+		return nil, err
+	}
+	conn.IdPEntityID = entityID
+	conn.IdPMetadata = metadata
+
+	s.recordAction(ctx, "update_saml_metadata", slug)
+	return conn, nil
+}
+
+// DeleteConnection removes a connection. Users it provisioned keep their accounts.
+func (s *SAMLService) DeleteConnection(ctx context.Context, slug string) error {
+	conn, err := s.samlRepo.GetConnectionBySlug(ctx, slug)
+	if err != nil {
+		return ErrSAMLConnectionNotFound
+	}
+	if err := s.samlRepo.DeleteConnection(ctx, conn.ID); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "delete_saml_connection", slug)
+	return nil
+}
+
+// Metadata returns the SP metadata XML the identity provider imports for a connection
+func (s *SAMLService) Metadata(ctx context.Context, slug string) ([]byte, error) {
+	_, sp, err := s.serviceProvider(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	return sp.Metadata()
+}
+
+// Start returns the identity provider URL carrying the AuthnRequest, and the state
+// the response has to be given back with
+func (s *SAMLService) Start(ctx context.Context, slug string) (string, *SAMLState, error) {
+	_, sp, err := s.serviceProvider(ctx, slug)
+	if err != nil {
+		return "", nil, err
+	}
+
+	redirectURL, requestID, err := sp.AuthnRequestURL("")
+	if err != nil {
+		return "", nil, err
+	}
+	return redirectURL, &SAMLState{Connection: slug, RequestID: requestID}, nil
+}
+
+// Complete validates the identity provider's response, finds or provisions the user and
+// starts a session. Only responses to a request started by this browser are accepted.
+func (s *SAMLService) Complete(ctx context.Context, samlState *SAMLState, slug, samlResponse string) (accessToken, refreshToken string, user *domain.User, err error) {
+	conn, sp, err := s.serviceProvider(ctx, slug)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if samlState == nil || samlState.Connection != slug || samlState.RequestID == "" {
+		return "", "", nil, ErrInvalidSAMLState
+	}
+
+	assertion, err := sp.ParseResponse(samlResponse, samlState.RequestID)
+	if err != nil {
+		s.authService.loginFailed(ctx, "", nil, "saml_invalid_response")
+		return "", "", nil, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, err)
+	}
+
+	// A valid assertion is only accepted once, even if it is intercepted and posted again
+	err = s.samlRepo.UseAssertion(ctx, &domain.SAMLAssertion{ID: assertion.ID, ConnectionID: conn.ID, ExpiresAt: assertion.ExpiresAt})
+	if err != nil {
+		if errors.Is(err, domain.ErrSAMLAssertionReplayed) {
+			s.authService.loginFailed(ctx, "", nil, "saml_assertion_replayed")
+			return "", "", nil, ErrSAMLAssertionReplayed
+		}
+		return "", "", nil, err
+	}
+
+	user, err = s.resolveUser(ctx, conn, assertion)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if user.Status == domain.UserStatusPendingApproval {
+		s.authService.loginFailed(ctx, user.Email, &user.ID, "pending_approval")
+		return "", "", nil, ErrUserPendingApproval
+	}
+
+	if !user.IsActive() {
+		s.authService.loginFailed(ctx, user.Email, &user.ID, "account_disabled")
+		return "", "", nil, ErrUserDisabled
+	}
+
+	accessToken, refreshToken, err = s.authService.StartSession(ctx, user, samlProvider(conn))
+	if err != nil {
+		return "", "", nil, err
+	}
+	return accessToken, refreshToken, user, nil
+}
+
+// resolveUser returns the user linked to the asserted NameID, or links the user with the
+// asserted email. The identity provider is trusted for the email domains configured on the
+// connection, so a new account is provisioned just in time whatever the registration mode:
+// an admin set up the connection. Existing accounts are only linked when their email is
+// verified, like with social login.
+func (s *SAMLService) resolveUser(ctx context.Context, conn *domain.SAMLConnection, assertion *saml.Assertion) (*domain.User, error) {
+	provider := samlProvider(conn)
+	persistent := assertion.NameID != "" && assertion.NameIDFormat != samlTransientNameID
+
+	if persistent {
+		linked, err := s.identityRepo.GetByProviderSubject(ctx, provider, assertion.NameID)
+		if err == nil {
+			if err := s.identityRepo.UpdateLastLogin(ctx, linked.ID); err != nil {
+				return nil, err
+			}
+			user, err := s.userRepo.GetByID(ctx, linked.UserID)
+			if err != nil {
+				return nil, ErrUserNotFound
+			}
+			return user, nil
+		}
+	}
+
+	email := strings.ToLower(strings.TrimSpace(samlEmail(conn, assertion)))
+	if email == "" {
+		s.authService.loginFailed(ctx, "", nil, "saml_email_missing")
+		return nil, ErrSAMLEmailMissing
+	}
+	if !slices.Contains(conn.Domains, emailDomain(email)) {
+		s.authService.loginFailed(ctx, email, nil, "saml_domain_not_allowed")
+		return nil, ErrSAMLDomainNotAllowed
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err == nil {
+		if !user.Verified || user.IsDirectoryUser() {
+			s.authService.loginFailed(ctx, email, &user.ID, "saml_identity_conflict")
+			return nil, ErrIdentityConflict
+		}
+	} else {
+		user, err = s.provision(ctx, conn, email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if persistent {
+		if err := s.link(ctx, user, provider, assertion.NameID, email); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// provision creates the account of a user signing in for the first time. Like social-only
+// accounts it gets an unusable random password, a password reset sets a real one.
+func (s *SAMLService) provision(ctx context.Context, conn *domain.SAMLConnection, email string) (*domain.User, error) {
+	password, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+	hashedPassword, err := crypto.HashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user, err := s.authService.createUser(ctx, &domain.User{
+		Email:    email,
+		Password: hashedPassword,
+		Status:   domain.UserStatusActive,
+	}, samlProvider(conn))
+	if err != nil {
+		return nil, err
+	}
+
+	if conn.OrgID != nil {
+		err := s.orgRepo.AddMember(ctx, &domain.Membership{OrgID: *conn.OrgID, UserID: user.ID, Role: domain.OrgRoleMember})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add provisioned user to organization: %w", err)
+		}
+	}
+	return user, nil
+}
+
+func (s *SAMLService) link(ctx context.Context, user *domain.User, provider, nameID, email string) error {
+	if err := s.identityRepo.Create(ctx, &domain.UserIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  nameID,
+		Email:    email,
+	}); err != nil {
+		return err
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditIdentityLinked,
+		SubjectID: &user.ID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"provider": provider, "email": email},
+	})
+	return nil
+}
+
+// serviceProvider builds the SP of a connection from its stored IdP metadata
+func (s *SAMLService) serviceProvider(ctx context.Context, slug string) (*domain.SAMLConnection, *saml.ServiceProvider, error) {
+	conn, err := s.samlRepo.GetConnectionBySlug(ctx, slug)
+	if err != nil {
+		return nil, nil, ErrSAMLConnectionNotFound
+	}
+
+	base := fmt.Sprintf("%s/api/auth/saml/%s", s.cfg.SAML.BaseURL, conn.Slug)
+	sp, err := saml.NewServiceProvider(saml.Config{
+		EntityID:    base + "/metadata",
+		ACSURL:      base + "/acs",
+		IdPMetadata: []byte(conn.IdPMetadata),
+		Keys:        s.keys,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, sp, nil
+}
+
+// loadMetadata returns the validated metadata XML and the IdP entity ID it describes
+func (s *SAMLService) loadMetadata(ctx context.Context, metadataXML, metadataURL string) (string, string, error) {
+	if metadataURL != "" {
+		data, err := saml.FetchMetadata(ctx, s.httpClient, metadataURL)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %v", ErrInvalidSAMLMetadata, err)
+		}
+		metadataXML = string(data)
+	}
+
+	entityID, err := saml.ParseIdPMetadata([]byte(metadataXML))
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidSAMLMetadata, err)
+	}
+	return metadataXML, entityID, nil
+}
+
+func (s *SAMLService) recordAction(ctx context.Context, action, slug string) {
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:     domain.AuditAdminAction,
+		Outcome:  domain.AuditSuccess,
+		Metadata: map[string]interface{}{"action": action, "connection": slug},
+	})
+}
+
+// samlProvider names the connection in identities and audit events
+func samlProvider(conn *domain.SAMLConnection) string {
+	return "saml:" + conn.Slug
+}
+
+// samlEmail reads the email from the configured attribute, or from the common email
+// attributes and an email-like NameID when none is configured
+func samlEmail(conn *domain.SAMLConnection, assertion *saml.Assertion) string {
+	if conn.EmailAttribute != "" {
+		return assertion.Attribute(conn.EmailAttribute)
+	}
+	for _, name := range []string{
+		"email",
+		"mail",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	} {
+		if email := assertion.Attribute(name); email != "" {
+			return email
+		}
+	}
+	if strings.Contains(assertion.NameID, "@") {
+		return assertion.NameID
+	}
+	return ""
+}
+
+func normalizeDomains(domains []string) []string {
+	normalized := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d != "" && !slices.Contains(normalized, d) {
+			normalized = append(normalized, d)
+		}
+	}
+	return normalized
+}
+
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return email[at+1:]
+}
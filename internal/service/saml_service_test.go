@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/saml"
+	"github.com/login_flow/auth-service/pkg/saml/samltest"
+)
+
+const samlPersistentNameID = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+
+type fakeSAMLRepo struct {
+	domain.SAMLRepository
+	conn       *domain.SAMLConnection
+	assertions map[string]bool
+}
+
+func (r *fakeSAMLRepo) GetConnectionBySlug(ctx context.Context, slug string) (*domain.SAMLConnection, error) {
+	if r.conn == nil || r.conn.Slug != slug {
+		return nil, errFakeNotFound
+	}
+	return r.conn, nil
+}
+
+func (r *fakeSAMLRepo) UseAssertion(ctx context.Context, assertion *domain.SAMLAssertion) error {
+	if r.assertions[assertion.ID] {
+		return domain.ErrSAMLAssertionReplayed
+	}
+	r.assertions[assertion.ID] = true
+	return nil
+}
+
+func newTestSAMLService(t *testing.T, env *testEnv, conn *domain.SAMLConnection) (*SAMLService, *fakeSAMLRepo) {
+	t.Helper()
+	keys, err := saml.GenerateKeyPair("sp.example.com")
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	env.cfg.SAML.BaseURL = "https://sp.example.com"
+
+	samlRepo := &fakeSAMLRepo{conn: conn, assertions: make(map[string]bool)}
+	return NewSAMLService(env.auth, samlRepo, env.users, env.identities, env.orgs, env.audit, keys, env.cfg), samlRepo
+}
+
+func TestSAMLResolveUser(t *testing.T) {
+	orgID := int64(7)
+	conn := &domain.SAMLConnection{ID: 1, Slug: "acme", Domains: []string{"acme.com"}, OrgID: &orgID}
+
+	newAssertion := func(nameID, nameIDFormat, email string) *saml.Assertion {
+		return &saml.Assertion{
+			ID:           "id-assertion",
+			NameID:       nameID,
+			NameIDFormat: nameIDFormat,
+			Attributes:   map[string][]string{"email": {email}},
+		}
+	}
+
+	t.Run("linked NameID wins over the email", func(t *testing.T) {
+		env := newTestEnv(t)
+		s, _ := newTestSAMLService(t, env, conn)
+		userID := env.users.add(domain.User{Email: "jane@acme.com", Verified: true})
+		env.identities.Create(context.Background(), &domain.UserIdentity{UserID: userID, Provider: "saml:acme", Subject: "00u1"})
+
+		// The IdP changed the email, the NameID still identifies the user
+		user, err := s.resolveUser(context.Background(), conn, newAssertion("00u1", samlPersistentNameID, "jane.doe@acme.com"))
+		if err != nil {
+			t.Fatalf("resolveUser: %v", err)
+		}
+		if user.ID != userID {
+			t.Errorf("user ID = %d, want %d", user.ID, userID)
+		}
+	})
+
+	t.Run("email outside the allowed domains", func(t *testing.T) {
+		env := newTestEnv(t)
+		s, _ := newTestSAMLService(t, env, conn)
+		env.users.add(domain.User{Email: "admin@example.com", Verified: true})
+
+		_, err := s.resolveUser(context.Background(), conn, newAssertion("00u1", samlPersistentNameID, "admin@example.com"))
+		if !errors.Is(err, ErrSAMLDomainNotAllowed) {
+			t.Fatalf("resolveUser error = %v, want ErrSAMLDomainNotAllowed", err)
+		}
+		if len(env.identities.identities) != 0 {
+			t.Error("identity was linked")
+		}
+	})
+
+	t.Run("subdomain is not an allowed domain", func(t *testing.T) {
+		env := newTestEnv(t)
+		s, _ := newTestSAMLService(t, env, conn)
+
+		_, err := s.resolveUser(context.Background(), conn, newAssertion("00u1", samlPersistentNameID, "jane@evil.acme.com"))
+		if !errors.Is(err, ErrSAMLDomainNotAllowed) {
+			t.Fatalf("resolveUser error = %v, want ErrSAMLDomainNotAllowed", err)
+		}
+	})
+
+	t.Run("missing email", func(t *testing.T) {
+		env := newTestEnv(t)
+		s, _ := newTestSAMLService(t, env, conn)
+
+		_, err := s.resolveUser(context.Background(), conn, newAssertion("00u1", samlPersistentNameID, ""))
+		if !errors.Is(err, ErrSAMLEmailMissing) {
+			t.Fatalf("resolveUser error = %v, want ErrSAMLEmailMissing", err)
+		}
+	})
+
+	t.Run("unverified account is not taken over", func(t *testing.T) {
+		env := newTestEnv(t)
+		s, _ := newTestSAMLService(t, env, conn)
+		env.users.add(domain.User{Email: "jane@acme.com", Verified: false})
+
+		_, err := s.resolveUser(context.Background(), conn, newAssertion("00u1", samlPersistentNameID, "jane@acme.com"))
+		if !errors.Is(err, ErrIdentityConflict) {
+			t.Fatalf("resolveUser error = %v, want ErrIdentityConflict", err)
+		}
+		if len(env.identities.identities) != 0 {
+			t.Error("identity was linked to the unverified account")
+		}
+	})
+
+	t.Run("directory account is not taken over", func(t *testing.T) {
+		env := newTestEnv(t)
+		s, _ := newTestSAMLService(t, env, conn)
+		env.users.add(domain.User{Email: "jane@acme.com", Verified: true, AuthSource: domain.AuthSourceLDAP})
+
+		_, err := s.resolveUser(context.Background(), conn, newAssertion("00u1", samlPersistentNameID, "jane@acme.com"))
+		if !errors.Is(err, ErrIdentityConflict) {
+			t.Fatalf("resolveUser error = %v, want ErrIdentityConflict", err)
+		}
+	})
+
+	t.Run("verified account is linked", func(t *testing.T) {
+		env := newTestEnv(t)
+		s, _ := newTestSAMLService(t, env, conn)
+		userID := env.users.add(domain.User{Email: "jane@acme.com", Verified: true})
+
+		user, err := s.resolveUser(context.Background(), conn, newAssertion("00u1", samlPersistentNameID, "Jane@Acme.com"))
+		if err != nil {
+			t.Fatalf("resolveUser: %v", err)
+		}
+		if user.ID != userID {
+			t.Errorf("user ID = %d, want %d", user.ID, userID)
+		}
+		identity, err := env.identities.GetByProviderSubject(context.Background(), "saml:acme", "00u1")
+		if err != nil || identity.UserID != userID {
+			t.Errorf("NameID is not linked to user %d", userID)
+		}
+		if len(env.orgs.members) != 0 {
+			t.Error("existing account was added to the organization")
+		}
+	})
+
+	t.Run("new user is provisioned into the organization", func(t *testing.T) {
+		env := newTestEnv(t)
+		s, _ := newTestSAMLService(t, env, conn)
+
+		user, err := s.resolveUser(context.Background(), conn, newAssertion("00u1", samlPersistentNameID, "new@acme.com"))
+		if err != nil {
+			t.Fatalf("resolveUser: %v", err)
+		}
+		if user.Email != "new@acme.com" || !env.users.users[user.ID].Verified || !user.IsActive() || user.IsDirectoryUser() {
+			t.Errorf("provisioned user = %+v, want an active, verified local account for new@acme.com", user)
+		}
+		if len(env.orgs.members) != 1 || env.orgs.members[0].OrgID != orgID || env.orgs.members[0].UserID != user.ID ||
+			env.orgs.members[0].Role != domain.OrgRoleMember {
+			t.Errorf("memberships = %+v, want user %d as member of org %d", env.orgs.members, user.ID, orgID)
+		}
+		if _, err := env.identities.GetByProviderSubject(context.Background(), "saml:acme", "00u1"); err != nil {
+			t.Error("NameID is not linked to the provisioned user")
+		}
+	})
+
+	t.Run("approval queue doesn't apply to provisioned users", func(t *testing.T) {
+		env := newTestEnv(t)
+		env.cfg.Registration.RequireApproval = true
+		s, _ := newTestSAMLService(t, env, conn)
+
+		user, err := s.resolveUser(context.Background(), conn, newAssertion("00u1", samlPersistentNameID, "new@acme.com"))
+		if err != nil {
+			t.Fatalf("resolveUser: %v", err)
+		}
+		if !user.IsActive() {
+			t.Errorf("status = %q, want %q", user.Status, domain.UserStatusActive)
+		}
+	})
+
+	t.Run("transient NameID is not linked", func(t *testing.T) {
+		env := newTestEnv(t)
+		s, _ := newTestSAMLService(t, env, conn)
+		env.users.add(domain.User{Email: "jane@acme.com", Verified: true})
+
+		if _, err := s.resolveUser(context.Background(), conn, newAssertion("_a1b2", samlTransientNameID, "jane@acme.com")); err != nil {
+			t.Fatalf("resolveUser: %v", err)
+		}
+		if len(env.identities.identities) != 0 {
+			t.Error("transient NameID was linked")
+		}
+	})
+}
+
+func TestSAMLCompleteRejectsReplay(t *testing.T) {
+	idp, err := samltest.NewIdP("https://idp.acme.com/metadata")
+	if err != nil {
+		t.Fatalf("NewIdP: %v", err)
+	}
+	metadata, err := idp.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata: %v", err)
+	}
+
+	env := newTestEnv(t)
+	conn := &domain.SAMLConnection{ID: 1, Slug: "acme", IdPMetadata: string(metadata), Domains: []string{"acme.com"}}
+	s, samlRepo := newTestSAMLService(t, env, conn)
+	env.users.add(domain.User{Email: "jane@acme.com", Verified: true})
+
+	response, err := idp.Response(samltest.Response{
+		SPEntityID:   "https://sp.example.com/api/auth/saml/acme/metadata",
+		ACSURL:       "https://sp.example.com/api/auth/saml/acme/acs",
+		InResponseTo: "id-request",
+		NameID:       "00u1",
+		NameIDFormat: samlPersistentNameID,
+		Attributes:   map[string]string{"email": "jane@acme.com"},
+	})
+	if err != nil {
+		t.Fatalf("Response: %v", err)
+	}
+	state := &SAMLState{Connection: "acme", RequestID: "id-request"}
+
+	if _, _, user, err := s.Complete(context.Background(), state, "acme", response); err != nil {
+		t.Fatalf("Complete: %v", err)
+	} else if user.Email != "jane@acme.com" {
+		t.Errorf("user = %q, want jane@acme.com", user.Email)
+	}
+	if len(samlRepo.assertions) != 1 {
+		t.Fatalf("recorded %d assertions, want 1", len(samlRepo.assertions))
+	}
+	sessions := len(env.tokens.tokens)
+
+	_, _, _, err = s.Complete(context.Background(), state, "acme", response)
+	if !errors.Is(err, ErrSAMLAssertionReplayed) {
+		t.Fatalf("Complete with a replayed response error = %v, want ErrSAMLAssertionReplayed", err)
+	}
+	if len(env.tokens.tokens) != sessions {
+		t.Error("replayed response started a session")
+	}
+}
+
+func TestSAMLCompleteRejectsResponseForAnotherRequest(t *testing.T) {
+	idp, err := samltest.NewIdP("https://idp.acme.com/metadata")
+	if err != nil {
+		t.Fatalf("NewIdP: %v", err)
+	}
+	metadata, err := idp.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata: %v", err)
+	}
+
+	env := newTestEnv(t)
+	conn := &domain.SAMLConnection{ID: 1, Slug: "acme", IdPMetadata: string(metadata), Domains: []string{"acme.com"}}
+	s, samlRepo := newTestSAMLService(t, env, conn)
+
+	response, err := idp.Response(samltest.Response{
+		SPEntityID:   "https://sp.example.com/api/auth/saml/acme/metadata",
+		ACSURL:       "https://sp.example.com/api/auth/saml/acme/acs",
+		InResponseTo: "id-other-browser",
+		NameID:       "00u1",
+		Attributes:   map[string]string{"email": "jane@acme.com"},
+	})
+	if err != nil {
+		t.Fatalf("Response: %v", err)
+	}
+
+	_, _, _, err = s.Complete(context.Background(), &SAMLState{Connection: "acme", RequestID: "id-request"}, "acme", response)
+	if !errors.Is(err, ErrInvalidSAMLResponse) {
+		t.Fatalf("Complete error = %v, want ErrInvalidSAMLResponse", err)
+	}
+	if len(samlRepo.assertions) != 0 {
+		t.Error("assertion of a rejected response was recorded")
+	}
+}
@@ -0,0 +1,802 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+	"github.com/login_flow/auth-service/pkg/scim"
+	"github.com/login_flow/auth-service/pkg/validator"
+)
+
+var (
+	ErrSCIMTokenNotFound  = errors.New("scim token not found")
+	ErrSCIMRoleNotAllowed = errors.New("role can't be managed through scim")
+	ErrSCIMUserNotFound   = errors.New("scim user not found")
+	ErrSCIMGroupNotFound  = errors.New("scim group not found")
+	ErrSCIMUserNameTaken  = errors.New("userName already in use")
+)
+
+// SCIMService provisions users from the identity provider of an organization (SCIM 2.0).
+// A token only sees the users its organization provisioned, and the groups are the
+// roles the token was given. Users are never taken over: an email that already has an
+// account can't be provisioned.
+type SCIMService struct {
+	authService *AuthService
+	scimRepo    domain.SCIMRepository
+	userRepo    domain.UserRepository
+	tokenRepo   domain.TokenRepository
+	patRepo     domain.PersonalAccessTokenRepository
+	roleRepo    domain.RoleRepository
+	orgRepo     domain.OrganizationRepository
+	audit       domain.AuditEmitter
+	events      domain.EventPublisher
+	cfg         *config.Config
+}
+
+func NewSCIMService(authService *AuthService, scimRepo domain.SCIMRepository, userRepo domain.UserRepository, tokenRepo domain.TokenRepository, patRepo domain.PersonalAccessTokenRepository, roleRepo domain.RoleRepository, orgRepo domain.OrganizationRepository, audit domain.AuditEmitter, events domain.EventPublisher, cfg *config.Config) *SCIMService {
+	return &SCIMService{
+		authService: authService,
+		scimRepo:    scimRepo,
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		patRepo:     patRepo,
+		roleRepo:    roleRepo,
+		orgRepo:     orgRepo,
+		audit:       audit,
+		events:      events,
+		cfg:         cfg,
+	}
+}
+
+// CreateToken issues a token for an organization's identity provider. The token is
+// returned here only, it is stored hashed. Users can only be provisioned with emails
+// in domains, and roles are exposed as groups; admin can't be one of them.
+func (s *SCIMService) CreateToken(ctx context.Context, orgID int64, description string, domains, roles []string) (*domain.SCIMToken, string, error) {
+	if _, err := s.orgRepo.GetByID(ctx, orgID); err != nil {
+		return nil, "", ErrOrganizationNotFound
+	}
+	for _, role := range roles {
+		// Whoever controls the identity provider would control this service
+		if role == domain.RoleAdmin {
+			return nil, "", fmt.Errorf("%w: %s", ErrSCIMRoleNotAllowed, role)
+		}
+		if _, err := s.roleRepo.GetByName(ctx, role); err != nil {
+			return nil, "", fmt.Errorf("%w: %s", ErrRoleNotFound, role)
+		}
+	}
+
+	random, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate scim token: %w", err)
+	}
+	token := domain.SCIMTokenPrefix + strings.TrimRight(random, "=")
+
+	scimToken := &domain.SCIMToken{
+		OrgID:       orgID,
+		Description: description,
+		TokenHash:   crypto.HashToken(token),
+		Hint:        token[len(token)-4:],
+		Domains:     normalizeDomains(domains),
+		Roles:       slices.Compact(slices.Sorted(slices.Values(roles))),
+	}
+	if err := s.scimRepo.CreateToken(ctx, scimToken); err != nil {
+		return nil, "", err
+	}
+
+	s.recordAdminAction(ctx, "create_scim_token", scimToken)
+	return scimToken, token, nil
+}
+
+func (s *SCIMService) ListTokens(ctx context.Context) ([]*domain.SCIMToken, error) {
+	return s.scimRepo.ListTokens(ctx)
+}
+
+// DeleteToken revokes a token. The users it provisioned are left as they are.
+func (s *SCIMService) DeleteToken(ctx context.Context, id int64) error {
+	if err := s.scimRepo.DeleteToken(ctx, id); err != nil {
+		if errors.Is(err, domain.ErrSCIMTokenNotFound) {
+			return ErrSCIMTokenNotFound
+		}
+		return err
+	}
+
+	s.recordAdminAction(ctx, "delete_scim_token", &domain.SCIMToken{ID: id})
+	return nil
+}
+
+// Authenticate checks a token from an Authorization header
+func (s *SCIMService) Authenticate(ctx context.Context, token string) (*domain.SCIMToken, error) {
+	if !strings.HasPrefix(token, domain.SCIMTokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	scimToken, err := s.scimRepo.GetTokenByHash(ctx, crypto.HashToken(token))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if scimToken.LastUsedAt == nil || time.Since(*scimToken.LastUsedAt) > lastUsedResolution {
+		if err := s.scimRepo.UpdateTokenLastUsed(ctx, scimToken.ID); err != nil {
+			log.Printf("failed to record scim token use: %v", err)
+		}
+	}
+	return scimToken, nil
+}
+
+// ListUsers returns a page of the organization's users matching the filter.
+// startIndex is 1-based, count 0 only returns the total.
+func (s *SCIMService) ListUsers(ctx context.Context, token *domain.SCIMToken, filter string, startIndex, count int) (*scim.ListResponse, error) {
+	userFilter, err := parseUserFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.scimRepo.CountUsers(ctx, token.OrgID, userFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []*scim.User{}
+	if count > 0 {
+		userFilter.Offset = startIndex - 1
+		userFilter.Limit = count
+		scimUsers, err := s.scimRepo.ListUsers(ctx, token.OrgID, userFilter)
+		if err != nil {
+			return nil, err
+		}
+		groups, err := s.groups(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, scimUser := range scimUsers {
+			resource, err := s.toSCIMUser(ctx, scimUser, groups)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, resource)
+		}
+	}
+
+	return scim.NewListResponse(resources, total, startIndex), nil
+}
+
+func (s *SCIMService) GetUser(ctx context.Context, token *domain.SCIMToken, id string) (*scim.User, error) {
+	scimUser, err := s.scimUser(ctx, token, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.userResource(ctx, token, scimUser)
+}
+
+// CreateUser provisions a new account in the organization. It is active unless the
+// request says otherwise, regardless of REGISTRATION_MODE since an admin issued the token.
+func (s *SCIMService) CreateUser(ctx context.Context, token *domain.SCIMToken, resource *scim.User) (*scim.User, error) {
+	email, err := s.resourceEmail(token, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	// Existing accounts belong to someone, the identity provider can't take them over
+	if _, err := s.userRepo.GetByEmail(ctx, email); err == nil {
+		return nil, ErrUserAlreadyExists
+	}
+	taken, err := s.scimRepo.CountUsers(ctx, token.OrgID, &domain.SCIMUserFilter{UserName: resource.UserName})
+	if err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		return nil, ErrSCIMUserNameTaken
+	}
+
+	// Without a password from the identity provider the account gets an unusable
+	// random one; users sign in with SSO, or set one with a password reset
+	password := resource.Password
+	if password == "" {
+		if password, err = crypto.GenerateRandomToken(32); err != nil {
+			return nil, fmt.Errorf("failed to generate password: %w", err)
+		}
+	} else if !validator.ValidatePassword(password) {
+		return nil, scim.Errorf(scim.InvalidValue, "password must be at least 8 characters and contain uppercase, lowercase, and number")
+	}
+	hashedPassword, err := crypto.HashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	status := domain.UserStatusActive
+	if !resource.IsActive() {
+		status = domain.UserStatusDeprovisioned
+	}
+	user := &domain.User{
+		Email:       email,
+		Password:    hashedPassword,
+		Status:      status,
+		DisplayName: strings.TrimSpace(resource.FormattedName()),
+	}
+	if locale, ok := scimLocale(resource.Locale); ok {
+		user.Locale = locale
+	}
+	if validator.ValidateTimezone(resource.Timezone) {
+		user.Timezone = resource.Timezone
+	}
+	if user, err = s.authService.createUser(ctx, user, "scim"); err != nil {
+		return nil, err
+	}
+
+	scimUser := &domain.SCIMUser{
+		UserID:     user.ID,
+		OrgID:      token.OrgID,
+		UserName:   resource.UserName,
+		ExternalID: resource.ExternalID,
+		User:       user,
+	}
+	if err := s.scimRepo.CreateUser(ctx, scimUser); err != nil {
+		// Don't leave an account behind that no one manages
+		if err := s.userRepo.Delete(ctx, user.ID); err != nil {
+			log.Printf("failed to delete user %d after failed scim provisioning: %v", user.ID, err)
+		}
+		if errors.Is(err, domain.ErrSCIMUserNameTaken) {
+			return nil, ErrSCIMUserNameTaken
+		}
+		return nil, err
+	}
+	if err := s.orgRepo.AddMember(ctx, &domain.Membership{OrgID: token.OrgID, UserID: user.ID, Role: domain.OrgRoleMember}); err != nil {
+		return nil, fmt.Errorf("failed to add provisioned user to organization: %w", err)
+	}
+
+	s.recordAction(ctx, token, "create_user", user.ID, map[string]interface{}{"email": email, "user_name": resource.UserName})
+	return s.userResource(ctx, token, scimUser)
+}
+
+// ReplaceUser sets all attributes of a user (PUT). Omitted optional attributes are cleared.
+func (s *SCIMService) ReplaceUser(ctx context.Context, token *domain.SCIMToken, id string, resource *scim.User) (*scim.User, error) {
+	scimUser, err := s.scimUser(ctx, token, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.updateUser(ctx, token, scimUser, resource); err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, token, id)
+}
+
+// PatchUser applies PATCH operations to a user
+func (s *SCIMService) PatchUser(ctx context.Context, token *domain.SCIMToken, id string, ops []scim.PatchOperation) (*scim.User, error) {
+	scimUser, err := s.scimUser(ctx, token, id)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := s.userResource(ctx, token, scimUser)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName, name := resource.DisplayName, *resource.Name
+	if err := resource.ApplyPatch(ops); err != nil {
+		return nil, err
+	}
+	// We only store a display name; when just the name changed it follows the name
+	if resource.DisplayName == displayName && (resource.Name == nil || *resource.Name != name) {
+		resource.DisplayName = ""
+	}
+
+	if err := s.updateUser(ctx, token, scimUser, resource); err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, token, id)
+}
+
+// DeleteUser deletes the account of a provisioned user
+func (s *SCIMService) DeleteUser(ctx context.Context, token *domain.SCIMToken, id string) error {
+	scimUser, err := s.scimUser(ctx, token, id)
+	if err != nil {
+		return err
+	}
+	user := scimUser.User
+
+	if err := s.userRepo.Delete(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, token, "delete_user", user.ID, map[string]interface{}{"email": user.Email})
+	s.events.Publish(ctx, domain.EventUserDeleted, map[string]interface{}{"user_id": user.ID, "email": user.Email})
+	return nil
+}
+
+// updateUser saves the attributes of resource. An email change revokes the user's sessions,
+// a new password or deactivation also their personal access tokens.
+func (s *SCIMService) updateUser(ctx context.Context, token *domain.SCIMToken, scimUser *domain.SCIMUser, resource *scim.User) error {
+	user := scimUser.User
+	email, err := s.resourceEmail(token, resource)
+	if err != nil {
+		return err
+	}
+	if resource.Password != "" && !validator.ValidatePassword(resource.Password) {
+		return scim.Errorf(scim.InvalidValue, "password must be at least 8 characters and contain uppercase, lowercase, and number")
+	}
+
+	if resource.UserName != scimUser.UserName || resource.ExternalID != scimUser.ExternalID {
+		if err := s.scimRepo.UpdateUser(ctx, user.ID, resource.UserName, resource.ExternalID); err != nil {
+			if errors.Is(err, domain.ErrSCIMUserNameTaken) {
+				return ErrSCIMUserNameTaken
+			}
+			return err
+		}
+	}
+
+	if email != user.Email {
+		if err := s.userRepo.UpdateEmail(ctx, user.ID, email); err != nil {
+			if errors.Is(err, domain.ErrEmailTaken) {
+				return ErrUserAlreadyExists
+			}
+			return err
+		}
+		// Like a confirmed email change: sessions of the old address end, UpdateEmail
+		// already invalidated the access tokens carrying it
+		if err := s.tokenRepo.RevokeAllForUser(ctx, user.ID); err != nil {
+			return err
+		}
+		s.recordAction(ctx, token, "change_email", user.ID, map[string]interface{}{"old_email": user.Email, "new_email": email})
+		s.events.Publish(ctx, domain.EventUserEmailChanged, map[string]interface{}{
+			"user_id":   user.ID,
+			"old_email": user.Email,
+			"email":     email,
+		})
+	}
+
+	displayName := strings.TrimSpace(resource.FormattedName())
+	profile := &domain.ProfileUpdate{DisplayName: &displayName}
+	if locale, ok := scimLocale(resource.Locale); ok {
+		profile.Locale = &locale
+	}
+	if resource.Timezone == "" || validator.ValidateTimezone(resource.Timezone) {
+		profile.Timezone = &resource.Timezone
+	}
+	if err := s.userRepo.UpdateProfile(ctx, user.ID, profile); err != nil {
+		return err
+	}
+
+	if resource.Password != "" {
+		hashedPassword, err := crypto.HashPassword(resource.Password)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+		if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+			return err
+		}
+		// Whoever knew the old password may still hold a session or a personal access token
+		if err := s.tokenRepo.RevokeAllForUser(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := s.patRepo.RevokeAllForUser(ctx, user.ID); err != nil {
+			return err
+		}
+		s.recordAction(ctx, token, "set_password", user.ID, nil)
+	}
+
+	// The identity provider only undoes its own deactivation, accounts an admin disabled
+	// stay disabled
+	switch active := resource.IsActive(); {
+	case active && user.Status == domain.UserStatusDeprovisioned:
+		if err := s.userRepo.UpdateStatus(ctx, user.ID, domain.UserStatusActive); err != nil {
+			return err
+		}
+		s.recordAction(ctx, token, "activate_user", user.ID, nil)
+	case !active && user.IsActive():
+		if err := s.deactivate(ctx, user.ID); err != nil {
+			return err
+		}
+		s.recordAction(ctx, token, "deactivate_user", user.ID, nil)
+	}
+	return nil
+}
+
+func (s *SCIMService) deactivate(ctx context.Context, userID int64) error {
+	if err := s.userRepo.UpdateStatus(ctx, userID, domain.UserStatusDeprovisioned); err != nil {
+		return err
+	}
+	if err := s.tokenRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.patRepo.RevokeAllForUser(ctx, userID)
+}
+
+// resourceEmail returns the account email of a user resource: its primary email, or the
+// userName when it has none. It must be in one of the token's domains.
+func (s *SCIMService) resourceEmail(token *domain.SCIMToken, resource *scim.User) (string, error) {
+	if strings.TrimSpace(resource.UserName) == "" {
+		return "", scim.Errorf(scim.InvalidValue, "userName is required")
+	}
+
+	email := resource.PrimaryEmail()
+	if email == "" {
+		email = resource.UserName
+	}
+	email = strings.TrimSpace(email)
+	if err := validator.ValidateEmail(email); err != nil {
+		return "", scim.Errorf(scim.InvalidValue, "%q is not a valid email, set emails or an email userName", email)
+	}
+	if !slices.Contains(token.Domains, strings.ToLower(emailDomain(email))) {
+		return "", scim.Errorf(scim.InvalidValue, "the email domain of %q is not allowed for this organization", email)
+	}
+	return email, nil
+}
+
+// ListGroups returns a page of the token's roles matching the filter
+func (s *SCIMService) ListGroups(ctx context.Context, token *domain.SCIMToken, filter string, startIndex, count int, withMembers bool) (*scim.ListResponse, error) {
+	roles, err := s.groups(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if filter != "" {
+		if roles, err = filterGroups(roles, filter); err != nil {
+			return nil, err
+		}
+	}
+
+	total := int64(len(roles))
+	// Both come from the query, startIndex-1+count can overflow
+	lo := min(startIndex-1, len(roles))
+	page := roles[lo : lo+min(count, len(roles)-lo)]
+	resources := make([]*scim.Group, 0, len(page))
+	for _, role := range page {
+		resource, err := s.toSCIMGroup(ctx, token, role, withMembers)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	return scim.NewListResponse(resources, total, startIndex), nil
+}
+
+func (s *SCIMService) GetGroup(ctx context.Context, token *domain.SCIMToken, id string, withMembers bool) (*scim.Group, error) {
+	role, err := s.group(ctx, token, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toSCIMGroup(ctx, token, role, withMembers)
+}
+
+// CreateGroup can't create roles: it claims the role named by displayName, which must be
+// one of the token's roles, and sets its members
+func (s *SCIMService) CreateGroup(ctx context.Context, token *domain.SCIMToken, resource *scim.Group) (*scim.Group, error) {
+	roles, err := s.groups(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(roles, func(role *domain.Role) bool { return strings.EqualFold(role.Name, resource.DisplayName) })
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSCIMRoleNotAllowed, resource.DisplayName)
+	}
+
+	if err := s.setMembers(ctx, token, roles[i], resource.Members); err != nil {
+		return nil, err
+	}
+	return s.toSCIMGroup(ctx, token, roles[i], true)
+}
+
+// ReplaceGroup sets the members of a group (PUT)
+func (s *SCIMService) ReplaceGroup(ctx context.Context, token *domain.SCIMToken, id string, resource *scim.Group) (*scim.Group, error) {
+	role, err := s.group(ctx, token, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.updateGroup(ctx, token, role, resource); err != nil {
+		return nil, err
+	}
+	return s.toSCIMGroup(ctx, token, role, true)
+}
+
+// PatchGroup applies PATCH operations to a group, typically adding or removing members
+func (s *SCIMService) PatchGroup(ctx context.Context, token *domain.SCIMToken, id string, ops []scim.PatchOperation) (*scim.Group, error) {
+	role, err := s.group(ctx, token, id)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := s.toSCIMGroup(ctx, token, role, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := resource.ApplyPatch(ops); err != nil {
+		return nil, err
+	}
+	if err := s.updateGroup(ctx, token, role, resource); err != nil {
+		return nil, err
+	}
+	return s.toSCIMGroup(ctx, token, role, true)
+}
+
+// DeleteGroup removes the role from all of the organization's provisioned users; the
+// role itself stays
+func (s *SCIMService) DeleteGroup(ctx context.Context, token *domain.SCIMToken, id string) error {
+	role, err := s.group(ctx, token, id)
+	if err != nil {
+		return err
+	}
+	return s.setMembers(ctx, token, role, nil)
+}
+
+func (s *SCIMService) updateGroup(ctx context.Context, token *domain.SCIMToken, role *domain.Role, resource *scim.Group) error {
+	if resource.DisplayName != "" && !strings.EqualFold(resource.DisplayName, role.Name) {
+		return scim.Errorf(scim.Mutability, "groups are roles and can't be renamed")
+	}
+	return s.setMembers(ctx, token, role, resource.Members)
+}
+
+// setMembers gives the role to exactly the listed users, who must be provisioned users
+// of the organization. Other users with the role aren't affected.
+func (s *SCIMService) setMembers(ctx context.Context, token *domain.SCIMToken, role *domain.Role, members []scim.Member) error {
+	var desired []int64
+	for _, member := range members {
+		userID, err := strconv.ParseInt(member.Value, 10, 64)
+		if err == nil {
+			_, err = s.scimRepo.GetUser(ctx, token.OrgID, userID)
+		}
+		if err != nil {
+			return scim.Errorf(scim.InvalidValue, "member %q is not a user of this organization", member.Value)
+		}
+		if !slices.Contains(desired, userID) {
+			desired = append(desired, userID)
+		}
+	}
+
+	current, err := s.scimRepo.ListUsers(ctx, token.OrgID, &domain.SCIMUserFilter{Role: role.Name})
+	if err != nil {
+		return err
+	}
+	currentIDs := make([]int64, 0, len(current))
+	for _, scimUser := range current {
+		currentIDs = append(currentIDs, scimUser.UserID)
+	}
+
+	added, removed := []int64{}, []int64{}
+	for _, userID := range desired {
+		if slices.Contains(currentIDs, userID) {
+			continue
+		}
+		if err := s.roleRepo.AssignToUser(ctx, userID, role.Name); err != nil {
+			return err
+		}
+		added = append(added, userID)
+	}
+	for _, userID := range currentIDs {
+		if slices.Contains(desired, userID) {
+			continue
+		}
+		if err := s.roleRepo.RemoveFromUser(ctx, userID, role.Name); err != nil {
+			return err
+		}
+		removed = append(removed, userID)
+	}
+
+	if len(added) > 0 || len(removed) > 0 {
+		s.recordAction(ctx, token, "update_group", 0, map[string]interface{}{"role": role.Name, "added": added, "removed": removed})
+	}
+	return nil
+}
+
+// groups returns the roles the token exposes as groups
+func (s *SCIMService) groups(ctx context.Context, token *domain.SCIMToken) ([]*domain.Role, error) {
+	roles, err := s.roleRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(roles, func(role *domain.Role) bool {
+		return !slices.Contains(token.Roles, role.Name)
+	}), nil
+}
+
+func (s *SCIMService) group(ctx context.Context, token *domain.SCIMToken, id string) (*domain.Role, error) {
+	roles, err := s.groups(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(roles, func(role *domain.Role) bool { return strconv.FormatInt(role.ID, 10) == id })
+	if i < 0 {
+		return nil, ErrSCIMGroupNotFound
+	}
+	return roles[i], nil
+}
+
+// scimUser returns a user the token's organization provisioned
+func (s *SCIMService) scimUser(ctx context.Context, token *domain.SCIMToken, id string) (*domain.SCIMUser, error) {
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrSCIMUserNotFound
+	}
+	scimUser, err := s.scimRepo.GetUser(ctx, token.OrgID, userID)
+	if err != nil || scimUser.User == nil {
+		return nil, ErrSCIMUserNotFound
+	}
+	return scimUser, nil
+}
+
+func (s *SCIMService) userResource(ctx context.Context, token *domain.SCIMToken, scimUser *domain.SCIMUser) (*scim.User, error) {
+	groups, err := s.groups(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.toSCIMUser(ctx, scimUser, groups)
+}
+
+// toSCIMUser builds the resource of a user, with the roles among groups as its groups
+func (s *SCIMService) toSCIMUser(ctx context.Context, scimUser *domain.SCIMUser, groups []*domain.Role) (*scim.User, error) {
+	user := scimUser.User
+	roles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	id := strconv.FormatInt(user.ID, 10)
+	active := user.IsActive()
+	resource := &scim.User{
+		Schemas:     []string{scim.SchemaUser},
+		ID:          id,
+		ExternalID:  scimUser.ExternalID,
+		UserName:    scimUser.UserName,
+		Name:        &scim.Name{Formatted: user.DisplayName},
+		DisplayName: user.DisplayName,
+		Emails:      []scim.Email{{Value: user.Email, Type: "work", Primary: true}},
+		Locale:      user.Locale,
+		Timezone:    user.Timezone,
+		Active:      &active,
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      &user.CreatedAt,
+			LastModified: &user.UpdatedAt,
+			Location:     s.location("Users", id),
+		},
+	}
+	for _, group := range groups {
+		if slices.Contains(roles, group.Name) {
+			groupID := strconv.FormatInt(group.ID, 10)
+			resource.Groups = append(resource.Groups, scim.Member{Value: groupID, Ref: s.location("Groups", groupID), Display: group.Name})
+		}
+	}
+	return resource, nil
+}
+
+func (s *SCIMService) toSCIMGroup(ctx context.Context, token *domain.SCIMToken, role *domain.Role, withMembers bool) (*scim.Group, error) {
+	id := strconv.FormatInt(role.ID, 10)
+	resource := &scim.Group{
+		Schemas:     []string{scim.SchemaGroup},
+		ID:          id,
+		DisplayName: role.Name,
+		Members:     []scim.Member{},
+		Meta: &scim.Meta{
+			ResourceType: "Group",
+			Created:      &role.CreatedAt,
+			Location:     s.location("Groups", id),
+		},
+	}
+	if !withMembers {
+		return resource, nil
+	}
+
+	members, err := s.scimRepo.ListUsers(ctx, token.OrgID, &domain.SCIMUserFilter{Role: role.Name})
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		userID := strconv.FormatInt(member.UserID, 10)
+		resource.Members = append(resource.Members, scim.Member{Value: userID, Ref: s.location("Users", userID), Display: member.UserName})
+	}
+	return resource, nil
+}
+
+func (s *SCIMService) location(resourceType, id string) string {
+	return fmt.Sprintf("%s/scim/v2/%s/%s", s.cfg.SCIM.BaseURL, resourceType, id)
+}
+
+// recordAction audits a change made by an organization's identity provider. userID 0
+// means the action didn't affect a single user.
+func (s *SCIMService) recordAction(ctx context.Context, token *domain.SCIMToken, action string, userID int64, metadata map[string]interface{}) {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata["org_id"] = token.OrgID
+	metadata["scim_token_id"] = token.ID
+
+	event := &domain.AuditEvent{
+		Type:     domain.AuditSCIMAction,
+		Outcome:  domain.AuditSuccess,
+		Reason:   action,
+		Metadata: metadata,
+	}
+	if userID != 0 {
+		event.SubjectID = &userID
+	}
+	s.audit.Emit(ctx, event)
+}
+
+// recordAdminAction audits an admin managing SCIM tokens, the admin is taken from ctx
+func (s *SCIMService) recordAdminAction(ctx context.Context, action string, token *domain.SCIMToken) {
+	metadata := map[string]interface{}{"action": action, "scim_token_id": token.ID}
+	if token.OrgID != 0 {
+		metadata["org_id"] = token.OrgID
+	}
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:     domain.AuditAdminAction,
+		Outcome:  domain.AuditSuccess,
+		Metadata: metadata,
+	})
+}
+
+// parseUserFilter turns a SCIM filter into a repository filter. Only eq comparisons
+// of userName, externalId, emails and active are supported, joined with "and".
+func parseUserFilter(filter string) (*domain.SCIMUserFilter, error) {
+	userFilter := &domain.SCIMUserFilter{}
+	if filter == "" {
+		return userFilter, nil
+	}
+
+	comparisons, err := scim.ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, comparison := range comparisons {
+		if comparison.Operator != "eq" {
+			return nil, scim.Errorf(scim.InvalidFilter, "only eq comparisons are supported")
+		}
+		value, isString := comparison.Value.(string)
+		switch comparison.Attribute {
+		case "username":
+			userFilter.UserName = value
+		case "externalid":
+			userFilter.ExternalID = value
+		case "emails", "emails.value":
+			userFilter.Email = value
+		case "active":
+			active, isBool := comparison.Value.(bool)
+			if !isBool {
+				return nil, scim.Errorf(scim.InvalidFilter, "active must be compared with true or false")
+			}
+			userFilter.Active = &active
+			continue
+		default:
+			return nil, scim.Errorf(scim.InvalidFilter, "filtering users by %s is not supported", comparison.Attribute)
+		}
+		if !isString || value == "" {
+			return nil, scim.Errorf(scim.InvalidFilter, "%s must be compared with a string", comparison.Attribute)
+		}
+	}
+	return userFilter, nil
+}
+
+// filterGroups applies a filter of displayName eq comparisons to the roles
+func filterGroups(roles []*domain.Role, filter string) ([]*domain.Role, error) {
+	comparisons, err := scim.ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, comparison := range comparisons {
+		value, isString := comparison.Value.(string)
+		if comparison.Attribute != "displayname" || comparison.Operator != "eq" || !isString {
+			return nil, scim.Errorf(scim.InvalidFilter, `only displayName eq "..." filters are supported for groups`)
+		}
+		roles = slices.DeleteFunc(roles, func(role *domain.Role) bool { return !strings.EqualFold(role.Name, value) })
+	}
+	return roles, nil
+}
+
+// scimLocale accepts BCP 47 tags, also with underscores like "en_US" as some identity
+// providers send. Invalid locales are ignored rather than failing the provisioning.
+func scimLocale(locale string) (string, bool) {
+	if locale == "" {
+		return "", true
+	}
+	locale = strings.ReplaceAll(locale, "_", "-")
+	return locale, validator.ValidateLocale(locale)
+}
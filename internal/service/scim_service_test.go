@@ -0,0 +1,417 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/scim"
+)
+
+// scimTestEnv is a SCIMService on the in-memory repositories of a testEnv, with a token
+// of organization 1 for example.com that exposes the editor and viewer roles as groups
+type scimTestEnv struct {
+	*testEnv
+	scimRepo *fakeSCIMRepo
+	scim     *SCIMService
+	token    *domain.SCIMToken
+}
+
+func newTestSCIMService(t *testing.T) *scimTestEnv {
+	t.Helper()
+	env := newTestEnv(t)
+	env.cfg.SCIM.BaseURL = "https://auth.example.com"
+	env.roles.defined = []*domain.Role{
+		{ID: 1, Name: domain.RoleUser},
+		{ID: 2, Name: domain.RoleAdmin},
+		{ID: 3, Name: "editor"},
+		{ID: 4, Name: "viewer"},
+	}
+	o := &scimTestEnv{
+		testEnv:  env,
+		scimRepo: &fakeSCIMRepo{users: env.users, roles: env.roles},
+		token:    &domain.SCIMToken{ID: 1, OrgID: 1, Domains: []string{"example.com"}, Roles: []string{"editor", "viewer"}},
+	}
+	o.scim = NewSCIMService(env.auth, o.scimRepo, env.users, env.tokens, env.pats, env.roles, env.orgs, env.audit, fakeEvents{}, env.cfg)
+	return o
+}
+
+func TestSCIMListGroupsPaging(t *testing.T) {
+	tests := []struct {
+		name       string
+		startIndex int
+		count      int
+		want       []string
+	}{
+		{name: "everything", startIndex: 1, count: 100, want: []string{"editor", "viewer"}},
+		{name: "first page", startIndex: 1, count: 1, want: []string{"editor"}},
+		{name: "second page", startIndex: 2, count: 1, want: []string{"viewer"}},
+		{name: "only the total", startIndex: 1, count: 0, want: []string{}},
+		{name: "past the end", startIndex: 3, count: 100, want: []string{}},
+		{name: "huge startIndex", startIndex: math.MaxInt, count: 100, want: []string{}},
+		{name: "huge count", startIndex: 2, count: math.MaxInt, want: []string{"viewer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestSCIMService(t)
+			list, err := o.scim.ListGroups(context.Background(), o.token, "", tt.startIndex, tt.count, false)
+			if err != nil {
+				t.Fatalf("ListGroups: %v", err)
+			}
+			got := []string{}
+			for _, group := range list.Resources.([]*scim.Group) {
+				got = append(got, group.DisplayName)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("groups = %v, want %v", got, tt.want)
+			}
+			if list.TotalResults != 2 || list.StartIndex != tt.startIndex {
+				t.Errorf("totalResults = %d, startIndex = %d; want 2, %d", list.TotalResults, list.StartIndex, tt.startIndex)
+			}
+		})
+	}
+}
+
+// provision creates a user through SCIM with a session and a personal access token
+func (o *scimTestEnv) provision(t *testing.T, userName string) (*scim.User, string) {
+	t.Helper()
+	ctx := context.Background()
+	resource, err := o.scim.CreateUser(ctx, o.token, &scim.User{UserName: userName, Name: &scim.Name{Formatted: "Jane Doe"}})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	userID, _ := strconv.ParseInt(resource.ID, 10, 64)
+	user, _ := o.users.GetByID(ctx, userID)
+	accessToken, _, err := o.auth.StartSession(ctx, user, "password")
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	o.pats.tokens = append(o.pats.tokens, &domain.PersonalAccessToken{ID: int64(len(o.pats.tokens) + 1), UserID: userID, ExpiresAt: time.Now().Add(time.Hour)})
+	return resource, accessToken
+}
+
+// revoked reports whether every session and personal access token of the user is revoked
+func (o *scimTestEnv) revoked(userID string) (sessions, pats bool) {
+	sessions, pats = true, true
+	for _, token := range o.tokens.tokens {
+		if strconv.FormatInt(token.UserID, 10) == userID && token.RevokedAt == nil {
+			sessions = false
+		}
+	}
+	for _, token := range o.pats.tokens {
+		if strconv.FormatInt(token.UserID, 10) == userID && token.RevokedAt == nil {
+			pats = false
+		}
+	}
+	return sessions, pats
+}
+
+func TestSCIMReplaceUserRevokesCredentials(t *testing.T) {
+	tests := []struct {
+		name          string
+		change        func(resource *scim.User)
+		wantSessions  bool // Sessions revoked
+		wantPATs      bool // Personal access tokens revoked
+		wantOldAccess bool // The access token issued before still works
+	}{
+		{
+			name:          "display name",
+			change:        func(resource *scim.User) { resource.Name = &scim.Name{Formatted: "Jane Smith"} },
+			wantOldAccess: true,
+		},
+		{
+			name: "email",
+			change: func(resource *scim.User) {
+				resource.Emails = []scim.Email{{Value: "jane.smith@example.com", Primary: true}}
+			},
+			wantSessions: true,
+		},
+		{
+			name:          "password",
+			change:        func(resource *scim.User) { resource.Password = "N3w-password" },
+			wantSessions:  true,
+			wantPATs:      true,
+			wantOldAccess: true,
+		},
+		{
+			// Short-lived access tokens of disabled users run out on their own
+			name:          "deactivated",
+			change:        func(resource *scim.User) { resource.Active = new(bool) },
+			wantSessions:  true,
+			wantPATs:      true,
+			wantOldAccess: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			o := newTestSCIMService(t)
+			resource, accessToken := o.provision(t, "jane@example.com")
+
+			replacement := &scim.User{UserName: resource.UserName, Name: resource.Name, Emails: resource.Emails}
+			tt.change(replacement)
+			if _, err := o.scim.ReplaceUser(ctx, o.token, resource.ID, replacement); err != nil {
+				t.Fatalf("ReplaceUser: %v", err)
+			}
+
+			sessions, pats := o.revoked(resource.ID)
+			if sessions != tt.wantSessions || pats != tt.wantPATs {
+				t.Errorf("sessions revoked = %v, tokens revoked = %v; want %v, %v", sessions, pats, tt.wantSessions, tt.wantPATs)
+			}
+			if _, err := o.auth.ValidateAccessToken(ctx, accessToken); (err == nil) != tt.wantOldAccess {
+				t.Errorf("ValidateAccessToken of the old access token error = %v, want valid %v", err, tt.wantOldAccess)
+			}
+		})
+	}
+}
+
+func TestSCIMActivationOnlyUndoesItsOwnDeactivation(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string // Set before the identity provider sends active: true
+		wantStatus string
+	}{
+		{name: "deactivated through SCIM", status: domain.UserStatusDeprovisioned, wantStatus: domain.UserStatusActive},
+		{name: "disabled by an admin", status: domain.UserStatusDisabled, wantStatus: domain.UserStatusDisabled},
+		{name: "waiting for approval", status: domain.UserStatusPendingApproval, wantStatus: domain.UserStatusPendingApproval},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			o := newTestSCIMService(t)
+			resource, _ := o.provision(t, "jane@example.com")
+			userID, _ := strconv.ParseInt(resource.ID, 10, 64)
+			o.users.users[userID].Status = tt.status
+
+			active := true
+			replacement := &scim.User{UserName: resource.UserName, Name: resource.Name, Emails: resource.Emails, Active: &active}
+			if _, err := o.scim.ReplaceUser(ctx, o.token, resource.ID, replacement); err != nil {
+				t.Fatalf("ReplaceUser: %v", err)
+			}
+			if status := o.users.users[userID].Status; status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSCIMDeactivationKeepsAdminDisable(t *testing.T) {
+	ctx := context.Background()
+	o := newTestSCIMService(t)
+	resource, _ := o.provision(t, "jane@example.com")
+	userID, _ := strconv.ParseInt(resource.ID, 10, 64)
+	o.users.users[userID].Status = domain.UserStatusDisabled
+
+	// Deactivating an account an admin disabled must not hand it to the identity provider
+	inactive, active := false, true
+	for _, flag := range []*bool{&inactive, &active} {
+		replacement := &scim.User{UserName: resource.UserName, Name: resource.Name, Emails: resource.Emails, Active: flag}
+		if _, err := o.scim.ReplaceUser(ctx, o.token, resource.ID, replacement); err != nil {
+			t.Fatalf("ReplaceUser: %v", err)
+		}
+	}
+	if status := o.users.users[userID].Status; status != domain.UserStatusDisabled {
+		t.Errorf("status = %q, want disabled", status)
+	}
+}
+
+func TestSCIMListUsers(t *testing.T) {
+	tests := []struct {
+		name       string
+		filter     string
+		startIndex int
+		count      int
+		want       []string
+		wantTotal  int64
+	}{
+		{name: "everything", startIndex: 1, count: 100, want: []string{"ann@example.com", "bob@example.com", "cat@example.com"}, wantTotal: 3},
+		{name: "first page", startIndex: 1, count: 2, want: []string{"ann@example.com", "bob@example.com"}, wantTotal: 3},
+		{name: "last page", startIndex: 3, count: 2, want: []string{"cat@example.com"}, wantTotal: 3},
+		{name: "only the total", startIndex: 1, count: 0, want: []string{}, wantTotal: 3},
+		{name: "past the end", startIndex: 4, count: 100, want: []string{}, wantTotal: 3},
+		{name: "huge startIndex", startIndex: math.MaxInt, count: 100, want: []string{}, wantTotal: 3},
+		{name: "huge count", startIndex: 2, count: math.MaxInt, want: []string{"bob@example.com", "cat@example.com"}, wantTotal: 3},
+		{name: "userName", filter: `userName eq "BOB@example.com"`, startIndex: 1, count: 100, want: []string{"bob@example.com"}, wantTotal: 1},
+		{name: "inactive", filter: `active eq false`, startIndex: 1, count: 100, want: []string{"cat@example.com"}, wantTotal: 1},
+		{name: "no match", filter: `userName eq "bob@example.com" and active eq false`, startIndex: 1, count: 100, want: []string{}, wantTotal: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			o := newTestSCIMService(t)
+			for _, userName := range []string{"ann@example.com", "bob@example.com"} {
+				o.provision(t, userName)
+			}
+			inactive := false
+			if _, err := o.scim.CreateUser(ctx, o.token, &scim.User{UserName: "cat@example.com", Active: &inactive}); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+
+			list, err := o.scim.ListUsers(ctx, o.token, tt.filter, tt.startIndex, tt.count)
+			if err != nil {
+				t.Fatalf("ListUsers: %v", err)
+			}
+			got := []string{}
+			for _, user := range list.Resources.([]*scim.User) {
+				got = append(got, user.UserName)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("users = %v, want %v", got, tt.want)
+			}
+			if list.TotalResults != tt.wantTotal || list.StartIndex != tt.startIndex {
+				t.Errorf("totalResults = %d, startIndex = %d; want %d, %d", list.TotalResults, list.StartIndex, tt.wantTotal, tt.startIndex)
+			}
+		})
+	}
+}
+
+func TestSCIMListUsersRejectsUnsupportedFilters(t *testing.T) {
+	for _, filter := range []string{
+		`userName co "jane"`,
+		`displayName eq "Jane"`,
+		`active eq "false"`,
+		`userName eq true`,
+		`userName eq`,
+	} {
+		t.Run(filter, func(t *testing.T) {
+			o := newTestSCIMService(t)
+			_, err := o.scim.ListUsers(context.Background(), o.token, filter, 1, 100)
+			var scimErr *scim.Error
+			if !errors.As(err, &scimErr) || scimErr.ScimType != scim.InvalidFilter {
+				t.Errorf("ListUsers error = %v, want invalidFilter", err)
+			}
+		})
+	}
+}
+
+func TestSCIMPatchUserDeactivates(t *testing.T) {
+	tests := []struct {
+		name string
+		op   scim.PatchOperation
+	}{
+		{name: "with path", op: scim.PatchOperation{Op: "replace", Path: "active", Value: json.RawMessage(`false`)}},
+		{name: "without path", op: scim.PatchOperation{Op: "Replace", Value: json.RawMessage(`{"active": "False"}`)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			o := newTestSCIMService(t)
+			resource, _ := o.provision(t, "jane@example.com")
+			o.provision(t, "john@example.com")
+
+			patched, err := o.scim.PatchUser(ctx, o.token, resource.ID, []scim.PatchOperation{tt.op})
+			if err != nil {
+				t.Fatalf("PatchUser: %v", err)
+			}
+			if patched.IsActive() {
+				t.Error("patched user is still active")
+			}
+			userID, _ := strconv.ParseInt(resource.ID, 10, 64)
+			if status := o.users.users[userID].Status; status != domain.UserStatusDeprovisioned {
+				t.Errorf("status = %q, want %q", status, domain.UserStatusDeprovisioned)
+			}
+			if sessions, pats := o.revoked(resource.ID); !sessions || !pats {
+				t.Errorf("sessions revoked = %v, tokens revoked = %v; want both", sessions, pats)
+			}
+			if sessions, pats := o.revoked(strconv.FormatInt(userID+1, 10)); sessions || pats {
+				t.Error("credentials of another user were revoked")
+			}
+		})
+	}
+}
+
+func TestSCIMPatchGroupMembers(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  func(ann, bob string) []scim.PatchOperation
+		want func(ann, bob string) []string
+	}{
+		{
+			name: "add",
+			ops: func(ann, bob string) []scim.PatchOperation {
+				return []scim.PatchOperation{{Op: "add", Path: "members", Value: json.RawMessage(`[{"value": "` + bob + `"}]`)}}
+			},
+			want: func(ann, bob string) []string { return []string{ann, bob} },
+		},
+		{
+			name: "remove by value",
+			ops: func(ann, bob string) []scim.PatchOperation {
+				return []scim.PatchOperation{{Op: "remove", Path: "members", Value: json.RawMessage(`[{"value": "` + ann + `"}]`)}}
+			},
+			want: func(ann, bob string) []string { return []string{} },
+		},
+		{
+			name: "remove by filter",
+			ops: func(ann, bob string) []scim.PatchOperation {
+				return []scim.PatchOperation{{Op: "remove", Path: `members[value eq "` + ann + `"]`}}
+			},
+			want: func(ann, bob string) []string { return []string{} },
+		},
+		{
+			name: "replace",
+			ops: func(ann, bob string) []scim.PatchOperation {
+				return []scim.PatchOperation{{Op: "replace", Path: "members", Value: json.RawMessage(`[{"value": "` + bob + `"}]`)}}
+			},
+			want: func(ann, bob string) []string { return []string{bob} },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			o := newTestSCIMService(t)
+			annResource, _ := o.provision(t, "ann@example.com")
+			bobResource, _ := o.provision(t, "bob@example.com")
+			ann, bob := annResource.ID, bobResource.ID
+			if _, err := o.scim.PatchGroup(ctx, o.token, "3", []scim.PatchOperation{{Op: "add", Path: "members", Value: json.RawMessage(`[{"value": "` + ann + `"}]`)}}); err != nil {
+				t.Fatalf("PatchGroup: %v", err)
+			}
+
+			group, err := o.scim.PatchGroup(ctx, o.token, "3", tt.ops(ann, bob))
+			if err != nil {
+				t.Fatalf("PatchGroup: %v", err)
+			}
+			members := []string{}
+			for _, member := range group.Members {
+				members = append(members, member.Value)
+			}
+			slices.Sort(members)
+			if want := tt.want(ann, bob); !slices.Equal(members, want) {
+				t.Errorf("members = %v, want %v", members, want)
+			}
+			for _, id := range []string{ann, bob} {
+				userID, _ := strconv.ParseInt(id, 10, 64)
+				if hasRole, want := slices.Contains(o.roles.roles[userID], "editor"), slices.Contains(members, id); hasRole != want {
+					t.Errorf("user %s has the editor role = %v, want %v", id, hasRole, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSCIMPatchGroupRejectsForeignMembers(t *testing.T) {
+	ctx := context.Background()
+	o := newTestSCIMService(t)
+	// A user of another organization, or one that wasn't provisioned
+	userID := o.users.add(domain.User{Email: "eve@example.com", Verified: true})
+
+	_, err := o.scim.PatchGroup(ctx, o.token, "3", []scim.PatchOperation{{Op: "add", Path: "members", Value: json.RawMessage(`[{"value": "` + strconv.FormatInt(userID, 10) + `"}]`)}})
+	var scimErr *scim.Error
+	if !errors.As(err, &scimErr) || scimErr.ScimType != scim.InvalidValue {
+		t.Errorf("PatchGroup error = %v, want invalidValue", err)
+	}
+	if slices.Contains(o.roles.roles[userID], "editor") {
+		t.Error("the user got the editor role")
+	}
+}
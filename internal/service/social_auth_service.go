@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+	"github.com/login_flow/auth-service/pkg/oauth"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrUnknownProvider          = errors.New("unknown login provider")
+	ErrInvalidOAuthState        = errors.New("invalid or expired login state")
+	ErrProviderEmailNotVerified = errors.New("login provider did not report a verified email")
+	ErrIdentityConflict         = errors.New("an account with this email exists and can't be linked automatically")
+)
+
+// OAuthState is kept by the client between starting a login at a provider and the callback
+type OAuthState struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+}
+
+// SocialAuthService handles "Sign in with ..." logins through external providers
+type SocialAuthService struct {
+	authService  *AuthService
+	userRepo     domain.UserRepository
+	identityRepo domain.IdentityRepository
+	audit        domain.AuditEmitter
+	providers    map[string]*oauth.Provider
+}
+
+func NewSocialAuthService(authService *AuthService, userRepo domain.UserRepository, identityRepo domain.IdentityRepository, audit domain.AuditEmitter, providers ...*oauth.Provider) *SocialAuthService {
+	s := &SocialAuthService{
+		authService:  authService,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		audit:        audit,
+		providers:    make(map[string]*oauth.Provider, len(providers)),
+	}
+	for _, provider := range providers {
+		s.providers[provider.Name()] = provider
+	}
+	return s
+}
+
+// Providers returns the names of the configured providers
+func (s *SocialAuthService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Start returns the provider URL to send the user to, and the state the
+// callback has to be given back
+func (s *SocialAuthService) Start(providerName string) (string, *OAuthState, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", nil, ErrUnknownProvider
+	}
+
+	state, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate oauth state: %w", err)
+	}
+	nonce, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate oauth nonce: %w", err)
+	}
+
+	oauthState := &OAuthState{
+		Provider: providerName,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+	}
+	return provider.AuthCodeURL(state, nonce, oauthState.Verifier), oauthState, nil
+}
+
+// Complete handles the provider callback: it checks the state, exchanges the code,
+// finds or creates the linked user and starts a session
+func (s *SocialAuthService) Complete(ctx context.Context, oauthState *OAuthState, providerName, code, state string) (accessToken, refreshToken string, user *domain.User, err error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", nil, ErrUnknownProvider
+	}
+
+	// The state ties the callback to the browser that started the login (CSRF)
+	if oauthState == nil || oauthState.Provider != providerName || state == "" ||
+		subtle.ConstantTimeCompare([]byte(oauthState.State), []byte(state)) != 1 {
+		return "", "", nil, ErrInvalidOAuthState
+	}
+
+	identity, err := provider.Exchange(ctx, code, oauthState.Verifier, oauthState.Nonce)
+	if err != nil {
+		s.authService.loginFailed(ctx, "", nil, "oauth_exchange_failed")
+		return "", "", nil, err
+	}
+
+	user, err = s.resolveUser(ctx, providerName, identity)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if user.Status == domain.UserStatusPendingApproval {
+		s.authService.loginFailed(ctx, user.Email, &user.ID, "pending_approval")
+		return "", "", nil, ErrUserPendingApproval
+	}
+
+	if !user.IsActive() {
+		s.authService.loginFailed(ctx, user.Email, &user.ID, "account_disabled")
+		return "", "", nil, ErrUserDisabled
+	}
+
+	accessToken, refreshToken, err = s.authService.StartSession(ctx, user, "oauth:"+providerName)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return accessToken, refreshToken, user, nil
+}
+
+// resolveUser returns the user linked to the provider identity. Unknown identities are
+// linked by email, but only when both sides verified it: the provider must report the
+// email as verified, and an existing account must have verified it too. Otherwise whoever
+// registered an address first (here or at the provider) could take over the other account.
+// When no account uses the email a new one is created.
+func (s *SocialAuthService) resolveUser(ctx context.Context, providerName string, identity *oauth.Identity) (*domain.User, error) {
+	linked, err := s.identityRepo.GetByProviderSubject(ctx, providerName, identity.Subject)
+	if err == nil {
+		if err := s.identityRepo.UpdateLastLogin(ctx, linked.ID); err != nil {
+			return nil, err
+		}
+		user, err := s.userRepo.GetByID(ctx, linked.UserID)
+		if err != nil {
+			return nil, ErrUserNotFound
+		}
+		return user, nil
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		s.authService.loginFailed(ctx, identity.Email, nil, "oauth_email_not_verified")
+		return nil, ErrProviderEmailNotVerified
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, identity.Email)
+	if err == nil {
+		if !user.Verified || user.IsDirectoryUser() {
+			s.authService.loginFailed(ctx, identity.Email, &user.ID, "oauth_identity_conflict")
+			return nil, ErrIdentityConflict
+		}
+	} else {
+		if !s.authService.openSignUp() {
+			s.authService.registerFailed(ctx, identity.Email, "registration_closed")
+			return nil, ErrRegistrationClosed
+		}
+
+		// Social-only accounts get an unusable random password, a password reset sets a real one
+		password, err := crypto.GenerateRandomToken(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate password: %w", err)
+		}
+		hashedPassword, err := crypto.HashPassword(password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+		user, err = s.authService.createUser(ctx, &domain.User{
+			Email:    identity.Email,
+			Password: hashedPassword,
+			Status:   s.authService.newAccountStatus(false),
+		}, "oauth:"+providerName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.link(ctx, user, providerName, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *SocialAuthService) link(ctx context.Context, user *domain.User, providerName string, identity *oauth.Identity) error {
+	if err := s.identityRepo.Create(ctx, &domain.UserIdentity{
+		UserID:   user.ID,
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}); err != nil {
+		return err
+	}
+
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:      domain.AuditIdentityLinked,
+		SubjectID: &user.ID,
+		Outcome:   domain.AuditSuccess,
+		Metadata:  map[string]interface{}{"provider": providerName, "email": identity.Email},
+	})
+	return nil
+}
+
+// ListIdentities returns the external logins linked to a user
+func (s *SocialAuthService) ListIdentities(ctx context.Context, userID int64) ([]*domain.UserIdentity, error) {
+	return s.identityRepo.ListForUser(ctx, userID)
+}
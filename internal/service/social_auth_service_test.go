@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/oauth"
+	"github.com/login_flow/auth-service/pkg/oauth/oauthtest"
+)
+
+func newTestSocialAuthService(t *testing.T, env *testEnv) (*SocialAuthService, *oauthtest.Provider) {
+	t.Helper()
+	idp := oauthtest.Start(t)
+	provider, err := oauth.NewProvider(context.Background(), oauth.Config{
+		Name:         "acme",
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "https://app.example.com/api/auth/oauth/acme/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+		Issuer:       idp.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	return NewSocialAuthService(env.auth, env.users, env.identities, env.audit, provider), idp
+}
+
+// signIn starts a login and approves it at the provider as user, returning the state
+// the browser keeps and the code of the callback
+func signIn(t *testing.T, s *SocialAuthService, idp *oauthtest.Provider, user oauthtest.User) (*OAuthState, string) {
+	t.Helper()
+	authURL, oauthState, err := s.Start("acme")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	code, err := idp.Approve(authURL, user)
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	return oauthState, code
+}
+
+var acmeJane = oauthtest.User{Subject: "acme-jane", Email: "jane@example.com", EmailVerified: true, Name: "Jane Doe"}
+
+func TestSocialCompleteRejectsForeignCallbacks(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     func(oauthState *OAuthState, state *string)
+		want       error // nil: the code exchange fails
+		wantTokens int   // Codes redeemed at the provider
+	}{
+		{
+			name:   "state of another login",
+			tamper: func(oauthState *OAuthState, state *string) { *state = "forged" },
+			want:   ErrInvalidOAuthState,
+		},
+		{
+			name:   "no state",
+			tamper: func(oauthState *OAuthState, state *string) { *state = "" },
+			want:   ErrInvalidOAuthState,
+		},
+		{
+			name:   "started at another provider",
+			tamper: func(oauthState *OAuthState, state *string) { oauthState.Provider = "other" },
+			want:   ErrInvalidOAuthState,
+		},
+		{
+			name:       "ID token issued for another nonce",
+			tamper:     func(oauthState *OAuthState, state *string) { oauthState.Nonce = "other-nonce" },
+			want:       oauth.ErrNonceMismatch,
+			wantTokens: 1,
+		},
+		{
+			name: "PKCE verifier of another login",
+			tamper: func(oauthState *OAuthState, state *string) {
+				oauthState.Verifier = "other-verifier-other-verifier-other-verifier"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			s, idp := newTestSocialAuthService(t, env)
+			env.users.add(domain.User{Email: acmeJane.Email, Verified: true})
+
+			oauthState, code := signIn(t, s, idp, acmeJane)
+			state := oauthState.State
+			tt.tamper(oauthState, &state)
+
+			_, _, user, err := s.Complete(context.Background(), oauthState, "acme", code, state)
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Complete error = %v, want %v", err, tt.want)
+			}
+			if err == nil {
+				t.Fatal("Complete succeeded, want an error")
+			}
+			if user != nil {
+				t.Errorf("user = %+v, want none", user)
+			}
+			if n := idp.TokenRequests(); n != tt.wantTokens {
+				t.Errorf("codes redeemed = %d, want %d", n, tt.wantTokens)
+			}
+			if len(env.identities.identities) != 0 || len(env.tokens.tokens) != 0 {
+				t.Errorf("identities = %d, sessions = %d; want none", len(env.identities.identities), len(env.tokens.tokens))
+			}
+		})
+	}
+}
+
+func TestSocialCompleteRejectsUnverifiedProviderEmail(t *testing.T) {
+	env := newTestEnv(t)
+	s, idp := newTestSocialAuthService(t, env)
+	userID := env.users.add(domain.User{Email: acmeJane.Email, Verified: true})
+
+	unverified := acmeJane
+	unverified.EmailVerified = false
+	oauthState, code := signIn(t, s, idp, unverified)
+
+	if _, _, _, err := s.Complete(context.Background(), oauthState, "acme", code, oauthState.State); !errors.Is(err, ErrProviderEmailNotVerified) {
+		t.Fatalf("Complete error = %v, want ErrProviderEmailNotVerified", err)
+	}
+	if len(env.identities.identities) != 0 {
+		t.Errorf("identity linked to user %d", userID)
+	}
+}
+
+func TestSocialCompleteLinksVerifiedAccount(t *testing.T) {
+	env := newTestEnv(t)
+	s, idp := newTestSocialAuthService(t, env)
+	userID := env.users.add(domain.User{Email: acmeJane.Email, Verified: true})
+
+	oauthState, code := signIn(t, s, idp, acmeJane)
+	accessToken, refreshToken, user, err := s.Complete(context.Background(), oauthState, "acme", code, oauthState.State)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if user.ID != userID || accessToken == "" || refreshToken == "" {
+		t.Errorf("Complete = user %d with tokens %q, %q; want a session of user %d", user.ID, accessToken, refreshToken, userID)
+	}
+	identities := env.identities.identities
+	if len(identities) != 1 || identities[0].UserID != userID || identities[0].Provider != "acme" || identities[0].Subject != acmeJane.Subject {
+		t.Fatalf("identities = %+v, want %s at acme linked to user %d", identities, acmeJane.Subject, userID)
+	}
+
+	// The next login finds the account by subject, even after the email changed at the provider
+	renamed := acmeJane
+	renamed.Email = "jane.doe@example.com"
+	oauthState, code = signIn(t, s, idp, renamed)
+	_, _, user, err = s.Complete(context.Background(), oauthState, "acme", code, oauthState.State)
+	if err != nil {
+		t.Fatalf("second Complete: %v", err)
+	}
+	if user.ID != userID || len(env.identities.identities) != 1 {
+		t.Errorf("second login = user %d with %d identities, want user %d with one", user.ID, len(env.identities.identities), userID)
+	}
+}
+
+// Whoever registered the address without confirming it may not be its owner
+func TestSocialCompleteRefusesUnverifiedAccount(t *testing.T) {
+	env := newTestEnv(t)
+	s, idp := newTestSocialAuthService(t, env)
+	env.users.add(domain.User{Email: acmeJane.Email})
+
+	oauthState, code := signIn(t, s, idp, acmeJane)
+	if _, _, _, err := s.Complete(context.Background(), oauthState, "acme", code, oauthState.State); !errors.Is(err, ErrIdentityConflict) {
+		t.Fatalf("Complete error = %v, want ErrIdentityConflict", err)
+	}
+	if len(env.identities.identities) != 0 || len(env.tokens.tokens) != 0 {
+		t.Errorf("identities = %d, sessions = %d; want none", len(env.identities.identities), len(env.tokens.tokens))
+	}
+	if reasons := env.audit.failureReasons(); len(reasons) != 1 || reasons[0] != "oauth_identity_conflict" {
+		t.Errorf("failed login reasons = %v, want [oauth_identity_conflict]", reasons)
+	}
+}
+
+func TestSocialCompleteCreatesAccount(t *testing.T) {
+	env := newTestEnv(t)
+	s, idp := newTestSocialAuthService(t, env)
+
+	oauthState, code := signIn(t, s, idp, acmeJane)
+	_, _, user, err := s.Complete(context.Background(), oauthState, "acme", code, oauthState.State)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if user.Email != acmeJane.Email || len(env.identities.identities) != 1 || env.identities.identities[0].UserID != user.ID {
+		t.Errorf("Complete = %+v with identities %+v, want a new account for %s linked to it", user, env.identities.identities, acmeJane.Email)
+	}
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/crypto"
+	"github.com/login_flow/auth-service/pkg/webhook"
+)
+
+var (
+	ErrWebhookNotFound     = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound    = errors.New("webhook delivery not found")
+	ErrUnknownWebhookEvent = errors.New("unknown webhook event")
+)
+
+// dispatchBatchSize is how many due deliveries one dispatcher pass claims
+const dispatchBatchSize = 50
+
+// WebhookService manages webhook subscriptions and delivers account events to them.
+// Events are written to an outbox first and sent by the dispatcher, so a slow or
+// failing subscriber never blocks the request that produced the event.
+// It implements domain.EventPublisher.
+type WebhookService struct {
+	webhookRepo domain.WebhookRepository
+	audit       domain.AuditEmitter
+	client      *http.Client
+	cfg         *config.Config
+}
+
+func NewWebhookService(webhookRepo domain.WebhookRepository, audit domain.AuditEmitter, cfg *config.Config) *WebhookService {
+	return &WebhookService{
+		webhookRepo: webhookRepo,
+		audit:       audit,
+		client:      &http.Client{Timeout: cfg.Webhook.Timeout},
+		cfg:         cfg,
+	}
+}
+
+// webhookPayload is the JSON body sent to subscribers
+type webhookPayload struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// Publish queues the event for every subscription that selected it.
+// Failures are logged, never returned, so publishing can't fail the caller.
+func (s *WebhookService) Publish(ctx context.Context, eventType string, data map[string]interface{}) {
+	subscriptions, err := s.webhookRepo.GetSubscriptionsForEvent(ctx, eventType)
+	if err != nil {
+		log.Printf("failed to publish webhook event %s: %v", eventType, err)
+		return
+	}
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	eventID, err := crypto.GenerateRandomToken(16)
+	if err != nil {
+		log.Printf("failed to publish webhook event %s: %v", eventType, err)
+		return
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(webhookPayload{
+		ID:        eventID,
+		Type:      eventType,
+		CreatedAt: now.UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		log.Printf("failed to encode webhook event %s: %v", eventType, err)
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		delivery := &domain.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        eventID,
+			EventType:      eventType,
+			Payload:        string(payload),
+			Status:         domain.DeliveryPending,
+			NextAttemptAt:  now,
+		}
+		if err := s.webhookRepo.CreateDelivery(ctx, delivery); err != nil {
+			log.Printf("failed to queue webhook event %s for subscription %d: %v", eventType, subscription.ID, err)
+		}
+	}
+}
+
+// DispatchDue sends every delivery that is due and returns how many were attempted
+// and recorded
+func (s *WebhookService) DispatchDue(ctx context.Context) (int, error) {
+	// A claimed delivery is hidden from other dispatchers until the request
+	// has had time to finish, after that it is picked up again
+	deliveries, err := s.webhookRepo.ClaimDueDeliveries(ctx, dispatchBatchSize, s.cfg.Webhook.Timeout+time.Minute)
+	if err != nil {
+		return 0, err
+	}
+
+	// One delivery failing to be recorded must not hold up the rest of the batch, its
+	// lease runs out and it is attempted again
+	dispatched := 0
+	for _, delivery := range deliveries {
+		if err := ctx.Err(); err != nil {
+			return dispatched, err
+		}
+		if err := s.deliver(ctx, delivery); err != nil {
+			log.Printf("failed to record webhook delivery %d: %v", delivery.ID, err)
+			continue
+		}
+		dispatched++
+	}
+
+	return dispatched, nil
+}
+
+// RunDispatcher calls DispatchDue every interval until ctx is cancelled
+func (s *WebhookService) RunDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.DispatchDue(ctx); err != nil {
+				log.Printf("webhook dispatch failed: %v", err)
+			}
+		}
+	}
+}
+
+// deliver makes one attempt, logs it and schedules a retry with exponential backoff on failure
+func (s *WebhookService) deliver(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	start := time.Now()
+	status, sendErr := s.send(ctx, delivery)
+
+	attempt := &domain.WebhookAttempt{
+		DeliveryID:     delivery.ID,
+		ResponseStatus: status,
+		DurationMS:     time.Since(start).Milliseconds(),
+	}
+	if sendErr != nil {
+		attempt.Error = sendErr.Error()
+	}
+	if err := s.webhookRepo.CreateAttempt(ctx, attempt); err != nil {
+		return err
+	}
+
+	delivery.Attempts++
+	if sendErr == nil {
+		now := time.Now()
+		delivery.Status = domain.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = sendErr.Error()
+		if delivery.Attempts >= s.cfg.Webhook.MaxAttempts {
+			delivery.Status = domain.DeliveryFailed
+		} else {
+			delivery.NextAttemptAt = time.Now().Add(s.retryDelay(delivery.Attempts))
+		}
+	}
+
+	return s.webhookRepo.UpdateDelivery(ctx, delivery)
+}
+
+// send posts the signed payload and returns the response status, 0 if there was no response
+func (s *WebhookService) send(ctx context.Context, delivery *domain.WebhookDelivery) (int, error) {
+	subscription := delivery.Subscription
+	if subscription == nil {
+		return 0, ErrWebhookNotFound
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	// Signed at send time so retries carry a fresh timestamp
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "auth-service-webhooks")
+	req.Header.Set(webhook.IDHeader, delivery.EventID)
+	req.Header.Set(webhook.EventHeader, delivery.EventType)
+	req.Header.Set(webhook.TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(subscription.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryDelay doubles the base delay for every failed attempt, up to the maximum
+func (s *WebhookService) retryDelay(attempts int) time.Duration {
+	delay := s.cfg.Webhook.RetryBaseDelay
+	for i := 1; i < attempts && delay < s.cfg.Webhook.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, s.cfg.Webhook.RetryMaxDelay)
+}
+
+// CreateSubscription registers a receiver for the given events. A signing secret is
+// generated when none is given; it is returned here and never shown again.
+func (s *WebhookService) CreateSubscription(ctx context.Context, url string, events []string, secret, description string) (*domain.WebhookSubscription, string, error) {
+	for _, event := range events {
+		if event != domain.EventAll && !slices.Contains(domain.WebhookEvents, event) {
+			return nil, "", fmt.Errorf("%w: %s", ErrUnknownWebhookEvent, event)
+		}
+	}
+
+	if secret == "" {
+		token, err := crypto.GenerateRandomToken(32)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		secret = "whsec_" + token
+	}
+
+	subscription := &domain.WebhookSubscription{
+		URL:         url,
+		Events:      slices.Compact(slices.Sorted(slices.Values(events))),
+		Secret:      secret,
+		Description: description,
+		Active:      true,
+	}
+	if err := s.webhookRepo.CreateSubscription(ctx, subscription); err != nil {
+		return nil, "", err
+	}
+
+	s.recordAction(ctx, "create_webhook", subscription.ID)
+	return subscription, secret, nil
+}
+
+func (s *WebhookService) ListSubscriptions(ctx context.Context) ([]*domain.WebhookSubscription, error) {
+	return s.webhookRepo.ListSubscriptions(ctx)
+}
+
+// DeleteSubscription removes the subscription and drops its pending deliveries
+func (s *WebhookService) DeleteSubscription(ctx context.Context, id int64) error {
+	if _, err := s.webhookRepo.GetSubscription(ctx, id); err != nil {
+		return ErrWebhookNotFound
+	}
+
+	if err := s.webhookRepo.DeleteSubscription(ctx, id); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "delete_webhook", id)
+	return nil
+}
+
+// ListDeliveries returns the most recent deliveries of a subscription
+func (s *WebhookService) ListDeliveries(ctx context.Context, subscriptionID int64, limit int) ([]*domain.WebhookDelivery, error) {
+	if _, err := s.webhookRepo.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, ErrWebhookNotFound
+	}
+	return s.webhookRepo.ListDeliveries(ctx, subscriptionID, limit)
+}
+
+// ListAttempts returns the delivery log of one delivery
+func (s *WebhookService) ListAttempts(ctx context.Context, deliveryID int64) ([]*domain.WebhookAttempt, error) {
+	if _, err := s.webhookRepo.GetDelivery(ctx, deliveryID); err != nil {
+		return nil, ErrDeliveryNotFound
+	}
+	return s.webhookRepo.ListAttempts(ctx, deliveryID)
+}
+
+// RetryDelivery queues a delivery again right away with a fresh set of attempts
+func (s *WebhookService) RetryDelivery(ctx context.Context, deliveryID int64) error {
+	delivery, err := s.webhookRepo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return ErrDeliveryNotFound
+	}
+
+	delivery.Status = domain.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	delivery.DeliveredAt = nil
+	if err := s.webhookRepo.UpdateDelivery(ctx, delivery); err != nil {
+		return err
+	}
+
+	s.recordAction(ctx, "retry_webhook_delivery", delivery.SubscriptionID)
+	return nil
+}
+
+func (s *WebhookService) recordAction(ctx context.Context, action string, subscriptionID int64) {
+	s.audit.Emit(ctx, &domain.AuditEvent{
+		Type:     domain.AuditAdminAction,
+		Outcome:  domain.AuditSuccess,
+		Metadata: map[string]interface{}{"action": action, "subscription_id": subscriptionID},
+	})
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/login_flow/auth-service/internal/config"
+	"github.com/login_flow/auth-service/internal/domain"
+	"github.com/login_flow/auth-service/pkg/webhook"
+)
+
+type fakeWebhookRepo struct {
+	domain.WebhookRepository
+	subscriptions []*domain.WebhookSubscription
+	deliveries    []*domain.WebhookDelivery
+	attempts      []*domain.WebhookAttempt
+	failAttempts  map[int64]bool // Deliveries whose attempts can't be recorded
+}
+
+func (r *fakeWebhookRepo) GetSubscriptionsForEvent(ctx context.Context, eventType string) ([]*domain.WebhookSubscription, error) {
+	return r.subscriptions, nil
+}
+
+func (r *fakeWebhookRepo) CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	delivery.ID = int64(len(r.deliveries) + 1)
+	for _, subscription := range r.subscriptions {
+		if subscription.ID == delivery.SubscriptionID {
+			delivery.Subscription = subscription
+		}
+	}
+	r.deliveries = append(r.deliveries, delivery)
+	return nil
+}
+
+// ClaimDueDeliveries returns the due deliveries themselves, so the test sees what
+// UpdateDelivery stored
+func (r *fakeWebhookRepo) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.WebhookDelivery, error) {
+	var due []*domain.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.Status == domain.DeliveryPending && !delivery.NextAttemptAt.After(time.Now()) && len(due) < limit {
+			due = append(due, delivery)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeWebhookRepo) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	return nil
+}
+
+func (r *fakeWebhookRepo) CreateAttempt(ctx context.Context, attempt *domain.WebhookAttempt) error {
+	if r.failAttempts[attempt.DeliveryID] {
+		return errors.New("connection reset")
+	}
+	r.attempts = append(r.attempts, attempt)
+	return nil
+}
+
+// receiver is a subscriber endpoint that records the requests it gets and answers
+// with status
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func startReceiver(t *testing.T, status int) *receiver {
+	t.Helper()
+	rcv := &receiver{status: status}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		rcv.requests = append(rcv.requests, receivedRequest{header: r.Header, body: body})
+		w.WriteHeader(rcv.status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *receiver) received() []receivedRequest {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]receivedRequest(nil), rcv.requests...)
+}
+
+const testWebhookSecret = "whsec_test"
+
+// newTestWebhookService has one subscription posting to url
+func newTestWebhookService(t *testing.T, url string) (*WebhookService, *fakeWebhookRepo) {
+	t.Helper()
+	repo := &fakeWebhookRepo{
+		subscriptions: []*domain.WebhookSubscription{{ID: 1, URL: url, Events: []string{domain.EventAll}, Secret: testWebhookSecret, Active: true}},
+		failAttempts:  make(map[int64]bool),
+	}
+	cfg := &config.Config{Webhook: config.WebhookConfig{
+		Timeout:        5 * time.Second,
+		MaxAttempts:    4,
+		RetryBaseDelay: time.Minute,
+		RetryMaxDelay:  3 * time.Minute,
+	}}
+	return NewWebhookService(repo, &fakeAudit{}, cfg), repo
+}
+
+func TestWebhookDeliveryIsSigned(t *testing.T) {
+	rcv := startReceiver(t, http.StatusNoContent)
+	s, repo := newTestWebhookService(t, rcv.URL)
+
+	s.Publish(context.Background(), "user.created", map[string]interface{}{"user_id": 42})
+	if n, err := s.DispatchDue(context.Background()); err != nil || n != 1 {
+		t.Fatalf("DispatchDue = %d, %v; want 1 delivery", n, err)
+	}
+
+	requests := rcv.received()
+	if len(requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(requests))
+	}
+	req, delivery := requests[0], repo.deliveries[0]
+	if string(req.body) != delivery.Payload {
+		t.Errorf("body = %s, want the stored payload %s", req.body, delivery.Payload)
+	}
+	if req.header.Get(webhook.IDHeader) != delivery.EventID || req.header.Get(webhook.EventHeader) != "user.created" {
+		t.Errorf("event headers = %q, %q; want %q, user.created", req.header.Get(webhook.IDHeader), req.header.Get(webhook.EventHeader), delivery.EventID)
+	}
+
+	signature, timestamp := req.header.Get(webhook.SignatureHeader), req.header.Get(webhook.TimestampHeader)
+	if err := webhook.Verify(testWebhookSecret, signature, timestamp, req.body, 5*time.Minute); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := webhook.Verify("whsec_other", signature, timestamp, req.body, 5*time.Minute); !errors.Is(err, webhook.ErrInvalidSignature) {
+		t.Errorf("Verify with another secret error = %v, want ErrInvalidSignature", err)
+	}
+	if err := webhook.Verify(testWebhookSecret, signature, timestamp, []byte(`{"type":"user.deleted"}`), 5*time.Minute); !errors.Is(err, webhook.ErrInvalidSignature) {
+		t.Errorf("Verify of another body error = %v, want ErrInvalidSignature", err)
+	}
+
+	if delivery.Status != domain.DeliveryDelivered || delivery.Attempts != 1 || delivery.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want delivered on the first attempt", delivery)
+	}
+	if len(repo.attempts) != 1 || repo.attempts[0].ResponseStatus != http.StatusNoContent || repo.attempts[0].Error != "" {
+		t.Errorf("attempts = %+v, want one answered with 204", repo.attempts)
+	}
+}
+
+func TestWebhookDeliveryRetriesWithBackoff(t *testing.T) {
+	rcv := startReceiver(t, http.StatusServiceUnavailable)
+	s, repo := newTestWebhookService(t, rcv.URL)
+	s.Publish(context.Background(), "user.created", map[string]interface{}{"user_id": 42})
+	delivery := repo.deliveries[0]
+
+	// Doubled from the base delay, capped at the maximum; the last attempt gives up
+	for i, wantDelay := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		before := time.Now()
+		if n, err := s.DispatchDue(context.Background()); err != nil || n != 1 {
+			t.Fatalf("attempt %d: DispatchDue = %d, %v; want 1 delivery", i+1, n, err)
+		}
+		if delivery.Status != domain.DeliveryPending || delivery.Attempts != i+1 || delivery.LastError == "" {
+			t.Fatalf("attempt %d: delivery = %+v, want pending after %d attempts", i+1, delivery, i+1)
+		}
+		if delay := delivery.NextAttemptAt.Sub(before); delay < wantDelay || delay > wantDelay+time.Second {
+			t.Errorf("attempt %d: next attempt in %v, want %v", i+1, delay, wantDelay)
+		}
+
+		// Not due yet
+		if n, _ := s.DispatchDue(context.Background()); n != 0 {
+			t.Fatalf("attempt %d: retried %d deliveries before the delay", i+1, n)
+		}
+		delivery.NextAttemptAt = time.Now()
+	}
+
+	if n, err := s.DispatchDue(context.Background()); err != nil || n != 1 {
+		t.Fatalf("last attempt: DispatchDue = %d, %v; want 1 delivery", n, err)
+	}
+	if delivery.Status != domain.DeliveryFailed || delivery.Attempts != 4 {
+		t.Errorf("delivery = %+v, want failed after 4 attempts", delivery)
+	}
+	if n, _ := s.DispatchDue(context.Background()); n != 0 {
+		t.Errorf("a failed delivery was attempted again")
+	}
+
+	if requests := rcv.received(); len(requests) != 4 {
+		t.Errorf("receiver got %d requests, want 4", len(requests))
+	}
+	for _, attempt := range repo.attempts {
+		if attempt.ResponseStatus != http.StatusServiceUnavailable || attempt.Error == "" {
+			t.Errorf("attempt = %+v, want a logged 503", attempt)
+		}
+	}
+}
+
+func TestWebhookDeliveryToUnreachableReceiver(t *testing.T) {
+	rcv := startReceiver(t, http.StatusNoContent)
+	rcv.Close()
+	s, repo := newTestWebhookService(t, rcv.URL)
+
+	s.Publish(context.Background(), "user.created", map[string]interface{}{"user_id": 42})
+	if _, err := s.DispatchDue(context.Background()); err != nil {
+		t.Fatalf("DispatchDue: %v", err)
+	}
+	if delivery := repo.deliveries[0]; delivery.Status != domain.DeliveryPending || delivery.Attempts != 1 {
+		t.Errorf("delivery = %+v, want pending for a retry", delivery)
+	}
+	if len(repo.attempts) != 1 || repo.attempts[0].ResponseStatus != 0 || repo.attempts[0].Error == "" {
+		t.Errorf("attempts = %+v, want one without a response", repo.attempts)
+	}
+}
+
+// A delivery whose attempt can't be recorded doesn't hold up the rest of the batch
+func TestWebhookDispatchContinuesPastFailures(t *testing.T) {
+	rcv := startReceiver(t, http.StatusNoContent)
+	s, repo := newTestWebhookService(t, rcv.URL)
+	for range 3 {
+		s.Publish(context.Background(), "user.created", map[string]interface{}{"user_id": 42})
+	}
+	repo.failAttempts[1] = true
+
+	n, err := s.DispatchDue(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("DispatchDue = %d, %v; want 2 deliveries", n, err)
+	}
+	for _, delivery := range repo.deliveries[1:] {
+		if delivery.Status != domain.DeliveryDelivered {
+			t.Errorf("delivery %d = %s, want delivered", delivery.ID, delivery.Status)
+		}
+	}
+}
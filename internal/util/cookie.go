@@ -11,6 +11,13 @@ const (
 	AccessTokenCookie  = "access_token"
 	RefreshTokenCookie = "refresh_token"
 	CSRFTokenCookie    = "csrf_token"
+	OAuthStateCookie   = "oauth_state"
+	MagicLinkCookie    = "magic_link_nonce"
+	SAMLRequestCookie  = "saml_request"
+
+	oauthCookiePath     = "/api/auth/oauth"
+	magicLinkCookiePath = "/api/auth/magic-link"
+	samlCookiePath      = "/api/auth/saml"
 )
 
 // SetAccessTokenCookie sets the access token as HTTP-only cookie
@@ -55,6 +62,72 @@ func SetCSRFTokenCookie(c *gin.Context, token string, cfg *config.CookieConfig,
 	)
 }
 
+// SetOAuthStateCookie keeps the state of a login at an external provider until its callback.
+// It must be Lax, not Strict: the callback is a cross-site redirect from the provider.
+func SetOAuthStateCookie(c *gin.Context, value string, cfg *config.CookieConfig, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(
+		OAuthStateCookie,
+		value,
+		maxAge,
+		oauthCookiePath,
+		cfg.Domain,
+		cfg.Secure,
+		true, // HttpOnly
+	)
+}
+
+// ClearOAuthStateCookie removes the external login state once the callback used it
+func ClearOAuthStateCookie(c *gin.Context, cfg *config.CookieConfig) {
+	c.SetCookie(OAuthStateCookie, "", -1, oauthCookiePath, cfg.Domain, cfg.Secure, true)
+}
+
+// SetSAMLRequestCookie keeps the ID of a pending AuthnRequest until the IdP posts its
+// response. The response is a cross-site POST, which only carries SameSite=None cookies,
+// and browsers only accept those when Secure. Without COOKIE_SECURE the cookie falls back
+// to Lax, which is enough for an identity provider on the same site (development).
+func SetSAMLRequestCookie(c *gin.Context, value string, cfg *config.CookieConfig, maxAge int) {
+	if cfg.Secure {
+		c.SetSameSite(http.SameSiteNoneMode)
+	} else {
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	c.SetCookie(
+		SAMLRequestCookie,
+		value,
+		maxAge,
+		samlCookiePath,
+		cfg.Domain,
+		cfg.Secure,
+		true, // HttpOnly
+	)
+}
+
+// ClearSAMLRequestCookie removes the pending AuthnRequest once its response arrived
+func ClearSAMLRequestCookie(c *gin.Context, cfg *config.CookieConfig) {
+	c.SetCookie(SAMLRequestCookie, "", -1, samlCookiePath, cfg.Domain, cfg.Secure, true)
+}
+
+// SetMagicLinkCookie binds a requested magic link to this browser until it is consumed.
+// Strict works here: the link opens the app, which then calls the API same-site.
+func SetMagicLinkCookie(c *gin.Context, nonce string, cfg *config.CookieConfig, maxAge int) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(
+		MagicLinkCookie,
+		nonce,
+		maxAge,
+		magicLinkCookiePath,
+		cfg.Domain,
+		cfg.Secure,
+		true, // HttpOnly
+	)
+}
+
+// ClearMagicLinkCookie removes the magic link nonce once the link was used
+func ClearMagicLinkCookie(c *gin.Context, cfg *config.CookieConfig) {
+	c.SetCookie(MagicLinkCookie, "", -1, magicLinkCookiePath, cfg.Domain, cfg.Secure, true)
+}
+
 // ClearAuthCookies removes all authentication cookies
 func ClearAuthCookies(c *gin.Context, cfg *config.CookieConfig) {
 	c.SetCookie(AccessTokenCookie, "", -1, "/", cfg.Domain, cfg.Secure, true)
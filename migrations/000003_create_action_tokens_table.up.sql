@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS action_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(50) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    data TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    consumed_at TIMESTAMP
+);
+
+CREATE INDEX idx_action_tokens_user_id ON action_tokens(user_id);
+CREATE INDEX idx_action_tokens_expires_at ON action_tokens(expires_at);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS known_devices (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    first_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, device, ip)
+);
+
+CREATE INDEX idx_known_devices_user_id ON known_devices(user_id);
@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE name = 'oauth_clients:manage';
+DELETE FROM refresh_tokens WHERE client_id <> '';
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS scope;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS client_id;
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
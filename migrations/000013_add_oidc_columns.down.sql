@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS auth_time;
+
+ALTER TABLE oauth_authorization_codes DROP COLUMN IF EXISTS auth_time;
+ALTER TABLE oauth_authorization_codes DROP COLUMN IF EXISTS nonce;
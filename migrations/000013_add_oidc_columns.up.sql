@@ -0,0 +1,7 @@
+-- OpenID Connect: the nonce and login time of an authorization end up in the ID token
+ALTER TABLE oauth_authorization_codes ADD COLUMN nonce VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE oauth_authorization_codes ADD COLUMN auth_time TIMESTAMP NOT NULL DEFAULT NOW();
+
+-- When the user logged in, kept across refresh token rotation
+ALTER TABLE refresh_tokens ADD COLUMN auth_time TIMESTAMP;
+UPDATE refresh_tokens SET auth_time = created_at;
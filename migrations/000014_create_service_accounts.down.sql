@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE name = 'service_accounts:manage';
+DROP TABLE IF EXISTS service_accounts;
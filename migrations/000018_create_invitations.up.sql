@@ -0,0 +1,18 @@
+-- Invitations to register while REGISTRATION_MODE is invite_only. Accepted rows are
+-- kept as a record of who invited whom, so they don't reference users.
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGSERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(50) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    invited_by BIGINT,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    accepted_at TIMESTAMP,
+    accepted_by BIGINT
+);
+
+INSERT INTO permissions (name, description) VALUES ('invitations:manage', 'Invite users to register');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin' AND p.name = 'invitations:manage';
@@ -0,0 +1,3 @@
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS org_id;
+DROP TABLE IF EXISTS memberships;
+DROP TABLE IF EXISTS organizations;
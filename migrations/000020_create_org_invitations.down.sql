@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_org_id;
+DROP TABLE IF EXISTS org_invitations;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS org_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    invited_by BIGINT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    accepted_at TIMESTAMP
+);
+
+CREATE INDEX idx_org_invitations_org_id ON org_invitations(org_id);
+
+-- Removing a member revokes the sessions switched to that organization
+CREATE INDEX idx_refresh_tokens_org_id ON refresh_tokens(org_id);
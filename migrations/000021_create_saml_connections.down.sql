@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name = 'saml:manage';
+DROP TABLE IF EXISTS saml_assertions;
+DROP TABLE IF EXISTS saml_connections;
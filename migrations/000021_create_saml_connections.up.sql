@@ -0,0 +1,27 @@
+-- Enterprise identity providers users sign in with through SAML 2.0
+CREATE TABLE IF NOT EXISTS saml_connections (
+    id BIGSERIAL PRIMARY KEY,
+    slug VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL,
+    idp_entity_id VARCHAR(1024) NOT NULL,
+    idp_metadata TEXT NOT NULL,
+    email_attribute VARCHAR(255) NOT NULL DEFAULT '',
+    domains JSONB NOT NULL DEFAULT '[]',
+    org_id BIGINT REFERENCES organizations(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- IDs of consumed assertions, kept until the assertion expires so it can't be replayed
+CREATE TABLE IF NOT EXISTS saml_assertions (
+    id VARCHAR(255) PRIMARY KEY,
+    connection_id BIGINT NOT NULL REFERENCES saml_connections(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_saml_assertions_expires_at ON saml_assertions(expires_at);
+
+INSERT INTO permissions (name, description) VALUES ('saml:manage', 'Manage SAML single sign-on connections');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin' AND p.name = 'saml:manage';
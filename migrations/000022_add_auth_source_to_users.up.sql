@@ -0,0 +1,2 @@
+-- Where the password is checked: 'local' (users.password) or 'ldap' (the directory, users.password stays empty)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS auth_source VARCHAR(20) NOT NULL DEFAULT 'local';
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name = 'scim:manage';
+DROP TABLE IF EXISTS scim_users;
+DROP TABLE IF EXISTS scim_tokens;
@@ -0,0 +1,31 @@
+-- Bearer tokens an organization's identity provider provisions users with through SCIM
+CREATE TABLE IF NOT EXISTS scim_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    description VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    hint VARCHAR(8) NOT NULL,
+    domains JSONB NOT NULL DEFAULT '[]',
+    roles JSONB NOT NULL DEFAULT '[]',
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_scim_tokens_org_id ON scim_tokens(org_id);
+
+-- Users provisioned through SCIM and the organization that manages them
+CREATE TABLE IF NOT EXISTS scim_users (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    org_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_name VARCHAR(255) NOT NULL,
+    external_id VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_scim_users_user_name ON scim_users(org_id, LOWER(user_name));
+
+INSERT INTO permissions (name, description) VALUES ('scim:manage', 'Manage SCIM provisioning tokens');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin' AND p.name = 'scim:manage';
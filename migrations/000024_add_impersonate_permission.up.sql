@@ -0,0 +1,4 @@
+INSERT INTO permissions (name, description) VALUES ('users:impersonate', 'Sign in as a user to debug their account');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin' AND p.name = 'users:impersonate';
@@ -0,0 +1,2 @@
+-- Access tokens carry this version, bumping it invalidates the ones issued before (e.g. on an email change)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INTEGER NOT NULL DEFAULT 0;
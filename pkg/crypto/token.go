@@ -0,0 +1,42 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// HashToken returns the hex-encoded SHA-256 digest of a random token.
+//
+// Single-use tokens (email confirmation, password reset, ...) are stored hashed
+// so a database leak doesn't hand out working links. SHA-256 is enough here
+// because the tokens are high-entropy random values, unlike passwords.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateNumericCode returns a random code of the given number of digits, with
+// leading zeros kept (e.g. "004821").
+func GenerateNumericCode(digits int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// HashCode returns the hex-encoded HMAC-SHA256 of a short code.
+//
+// Unlike random tokens, a 6-digit code can be recovered from a plain SHA-256 by
+// trying all million values. Keying the hash with a server secret means a
+// database leak alone isn't enough; context (e.g. the user ID) ties the code to its owner.
+func HashCode(secret, context, code string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(context + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -12,8 +12,10 @@
 package jwt
 
 import (
-	"fmt"  // For error formatting
-	"time" // For token expiration times
+	"crypto/rand"  // For the token ID
+	"encoding/hex" // For the token ID
+	"fmt"          // For error formatting
+	"time"         // For token expiration times
 
 	"github.com/golang-jwt/jwt/v5" // Popular JWT library for Go
 )
@@ -24,11 +26,35 @@ import (
 // RegisteredClaims are standard JWT fields (ExpiresAt, IssuedAt, etc.)
 // We embed it here so our Claims has all those fields automatically.
 type Claims struct {
-	UserID               int64  `json:"user_id"` // Custom claim: which user this token belongs to
-	Email                string `json:"email"`   // Custom claim: user's email
-	jwt.RegisteredClaims        // Embedded struct - adds ExpiresAt, IssuedAt, etc.
+	UserID               int64        `json:"user_id"`               // Custom claim: which user this token belongs to
+	Email                string       `json:"email"`                 // Custom claim: user's email
+	Roles                []string     `json:"roles,omitempty"`       // Custom claim: role names (e.g. "admin")
+	Permissions          []string     `json:"permissions,omitempty"` // Custom claim: permissions granted by those roles
+	Scope                string       `json:"scope,omitempty"`       // OAuth scopes granted to a client (space-separated)
+	ClientID             string       `json:"client_id,omitempty"`   // OAuth client the token was issued to, empty for our own sessions
+	AuthTime             *NumericDate `json:"auth_time,omitempty"`   // When the user logged in; unlike IssuedAt it survives refreshes
+	OrgID                *int64       `json:"org_id,omitempty"`      // Active organization of the session, nil outside any organization
+	OrgRole              string       `json:"org_role,omitempty"`    // The user's role in that organization
+	Act                  *Actor       `json:"act,omitempty"`         // Set when an admin impersonates the user (RFC 8693 actor claim)
+	TokenVersion         int          `json:"ver,omitempty"`         // Custom claim: the user's token version when the token was issued
+	jwt.RegisteredClaims              // Embedded struct - adds ExpiresAt, IssuedAt, etc.
 }
 
+// Actor identifies who is acting on behalf of the token's user. Sub is the
+// admin's user ID as a string, as the "act" claim requires.
+type Actor struct {
+	Subject string `json:"sub"`
+	UserID  int64  `json:"user_id"`
+	Email   string `json:"email"`
+}
+
+// RegisteredClaims and ClaimStrings are re-exported so callers can set the
+// issuer, subject and audience without importing the JWT library themselves
+type (
+	RegisteredClaims = jwt.RegisteredClaims
+	ClaimStrings     = jwt.ClaimStrings
+)
+
 // Embedding Explained:
 // jwt.RegisteredClaims has fields like ExpiresAt, IssuedAt, Issuer, etc.
 // By embedding it (no field name), Claims automatically gets all those fields.
@@ -37,26 +63,32 @@ type Claims struct {
 // GenerateAccessToken creates a short-lived JWT access token.
 //
 // Parameters:
-//   - userID: The user's unique ID (stored in the token)
-//   - email: The user's email (stored in the token)
+//   - claims: The custom claims to store in the token (user ID, email, roles, ...)
 //   - secret: Secret key used to sign the token (NEVER share this!)
 //   - expiry: How long until the token expires (e.g., 5 minutes)
 //
+// The time-based registered claims (exp, iat, nbf) are filled in here,
+// so callers only set the custom claims.
+//
 // Returns: A signed JWT string that can be verified later
 //
 // Security Note: The token is SIGNED, not ENCRYPTED.
 // Anyone can read the payload, but only we can verify it's authentic.
 // Never put sensitive data (passwords, credit cards) in JWT claims!
-func GenerateAccessToken(userID int64, email string, secret string, expiry time.Duration) (string, error) {
-	// Create the claims (payload data)
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)), // Token expires after 'expiry' duration
-			IssuedAt:  jwt.NewNumericDate(time.Now()),             // When was token created
-			NotBefore: jwt.NewNumericDate(time.Now()),             // Token not valid before this time
-		},
+func GenerateAccessToken(claims *Claims, secret string, expiry time.Duration) (string, error) {
+	// Set the expiry-related registered claims
+	now := time.Now()
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(expiry)) // Token expires after 'expiry' duration
+	claims.IssuedAt = jwt.NewNumericDate(now)              // When was token created
+	claims.NotBefore = jwt.NewNumericDate(now)             // Token not valid before this time
+
+	// A unique token ID ("jti") lets a single token be revoked before it expires
+	if claims.ID == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return "", fmt.Errorf("failed to generate token id: %w", err)
+		}
+		claims.ID = hex.EncodeToString(id)
 	}
 
 	// Create a new token with our claims
@@ -0,0 +1,131 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// NumericDate is re-exported for claims like auth_time, see RegisteredClaims
+type NumericDate = jwt.NumericDate
+
+func NewNumericDate(t time.Time) *NumericDate {
+	return jwt.NewNumericDate(t)
+}
+
+// SigningKey is an RSA key for tokens that other parties verify themselves,
+// like OpenID Connect ID tokens.
+//
+// Why not the HMAC secret?
+// - Verifying an HS256 token needs the secret, which would let the verifier forge tokens too
+// - With RS256 we keep the private key and publish only the public key (JWKS)
+type SigningKey struct {
+	KeyID   string // "kid" header, tells verifiers which published key to use
+	private *rsa.PrivateKey
+}
+
+// LoadSigningKey reads a PEM encoded RSA private key (PKCS#1 or PKCS#8)
+func LoadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return newSigningKey(key), nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an RSA key")
+	}
+	return newSigningKey(key), nil
+}
+
+// GenerateSigningKey creates a new random key. Tokens signed with it can't be
+// verified anymore once the process restarts, so it is only meant for development.
+func GenerateSigningKey() (*SigningKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return newSigningKey(key), nil
+}
+
+func newSigningKey(key *rsa.PrivateKey) *SigningKey {
+	// The key ID is derived from the public key, so it changes whenever the key does
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	sum := sha256.Sum256(der)
+	return &SigningKey{
+		KeyID:   base64.RawURLEncoding.EncodeToString(sum[:12]),
+		private: key,
+	}
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKSet is the document served at the jwks_uri
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of the key for publishing
+func (k *SigningKey) JWKS() *JWKSet {
+	public := k.private.PublicKey
+	return &JWKSet{Keys: []JWK{{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		Kid: k.KeyID,
+		N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+	}}}
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token. Issuer, Subject and
+// Audience (the client ID) are set by the caller in RegisteredClaims.
+type IDTokenClaims struct {
+	Email         string       `json:"email,omitempty"`
+	EmailVerified *bool        `json:"email_verified,omitempty"` // Pointer so that false is still sent
+	Nonce         string       `json:"nonce,omitempty"`          // Echoed from the authorization request, against replay
+	AuthTime      *NumericDate `json:"auth_time,omitempty"`      // When the user last actually logged in
+	jwt.RegisteredClaims
+}
+
+// GenerateIDToken signs an ID token with RS256. Like GenerateAccessToken it
+// fills in the time-based registered claims.
+func GenerateIDToken(claims *IDTokenClaims, key *SigningKey, expiry time.Duration) (string, error) {
+	now := time.Now()
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(expiry))
+	claims.IssuedAt = jwt.NewNumericDate(now)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.KeyID
+	return token.SignedString(key.private)
+}
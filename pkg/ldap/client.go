@@ -0,0 +1,155 @@
+// Package ldap authenticates users against an LDAP directory (OpenLDAP, Active Directory).
+//
+// Authentication is search-then-bind: the service account (or an anonymous bind)
+// searches the base DN for the one entry matching the login, then that entry's DN
+// is bound with the user's password. The password is never compared by us.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrUserNotFound       = errors.New("no directory entry matches the login")
+	ErrInvalidCredentials = errors.New("directory rejected the credentials")
+)
+
+type Config struct {
+	URL      string // ldap://host:389 or ldaps://host:636
+	StartTLS bool   // Upgrade an ldap:// connection before binding
+
+	// Service account that searches the directory, anonymous search when empty
+	BindDN       string
+	BindPassword string
+
+	BaseDN     string
+	UserFilter string // e.g. "(&(objectClass=person)(mail=%s))", %s is the escaped login
+
+	// Attribute mapping of directory entries onto users
+	EmailAttribute       string
+	DisplayNameAttribute string
+
+	Timeout time.Duration
+}
+
+// Entry is the directory entry a login belongs to
+type Entry struct {
+	DN          string
+	Email       string
+	DisplayName string
+}
+
+type Client struct {
+	cfg Config
+}
+
+func NewClient(cfg Config) *Client {
+	return &Client{cfg: cfg}
+}
+
+// Authenticate finds the entry matching login and binds as it with password
+func (c *Client) Authenticate(ctx context.Context, login, password string) (*Entry, error) {
+	// An empty password is an unauthenticated bind (RFC 4513), which most servers accept
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Abort pending operations when the request goes away
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	entry, err := c.find(conn, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to bind as user: %w", err)
+	}
+	return entry, nil
+}
+
+func (c *Client) dial() (*goldap.Conn, error) {
+	u, err := url.Parse(c.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ldap url: %w", err)
+	}
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+
+	conn, err := goldap.DialURL(c.cfg.URL,
+		goldap.DialWithDialer(&net.Dialer{Timeout: c.cfg.Timeout}),
+		goldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap: %w", err)
+	}
+	conn.SetTimeout(c.cfg.Timeout)
+
+	if c.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// find searches the entry of a login with the service account
+func (c *Client) find(conn *goldap.Conn, login string) (*Entry, error) {
+	var err error
+	if c.cfg.BindDN != "" {
+		err = conn.Bind(c.cfg.BindDN, c.cfg.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind service account: %w", err)
+	}
+
+	attributes := []string{c.cfg.EmailAttribute}
+	if c.cfg.DisplayNameAttribute != "" {
+		attributes = append(attributes, c.cfg.DisplayNameAttribute)
+	}
+	filter := strings.ReplaceAll(c.cfg.UserFilter, "%s", goldap.EscapeFilter(login))
+
+	// Two results are enough to tell the login is ambiguous
+	result, err := conn.Search(goldap.NewSearchRequest(
+		c.cfg.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		2, int(c.cfg.Timeout.Seconds()), false, filter, attributes, nil,
+	))
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("failed to search directory: %w", err)
+	}
+
+	switch {
+	case result == nil || len(result.Entries) == 0:
+		return nil, ErrUserNotFound
+	case len(result.Entries) > 1:
+		return nil, fmt.Errorf("login %q matches several directory entries", login)
+	}
+
+	entry := result.Entries[0]
+	return &Entry{
+		DN:          entry.DN,
+		Email:       entry.GetAttributeValue(c.cfg.EmailAttribute),
+		DisplayName: entry.GetAttributeValue(c.cfg.DisplayNameAttribute),
+	}, nil
+}
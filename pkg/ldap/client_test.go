@@ -0,0 +1,173 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/login_flow/auth-service/pkg/ldap/ldaptest"
+)
+
+var (
+	jane = &ldaptest.Entry{
+		DN:       "uid=jane,ou=people,dc=example,dc=com",
+		Password: "jane-secret",
+		Attributes: map[string][]string{
+			"objectClass":       {"person"},
+			"mail":              {"jane@example.com"},
+			"userPrincipalName": {"jdoe@corp.example.com"},
+			"cn":                {"Jane Doe"},
+		},
+	}
+	// Two entries share this email, e.g. a person and a shared mailbox
+	sam1 = &ldaptest.Entry{
+		DN:         "uid=sam,ou=people,dc=example,dc=com",
+		Password:   "sam-secret",
+		Attributes: map[string][]string{"objectClass": {"person"}, "mail": {"sam@example.com"}},
+	}
+	sam2 = &ldaptest.Entry{
+		DN:         "uid=sam.admin,ou=people,dc=example,dc=com",
+		Password:   "sam-admin-secret",
+		Attributes: map[string][]string{"objectClass": {"person"}, "mail": {"sam@example.com"}},
+	}
+)
+
+func newTestClient(t *testing.T) (*Client, *ldaptest.Directory) {
+	t.Helper()
+	directory := ldaptest.Start(t, jane, sam1, sam2)
+	return NewClient(Config{
+		URL:                  directory.URL,
+		BindDN:               directory.BindDN,
+		BindPassword:         directory.BindPassword,
+		BaseDN:               "ou=people,dc=example,dc=com",
+		UserFilter:           "(&(objectClass=person)(mail=%s))",
+		EmailAttribute:       "mail",
+		DisplayNameAttribute: "cn",
+		Timeout:              5 * time.Second,
+	}), directory
+}
+
+func TestAuthenticate(t *testing.T) {
+	client, directory := newTestClient(t)
+
+	entry, err := client.Authenticate(context.Background(), "jane@example.com", "jane-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if entry.DN != jane.DN || entry.Email != "jane@example.com" || entry.DisplayName != "Jane Doe" {
+		t.Errorf("entry = %+v, want %s with its email and display name", entry, jane.DN)
+	}
+
+	// Search-then-bind: the service account finds the entry, then the entry is bound
+	if binds := directory.Binds(); !slices.Equal(binds, []string{directory.BindDN, jane.DN}) {
+		t.Errorf("binds = %v, want the service account then %s", binds, jane.DN)
+	}
+}
+
+func TestAuthenticateWithAnotherLoginAttribute(t *testing.T) {
+	client, _ := newTestClient(t)
+	client.cfg.UserFilter = "(&(objectClass=person)(userPrincipalName=%s))"
+
+	entry, err := client.Authenticate(context.Background(), "jdoe@corp.example.com", "jane-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	// The email attribute is reported, not the login
+	if entry.Email != "jane@example.com" {
+		t.Errorf("email = %q, want %q", entry.Email, "jane@example.com")
+	}
+}
+
+func TestAuthenticateRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		want     error // nil: any error but ErrUserNotFound and ErrInvalidCredentials
+	}{
+		{name: "wrong password", login: "jane@example.com", password: "wrong", want: ErrInvalidCredentials},
+		{name: "unknown login", login: "nobody@example.com", password: "secret", want: ErrUserNotFound},
+		{name: "wildcard login is escaped", login: "*", password: "jane-secret", want: ErrUserNotFound},
+		{name: "filter injection is escaped", login: "jane@example.com)(mail=*", password: "jane-secret", want: ErrUserNotFound},
+		{name: "ambiguous login", login: "sam@example.com", password: "sam-secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, directory := newTestClient(t)
+
+			entry, err := client.Authenticate(context.Background(), tt.login, tt.password)
+			if entry != nil {
+				t.Errorf("entry = %+v, want none", entry)
+			}
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("Authenticate error = %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err == nil || errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("Authenticate error = %v, want a directory error", err)
+			}
+			// None of the matching entries may be tried with the password
+			if binds := directory.Binds(); !slices.Equal(binds, []string{directory.BindDN}) {
+				t.Errorf("binds = %v, want only the service account", binds)
+			}
+		})
+	}
+}
+
+// An empty password is an unauthenticated bind, which servers accept for any DN
+func TestAuthenticateRejectsEmptyPassword(t *testing.T) {
+	client, directory := newTestClient(t)
+
+	_, err := client.Authenticate(context.Background(), "jane@example.com", "")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate error = %v, want ErrInvalidCredentials", err)
+	}
+	if binds := directory.Binds(); len(binds) != 0 {
+		t.Errorf("binds = %v, want none", binds)
+	}
+}
+
+// Directory errors must not look like an unknown user, or the next authenticator
+// would answer for the directory's users
+func TestAuthenticateFailsClosed(t *testing.T) {
+	t.Run("search fails", func(t *testing.T) {
+		client, directory := newTestClient(t)
+		directory.FailSearches(52) // Unavailable
+
+		_, err := client.Authenticate(context.Background(), "jane@example.com", "jane-secret")
+		if err == nil || errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Authenticate error = %v, want a directory error", err)
+		}
+	})
+
+	t.Run("service account rejected", func(t *testing.T) {
+		client, _ := newTestClient(t)
+		client.cfg.BindPassword = "rotated"
+
+		_, err := client.Authenticate(context.Background(), "jane@example.com", "jane-secret")
+		if err == nil || errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Authenticate error = %v, want a directory error", err)
+		}
+	})
+
+	t.Run("directory unreachable", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen: %v", err)
+		}
+		addr := listener.Addr().String()
+		listener.Close()
+
+		client := NewClient(Config{URL: "ldap://" + addr, BaseDN: "dc=example,dc=com", UserFilter: "(mail=%s)", EmailAttribute: "mail", Timeout: time.Second})
+		_, err = client.Authenticate(context.Background(), "jane@example.com", "jane-secret")
+		if err == nil || errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Authenticate error = %v, want a connection error", err)
+		}
+	})
+}
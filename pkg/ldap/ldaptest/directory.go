@@ -0,0 +1,201 @@
+// Package ldaptest is an in-process LDAP directory for tests of the ldap client. It
+// answers simple binds and searches over plain ldap:// on a local port.
+package ldaptest
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jimlambrt/gldap"
+)
+
+// Entry is a directory entry. Binding as DN succeeds with Password.
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Directory reads a search filter as the conjunction of its "(attr=value)" terms, which
+// is enough for filters like "(&(objectClass=person)(mail=%s))". Values compare
+// case-insensitively and unescaped "*" are wildcards, like on a real server, so a login
+// that isn't escaped matches entries it shouldn't.
+type Directory struct {
+	URL          string
+	BindDN       string // Service account, anonymous binds are rejected
+	BindPassword string
+
+	mu         sync.Mutex
+	entries    []*Entry
+	binds      []string
+	searchCode int
+}
+
+// Start runs a directory until the test ends
+func Start(t testing.TB, entries ...*Entry) *Directory {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ldaptest: failed to find a free port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	d := &Directory{
+		URL:          "ldap://" + addr,
+		BindDN:       "cn=service,dc=example,dc=com",
+		BindPassword: "service-secret",
+		entries:      entries,
+	}
+
+	server, err := gldap.NewServer()
+	if err != nil {
+		t.Fatalf("ldaptest: %v", err)
+	}
+	mux, err := gldap.NewMux()
+	if err != nil {
+		t.Fatalf("ldaptest: %v", err)
+	}
+	mux.Bind(d.handleBind)
+	mux.Search(d.handleSearch)
+	server.Router(mux)
+
+	go server.Run(addr)
+	t.Cleanup(func() { server.Stop() })
+
+	for deadline := time.Now().Add(5 * time.Second); !server.Ready(); {
+		if time.Now().After(deadline) {
+			t.Fatal("ldaptest: server didn't start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return d
+}
+
+// Binds returns the DNs bound so far, in order
+func (d *Directory) Binds() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.binds...)
+}
+
+// FailSearches makes every search end with the LDAP result code, e.g. 52 (unavailable).
+// 0 lets searches succeed again.
+func (d *Directory) FailSearches(code int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.searchCode = code
+}
+
+func (d *Directory) handleBind(w *gldap.ResponseWriter, r *gldap.Request) {
+	resp := r.NewBindResponse(gldap.WithResponseCode(gldap.ResultInvalidCredentials))
+	defer w.Write(resp)
+
+	m, err := r.GetSimpleBindMessage()
+	if err != nil || m.Password == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.binds = append(d.binds, m.UserName)
+
+	if m.UserName == d.BindDN && string(m.Password) == d.BindPassword {
+		resp.SetResultCode(gldap.ResultSuccess)
+		return
+	}
+	for _, entry := range d.entries {
+		if strings.EqualFold(entry.DN, m.UserName) && string(m.Password) == entry.Password {
+			resp.SetResultCode(gldap.ResultSuccess)
+			return
+		}
+	}
+}
+
+func (d *Directory) handleSearch(w *gldap.ResponseWriter, r *gldap.Request) {
+	resp := r.NewSearchDoneResponse(gldap.WithResponseCode(gldap.ResultSuccess))
+	defer w.Write(resp)
+
+	m, err := r.GetSearchMessage()
+	if err != nil {
+		resp.SetResultCode(gldap.ResultProtocolError)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.searchCode != 0 {
+		resp.SetResultCode(d.searchCode)
+		return
+	}
+
+	for _, entry := range d.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.DN), strings.ToLower(m.BaseDN)) || !matches(entry, m.Filter) {
+			continue
+		}
+		attributes := make(map[string][]string)
+		for _, name := range m.Attributes {
+			if values, ok := entry.Attributes[name]; ok {
+				attributes[name] = values
+			}
+		}
+		w.Write(r.NewSearchResponseEntry(entry.DN, gldap.WithAttributes(attributes)))
+	}
+}
+
+var equalityTerm = regexp.MustCompile(`\(([^()=&|!]+)=([^()]*)\)`)
+
+func matches(entry *Entry, filter string) bool {
+	terms := equalityTerm.FindAllStringSubmatch(filter, -1)
+	if len(terms) == 0 {
+		return false
+	}
+	for _, term := range terms {
+		if !hasValue(entry, term[1], term[2]) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasValue(entry *Entry, name, pattern string) bool {
+	// Literal parts between the wildcards, each still escaped
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(unescape(part))
+	}
+	re := regexp.MustCompile("(?is)^" + strings.Join(parts, ".*") + "$")
+
+	for attribute, values := range entry.Attributes {
+		if !strings.EqualFold(attribute, name) {
+			continue
+		}
+		for _, value := range values {
+			if re.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unescape decodes the \XX escapes of a filter value
+func unescape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+2 < len(value) {
+			if n, err := strconv.ParseUint(value[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,204 @@
+// Package oauth is a client for "Sign in with ..." providers.
+//
+// OpenID Connect providers (Google, Microsoft, any issuer with discovery) are
+// configured with an Issuer: endpoints and signing keys are discovered, and the
+// ID token is verified including its nonce. Plain OAuth2 providers (GitHub) are
+// configured with explicit endpoints and identify the user via a userinfo URL.
+// Every flow uses the authorization code grant with PKCE (S256).
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrNonceMismatch = errors.New("id token nonce mismatch")
+	ErrMissingClaims = errors.New("provider did not return a subject")
+)
+
+type Config struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// OIDC providers: endpoints are discovered from the issuer
+	Issuer string
+
+	// Plain OAuth2 providers
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	EmailsURL   string // Optional GitHub-style list of {email, primary, verified}
+}
+
+// Identity is the user as reported by the provider
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type Provider struct {
+	cfg      Config
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewProvider builds a provider, fetching the discovery document for OIDC issuers
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	p := &Provider{
+		cfg: cfg,
+		oauth2: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+			Endpoint:     oauth2.Endpoint{AuthURL: cfg.AuthURL, TokenURL: cfg.TokenURL},
+		},
+	}
+
+	if cfg.Issuer != "" {
+		provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover %s: %w", cfg.Name, err)
+		}
+		p.oauth2.Endpoint = provider.Endpoint()
+		p.verifier = provider.Verifier(&oidc.Config{ClientID: cfg.ClientID})
+	}
+
+	return p, nil
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the provider's consent page URL. The verifier is the PKCE
+// code verifier from oauth2.GenerateVerifier, only its S256 challenge is sent.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}
+	if p.verifier != nil {
+		opts = append(opts, oidc.Nonce(nonce))
+	}
+	return p.oauth2.AuthCodeURL(state, opts...)
+}
+
+// Exchange redeems the authorization code and returns the verified identity
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	if p.verifier != nil {
+		return p.identityFromIDToken(ctx, token, nonce)
+	}
+	return p.identityFromUserInfo(ctx, token)
+}
+
+func (p *Provider) identityFromIDToken(ctx context.Context, token *oauth2.Token, nonce string) (*Identity, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode id token claims: %w", err)
+	}
+
+	return &Identity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+func (p *Provider) identityFromUserInfo(ctx context.Context, token *oauth2.Token) (*Identity, error) {
+	client := p.oauth2.Client(ctx, token)
+
+	var info struct {
+		Sub           string      `json:"sub"`
+		ID            json.Number `json:"id"` // GitHub uses a numeric id instead of sub
+		Email         string      `json:"email"`
+		EmailVerified bool        `json:"email_verified"`
+		Name          string      `json:"name"`
+	}
+	if err := getJSON(client, p.cfg.UserInfoURL, &info); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Subject:       info.Sub,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		Name:          info.Name,
+	}
+	if identity.Subject == "" {
+		identity.Subject = info.ID.String()
+	}
+	if identity.Subject == "" {
+		return nil, ErrMissingClaims
+	}
+
+	// The profile email isn't necessarily verified, the emails endpoint says which are
+	if p.cfg.EmailsURL != "" {
+		var emails []struct {
+			Email    string `json:"email"`
+			Primary  bool   `json:"primary"`
+			Verified bool   `json:"verified"`
+		}
+		if err := getJSON(client, p.cfg.EmailsURL, &emails); err != nil {
+			return nil, err
+		}
+		identity.Email, identity.EmailVerified = "", false
+		for _, e := range emails {
+			if e.Primary {
+				identity.Email, identity.EmailVerified = e.Email, e.Verified
+			}
+		}
+	}
+
+	return identity, nil
+}
+
+func getJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to fetch %s: status %d: %s", url, resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+// Package saml is the service provider side of SAML 2.0 single sign-on.
+//
+// It wraps github.com/crewjam/saml: a ServiceProvider is built for one identity
+// provider from its metadata, sends AuthnRequests with the HTTP-Redirect binding and
+// accepts responses with the HTTP-POST binding. Parsing a response verifies the XML
+// signature against the certificates in the IdP metadata and checks the issuer,
+// audience, recipient, InResponseTo and validity window. Replay of a valid assertion
+// is not detected here, callers must remember Assertion.ID until Assertion.ExpiresAt.
+package saml
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	crewjam "github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+var (
+	ErrInvalidMetadata = errors.New("invalid identity provider metadata")
+	ErrInvalidResponse = errors.New("invalid saml response")
+)
+
+// maxMetadataSize bounds metadata fetched from an IdP URL
+const maxMetadataSize = 1 << 20
+
+// KeyPair is the SP key and certificate. The key signs AuthnRequests and decrypts
+// encrypted assertions, the certificate is published in the SP metadata.
+type KeyPair struct {
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+// LoadKeyPair reads a PEM certificate and its PEM RSA private key (PKCS#1 or PKCS#8)
+func LoadKeyPair(certFile, keyFile string) (*KeyPair, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saml certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saml key: %w", err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, errors.New("saml certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse saml certificate: %w", err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, errors.New("saml key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes); err == nil {
+		return &KeyPair{Key: key, Certificate: cert}, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse saml key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("saml key is not an RSA key")
+	}
+	return &KeyPair{Key: key, Certificate: cert}, nil
+}
+
+// GenerateKeyPair creates a key with a self-signed certificate. IdPs pin the SP
+// certificate from our metadata, so this is only meant for development.
+func GenerateKeyPair(commonName string) (*KeyPair, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate saml key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate serial: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create saml certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse saml certificate: %w", err)
+	}
+	return &KeyPair{Key: key, Certificate: cert}, nil
+}
+
+// ParseIdPMetadata checks that the metadata describes an identity provider we can use
+// (an SSO endpoint with the HTTP-Redirect binding) and returns its entity ID
+func ParseIdPMetadata(data []byte) (string, error) {
+	entity, err := samlsp.ParseMetadata(data)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+	}
+	if entity.EntityID == "" || len(entity.IDPSSODescriptors) == 0 {
+		return "", fmt.Errorf("%w: no identity provider descriptor", ErrInvalidMetadata)
+	}
+
+	sp := &crewjam.ServiceProvider{IDPMetadata: entity}
+	if sp.GetSSOBindingLocation(crewjam.HTTPRedirectBinding) == "" {
+		return "", fmt.Errorf("%w: no SSO endpoint with the HTTP-Redirect binding", ErrInvalidMetadata)
+	}
+	return entity.EntityID, nil
+}
+
+// FetchMetadata downloads IdP metadata, to import it from the URL most IdPs publish
+func FetchMetadata(ctx context.Context, client *http.Client, metadataURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch metadata: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch metadata: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	return data, nil
+}
+
+type Config struct {
+	EntityID    string // SP entity ID, by convention the URL of the SP metadata
+	ACSURL      string // Assertion consumer service, receives the HTTP-POST response
+	IdPMetadata []byte
+	Keys        *KeyPair
+}
+
+// Assertion is the authenticated user as reported by the identity provider
+type Assertion struct {
+	ID           string
+	NameID       string
+	NameIDFormat string
+	Attributes   map[string][]string // By attribute name and by friendly name
+	SessionIndex string
+	ExpiresAt    time.Time // After this the assertion is rejected anyway, so it can't be replayed
+}
+
+// Attribute returns the first value of the named attribute, empty if it is missing
+func (a *Assertion) Attribute(name string) string {
+	if values := a.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+type ServiceProvider struct {
+	sp *crewjam.ServiceProvider
+}
+
+func NewServiceProvider(cfg Config) (*ServiceProvider, error) {
+	entity, err := samlsp.ParseMetadata(cfg.IdPMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+	}
+	metadataURL, err := url.Parse(cfg.EntityID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid saml entity id: %w", err)
+	}
+	acsURL, err := url.Parse(cfg.ACSURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid saml acs url: %w", err)
+	}
+
+	return &ServiceProvider{sp: &crewjam.ServiceProvider{
+		EntityID:          cfg.EntityID,
+		Key:               cfg.Keys.Key,
+		Certificate:       cfg.Keys.Certificate,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       entity,
+		AuthnNameIDFormat: crewjam.UnspecifiedNameIDFormat,
+		SignatureMethod:   dsig.RSASHA256SignatureMethod,
+		HTTPClient:        &http.Client{Timeout: 10 * time.Second},
+	}}, nil
+}
+
+// Metadata returns the SP metadata XML to register this SP at the identity provider
+func (p *ServiceProvider) Metadata() ([]byte, error) {
+	data, err := xml.MarshalIndent(p.sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal saml metadata: %w", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// AuthnRequestURL returns the IdP URL carrying a signed AuthnRequest, and the request ID
+// the response has to answer
+func (p *ServiceProvider) AuthnRequestURL(relayState string) (string, string, error) {
+	location := p.sp.GetSSOBindingLocation(crewjam.HTTPRedirectBinding)
+	req, err := p.sp.MakeAuthenticationRequest(location, crewjam.HTTPRedirectBinding, crewjam.HTTPPostBinding)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create authn request: %w", err)
+	}
+	redirect, err := req.Redirect(relayState, p.sp)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode authn request: %w", err)
+	}
+	return redirect.String(), req.ID, nil
+}
+
+// ParseResponse validates the base64 SAMLResponse form value of the HTTP-POST binding.
+// The response must answer requestID, IdP-initiated logins are not accepted.
+func (p *ServiceProvider) ParseResponse(samlResponse, requestID string) (*Assertion, error) {
+	raw, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	assertion, err := p.sp.ParseXMLResponse(raw, []string{requestID})
+	if err != nil {
+		// InvalidResponseError hides the reason from Error(), keep it for our logs
+		var invalid *crewjam.InvalidResponseError
+		if errors.As(err, &invalid) && invalid.PrivateErr != nil {
+			err = invalid.PrivateErr
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	return newAssertion(assertion), nil
+}
+
+func newAssertion(assertion *crewjam.Assertion) *Assertion {
+	result := &Assertion{
+		ID:         assertion.ID,
+		Attributes: make(map[string][]string),
+		ExpiresAt:  assertion.IssueInstant.Add(crewjam.MaxIssueDelay),
+	}
+	if assertion.Conditions != nil && assertion.Conditions.NotOnOrAfter.After(result.ExpiresAt) {
+		result.ExpiresAt = assertion.Conditions.NotOnOrAfter
+	}
+	result.ExpiresAt = result.ExpiresAt.Add(crewjam.MaxClockSkew)
+
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		result.NameID = assertion.Subject.NameID.Value
+		result.NameIDFormat = assertion.Subject.NameID.Format
+	}
+	for _, statement := range assertion.AuthnStatements {
+		if statement.SessionIndex != "" {
+			result.SessionIndex = statement.SessionIndex
+			break
+		}
+	}
+
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			var values []string
+			for _, value := range attribute.Values {
+				values = append(values, value.Value)
+			}
+			result.Attributes[attribute.Name] = append(result.Attributes[attribute.Name], values...)
+			if attribute.FriendlyName != "" && attribute.FriendlyName != attribute.Name {
+				result.Attributes[attribute.FriendlyName] = append(result.Attributes[attribute.FriendlyName], values...)
+			}
+		}
+	}
+	return result
+}
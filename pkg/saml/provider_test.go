@@ -0,0 +1,192 @@
+package saml
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/login_flow/auth-service/pkg/saml/samltest"
+)
+
+const (
+	testIdPEntityID = "https://idp.example.com/metadata"
+	testSPEntityID  = "https://sp.example.com/saml/acme/metadata"
+	testACSURL      = "https://sp.example.com/saml/acme/acs"
+	testRequestID   = "id-request"
+)
+
+func newTestProvider(t *testing.T) (*ServiceProvider, *samltest.IdP) {
+	t.Helper()
+	idp, err := samltest.NewIdP(testIdPEntityID)
+	if err != nil {
+		t.Fatalf("NewIdP: %v", err)
+	}
+	metadata, err := idp.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata: %v", err)
+	}
+	keys, err := GenerateKeyPair("sp.example.com")
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+
+	sp, err := NewServiceProvider(Config{EntityID: testSPEntityID, ACSURL: testACSURL, IdPMetadata: metadata, Keys: keys})
+	if err != nil {
+		t.Fatalf("NewServiceProvider: %v", err)
+	}
+	return sp, idp
+}
+
+func testResponse(t *testing.T, idp *samltest.IdP, modify func(*samltest.Response)) string {
+	t.Helper()
+	r := samltest.Response{
+		SPEntityID:   testSPEntityID,
+		ACSURL:       testACSURL,
+		InResponseTo: testRequestID,
+		NameID:       "00u1abcd",
+		NameIDFormat: "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+		Attributes:   map[string]string{"email": "jane@acme.com"},
+	}
+	if modify != nil {
+		modify(&r)
+	}
+	response, err := idp.Response(r)
+	if err != nil {
+		t.Fatalf("Response: %v", err)
+	}
+	return response
+}
+
+func TestParseResponse(t *testing.T) {
+	sp, idp := newTestProvider(t)
+
+	assertion, err := sp.ParseResponse(testResponse(t, idp, nil), testRequestID)
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if assertion.ID == "" {
+		t.Error("assertion ID is empty")
+	}
+	if assertion.NameID != "00u1abcd" {
+		t.Errorf("NameID = %q, want %q", assertion.NameID, "00u1abcd")
+	}
+	if got := assertion.Attribute("email"); got != "jane@acme.com" {
+		t.Errorf("email attribute = %q, want %q", got, "jane@acme.com")
+	}
+	if !assertion.ExpiresAt.After(time.Now()) {
+		t.Errorf("ExpiresAt = %v, want a time in the future", assertion.ExpiresAt)
+	}
+}
+
+func TestParseResponseRejects(t *testing.T) {
+	sp, idp := newTestProvider(t)
+
+	// Same entity ID as the trusted IdP, but not its key
+	forger, err := samltest.NewIdP(testIdPEntityID)
+	if err != nil {
+		t.Fatalf("NewIdP: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		response  func() string
+		requestID string
+	}{
+		{
+			name:     "signed by another key",
+			response: func() string { return testResponse(t, forger, nil) },
+		},
+		{
+			name: "tampered after signing",
+			response: func() string {
+				raw, _ := base64.StdEncoding.DecodeString(testResponse(t, idp, nil))
+				tampered := strings.ReplaceAll(string(raw), "jane@acme.com", "ceo@acme.com")
+				return base64.StdEncoding.EncodeToString([]byte(tampered))
+			},
+		},
+		{
+			name: "wrong audience",
+			response: func() string {
+				return testResponse(t, idp, func(r *samltest.Response) { r.Audience = "https://other.example.com/metadata" })
+			},
+		},
+		{
+			name: "expired",
+			response: func() string {
+				return testResponse(t, idp, func(r *samltest.Response) { r.IssuedAt = time.Now().Add(-time.Hour) })
+			},
+		},
+		{
+			name:      "answers another request",
+			response:  func() string { return testResponse(t, idp, nil) },
+			requestID: "id-other-request",
+		},
+		{
+			name: "unsolicited",
+			response: func() string {
+				return testResponse(t, idp, func(r *samltest.Response) { r.InResponseTo = "" })
+			},
+		},
+		{
+			name:     "not base64",
+			response: func() string { return "not base64!" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestID := tt.requestID
+			if requestID == "" {
+				requestID = testRequestID
+			}
+
+			_, err := sp.ParseResponse(tt.response(), requestID)
+			if !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("ParseResponse error = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+}
+
+// Replay is left to the caller, who remembers Assertion.ID until Assertion.ExpiresAt
+func TestParseResponseReplayKeepsAssertionID(t *testing.T) {
+	sp, idp := newTestProvider(t)
+	response := testResponse(t, idp, nil)
+
+	first, err := sp.ParseResponse(response, testRequestID)
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	second, err := sp.ParseResponse(response, testRequestID)
+	if err != nil {
+		t.Fatalf("ParseResponse again: %v", err)
+	}
+	if first.ID != second.ID {
+		t.Errorf("assertion IDs differ: %q and %q", first.ID, second.ID)
+	}
+}
+
+func TestParseIdPMetadata(t *testing.T) {
+	idp, err := samltest.NewIdP(testIdPEntityID)
+	if err != nil {
+		t.Fatalf("NewIdP: %v", err)
+	}
+	metadata, err := idp.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata: %v", err)
+	}
+
+	entityID, err := ParseIdPMetadata(metadata)
+	if err != nil {
+		t.Fatalf("ParseIdPMetadata: %v", err)
+	}
+	if entityID != testIdPEntityID {
+		t.Errorf("entity ID = %q, want %q", entityID, testIdPEntityID)
+	}
+
+	if _, err := ParseIdPMetadata([]byte("<EntityDescriptor/>")); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("ParseIdPMetadata of empty metadata error = %v, want ErrInvalidMetadata", err)
+	}
+}
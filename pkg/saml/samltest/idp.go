@@ -0,0 +1,156 @@
+// Package samltest is an identity provider for tests of SAML service providers. It
+// publishes metadata and signs responses with its own key, like a real IdP would.
+package samltest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/beevik/etree"
+	crewjam "github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// IdP signs responses as the identity provider EntityID. Two IdPs with the same
+// entity ID but different keys can be used to forge a signature.
+type IdP struct {
+	EntityID    string
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+func NewIdP(entityID string) (*IdP, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: entityID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &IdP{EntityID: entityID, Key: key, Certificate: cert}, nil
+}
+
+// Metadata returns the IdP metadata XML a service provider imports
+func (idp *IdP) Metadata() ([]byte, error) {
+	provider, err := idp.provider()
+	if err != nil {
+		return nil, err
+	}
+	return xml.Marshal(provider.Metadata())
+}
+
+// Response is the login an IdP answers an AuthnRequest with
+type Response struct {
+	SPEntityID   string
+	ACSURL       string
+	InResponseTo string // AuthnRequest ID, empty for an unsolicited response
+
+	NameID       string
+	NameIDFormat string // Transient when empty
+	Attributes   map[string]string
+
+	Audience string    // Defaults to SPEntityID
+	IssuedAt time.Time // Defaults to now
+}
+
+// Response returns the base64 SAMLResponse form value of the HTTP-POST binding, with
+// the response and the assertion signed
+func (idp *IdP) Response(r Response) (string, error) {
+	provider, err := idp.provider()
+	if err != nil {
+		return "", err
+	}
+	issuedAt := r.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = time.Now()
+	}
+
+	// The SP descriptor has no keys, so the assertion isn't encrypted and tests can
+	// tamper with it
+	req := &crewjam.IdpAuthnRequest{
+		IDP:                     provider,
+		HTTPRequest:             &http.Request{RemoteAddr: "192.0.2.1:49152"},
+		Request:                 crewjam.AuthnRequest{ID: r.InResponseTo, IssueInstant: issuedAt},
+		ServiceProviderMetadata: &crewjam.EntityDescriptor{EntityID: r.SPEntityID},
+		SPSSODescriptor:         &crewjam.SPSSODescriptor{},
+		ACSEndpoint:             &crewjam.IndexedEndpoint{Binding: crewjam.HTTPPostBinding, Location: r.ACSURL},
+		Now:                     issuedAt,
+	}
+
+	session := &crewjam.Session{
+		ID:           "session",
+		CreateTime:   issuedAt,
+		Index:        "session-index",
+		NameID:       r.NameID,
+		NameIDFormat: r.NameIDFormat,
+	}
+	names := make([]string, 0, len(r.Attributes))
+	for name := range r.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		session.CustomAttributes = append(session.CustomAttributes, crewjam.Attribute{
+			Name:       name,
+			NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+			Values:     []crewjam.AttributeValue{{Type: "xs:string", Value: r.Attributes[name]}},
+		})
+	}
+
+	if err := (crewjam.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		return "", fmt.Errorf("failed to make assertion: %w", err)
+	}
+	req.Assertion.IssueInstant = issuedAt
+	if r.Audience != "" {
+		req.Assertion.Conditions.AudienceRestrictions[0].Audience.Value = r.Audience
+	}
+
+	if err := req.MakeResponse(); err != nil {
+		return "", fmt.Errorf("failed to make response: %w", err)
+	}
+	doc := etree.NewDocument()
+	doc.SetRoot(req.ResponseEl)
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (idp *IdP) provider() (*crewjam.IdentityProvider, error) {
+	metadataURL, err := url.Parse(idp.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	ssoURL := *metadataURL
+	ssoURL.Path += "/sso"
+	return &crewjam.IdentityProvider{
+		Key:             idp.Key,
+		Certificate:     idp.Certificate,
+		MetadataURL:     *metadataURL,
+		SSOURL:          ssoURL,
+		SignatureMethod: dsig.RSASHA256SignatureMethod,
+	}, nil
+}
@@ -0,0 +1,137 @@
+package scim
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Comparison is one "attribute operator value" expression of a filter
+type Comparison struct {
+	Attribute string      // Lower case, without the core schema URN, e.g. "username", "emails.value"
+	Operator  string      // Lower case: eq, ne, co, sw, ew, gt, ge, lt, le or pr
+	Value     interface{} // string, bool, float64 or nil; nil for pr
+}
+
+var (
+	attributePattern = regexp.MustCompile(`^[A-Za-z][\w$.:-]*$`)
+	operators        = []string{"eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le"}
+)
+
+// ParseFilter parses a filter made of comparisons joined with "and", which covers what
+// identity providers send (e.g. `userName eq "jane@example.com"`). "or", "not" and
+// grouping are rejected with an invalidFilter error.
+func ParseFilter(filter string) ([]Comparison, error) {
+	var comparisons []Comparison
+	rest := strings.TrimSpace(filter)
+	for {
+		comparison, remaining, err := parseComparison(rest)
+		if err != nil {
+			return nil, err
+		}
+		comparisons = append(comparisons, comparison)
+
+		remaining = strings.TrimSpace(remaining)
+		if remaining == "" {
+			return comparisons, nil
+		}
+		word, after := nextWord(remaining)
+		if !strings.EqualFold(word, "and") {
+			return nil, Errorf(InvalidFilter, `only comparisons joined with "and" are supported`)
+		}
+		rest = strings.TrimSpace(after)
+	}
+}
+
+func parseComparison(s string) (Comparison, string, error) {
+	attribute, rest := nextWord(s)
+	if !attributePattern.MatchString(attribute) {
+		return Comparison{}, "", Errorf(InvalidFilter, "invalid attribute %q in filter", attribute)
+	}
+	operator, rest := nextWord(strings.TrimSpace(rest))
+	operator = strings.ToLower(operator)
+
+	comparison := Comparison{Attribute: attributePath(attribute), Operator: operator}
+	if operator == "pr" {
+		return comparison, rest, nil
+	}
+	if !slices.Contains(operators, operator) {
+		return Comparison{}, "", Errorf(InvalidFilter, "invalid operator %q in filter", operator)
+	}
+
+	value, rest, err := parseValue(strings.TrimSpace(rest))
+	if err != nil {
+		return Comparison{}, "", err
+	}
+	comparison.Value = value
+	return comparison, rest, nil
+}
+
+// parseValue reads a JSON string, true, false, null or a number
+func parseValue(s string) (interface{}, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				var value string
+				if err := json.Unmarshal([]byte(s[:i+1]), &value); err != nil {
+					return nil, "", Errorf(InvalidFilter, "invalid string in filter")
+				}
+				return value, s[i+1:], nil
+			}
+		}
+		return nil, "", Errorf(InvalidFilter, "unterminated string in filter")
+	}
+
+	word, rest := nextWord(s)
+	switch strings.ToLower(word) {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	case "null":
+		return nil, rest, nil
+	}
+	number, err := strconv.ParseFloat(word, 64)
+	if err != nil {
+		return nil, "", Errorf(InvalidFilter, "invalid value %q in filter", word)
+	}
+	return number, rest, nil
+}
+
+func nextWord(s string) (word, rest string) {
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+// attributePath normalizes an attribute path for matching: names are case-insensitive
+// and may be prefixed with the core schema URN. Value filters in brackets, as in
+// `emails[type eq "work"].value`, keep their case.
+func attributePath(path string) string {
+	path = strings.TrimSpace(path)
+	lower := strings.ToLower(path)
+	for _, schema := range []string{SchemaUser, SchemaGroup} {
+		if prefix := strings.ToLower(schema) + ":"; strings.HasPrefix(lower, prefix) {
+			path = path[len(prefix):]
+			break
+		}
+	}
+
+	open, end := strings.IndexByte(path, '['), strings.LastIndexByte(path, ']')
+	if open < 0 || end < open {
+		return strings.ToLower(path)
+	}
+	return strings.ToLower(path[:open]) + path[open:end+1] + strings.ToLower(path[end+1:])
+}
+
+// isExtension tells whether a normalized path belongs to a schema extension, e.g. the
+// enterprise user attributes, which aren't stored
+func isExtension(path string) bool {
+	return strings.HasPrefix(path, "urn:")
+}
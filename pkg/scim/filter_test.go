@@ -0,0 +1,93 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   []Comparison
+	}{
+		{
+			filter: `userName eq "jane@example.com"`,
+			want:   []Comparison{{Attribute: "username", Operator: "eq", Value: "jane@example.com"}},
+		},
+		{
+			filter: `urn:ietf:params:scim:schemas:core:2.0:User:userName EQ "Jane"`,
+			want:   []Comparison{{Attribute: "username", Operator: "eq", Value: "Jane"}},
+		},
+		{
+			filter: `displayName co "Doe"`,
+			want:   []Comparison{{Attribute: "displayname", Operator: "co", Value: "Doe"}},
+		},
+		{
+			filter: `emails.value sw "jane"`,
+			want:   []Comparison{{Attribute: "emails.value", Operator: "sw", Value: "jane"}},
+		},
+		{
+			filter: `externalId pr`,
+			want:   []Comparison{{Attribute: "externalid", Operator: "pr"}},
+		},
+		{
+			filter: `userName eq "jane" and active eq true`,
+			want: []Comparison{
+				{Attribute: "username", Operator: "eq", Value: "jane"},
+				{Attribute: "active", Operator: "eq", Value: true},
+			},
+		},
+		{
+			filter: `  externalId pr AND meta.version gt 2  `,
+			want: []Comparison{
+				{Attribute: "externalid", Operator: "pr"},
+				{Attribute: "meta.version", Operator: "gt", Value: float64(2)},
+			},
+		},
+		{
+			filter: `displayName eq "say \"hi\" and leave"`,
+			want:   []Comparison{{Attribute: "displayname", Operator: "eq", Value: `say "hi" and leave`}},
+		},
+		{
+			filter: `manager eq null`,
+			want:   []Comparison{{Attribute: "manager", Operator: "eq", Value: nil}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			got, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilter = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterRejects(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName equals "jane"`,
+		`userName eq "jane`,
+		`userName eq jane`,
+		`userName eq "jane" or userName eq "john"`,
+		`userName eq "jane" and`,
+		`not (userName eq "jane")`,
+		`(userName eq "jane")`,
+		`"userName" eq "jane"`,
+	} {
+		t.Run(filter, func(t *testing.T) {
+			_, err := ParseFilter(filter)
+			var scimErr *Error
+			if !errors.As(err, &scimErr) || scimErr.ScimType != InvalidFilter || scimErr.HTTPStatus() != 400 {
+				t.Errorf("ParseFilter error = %v, want a 400 invalidFilter error", err)
+			}
+		})
+	}
+}
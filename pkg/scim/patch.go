@@ -0,0 +1,380 @@
+package scim
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// PatchRequest is the body of a PATCH request (RFC 7644 section 3.5.2)
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"` // add, replace or remove, in any case
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// patchTarget is a resource the operations of a PatchRequest are applied to. Paths
+// are normalized with attributePath.
+type patchTarget interface {
+	set(path string, value json.RawMessage, add bool) error
+	remove(path string, value json.RawMessage) error
+}
+
+// ApplyPatch applies the operations to the user in order. The user is left partially
+// modified when an operation fails.
+func (u *User) ApplyPatch(ops []PatchOperation) error {
+	return applyPatch((*userTarget)(u), ops)
+}
+
+// ApplyPatch applies the operations to the group in order. The group is left partially
+// modified when an operation fails.
+func (g *Group) ApplyPatch(ops []PatchOperation) error {
+	return applyPatch((*groupTarget)(g), ops)
+}
+
+func applyPatch(target patchTarget, ops []PatchOperation) error {
+	if len(ops) == 0 {
+		return Errorf(InvalidValue, "no patch operations")
+	}
+
+	for _, op := range ops {
+		path := attributePath(op.Path)
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			add := strings.EqualFold(op.Op, "add")
+			if path != "" {
+				if err := target.set(path, op.Value, add); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// Without a path the value holds the attributes to set
+			var attributes map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &attributes); err != nil {
+				return Errorf(InvalidValue, "the value of an operation without path must be an object")
+			}
+			// Sorted so "name" is applied before "name.givenName"
+			for _, name := range slices.Sorted(maps.Keys(attributes)) {
+				if err := target.set(attributePath(name), attributes[name], add); err != nil {
+					return err
+				}
+			}
+		case "remove":
+			if path == "" {
+				return Errorf(NoTarget, "remove operations need a path")
+			}
+			if err := target.remove(path, op.Value); err != nil {
+				return err
+			}
+		default:
+			return Errorf(InvalidSyntax, "unknown patch operation %q", op.Op)
+		}
+	}
+	return nil
+}
+
+type userTarget User
+
+func (u *userTarget) set(path string, value json.RawMessage, add bool) error {
+	var err error
+	switch path {
+	case "username":
+		u.UserName, err = stringValue(path, value)
+	case "externalid":
+		u.ExternalID, err = stringValue(path, value)
+	case "displayname":
+		u.DisplayName, err = stringValue(path, value)
+	case "locale":
+		u.Locale, err = stringValue(path, value)
+	case "timezone":
+		u.Timezone, err = stringValue(path, value)
+	case "password":
+		u.Password, err = stringValue(path, value)
+	case "active":
+		var active bool
+		if active, err = boolValue(path, value); err == nil {
+			u.Active = &active
+		}
+	case "name":
+		var name Name
+		if err := json.Unmarshal(value, &name); err != nil {
+			return Errorf(InvalidValue, "name must be an object")
+		}
+		u.Name = &name
+	case "name.formatted", "name.givenname", "name.familyname":
+		if u.Name == nil {
+			u.Name = &Name{}
+		}
+		var field string
+		if field, err = stringValue(path, value); err == nil {
+			*u.nameField(path) = field
+		}
+	case "emails":
+		var emails []Email
+		if err := json.Unmarshal(value, &emails); err != nil {
+			return Errorf(InvalidValue, "emails must be an array")
+		}
+		if add {
+			for _, email := range emails {
+				u.Emails = slices.DeleteFunc(u.Emails, func(e Email) bool { return strings.EqualFold(e.Value, email.Value) })
+			}
+			u.Emails = append(u.Emails, emails...)
+		} else {
+			u.Emails = emails
+		}
+	case "id", "meta", "schemas":
+		// Sent back by some clients along with the attributes, never changed
+	case "groups":
+		return Errorf(Mutability, "groups are read-only, change the group members instead")
+	default:
+		if isExtension(path) {
+			return nil
+		}
+		if attribute, filter, sub, ok := splitValuePath(path); ok && attribute == "emails" {
+			return u.setEmail(filter, sub, value)
+		}
+		return Errorf(InvalidPath, "unsupported attribute %q", path)
+	}
+	return err
+}
+
+func (u *userTarget) remove(path string, value json.RawMessage) error {
+	switch path {
+	case "externalid":
+		u.ExternalID = ""
+	case "displayname":
+		u.DisplayName = ""
+	case "locale":
+		u.Locale = ""
+	case "timezone":
+		u.Timezone = ""
+	case "name":
+		u.Name = nil
+	case "name.formatted", "name.givenname", "name.familyname":
+		if u.Name != nil {
+			*u.nameField(path) = ""
+		}
+	case "emails":
+		var emails []Email
+		if len(value) == 0 || json.Unmarshal(value, &emails) != nil || len(emails) == 0 {
+			u.Emails = nil
+			return nil
+		}
+		for _, email := range emails {
+			u.Emails = slices.DeleteFunc(u.Emails, func(e Email) bool { return strings.EqualFold(e.Value, email.Value) })
+		}
+	case "username", "active", "password", "groups":
+		return Errorf(Mutability, "%s can't be removed", path)
+	default:
+		if isExtension(path) {
+			return nil
+		}
+		if attribute, filter, _, ok := splitValuePath(path); ok && attribute == "emails" {
+			comparisons, err := ParseFilter(filter)
+			if err != nil {
+				return err
+			}
+			u.Emails = slices.DeleteFunc(u.Emails, func(e Email) bool { return emailMatches(e, comparisons) })
+			return nil
+		}
+		return Errorf(InvalidPath, "unsupported attribute %q", path)
+	}
+	return nil
+}
+
+func (u *userTarget) nameField(path string) *string {
+	switch path {
+	case "name.givenname":
+		return &u.Name.GivenName
+	case "name.familyname":
+		return &u.Name.FamilyName
+	}
+	return &u.Name.Formatted
+}
+
+// setEmail handles paths like `emails[type eq "work"].value`: the matching emails are
+// updated, or an email with the filtered attributes is added when none matches
+func (u *userTarget) setEmail(filter, sub string, value json.RawMessage) error {
+	if sub != "value" {
+		return Errorf(InvalidPath, "only the value of an email can be set")
+	}
+	comparisons, err := ParseFilter(filter)
+	if err != nil {
+		return err
+	}
+	address, err := stringValue("emails.value", value)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i := range u.Emails {
+		if emailMatches(u.Emails[i], comparisons) {
+			u.Emails[i].Value = address
+			found = true
+		}
+	}
+	if found {
+		return nil
+	}
+
+	email := Email{Value: address}
+	for _, comparison := range comparisons {
+		switch comparison.Attribute {
+		case "type":
+			email.Type, _ = comparison.Value.(string)
+		case "primary":
+			email.Primary, _ = comparison.Value.(bool)
+		}
+	}
+	u.Emails = append(u.Emails, email)
+	return nil
+}
+
+// emailMatches evaluates a value filter on an email, only eq comparisons are supported
+func emailMatches(email Email, comparisons []Comparison) bool {
+	for _, comparison := range comparisons {
+		if comparison.Operator != "eq" {
+			return false
+		}
+		switch comparison.Attribute {
+		case "type":
+			if value, _ := comparison.Value.(string); !strings.EqualFold(email.Type, value) {
+				return false
+			}
+		case "value":
+			if value, _ := comparison.Value.(string); !strings.EqualFold(email.Value, value) {
+				return false
+			}
+		case "primary":
+			if value, _ := comparison.Value.(bool); email.Primary != value {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type groupTarget Group
+
+func (g *groupTarget) set(path string, value json.RawMessage, add bool) error {
+	switch path {
+	case "displayname":
+		displayName, err := stringValue(path, value)
+		if err != nil {
+			return err
+		}
+		g.DisplayName = displayName
+	case "members":
+		var members []Member
+		if err := json.Unmarshal(value, &members); err != nil {
+			return Errorf(InvalidValue, "members must be an array")
+		}
+		if !add {
+			g.Members = nil
+		}
+		for _, member := range members {
+			if !slices.ContainsFunc(g.Members, func(m Member) bool { return m.Value == member.Value }) {
+				g.Members = append(g.Members, member)
+			}
+		}
+	case "id", "meta", "schemas", "externalid":
+		// Groups have no external ID, the rest is never changed
+	default:
+		if isExtension(path) {
+			return nil
+		}
+		return Errorf(InvalidPath, "unsupported attribute %q", path)
+	}
+	return nil
+}
+
+func (g *groupTarget) remove(path string, value json.RawMessage) error {
+	switch path {
+	case "members":
+		// With a value only the listed members are removed
+		var members []Member
+		if len(value) == 0 || json.Unmarshal(value, &members) != nil || len(members) == 0 {
+			g.Members = nil
+			return nil
+		}
+		for _, member := range members {
+			g.Members = slices.DeleteFunc(g.Members, func(m Member) bool { return m.Value == member.Value })
+		}
+	case "externalid":
+	case "displayname":
+		return Errorf(Mutability, "displayName can't be removed")
+	default:
+		if isExtension(path) {
+			return nil
+		}
+		attribute, filter, _, ok := splitValuePath(path)
+		if !ok || attribute != "members" {
+			return Errorf(InvalidPath, "unsupported attribute %q", path)
+		}
+		comparisons, err := ParseFilter(filter)
+		if err != nil {
+			return err
+		}
+		for _, comparison := range comparisons {
+			value, isString := comparison.Value.(string)
+			if comparison.Attribute != "value" || comparison.Operator != "eq" || !isString {
+				return Errorf(InvalidFilter, `members can only be selected with "value eq"`)
+			}
+			g.Members = slices.DeleteFunc(g.Members, func(m Member) bool { return m.Value == value })
+		}
+	}
+	return nil
+}
+
+// splitValuePath splits `emails[type eq "work"].value` into "emails", `type eq "work"`
+// and "value"
+func splitValuePath(path string) (attribute, filter, sub string, ok bool) {
+	open, end := strings.IndexByte(path, '['), strings.LastIndexByte(path, ']')
+	if open <= 0 || end < open {
+		return "", "", "", false
+	}
+	rest := path[end+1:]
+	if rest != "" && !strings.HasPrefix(rest, ".") {
+		return "", "", "", false
+	}
+	return path[:open], path[open+1 : end], strings.TrimPrefix(rest, "."), true
+}
+
+func stringValue(path string, value json.RawMessage) (string, error) {
+	var s *string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return "", Errorf(InvalidValue, "%s must be a string", path)
+	}
+	if s == nil {
+		return "", nil
+	}
+	return *s, nil
+}
+
+// boolValue also accepts "True" and "False" strings, which some identity providers send
+func boolValue(path string, value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, Errorf(InvalidValue, "%s must be a boolean", path)
+}
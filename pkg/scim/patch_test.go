@@ -0,0 +1,218 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func testUser() *User {
+	return &User{
+		UserName:   "jane@example.com",
+		ExternalID: "00u1",
+		Name:       &Name{Formatted: "Jane Doe", GivenName: "Jane", FamilyName: "Doe"},
+		Emails:     []Email{{Value: "jane@example.com", Type: "work", Primary: true}},
+		Locale:     "en-US",
+		Active:     ptr(true),
+	}
+}
+
+func op(name, path, value string) PatchOperation {
+	return PatchOperation{Op: name, Path: path, Value: json.RawMessage(value)}
+}
+
+func TestUserApplyPatch(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []PatchOperation
+		want func(u *User)
+	}{
+		{
+			name: "replace with path",
+			ops:  []PatchOperation{op("replace", "userName", `"jane.doe@example.com"`)},
+			want: func(u *User) { u.UserName = "jane.doe@example.com" },
+		},
+		{
+			name: "replace without path",
+			ops:  []PatchOperation{op("Replace", "", `{"displayName": "Jane", "locale": "de-DE"}`)},
+			want: func(u *User) { u.DisplayName, u.Locale = "Jane", "de-DE" },
+		},
+		{
+			name: "deactivate",
+			ops:  []PatchOperation{op("replace", "active", `false`)},
+			want: func(u *User) { u.Active = ptr(false) },
+		},
+		{
+			name: "deactivate as Entra ID sends it",
+			ops:  []PatchOperation{op("Replace", "", `{"active": "False"}`)},
+			want: func(u *User) { u.Active = ptr(false) },
+		},
+		{
+			name: "sub-attribute with schema prefix",
+			ops:  []PatchOperation{op("replace", "urn:ietf:params:scim:schemas:core:2.0:User:name.givenName", `"Janet"`)},
+			want: func(u *User) { u.Name.GivenName = "Janet" },
+		},
+		{
+			name: "whole object without path, nested name applied first",
+			ops:  []PatchOperation{op("replace", "", `{"name.familyName": "Smith", "name": {"givenName": "Jane"}}`)},
+			want: func(u *User) { u.Name = &Name{GivenName: "Jane", FamilyName: "Smith"} },
+		},
+		{
+			name: "add emails appends",
+			ops:  []PatchOperation{op("add", "emails", `[{"value": "jd@example.com", "type": "home"}]`)},
+			want: func(u *User) { u.Emails = append(u.Emails, Email{Value: "jd@example.com", Type: "home"}) },
+		},
+		{
+			name: "replace emails overwrites",
+			ops:  []PatchOperation{op("replace", "emails", `[{"value": "jd@example.com", "primary": true}]`)},
+			want: func(u *User) { u.Emails = []Email{{Value: "jd@example.com", Primary: true}} },
+		},
+		{
+			name: "value path updates the matching email",
+			ops:  []PatchOperation{op("replace", `emails[type eq "work"].value`, `"jane.doe@example.com"`)},
+			want: func(u *User) { u.Emails[0].Value = "jane.doe@example.com" },
+		},
+		{
+			name: "value path adds a missing email",
+			ops:  []PatchOperation{op("add", `emails[type eq "home"].value`, `"jd@example.com"`)},
+			want: func(u *User) { u.Emails = append(u.Emails, Email{Value: "jd@example.com", Type: "home"}) },
+		},
+		{
+			name: "remove with path",
+			ops:  []PatchOperation{op("remove", "externalId", ``), op("remove", "name.familyName", ``)},
+			want: func(u *User) { u.ExternalID, u.Name.FamilyName = "", "" },
+		},
+		{
+			name: "remove an email by value filter",
+			ops:  []PatchOperation{op("remove", `emails[value eq "JANE@example.com"]`, ``)},
+			want: func(u *User) { u.Emails = []Email{} },
+		},
+		{
+			name: "extension attributes are ignored",
+			ops:  []PatchOperation{op("add", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", `"Sales"`)},
+			want: func(u *User) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, want := testUser(), testUser()
+			tt.want(want)
+			if err := got.ApplyPatch(tt.ops); err != nil {
+				t.Fatalf("ApplyPatch: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("user = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestUserApplyPatchRejects(t *testing.T) {
+	tests := []struct {
+		name         string
+		ops          []PatchOperation
+		wantScimType string
+	}{
+		{name: "no operations", wantScimType: InvalidValue},
+		{name: "unknown op", ops: []PatchOperation{op("move", "userName", `"x"`)}, wantScimType: InvalidSyntax},
+		{name: "remove without path", ops: []PatchOperation{op("remove", "", ``)}, wantScimType: NoTarget},
+		{name: "remove userName", ops: []PatchOperation{op("remove", "userName", ``)}, wantScimType: Mutability},
+		{name: "remove active", ops: []PatchOperation{op("remove", "active", ``)}, wantScimType: Mutability},
+		{name: "set groups", ops: []PatchOperation{op("add", "groups", `[{"value": "1"}]`)}, wantScimType: Mutability},
+		{name: "unknown attribute", ops: []PatchOperation{op("replace", "nickName", `"JD"`)}, wantScimType: InvalidPath},
+		{name: "wrong type", ops: []PatchOperation{op("replace", "userName", `42`)}, wantScimType: InvalidValue},
+		{name: "not a boolean", ops: []PatchOperation{op("replace", "active", `"maybe"`)}, wantScimType: InvalidValue},
+		{name: "value without path not an object", ops: []PatchOperation{op("replace", "", `"jane"`)}, wantScimType: InvalidValue},
+		{name: "bad value filter", ops: []PatchOperation{op("replace", `emails[type eq].value`, `"x"`)}, wantScimType: InvalidFilter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testUser().ApplyPatch(tt.ops)
+			var scimErr *Error
+			if !errors.As(err, &scimErr) || scimErr.ScimType != tt.wantScimType {
+				t.Errorf("ApplyPatch error = %v, want %s", err, tt.wantScimType)
+			}
+		})
+	}
+}
+
+func TestGroupApplyPatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		ops          []PatchOperation
+		wantMembers  []string
+		wantScimType string
+	}{
+		{
+			name:        "add members",
+			ops:         []PatchOperation{op("add", "members", `[{"value": "2"}, {"value": "1"}]`)},
+			wantMembers: []string{"1", "2"},
+		},
+		{
+			name:        "replace members",
+			ops:         []PatchOperation{op("replace", "members", `[{"value": "3"}]`)},
+			wantMembers: []string{"3"},
+		},
+		{
+			name:        "remove listed members",
+			ops:         []PatchOperation{op("remove", "members", `[{"value": "1"}]`)},
+			wantMembers: []string{},
+		},
+		{
+			name:        "remove member by filter",
+			ops:         []PatchOperation{op("add", "members", `[{"value": "2"}]`), op("remove", `members[value eq "1"]`, ``)},
+			wantMembers: []string{"2"},
+		},
+		{
+			name:        "remove all members",
+			ops:         []PatchOperation{op("remove", "members", ``)},
+			wantMembers: []string{},
+		},
+		{
+			name:        "replace without path",
+			ops:         []PatchOperation{op("replace", "", `{"members": [{"value": "4"}], "externalId": "ignored"}`)},
+			wantMembers: []string{"4"},
+		},
+		{
+			name:         "member filter on another attribute",
+			ops:          []PatchOperation{op("remove", `members[display eq "jane"]`, ``)},
+			wantScimType: InvalidFilter,
+		},
+		{
+			name:         "remove displayName",
+			ops:          []PatchOperation{op("remove", "displayName", ``)},
+			wantScimType: Mutability,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := &Group{DisplayName: "editor", Members: []Member{{Value: "1"}}}
+			err := group.ApplyPatch(tt.ops)
+			if tt.wantScimType != "" {
+				var scimErr *Error
+				if !errors.As(err, &scimErr) || scimErr.ScimType != tt.wantScimType {
+					t.Fatalf("ApplyPatch error = %v, want %s", err, tt.wantScimType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyPatch: %v", err)
+			}
+			members := []string{}
+			for _, member := range group.Members {
+				members = append(members, member.Value)
+			}
+			if !reflect.DeepEqual(members, tt.wantMembers) {
+				t.Errorf("members = %v, want %v", members, tt.wantMembers)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Package useragent turns a User-Agent header into a short device description
+// such as "Firefox on Linux". It only recognises the common browsers and
+// operating systems; anything else is reported as unknown.
+package useragent
+
+import "strings"
+
+type match struct {
+	token string
+	name  string
+}
+
+// Order matters: many browsers include the tokens of the ones they derive from
+// (Edge and Opera send "Chrome", Chrome sends "Safari").
+var browsers = []match{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+}
+
+var systems = []match{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// Parse returns the browser and operating system named in a User-Agent header
+func Parse(userAgent string) (browser, os string) {
+	return find(userAgent, browsers, "Unknown browser"), find(userAgent, systems, "unknown OS")
+}
+
+// Describe returns "<browser> on <os>"
+func Describe(userAgent string) string {
+	browser, os := Parse(userAgent)
+	return browser + " on " + os
+}
+
+func find(userAgent string, matches []match, fallback string) string {
+	for _, m := range matches {
+		if strings.Contains(userAgent, m.token) {
+			return m.name
+		}
+	}
+	return fallback
+}
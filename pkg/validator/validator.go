@@ -2,10 +2,14 @@ package validator
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/go-playground/validator/v10"
+
+	_ "time/tzdata" // Embedded time zone database so "timezone" validation works on minimal images
 )
 
 var validate *validator.Validate
@@ -15,14 +19,210 @@ func init() {
 }
 
 type RegisterRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Email       string `json:"email" binding:"required,email"`
+	Password    string `json:"password" binding:"required,min=8"`
+	InviteToken string `json:"invite_token"` // Required when REGISTRATION_MODE is invite_only
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
 }
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
 }
 
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ConsumeMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type LoginCodeRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type VerifyLoginCodeRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Code  string `json:"code" binding:"required,numeric,min=6,max=8"`
+}
+
+// RefreshTokenRequest carries the refresh token in token mode, where there are no cookies
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// UpdateProfileRequest is a partial update: omitted fields are left unchanged,
+// an empty string clears the field
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name" binding:"omitzero,max=100"`
+	AvatarURL   *string `json:"avatar_url" binding:"omitzero,max=2048,url,startswith=https://"`
+	Locale      *string `json:"locale" binding:"omitzero,bcp47_language_tag"`
+	Timezone    *string `json:"timezone" binding:"omitzero,timezone"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ReportSignInRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// ListUsersQuery is bound from the query string of GET /api/admin/users
+type ListUsersQuery struct {
+	Page          int        `form:"page" binding:"omitempty,min=1"`
+	PageSize      int        `form:"page_size" binding:"omitempty,min=1,max=100"`
+	Query         string     `form:"q" binding:"max=255"`
+	Verified      *bool      `form:"verified"`
+	Status        string     `form:"status" binding:"omitempty,oneof=active disabled pending_approval"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02"`
+}
+
+type SearchUsersQuery struct {
+	Query string `form:"q" binding:"required,max=255"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=50"`
+}
+
+// ListAuditEventsQuery is bound from the query string of GET /api/admin/audit-events
+type ListAuditEventsQuery struct {
+	Page      int        `form:"page" binding:"omitempty,min=1"`
+	PageSize  int        `form:"page_size" binding:"omitempty,min=1,max=100"`
+	Type      string     `form:"type" binding:"max=100"`
+	ActorID   *int64     `form:"actor_id"`
+	SubjectID *int64     `form:"subject_id"`
+	Outcome   string     `form:"outcome" binding:"omitempty,oneof=success failure"`
+	Since     *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until     *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required,max=50"`
+}
+
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" binding:"required,url,startswith=http,max=2048"`
+	Events      []string `json:"events" binding:"required,min=1,dive,required,max=100"`
+	Secret      string   `json:"secret" binding:"omitempty,min=16,max=255"` // Generated when empty
+	Description string   `json:"description" binding:"max=255"`
+}
+
+type ListWebhookDeliveriesQuery struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	Type         string   `json:"type" binding:"required,oneof=confidential public"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,dive,required,url,max=2048"`
+	Scopes       []string `json:"scopes" binding:"required,min=1,dive,required,max=100"`
+}
+
+type CreateServiceAccountRequest struct {
+	Name        string   `json:"name" binding:"required,max=100"`
+	Description string   `json:"description" binding:"max=255"`
+	Scopes      []string `json:"scopes" binding:"required,min=1,dive,required,max=100"`
+}
+
+// CreateSAMLConnectionRequest imports an identity provider from its metadata XML or
+// the URL it publishes the metadata at; exactly one of them is required
+type CreateSAMLConnectionRequest struct {
+	Name           string   `json:"name" binding:"required,max=100"`
+	Slug           string   `json:"slug" binding:"required,min=2,max=50"`
+	MetadataXML    string   `json:"metadata_xml" binding:"required_without=MetadataURL,excluded_with=MetadataURL"`
+	MetadataURL    string   `json:"metadata_url" binding:"omitempty,url,max=2048"`
+	EmailAttribute string   `json:"email_attribute" binding:"max=255"`
+	Domains        []string `json:"domains" binding:"required,min=1,dive,required,fqdn"`
+	OrgID          *int64   `json:"org_id" binding:"omitempty,min=1"`
+}
+
+type UpdateSAMLMetadataRequest struct {
+	MetadataXML string `json:"metadata_xml" binding:"required_without=MetadataURL,excluded_with=MetadataURL"`
+	MetadataURL string `json:"metadata_url" binding:"omitempty,url,max=2048"`
+}
+
+// CreateSCIMTokenRequest issues a token for an organization's identity provider. Users
+// can only be provisioned in Domains, and Roles are exposed as groups.
+type CreateSCIMTokenRequest struct {
+	OrgID       int64    `json:"org_id" binding:"required,min=1"`
+	Description string   `json:"description" binding:"required,max=100"`
+	Domains     []string `json:"domains" binding:"required,min=1,dive,required,fqdn"`
+	Roles       []string `json:"roles" binding:"dive,required,max=50"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+	Slug string `json:"slug" binding:"required,min=2,max=50"`
+}
+
+type InviteOrgMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=admin member"`
+}
+
+type ChangeOrgMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin member"`
+}
+
+type TransferOwnershipRequest struct {
+	UserID int64 `json:"user_id" binding:"required,min=1"`
+}
+
+type AcceptOrgInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type SwitchOrganizationRequest struct {
+	OrgID        int64  `json:"org_id" binding:"min=0"` // 0 leaves the active organization
+	RefreshToken string `json:"refresh_token"`          // Token mode only, cookie mode uses the cookie
+}
+
+// ImpersonateRequest records why an admin signs in as a user, e.g. a support ticket
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// StopImpersonationRequest carries the admin's own refresh token in token mode, to get
+// their session back; cookie mode uses the refresh cookie the admin kept
+type StopImpersonationRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,dive,required,max=100"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"required,min=1,max=365"`
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ValidateSlug checks a URL-friendly identifier like "acme-corp"
+func ValidateSlug(slug string) bool {
+	return slugPattern.MatchString(slug)
+}
+
 func ValidatePassword(password string) bool {
 	if len(password) < 8 {
 		return false
@@ -50,3 +250,13 @@ func ValidateEmail(email string) error {
 	}
 	return nil
 }
+
+// ValidateLocale checks a BCP 47 language tag like "en-US"
+func ValidateLocale(locale string) bool {
+	return validate.Var(locale, "bcp47_language_tag") == nil
+}
+
+// ValidateTimezone checks an IANA time zone like "Europe/Berlin"
+func ValidateTimezone(timezone string) bool {
+	return validate.Var(timezone, "timezone") == nil
+}